@@ -50,21 +50,27 @@ func (this *Peek) Run(args []string) (exitCode int) {
 	rows := slave.Events()
 	replErrors := slave.Errors()
 	var n, lastN int64
-	var row *model.RowsEvent
+	var ts uint32
 	for {
 		select {
 		case err := <-replErrors:
 			this.Ui.Error(err.Error())
 			return
 
-		case row = <-rows:
+		case ev := <-rows:
 			n++
+			switch row := ev.(type) {
+			case *model.RowsEvent:
+				ts = row.Timestamp
+			case *model.DDLEvent:
+				ts = row.Timestamp
+			}
 			if verbose {
-				this.Ui.Outputf("%+v", row)
+				this.Ui.Outputf("%+v", ev)
 			}
 
 		case <-tick.C:
-			this.Ui.Infof("%d tps, %s", (n-lastN)/5, time.Unix(int64(row.Timestamp), 0))
+			this.Ui.Infof("%d tps, %s", (n-lastN)/5, time.Unix(int64(ts), 0))
 			lastN = n
 		}
 	}
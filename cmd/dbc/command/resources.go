@@ -3,6 +3,7 @@ package command
 import (
 	"flag"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/funkygao/columnize"
@@ -20,6 +21,8 @@ type Resources struct {
 	cluster     string
 	addResource string
 	delResource string
+	regroup     string
+	group       int
 }
 
 func (this *Resources) Run(args []string) (exitCode int) {
@@ -29,6 +32,8 @@ func (this *Resources) Run(args []string) (exitCode int) {
 	cmdFlags.StringVar(&this.cluster, "c", "", "")
 	cmdFlags.StringVar(&this.addResource, "add", "", "")
 	cmdFlags.StringVar(&this.delResource, "del", "", "")
+	cmdFlags.StringVar(&this.regroup, "regroup", "", "")
+	cmdFlags.IntVar(&this.group, "group", 0, "")
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
@@ -61,6 +66,11 @@ func (this *Resources) Run(args []string) (exitCode int) {
 		return
 	}
 
+	if len(this.regroup) > 0 {
+		this.doRegroupResource(mgr, this.regroup)
+		return
+	}
+
 	// list all resources
 	resources, err := mgr.RegisteredResources()
 	if err != nil {
@@ -68,12 +78,25 @@ func (this *Resources) Run(args []string) (exitCode int) {
 		return
 	}
 
-	lines := []string{"InputPlugin|Resources|Epoch|Owner"}
+	// members of a group are listed together
+	sort.SliceStable(resources, func(i, j int) bool {
+		if resources[i].Group != resources[j].Group {
+			return resources[i].Group < resources[j].Group
+		}
+		return resources[i].Name < resources[j].Name
+	})
+
+	lines := []string{"InputPlugin|Resources|Group|Epoch|Owner"}
 	for _, res := range resources {
+		group := "-"
+		if res.Group != 0 {
+			group = fmt.Sprintf("%d", res.Group)
+		}
+
 		if res.State.IsOrphan() {
-			lines = append(lines, fmt.Sprintf("%s|%s|-|-", res.InputPlugin, res.Name))
+			lines = append(lines, fmt.Sprintf("%s|%s|%s|-|-", res.InputPlugin, res.Name, group))
 		} else {
-			lines = append(lines, fmt.Sprintf("%s|%s|%d|%s", res.InputPlugin, res.Name, res.State.LeaderEpoch, res.State.Owner))
+			lines = append(lines, fmt.Sprintf("%s|%s|%s|%d|%s", res.InputPlugin, res.Name, group, res.State.LeaderEpoch, res.State.Owner))
 		}
 	}
 	if len(lines) > 1 {
@@ -98,6 +121,7 @@ func (this *Resources) doAddResource(mgr cluster.Manager, input, resource string
 	res := cluster.Resource{
 		Name:        resource,
 		InputPlugin: input,
+		Group:       this.group,
 	}
 	if err := mgr.RegisterResource(res); err != nil {
 		this.Ui.Error(err.Error())
@@ -106,6 +130,23 @@ func (this *Resources) doAddResource(mgr cluster.Manager, input, resource string
 	}
 }
 
+func (this *Resources) doRegroupResource(mgr cluster.Manager, resource string) {
+	res := cluster.Resource{
+		Name: resource,
+	}
+	if err := mgr.SetResourceGroup(res, this.group); err != nil {
+		this.Ui.Error(err.Error())
+		return
+	}
+
+	// resource data change is not watched by the leader
+	if err := mgr.Rebalance(); err != nil {
+		this.Ui.Error(err.Error())
+	} else {
+		this.Ui.Info("ok")
+	}
+}
+
 func (*Resources) Synopsis() string {
 	return "Define cluster resources"
 }
@@ -129,9 +170,17 @@ Options:
       e,g.
         dbc resources -add in.test-mysql:local://root@localhost:3306/test
         dbc resources -add in.kafka-kafka:local://me/foobar#0
+        dbc resources -add in.test-mysql:local://root@localhost:3307/test -group 1
 
     -del resource
 
+    -regroup resource
+      Change group of the resource to -group and rebalance the cluster, 0 to ungroup.
+
+    -group n
+      Resources of the same non-zero group are assigned to a single participant,
+      e,g. sharded MySQL instances of a business line.
+
 `, this.Cmd, this.Synopsis())
 	return strings.TrimSpace(help)
 }
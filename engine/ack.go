@@ -0,0 +1,286 @@
+package engine
+
+import (
+	"sync"
+	"sync/atomic"
+
+	log "github.com/funkygao/log4go"
+)
+
+// defaultMaxReplays is the max times a failed packet is replayed before it is
+// sent to the dead letter log.
+const defaultMaxReplays = 10
+
+// ackTracker tracks the in-flight packets of an Input, and acks them to the Input
+// in the order they are emitted.
+//
+// A packet might be fanned out to multiple Output plugins, cloned by Filter plugins,
+// and acked by Output plugins out of order, e,g. async kafka producer.
+// The watermark advances only when every packet before it is done: all packets
+// derived from it are recycled and every matched Output acked.
+//
+// If an Output nacks a packet, the watermark stalls at it and the packet is replayed
+// to that Output only, so that checkpoint never skips it. The stall ends once the
+// replayed packet is done, or the packet is sent to the dead letter log after
+// maxReplays.
+//
+// A packet recycled without ack or nack, e,g. kafka dryrun, is skipped: the watermark
+// passes it without acking it to Input.
+type ackTracker struct {
+	mu    sync.Mutex
+	ackMu sync.Mutex // serializes Input ack outside mu in seq order
+
+	name       string // of the Input
+	maxReplays int32
+
+	seq         int64       // seq of the next emitted packet
+	watermark   int64       // packets before watermark are all acked to Input
+	inflight    []*ackEntry // in seq order
+	replayed    int64
+	skipped     int64
+	deadLetters int64
+
+	// replay re-sends the failed packets of an entry, nil to leave it stalled till restart
+	replay func(entry *ackEntry, failures []ackFailure)
+}
+
+// ackEntry is the tracking state of an emitted packet shared by all packets derived
+// from it.
+type ackEntry struct {
+	t   *ackTracker
+	seq int64
+
+	// what the Input emitted, the packet itself might be recycled before Input ack
+	acker    Acker
+	ident    string
+	metadata interface{}
+	payload  Payloader
+
+	refs     int32 // references of packets derived from it
+	expected int32 // number of matched Output
+	acked    int32
+	nacked   int32
+	state    int32
+	retries  int32
+
+	failures []ackFailure // guarded by ackTracker.mu
+}
+
+// ackFailure is a packet nacked by an Output, which is replayed to the Output.
+type ackFailure struct {
+	runner *foRunner
+
+	// what the Output received, which might be modified by Filter
+	ident    string
+	metadata interface{}
+	payload  Payloader
+}
+
+const (
+	ackPending int32 = iota
+	ackDone
+	ackFailed
+	ackSkipped
+)
+
+func newAckTracker(name string) *ackTracker {
+	return &ackTracker{name: name, maxReplays: defaultMaxReplays}
+}
+
+// track starts tracking the packet that is being emitted by Input.
+func (t *ackTracker) track(pack *Packet) *ackEntry {
+	entry := &ackEntry{
+		t:        t,
+		acker:    pack.acker,
+		ident:    pack.Ident,
+		metadata: pack.Metadata,
+		payload:  pack.Payload,
+		refs:     1,
+	}
+
+	t.mu.Lock()
+	entry.seq = t.seq
+	t.seq++
+	t.inflight = append(t.inflight, entry)
+	t.mu.Unlock()
+
+	return entry
+}
+
+// AckStat is the statistics of an ackTracker.
+type AckStat struct {
+	Watermark   int64 `json:"watermark"` // seq of the 1st packet not acked to Input
+	Emitted     int64 `json:"emitted"`
+	Inflight    int   `json:"inflight"`
+	Stalled     bool  `json:"stalled"` // some packet failed and is not done yet
+	Replayed    int64 `json:"replayed"`
+	Skipped     int64 `json:"skipped"` // recycled without ack or nack
+	DeadLetters int64 `json:"dead_letters"`
+}
+
+func (t *ackTracker) stat() AckStat {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stat := AckStat{
+		Watermark:   t.watermark,
+		Emitted:     t.seq,
+		Inflight:    len(t.inflight),
+		Replayed:    t.replayed,
+		Skipped:     t.skipped,
+		DeadLetters: t.deadLetters,
+	}
+	for _, entry := range t.inflight {
+		if atomic.LoadInt32(&entry.retries) > 0 || atomic.LoadInt32(&entry.state) == ackFailed {
+			stat.Stalled = true
+			break
+		}
+	}
+	return stat
+}
+
+// advance acks the leading done packets to Input in order.
+// Input ack might be slow, e,g. zk commit, so it is called outside of mu to not block Emit.
+func (t *ackTracker) advance() {
+	t.mu.Lock()
+	i := 0
+	for ; i < len(t.inflight); i++ {
+		if state := atomic.LoadInt32(&t.inflight[i].state); state != ackDone && state != ackSkipped {
+			// pending, or failed and waiting for replay
+			break
+		}
+	}
+
+	done := t.inflight[:i]
+	t.inflight = t.inflight[i:]
+	if i > 0 {
+		t.watermark = done[i-1].seq + 1
+	}
+
+	// acquired before releasing mu, so that acks of concurrent advance keep the order
+	t.ackMu.Lock()
+	t.mu.Unlock()
+
+	for _, entry := range done {
+		if atomic.LoadInt32(&entry.state) == ackSkipped {
+			continue
+		}
+
+		// the packet is recycled, so a dedicated one is created for Input
+		entry.acker.Ack(&Packet{
+			Ident:    entry.ident,
+			Metadata: entry.metadata,
+			Payload:  entry.payload,
+			acker:    entry.acker,
+		})
+	}
+	t.ackMu.Unlock()
+}
+
+// fail replays the packets nacked by Output, which blocks the watermark till they are done.
+func (t *ackTracker) fail(entry *ackEntry) {
+	if t.replay == nil {
+		// the Input replays from the watermark after restart
+		return
+	}
+
+	t.mu.Lock()
+	failures := entry.failures
+	entry.failures = nil
+	t.mu.Unlock()
+
+	retries := atomic.AddInt32(&entry.retries, 1)
+	if retries > t.maxReplays {
+		for _, f := range failures {
+			log.Error("[%s] packet#%d gave up after %d replays, dead letter for %s: {%s} %v",
+				t.name, entry.seq, t.maxReplays, f.runner.Name(), f.ident, f.payload)
+		}
+
+		t.mu.Lock()
+		t.deadLetters++
+		t.mu.Unlock()
+
+		atomic.StoreInt32(&entry.state, ackSkipped)
+		t.advance()
+		return
+	}
+
+	t.mu.Lock()
+	t.replayed++
+	t.mu.Unlock()
+
+	// only the replayed packets refer to it
+	n := int32(len(failures))
+	atomic.StoreInt32(&entry.refs, n)
+	atomic.StoreInt32(&entry.expected, n)
+	atomic.StoreInt32(&entry.acked, 0)
+	atomic.StoreInt32(&entry.nacked, 0)
+	atomic.StoreInt32(&entry.state, ackPending)
+	t.replay(entry, failures)
+}
+
+func (e *ackEntry) incRef() {
+	atomic.AddInt32(&e.refs, 1)
+}
+
+// expectAck is called when the packet is dispatched to an Output.
+func (e *ackEntry) expectAck() {
+	atomic.AddInt32(&e.expected, 1)
+}
+
+// ack is called when an Output acks the packet.
+func (e *ackEntry) ack() error {
+	if atomic.AddInt32(&e.acked, 1) >= atomic.LoadInt32(&e.expected) &&
+		atomic.LoadInt32(&e.refs) == 0 && atomic.LoadInt32(&e.nacked) == 0 {
+		e.finish(ackDone)
+	}
+	return nil
+}
+
+// nack is called when an Output fails to process the packet.
+func (e *ackEntry) nack(runner *foRunner, pack *Packet) {
+	e.t.mu.Lock()
+	e.failures = append(e.failures, ackFailure{
+		runner:   runner,
+		ident:    pack.Ident,
+		metadata: pack.Metadata,
+		payload:  pack.Payload,
+	})
+	e.t.mu.Unlock()
+
+	atomic.AddInt32(&e.nacked, 1)
+}
+
+// release is called when a packet derived from the entry is recycled.
+func (e *ackEntry) release() {
+	if atomic.AddInt32(&e.refs, -1) != 0 {
+		return
+	}
+
+	switch {
+	case atomic.LoadInt32(&e.nacked) > 0:
+		e.finish(ackFailed)
+
+	case atomic.LoadInt32(&e.acked) >= atomic.LoadInt32(&e.expected):
+		e.finish(ackDone)
+
+	default:
+		// recycled without ack on purpose, e,g. dryrun
+		e.t.mu.Lock()
+		e.t.skipped++
+		e.t.mu.Unlock()
+		e.finish(ackSkipped)
+	}
+}
+
+func (e *ackEntry) finish(state int32) {
+	if !atomic.CompareAndSwapInt32(&e.state, ackPending, state) {
+		return
+	}
+
+	if state == ackFailed {
+		e.t.fail(e)
+	} else {
+		e.t.advance()
+	}
+}
@@ -0,0 +1,345 @@
+package engine
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+type mockAcker struct {
+	mu    sync.Mutex
+	acked []interface{}
+}
+
+func (m *mockAcker) Ack(p *Packet) error {
+	m.mu.Lock()
+	m.acked = append(m.acked, p.Payload)
+	m.mu.Unlock()
+	return nil
+}
+
+type intPayload int
+
+func (intPayload) Length() int             { return 0 }
+func (intPayload) Encode() ([]byte, error) { return nil, nil }
+
+var testOutput = &foRunner{pRunnerBase: pRunnerBase{pluginCommons: &pluginCommons{name: "out"}}}
+
+func emitPacket(t *ackTracker, pool chan *Packet, acker Acker, i int) *Packet {
+	pack := <-pool
+	pack.Payload = intPayload(i)
+	pack.acker = acker
+	pack.entry = t.track(pack)
+	return pack
+}
+
+func TestAckTrackerInOrder(t *testing.T) {
+	pool := make(chan *Packet, 10)
+	for i := 0; i < 10; i++ {
+		pool <- newPacket(pool)
+	}
+
+	acker := &mockAcker{}
+	tracker := newAckTracker("in")
+	p0 := emitPacket(tracker, pool, acker, 0)
+	p1 := emitPacket(tracker, pool, acker, 1)
+
+	// router dispatches each packet to 2 outputs
+	for _, p := range []*Packet{p0, p1} {
+		p.incRef().expectAck()
+		p.incRef().expectAck()
+		p.Recycle()
+	}
+
+	// p1 fully acked before p0
+	p1.ack()
+	p1.Recycle()
+	p1.ack()
+	p1.Recycle()
+	assert.Equal(t, 0, len(acker.acked))
+	assert.Equal(t, 2, tracker.stat().Inflight)
+
+	p0.ack()
+	p0.Recycle()
+	assert.Equal(t, 0, len(acker.acked))
+	p0.ack()
+	p0.Recycle()
+	assert.Equal(t, []interface{}{intPayload(0), intPayload(1)}, acker.acked)
+
+	stat := tracker.stat()
+	assert.Equal(t, int64(2), stat.Watermark)
+	assert.Equal(t, 0, stat.Inflight)
+	assert.Equal(t, 10, len(pool))
+}
+
+func TestAckTrackerClone(t *testing.T) {
+	pool := make(chan *Packet, 10)
+	for i := 0; i < 10; i++ {
+		pool <- newPacket(pool)
+	}
+
+	acker := &mockAcker{}
+	tracker := newAckTracker("in")
+	p0 := emitPacket(tracker, pool, acker, 0)
+
+	// router dispatches to a filter which clones it
+	p0.incRef()
+	p0.Recycle()
+	clone := <-pool
+	clone.Reset()
+	p0.copyTo(clone)
+	p0.Recycle()
+	assert.Equal(t, 0, len(acker.acked))
+
+	// router dispatches the clone to an output
+	clone.incRef().expectAck()
+	clone.Recycle()
+	clone.ack()
+	clone.Recycle()
+	assert.Equal(t, 1, len(acker.acked))
+}
+
+func TestAckTrackerNoMatch(t *testing.T) {
+	pool := make(chan *Packet, 1)
+	pool <- newPacket(pool)
+
+	acker := &mockAcker{}
+	tracker := newAckTracker("in")
+	emitPacket(tracker, pool, acker, 0).Recycle()
+	assert.Equal(t, 1, len(acker.acked))
+}
+
+func TestAckTrackerStall(t *testing.T) {
+	pool := make(chan *Packet, 10)
+	for i := 0; i < 10; i++ {
+		pool <- newPacket(pool)
+	}
+
+	acker := &mockAcker{}
+	tracker := newAckTracker("in")
+	p0 := emitPacket(tracker, pool, acker, 0)
+	p1 := emitPacket(tracker, pool, acker, 1)
+	p0.incRef().expectAck()
+	p0.Recycle()
+	p1.incRef().expectAck()
+	p1.Recycle()
+
+	// output fails p0 and there is no replay
+	p0.nack(testOutput)
+	p0.Recycle()
+	p1.ack()
+	p1.Recycle()
+
+	stat := tracker.stat()
+	assert.Equal(t, 0, len(acker.acked))
+	assert.Equal(t, int64(0), stat.Watermark)
+	assert.Equal(t, true, stat.Stalled)
+	assert.Equal(t, 2, stat.Inflight)
+}
+
+func TestAckTrackerReplay(t *testing.T) {
+	pool := make(chan *Packet, 10)
+	for i := 0; i < 10; i++ {
+		pool <- newPacket(pool)
+	}
+
+	acker := &mockAcker{}
+	tracker := newAckTracker("in")
+	var (
+		replays  []*ackEntry
+		failures []ackFailure
+	)
+	tracker.replay = func(entry *ackEntry, f []ackFailure) {
+		replays = append(replays, entry)
+		failures = f
+	}
+
+	p0 := emitPacket(tracker, pool, acker, 0)
+	p1 := emitPacket(tracker, pool, acker, 1)
+	p0.incRef().expectAck()
+	p0.Recycle()
+	p1.incRef().expectAck()
+	p1.Recycle()
+
+	// output fails p0, p1 waits for the replay of p0
+	p0.nack(testOutput)
+	p0.Recycle()
+	p1.ack()
+	p1.Recycle()
+	assert.Equal(t, 1, len(replays))
+	assert.Equal(t, int64(0), replays[0].seq)
+	assert.Equal(t, 1, len(failures))
+	assert.Equal(t, testOutput, failures[0].runner)
+	stat := tracker.stat()
+	assert.Equal(t, 0, len(acker.acked))
+	assert.Equal(t, true, stat.Stalled)
+	assert.Equal(t, int64(1), stat.Replayed)
+
+	// packets emitted after the failure are tracked as usual
+	p2 := emitPacket(tracker, pool, acker, 2)
+	p2.incRef().expectAck()
+	p2.Recycle()
+	p2.ack()
+	p2.Recycle()
+	assert.Equal(t, 0, len(acker.acked))
+
+	// the replayed packet is sent to the failed output only and succeeds
+	replayed := newPacket(nil)
+	replayed.Payload = failures[0].payload
+	replayed.entry = replays[0]
+	replayed.ack()
+	replayed.Recycle()
+
+	assert.Equal(t, []interface{}{intPayload(0), intPayload(1), intPayload(2)}, acker.acked)
+	stat = tracker.stat()
+	assert.Equal(t, int64(3), stat.Watermark)
+	assert.Equal(t, false, stat.Stalled)
+	assert.Equal(t, 0, stat.Inflight)
+	assert.Equal(t, 10, len(pool))
+}
+
+func TestAckTrackerReplayFailedOutputOnly(t *testing.T) {
+	pool := make(chan *Packet, 10)
+	for i := 0; i < 10; i++ {
+		pool <- newPacket(pool)
+	}
+
+	acker := &mockAcker{}
+	tracker := newAckTracker("in")
+	var failures []ackFailure
+	tracker.replay = func(entry *ackEntry, f []ackFailure) {
+		failures = f
+	}
+
+	// dispatched to 2 outputs, the 2nd fails
+	p0 := emitPacket(tracker, pool, acker, 0)
+	p0.incRef().expectAck()
+	p0.incRef().expectAck()
+	p0.Recycle()
+	p0.ack()
+	p0.Recycle()
+	p0.nack(testOutput)
+	p0.Recycle()
+	assert.Equal(t, 1, len(failures))
+	assert.Equal(t, int32(1), p0Entry(tracker).expected)
+
+	replayed := newPacket(nil)
+	replayed.entry = p0Entry(tracker)
+	replayed.Payload = failures[0].payload
+	replayed.ack()
+	replayed.Recycle()
+	assert.Equal(t, []interface{}{intPayload(0)}, acker.acked)
+}
+
+func p0Entry(t *ackTracker) *ackEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.inflight[0]
+}
+
+func TestAckTrackerDeadLetter(t *testing.T) {
+	pool := make(chan *Packet, 10)
+	for i := 0; i < 10; i++ {
+		pool <- newPacket(pool)
+	}
+
+	acker := &mockAcker{}
+	tracker := newAckTracker("in")
+	tracker.maxReplays = 2
+	var replays int
+	tracker.replay = func(entry *ackEntry, f []ackFailure) {
+		replays++
+
+		// the output keeps failing
+		pack := newPacket(nil)
+		pack.entry = entry
+		pack.Payload = f[0].payload
+		pack.nack(f[0].runner)
+		pack.Recycle()
+	}
+
+	p0 := emitPacket(tracker, pool, acker, 0)
+	p1 := emitPacket(tracker, pool, acker, 1)
+	p0.incRef().expectAck()
+	p0.Recycle()
+	p1.incRef().expectAck()
+	p1.Recycle()
+	p1.ack()
+	p1.Recycle()
+	p0.nack(testOutput)
+	p0.Recycle()
+
+	// p0 is given up, checkpoint goes on without it
+	stat := tracker.stat()
+	assert.Equal(t, 2, replays)
+	assert.Equal(t, int64(1), stat.DeadLetters)
+	assert.Equal(t, int64(2), stat.Watermark)
+	assert.Equal(t, 0, stat.Inflight)
+	assert.Equal(t, []interface{}{intPayload(1)}, acker.acked)
+}
+
+func TestAckTrackerSkip(t *testing.T) {
+	pool := make(chan *Packet, 10)
+	for i := 0; i < 10; i++ {
+		pool <- newPacket(pool)
+	}
+
+	acker := &mockAcker{}
+	tracker := newAckTracker("in")
+	tracker.replay = func(entry *ackEntry, f []ackFailure) {
+		t.Fatal("replayed")
+	}
+
+	// output recycles p0 without ack, e,g. dryrun
+	p0 := emitPacket(tracker, pool, acker, 0)
+	p1 := emitPacket(tracker, pool, acker, 1)
+	p0.incRef().expectAck()
+	p0.Recycle()
+	p1.incRef().expectAck()
+	p1.Recycle()
+	p0.Recycle()
+	p1.ack()
+	p1.Recycle()
+
+	stat := tracker.stat()
+	assert.Equal(t, []interface{}{intPayload(1)}, acker.acked)
+	assert.Equal(t, int64(2), stat.Watermark)
+	assert.Equal(t, int64(1), stat.Skipped)
+	assert.Equal(t, false, stat.Stalled)
+	assert.Equal(t, 10, len(pool))
+}
+
+func TestAckTrackerConcurrent(t *testing.T) {
+	const n = 1000
+	pool := make(chan *Packet, n)
+	for i := 0; i < n; i++ {
+		pool <- newPacket(pool)
+	}
+
+	acker := &mockAcker{}
+	tracker := newAckTracker("in")
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		p := emitPacket(tracker, pool, acker, i)
+		p.incRef().expectAck()
+		p.incRef().expectAck()
+		p.Recycle()
+
+		for j := 0; j < 2; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p.ack()
+				p.Recycle()
+			}()
+		}
+	}
+	wg.Wait()
+
+	assert.Equal(t, n, len(acker.acked))
+	for i, v := range acker.acked {
+		assert.Equal(t, intPayload(i), v)
+	}
+	assert.Equal(t, int64(n), tracker.stat().Watermark)
+}
@@ -36,12 +36,12 @@ func (e *Engine) handleAPIDag(w http.ResponseWriter, r *http.Request, params map
 
 	// edge
 	for _, m := range e.router.filterMatchers {
-		for source := range m.matches {
+		for _, source := range m.sources() {
 			d.AddEdge(source, m.runner.Name())
 		}
 	}
 	for _, m := range e.router.outputMatchers {
-		for source := range m.matches {
+		for _, source := range m.sources() {
 			log.Info("%s,%s %+v", source, m.runner.Name(), d)
 			d.AddEdge(source, m.runner.Name())
 		}
@@ -74,6 +74,12 @@ func (e *Engine) handleAPIMetrics(w http.ResponseWriter, r *http.Request, params
 			"cum": m.Count(),
 		}
 	}
+	for name, m := range pluginMeters() {
+		output[name] = map[string]interface{}{
+			"tps": int(m.Rate1()),
+			"cum": m.Count(),
+		}
+	}
 
 	return output, nil
 }
@@ -3,6 +3,7 @@ package engine
 import (
 	"net/http"
 
+	"github.com/funkygao/dbus/pkg/cluster"
 	log "github.com/funkygao/log4go"
 	"github.com/gorilla/mux"
 )
@@ -46,17 +47,91 @@ func (e *Engine) handleAPIDecisionV1(w http.ResponseWriter, r *http.Request, par
 	return m.CurrentDecision(), nil
 }
 
+func (e *Engine) handleAPIResourcesV1(w http.ResponseWriter, r *http.Request, params map[string]interface{}) (interface{}, error) {
+	m := e.ClusterManager()
+	if m == nil {
+		return nil, ErrInvalidParam
+	}
+
+	return m.RegisteredResources()
+}
+
+// handleAPIRegisterResourceV1 registers the resource in body: {"input": "in.test", "name": "local://root@localhost:3306/test", "group": 1}
+func (e *Engine) handleAPIRegisterResourceV1(w http.ResponseWriter, r *http.Request, params map[string]interface{}) (interface{}, error) {
+	m := e.ClusterManager()
+	res, ok := resourceParam(params)
+	if m == nil || !ok || res.InputPlugin == "" {
+		return nil, ErrInvalidParam
+	}
+
+	return nil, m.RegisterResource(res)
+}
+
+// handleAPIUnregisterResourceV1 removes the resource in body: {"name": "local://root@localhost:3306/test"}
+func (e *Engine) handleAPIUnregisterResourceV1(w http.ResponseWriter, r *http.Request, params map[string]interface{}) (interface{}, error) {
+	m := e.ClusterManager()
+	res, ok := resourceParam(params)
+	if m == nil || !ok {
+		return nil, ErrInvalidParam
+	}
+
+	return nil, m.UnregisterResource(res)
+}
+
+// handleAPIGroupResourceV1 changes group of the resource and rebalances the cluster: {"name": "...", "group": 0}
+func (e *Engine) handleAPIGroupResourceV1(w http.ResponseWriter, r *http.Request, params map[string]interface{}) (interface{}, error) {
+	m := e.ClusterManager()
+	res, ok := resourceParam(params)
+	if m == nil || !ok {
+		return nil, ErrInvalidParam
+	}
+
+	if err := m.SetResourceGroup(res, res.Group); err != nil {
+		return nil, err
+	}
+
+	// resource change is not watched by the leader
+	return nil, m.Rebalance()
+}
+
+// resourceParam parses the resource in request body.
+func resourceParam(params map[string]interface{}) (res cluster.Resource, ok bool) {
+	if res.Name, ok = params["name"].(string); !ok || res.Name == "" {
+		return res, false
+	}
+
+	res.InputPlugin, _ = params["input"].(string)
+	if group, present := params["group"]; present {
+		g, isNumber := group.(float64)
+		if !isNumber || g < 0 || g != float64(int(g)) {
+			return res, false
+		}
+		res.Group = int(g)
+	}
+	return res, true
+}
+
 func (e *Engine) handleQueuesV1(w http.ResponseWriter, r *http.Request, params map[string]interface{}) (interface{}, error) {
-	rs := make(map[string]int)
+	rs := make(map[string]interface{})
 
 	globals := Globals()
-	rs["hub.free"] = globals.HubChanSize - rs["hub"]
+	rs["hub.free"] = globals.HubChanSize - len(e.router.hub)
 	rs["filter.free"] = len(e.filterRecycleChan)
 
 	for name, ch := range e.inputRecycleChans {
 		rs["input."+name+".free"] = len(ch)
 	}
 
+	for name, ir := range e.InputRunners {
+		stat := ir.AckStat()
+		rs["input."+name+".watermark"] = stat.Watermark
+		rs["input."+name+".inflight"] = stat.Inflight
+		rs["input."+name+".stalled"] = stat.Stalled
+		rs["input."+name+".replayed"] = stat.Replayed
+		rs["input."+name+".skipped"] = stat.Skipped
+		rs["input."+name+".dead_letters"] = stat.DeadLetters
+	}
+
 	for _, om := range e.router.outputMatchers {
 		rs["output."+om.runner.Name()+".free"] = globals.PluginChanSize - len(om.InChan())
 	}
@@ -0,0 +1,31 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestResourceParam(t *testing.T) {
+	res, ok := resourceParam(map[string]interface{}{"input": "in.test", "name": "local://root@localhost:3306/test", "group": float64(2)})
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "in.test", res.InputPlugin)
+	assert.Equal(t, "local://root@localhost:3306/test", res.Name)
+	assert.Equal(t, 2, res.Group)
+
+	res, ok = resourceParam(map[string]interface{}{"name": "r1"})
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 0, res.Group)
+
+	for _, params := range []map[string]interface{}{
+		{},
+		{"name": ""},
+		{"name": 1},
+		{"name": "r1", "group": "1"},
+		{"name": "r1", "group": float64(-1)},
+		{"name": "r1", "group": 1.5},
+	} {
+		_, ok = resourceParam(params)
+		assert.Equal(t, false, ok)
+	}
+}
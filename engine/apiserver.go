@@ -56,6 +56,10 @@ func (e *Engine) setupAPIRoutings() {
 	e.RegisterAPI("/api/v1/resume/{input}", e.handleAPIResumeV1).Methods("PUT")
 	e.RegisterAPI("/api/v1/decision", e.handleAPIDecisionV1).Methods("GET")
 	e.RegisterAPI("/api/v1/queues", e.handleQueuesV1).Methods("GET")
+	e.RegisterAPI("/api/v1/resources", e.handleAPIResourcesV1).Methods("GET")
+	e.RegisterAPI("/api/v1/resources", e.handleAPIRegisterResourceV1).Methods("POST")
+	e.RegisterAPI("/api/v1/resources", e.handleAPIUnregisterResourceV1).Methods("DELETE")
+	e.RegisterAPI("/api/v1/resources/group", e.handleAPIGroupResourceV1).Methods("PUT")
 }
 
 func (e *Engine) RegisterAPI(path string, handlerFunc APIHandler) *mux.Route {
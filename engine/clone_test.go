@@ -0,0 +1,131 @@
+// +build !v2
+
+package engine
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+// cells is a mutable payload.
+type cells struct {
+	id     int
+	values []int
+}
+
+func (c *cells) Length() int {
+	return len(c.values)
+}
+
+func (c *cells) Encode() ([]byte, error) {
+	return nil, nil
+}
+
+func (c *cells) ClonePayload() Payloader {
+	return &cells{id: c.id, values: append([]int(nil), c.values...)}
+}
+
+func newPacketPool(size int) chan *Packet {
+	pool := make(chan *Packet, size)
+	for i := 0; i < size; i++ {
+		pool <- newPacket(pool)
+	}
+	return pool
+}
+
+func TestPacketCopyToCloner(t *testing.T) {
+	p := newPacket(nil)
+	p.Ident = "in"
+	p.Payload = &cells{id: 1, values: []int{1, 2}}
+
+	other := newPacket(nil)
+	p.copyTo(other)
+	assert.Equal(t, "in", other.Ident)
+	other.Payload.(*cells).values[0] = 5
+	assert.Equal(t, 1, p.Payload.(*cells).values[0])
+
+	// payload that is not Cloner is shared
+	p.Payload = Bytes("hello")
+	p.copyTo(other)
+	assert.Equal(t, Bytes("hello"), other.Payload)
+
+	// shallow copy shares the Cloner payload
+	c := &cells{id: 2}
+	p.Payload = c
+	p.shareTo(other)
+	assert.Equal(t, "in", other.Ident)
+	assert.Equal(t, true, other.Payload.(*cells) == c)
+}
+
+// The Input packet is dispatched to Output1 and a Filter, which mutates the cloned packet
+// and emits it to Output2: Output1 must see the original payload.
+func TestClonePacketFanOutRace(t *testing.T) {
+	const n = 500
+
+	r := newRouter()
+	out1 := &foRunner{inChan: make(chan *Packet, n)}
+	out2 := &foRunner{inChan: make(chan *Packet, n)}
+	filter := &foRunner{inChan: make(chan *Packet, n)}
+	r.addOutputMatcher(newMatcher([]string{"in"}, out1))
+	r.addOutputMatcher(newMatcher([]string{"out"}, out2))
+	r.addFilterMatcher(newMatcher([]string{"in"}, filter))
+
+	inputPool, filterPool := newPacketPool(n), newPacketPool(n)
+	emitted := make(chan *Packet, n)
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for pack := range filter.inChan {
+			p := <-filterPool
+			p.Reset()
+			pack.copyTo(p)
+			p.Ident = "out"
+			c := p.Payload.(*cells)
+			for i := range c.values {
+				c.values[i] = -c.values[i]
+			}
+			emitted <- p
+
+			pack.Recycle()
+		}
+	}()
+
+	output := func(ch chan *Packet, sign int) {
+		defer wg.Done()
+		for pack := range ch {
+			c := pack.Payload.(*cells)
+			for _, v := range c.values {
+				if v != sign*c.id {
+					t.Errorf("%s: expected %d, got %d", pack.Ident, sign*c.id, v)
+				}
+			}
+			pack.Recycle()
+		}
+	}
+	go output(out1.inChan, 1)
+	go output(out2.inChan, -1)
+
+	for i := 1; i <= n; i++ {
+		p := <-inputPool
+		p.Ident = "in"
+		p.Payload = &cells{id: i, values: []int{i, i, i}}
+		r.dispatch(p)
+		p.Recycle()
+	}
+	close(filter.inChan)
+	for i := 0; i < n; i++ {
+		p := <-emitted
+		r.dispatch(p)
+		p.Recycle()
+	}
+	close(out1.inChan)
+	close(out2.inChan)
+	wg.Wait()
+
+	assert.Equal(t, n, len(inputPool))
+	assert.Equal(t, n, len(filterPool))
+}
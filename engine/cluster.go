@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/funkygao/dbus/pkg/cluster"
+	craft "github.com/funkygao/dbus/pkg/cluster/raft"
+	czk "github.com/funkygao/dbus/pkg/cluster/zk"
+)
+
+// newController creates the cluster controller of the configured backend: zk or raft.
+func (e *Engine) newController(strategy cluster.Strategy) cluster.Controller {
+	switch backend := e.String("cluster_backend", "zk"); backend {
+	case "zk":
+		return czk.NewController(e.zkSvr, Globals().Cluster, e.participant, strategy, e.loadPolicy, e.leaderRebalance)
+
+	case "raft":
+		return e.newRaftController(strategy)
+
+	default:
+		panic("invalid cluster_backend: " + backend)
+	}
+}
+
+// newRaftController creates a controller of the embedded raft group, whose members are
+// the participants listed in raft_peers. Each member listens on raft_port of its host.
+// Without raft_peers, the participant forms a single node cluster.
+func (e *Engine) newRaftController(strategy cluster.Strategy) cluster.Controller {
+	port := strconv.Itoa(e.Int("raft_port", 9878))
+	endpoints := e.StringList("raft_peers", []string{e.participant.Endpoint})
+	peers := make(map[string]string, len(endpoints))
+	for _, endpoint := range endpoints {
+		host, _, err := net.SplitHostPort(endpoint)
+		if err != nil {
+			panic(err)
+		}
+
+		peers[endpoint] = net.JoinHostPort(host, port)
+	}
+
+	addr, present := peers[e.participant.Endpoint]
+	if !present {
+		panic("participant not in raft_peers: " + e.participant.Endpoint)
+	}
+
+	storage, err := craft.NewFileStorage(e.String("raft_dir", "raft"))
+	if err != nil {
+		panic(err)
+	}
+
+	electionTimeout := e.Duration("raft_election_timeout", time.Second)
+	return craft.NewController(craft.Config{
+		Participant:       e.participant,
+		Peers:             peers,
+		Transport:         craft.NewHTTPTransport(addr, electionTimeout),
+		Storage:           storage,
+		Strategy:          strategy,
+		LoadPolicy:        e.loadPolicy,
+		OnRebalance:       e.leaderRebalance,
+		HeartbeatInterval: e.Duration("raft_heartbeat", time.Millisecond*100),
+		ElectionTimeout:   electionTimeout,
+		SessionTimeout:    e.Duration("raft_session_timeout", time.Second*10),
+	})
+}
@@ -29,7 +29,7 @@ func (e *Engine) exportPipeline(outfile string, format string, layout string, sc
 	for _, m := range e.router.filterMatchers {
 		lonelyFilters[m.runner.Name()] = struct{}{}
 
-		for source := range m.matches {
+		for _, source := range m.sources() {
 			link := fmt.Sprintf(`%s -> %s [label="Filter"]`, source, m.runner.Name())
 			dot += "\r\n" + link
 
@@ -39,7 +39,7 @@ func (e *Engine) exportPipeline(outfile string, format string, layout string, sc
 
 	// output matchers
 	for _, m := range e.router.outputMatchers {
-		for source := range m.matches {
+		for _, source := range m.sources() {
 			link := fmt.Sprintf(`%s -> %s [label="Output"]`, source, m.runner.Name())
 			dot += "\r\n" + link
 
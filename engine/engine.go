@@ -15,7 +15,6 @@ import (
 	"time"
 
 	"github.com/funkygao/dbus/pkg/cluster"
-	czk "github.com/funkygao/dbus/pkg/cluster/zk"
 	"github.com/funkygao/gafka/ctx"
 	"github.com/funkygao/gafka/telemetry"
 	"github.com/funkygao/gafka/telemetry/influxdb"
@@ -39,6 +38,7 @@ type Engine struct {
 	zkSvr       string
 	participant cluster.Participant
 	controller  cluster.Controller
+	loadPolicy  cluster.LoadPolicy
 	epoch       int // cache of latest cluster leader epoch
 
 	// API Server
@@ -126,7 +126,8 @@ func New(globals *GlobalConfig) *Engine {
 	}
 }
 
-// ClonePacket is used for plugin Filter to generate new Packet: copy on write.
+// ClonePacket is used for plugin Filter to generate new Packet.
+// Payload that implements Cloner is deep copied, so the generated Packet can be modified.
 // The generated Packet will use dedicated filter recycle chan.
 func (e *Engine) ClonePacket(p *Packet) *Packet {
 	pack := <-e.filterRecycleChan
@@ -135,6 +136,15 @@ func (e *Engine) ClonePacket(p *Packet) *Packet {
 	return pack
 }
 
+// ShallowClonePacket is used for plugin Filter to generate new Packet that shares payload
+// with the original one.
+func (e *Engine) ShallowClonePacket(p *Packet) *Packet {
+	pack := <-e.filterRecycleChan
+	pack.Reset()
+	p.shareTo(pack)
+	return pack
+}
+
 // ClusterManager returns the cluster manager.
 // If cluster is disabled, returns nil.
 func (e *Engine) ClusterManager() cluster.Manager {
@@ -282,7 +292,22 @@ func (e *Engine) ServeForever() (ret error) {
 	log.Trace("engine starting...")
 
 	if globals.ClusterEnabled {
-		e.controller = czk.NewController(e.zkSvr, globals.Cluster, e.participant, cluster.StrategyRoundRobin, e.leaderRebalance)
+		strategy, err := cluster.ParseStrategy(e.String("cluster_strategy", cluster.StrategyRoundRobin.String()))
+		if err != nil {
+			panic(err)
+		}
+
+		e.loadPolicy = cluster.LoadPolicy{
+			Interval:   e.Duration("cluster_load_interval", time.Minute),
+			Skew:       float64(e.Int("cluster_load_skew", 0)) / 100,
+			Hysteresis: float64(e.Int("cluster_load_hysteresis", 20)) / 100,
+			Cooldown:   e.Duration("cluster_load_cooldown", time.Minute*10),
+		}
+		if err = e.loadPolicy.Validate(strategy); err != nil {
+			panic(err)
+		}
+
+		e.controller = e.newController(strategy)
 	}
 
 	// setup signal handler first to avoid race condition
@@ -346,6 +371,9 @@ func (e *Engine) ServeForever() (ret error) {
 			panic(err)
 		}
 		go e.watchUpgrade(e.ClusterManager().Upgrade())
+		if e.loadPolicy.Interval > 0 {
+			go e.reportLoads(e.loadPolicy.Interval)
+		}
 
 		log.Info("[%s] participant started", e.participant)
 	} else {
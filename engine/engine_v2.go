@@ -105,6 +105,15 @@ func (e *Engine) ClonePacket(p *Packet) *Packet {
 	return pack
 }
 
+// ShallowClonePacket is used for plugin Filter to generate new Packet that shares payload
+// with the original one.
+func (e *Engine) ShallowClonePacket(p *Packet) *Packet {
+	pack := <-e.filterRecycleChan
+	pack.Reset()
+	p.shareTo(pack)
+	return pack
+}
+
 func (e *Engine) LoadConfig(path string) *Engine {
 	zkSvr, realPath := parseConfigPath(path)
 	var (
@@ -8,8 +8,14 @@ import (
 type PluginHelper interface {
 
 	// ClonePacket is used for plugin Filter to generate new Packet.
+	// Payload that implements Cloner is deep copied, or else shared with the original Packet.
 	ClonePacket(*Packet) *Packet
 
+	// ShallowClonePacket is used for plugin Filter to generate new Packet that shares payload
+	// with the original Packet, which must not be modified.
+	// It is cheaper than ClonePacket for Filter that only rewrites Ident or replaces Payload.
+	ShallowClonePacket(*Packet) *Packet
+
 	// RegisterAPI allows plugins to register handlers on the global API server.
 	RegisterAPI(path string, handlerFunc APIHandler) *mux.Route
 }
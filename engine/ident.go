@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	identDelimiter     = "."
+	identWildcardOne   = "*" // exactly 1 segment
+	identWildcardAny   = "#" // zero or more segments
+	identPatternRegexp = "re:"
+)
+
+// identPattern is a compiled match item with wildcards or regexp, shared by
+// the matchers of router v1 and v2. See matcher for the syntax.
+type identPattern struct {
+	raw      string
+	segments []string
+	re       *regexp.Regexp
+}
+
+// compileIdentPattern compiles a match item, nil if it is exact ident.
+// It panics if the regexp is invalid.
+func compileIdentPattern(match string) *identPattern {
+	if strings.HasPrefix(match, identPatternRegexp) {
+		return &identPattern{
+			raw: match,
+			re:  regexp.MustCompile(strings.TrimPrefix(match, identPatternRegexp)),
+		}
+	}
+
+	segments := strings.Split(match, identDelimiter)
+	for _, s := range segments {
+		if s == identWildcardOne || s == identWildcardAny {
+			return &identPattern{raw: match, segments: segments}
+		}
+	}
+
+	return nil
+}
+
+func (p *identPattern) match(ident string) bool {
+	if p.re != nil {
+		return p.re.MatchString(ident)
+	}
+
+	return matchSegments(p.segments, strings.Split(ident, identDelimiter))
+}
+
+func matchSegments(pattern, ident []string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case identWildcardAny:
+			if len(pattern) == 1 {
+				return true
+			}
+
+			// try to consume 0, 1, ... segments
+			for i := 0; i <= len(ident); i++ {
+				if matchSegments(pattern[1:], ident[i:]) {
+					return true
+				}
+			}
+			return false
+
+		case identWildcardOne:
+			if len(ident) == 0 {
+				return false
+			}
+
+		default:
+			if len(ident) == 0 || pattern[0] != ident[0] {
+				return false
+			}
+		}
+
+		pattern, ident = pattern[1:], ident[1:]
+	}
+
+	return len(ident) == 0
+}
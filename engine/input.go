@@ -5,6 +5,8 @@ import (
 	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/funkygao/dbus/pkg/cluster"
 	log "github.com/funkygao/log4go"
@@ -15,6 +17,11 @@ var (
 	_ InputRunner  = &iRunner{}
 )
 
+const (
+	replayBackoff    = time.Millisecond * 100
+	maxReplayBackoff = time.Second * 10
+)
+
 // Input is the input plugin.
 type Input interface {
 	Plugin
@@ -30,6 +37,12 @@ type Input interface {
 	Run(r InputRunner, h PluginHelper) (err error)
 }
 
+// LoadReporter is used for Input plugin in cluster mode to report the actual load of its
+// resources, so that the leader can rebalance the cluster by load.
+type LoadReporter interface {
+	ResourceLoads() cluster.ResourceLoads
+}
+
 // InputRunner is a helper for Input plugin to access some context data.
 type InputRunner interface {
 	PluginRunner
@@ -48,21 +61,25 @@ type InputRunner interface {
 type iRunner struct {
 	pRunnerBase
 
-	inChan chan *Packet
+	inChan  chan *Packet
+	tracker *ackTracker
 
 	resourcesCh chan []cluster.Resource
 	panicCh     chan<- error
 }
 
 func newInputRunner(input Input, pluginCommons *pluginCommons, panicCh chan<- error) (r *iRunner) {
-	return &iRunner{
+	r = &iRunner{
 		pRunnerBase: pRunnerBase{
 			plugin:        input.(Plugin),
 			pluginCommons: pluginCommons,
 		},
 		panicCh:     panicCh,
+		tracker:     newAckTracker(pluginCommons.name),
 		resourcesCh: make(chan []cluster.Resource), // FIXME how to close it
 	}
+	r.tracker.replay = r.replay
+	return
 }
 
 func (ir *iRunner) Exchange() Exchange {
@@ -75,9 +92,44 @@ func (ir *iRunner) Emit(pack *Packet) {
 	}
 
 	pack.acker = ir.Input()
+	pack.entry = ir.tracker.track(pack)
 	ir.engine.router.hub <- pack
 }
 
+// replay re-sends the packets nacked by Output to the Output with backoff in case it keeps
+// failing. On engine stop, it gives up and the Input replays from its checkpoint after restart.
+// The replayed packets are not from the Input recycle pool, so that the Input is not starved.
+func (ir *iRunner) replay(entry *ackEntry, failures []ackFailure) {
+	retries := atomic.LoadInt32(&entry.retries)
+	backoff := replayBackoff << uint(retries-1)
+	if backoff > maxReplayBackoff || backoff <= 0 {
+		backoff = maxReplayBackoff
+	}
+	log.Error("[%s] packet#%d failed, replay#%d after %s", ir.Name(), entry.seq, retries, backoff)
+
+	go func() {
+		select {
+		case <-time.After(backoff):
+		case <-ir.engine.stopper:
+			return
+		}
+
+		for _, f := range failures {
+			pack := newPacket(nil)
+			pack.Ident = f.ident
+			pack.Metadata = f.metadata
+			pack.Payload = f.payload
+			pack.acker = entry.acker
+			pack.entry = entry
+			select {
+			case f.runner.inChan <- pack:
+			case <-ir.engine.stopper:
+				return
+			}
+		}
+	}()
+}
+
 func (ir *iRunner) InChan() <-chan *Packet {
 	return ir.inChan
 }
@@ -90,6 +142,11 @@ func (ir *iRunner) Stopper() <-chan struct{} {
 	return ir.engine.stopper
 }
 
+// AckStat returns the in-flight packets statistics of the Input.
+func (ir *iRunner) AckStat() AckStat {
+	return ir.tracker.stat()
+}
+
 func (ir *iRunner) SampleConfigItems() []string {
 	var r []string
 	for _, line := range strings.Split(ir.plugin.SampleConfig(), "\n") {
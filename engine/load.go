@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/funkygao/dbus/pkg/cluster"
+	log "github.com/funkygao/log4go"
+)
+
+// reportLoads periodically reports the load of resources consumed by the Input plugins
+// of this participant.
+func (e *Engine) reportLoads(interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			loads := make(cluster.ResourceLoads)
+			for _, r := range e.InputRunners {
+				if reporter, ok := r.Input().(LoadReporter); ok {
+					for name, load := range reporter.ResourceLoads() {
+						loads[name] = load
+					}
+				}
+			}
+
+			if err := e.controller.ReportLoads(loads); err != nil {
+				log.Error("[%s] report loads: %v", e.participant, err)
+			}
+
+		case <-e.stopper:
+			return
+		}
+	}
+}
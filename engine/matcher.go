@@ -3,16 +3,28 @@
 package engine
 
 // matcher belongs to the singleton router, it requires no lock.
+//
+// Packet Ident is hierarchical separated by dot, e,g. "mybinlog.db1.user".
+// A match item can be:
+//   - exact ident, e,g. "mybinlog"
+//   - segments with wildcards: "*" matches exactly 1 segment and "#" matches zero or more
+//     segments, e,g. "mybinlog.*.user", "mybinlog.#"
+//   - regexp with "re:" prefix, e,g. "re:^mybinlog\.db\d+\."
 type matcher struct {
-	runner  *foRunner
-	matches map[string]bool
+	runner   *foRunner
+	matches  map[string]bool // exact idents
+	patterns []*identPattern
 }
 
 func newMatcher(matches []string, r *foRunner) *matcher {
 	m := new(matcher)
 	m.matches = make(map[string]bool)
 	for _, match := range matches {
-		m.matches[match] = true
+		if p := compileIdentPattern(match); p != nil {
+			m.patterns = append(m.patterns, p)
+		} else {
+			m.matches[match] = true
+		}
 	}
 	m.runner = r
 	return m
@@ -23,5 +35,30 @@ func (m *matcher) InChan() chan *Packet {
 }
 
 func (m *matcher) Match(pack *Packet) bool {
-	return m.matches[pack.Ident]
+	return m.matchIdent(pack.Ident)
+}
+
+func (m *matcher) matchIdent(ident string) bool {
+	if m.matches[ident] {
+		return true
+	}
+
+	for _, p := range m.patterns {
+		if p.match(ident) {
+			return true
+		}
+	}
+	return false
+}
+
+// sources returns all the match items.
+func (m *matcher) sources() []string {
+	r := make([]string, 0, len(m.matches)+len(m.patterns))
+	for source := range m.matches {
+		r = append(r, source)
+	}
+	for _, p := range m.patterns {
+		r = append(r, p.raw)
+	}
+	return r
 }
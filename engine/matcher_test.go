@@ -0,0 +1,128 @@
+// +build !v2
+
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestMatcherExact(t *testing.T) {
+	m := newMatcher([]string{"mybinlog", "db1"}, nil)
+	assert.Equal(t, true, m.matchIdent("mybinlog"))
+	assert.Equal(t, true, m.matchIdent("db1"))
+	assert.Equal(t, false, m.matchIdent("mybinlog.db1.user"))
+	assert.Equal(t, false, m.matchIdent(""))
+	assert.Equal(t, 0, len(m.patterns))
+}
+
+func TestMatcherWildcard(t *testing.T) {
+	fixtures := []struct {
+		pattern string
+		ident   string
+		match   bool
+	}{
+		{"mybinlog.*.user", "mybinlog.db1.user", true},
+		{"mybinlog.*.user", "mybinlog.db1.order", false},
+		{"mybinlog.*.user", "mybinlog.user", false},
+		{"mybinlog.*", "mybinlog.db1.user", false},
+		{"mybinlog.*.*", "mybinlog.db1.user", true},
+		{"mybinlog.#", "mybinlog", true},
+		{"mybinlog.#", "mybinlog.db1", true},
+		{"mybinlog.#", "mybinlog.db1.user", true},
+		{"mybinlog.#", "kafka.db1.user", false},
+		{"#.user", "mybinlog.db1.user", true},
+		{"#.user", "user", true},
+		{"#.user", "mybinlog.db1.order", false},
+		{"mybinlog.#.user", "mybinlog.user", true},
+		{"mybinlog.#.user", "mybinlog.db1.user", true},
+		{"mybinlog.#.user", "mybinlog.db1.user.x", false},
+		{"#", "", true},
+		{"#", "a.b.c", true},
+		{"*", "a", true},
+		{"*", "a.b", false},
+		{"*.#", "a.b", true},
+		{"re:^mybinlog\\.db\\d+\\.", "mybinlog.db12.user", true},
+		{"re:^mybinlog\\.db\\d+\\.", "mybinlog.dbx.user", false},
+	}
+
+	for _, f := range fixtures {
+		m := newMatcher([]string{f.pattern}, nil)
+		assert.Equal(t, 1, len(m.patterns))
+		if m.matchIdent(f.ident) != f.match {
+			t.Errorf("%s %s: expected %v", f.pattern, f.ident, f.match)
+		}
+	}
+}
+
+func TestMatcherSources(t *testing.T) {
+	m := newMatcher([]string{"mybinlog.#", "db1"}, nil)
+	assert.Equal(t, []string{"db1", "mybinlog.#"}, m.sources())
+}
+
+func TestRouterLookup(t *testing.T) {
+	r := &Router{routes: make(map[string]*route)}
+	out1 := newMatcher([]string{"mybinlog.db1.*"}, nil)
+	out2 := newMatcher([]string{"mybinlog.#"}, nil)
+	filter := newMatcher([]string{"mybinlog"}, nil)
+	r.addOutputMatcher(out1)
+	r.addOutputMatcher(out2)
+	r.addFilterMatcher(filter)
+
+	rt := r.lookup("mybinlog.db1.user")
+	assert.Equal(t, []*matcher{out1, out2}, rt.outputs)
+	assert.Equal(t, 0, len(rt.filters))
+	assert.Equal(t, rt, r.lookup("mybinlog.db1.user")) // cached
+
+	rt = r.lookup("mybinlog")
+	assert.Equal(t, []*matcher{out2}, rt.outputs)
+	assert.Equal(t, []*matcher{filter}, rt.filters)
+
+	assert.Equal(t, 0, len(r.lookup("kafka").outputs))
+}
+
+func BenchmarkMatcherExact(b *testing.B) {
+	m := newMatcher([]string{"mybinlog", "db1", "db2"}, nil)
+	for i := 0; i < b.N; i++ {
+		m.matchIdent("db2")
+	}
+}
+
+func BenchmarkMatcherWildcard(b *testing.B) {
+	m := newMatcher([]string{"mybinlog.*.user", "mybinlog.db1.#"}, nil)
+	for i := 0; i < b.N; i++ {
+		m.matchIdent("mybinlog.db1.order")
+	}
+}
+
+func BenchmarkMatcherRegexp(b *testing.B) {
+	m := newMatcher([]string{`re:^mybinlog\.db\d+\.order$`}, nil)
+	for i := 0; i < b.N; i++ {
+		m.matchIdent("mybinlog.db1.order")
+	}
+}
+
+// the router evaluates patterns once for each ident
+func BenchmarkRouterLookupWildcard(b *testing.B) {
+	r := &Router{routes: make(map[string]*route)}
+	for i := 0; i < 10; i++ {
+		r.addOutputMatcher(newMatcher([]string{fmt.Sprintf("mybinlog.db%d.#", i)}, nil))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.lookup("mybinlog.db9.order")
+	}
+}
+
+func BenchmarkRouterLookupExact(b *testing.B) {
+	r := &Router{routes: make(map[string]*route)}
+	for i := 0; i < 10; i++ {
+		r.addOutputMatcher(newMatcher([]string{fmt.Sprintf("db%d", i)}, nil))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.lookup("db9")
+	}
+}
@@ -2,12 +2,6 @@
 
 package engine
 
-const (
-	delimiter = "."
-	wildcard  = "*"
-	empty     = ""
-)
-
 // Subscriber is a value associated with a subscription.
 type Subscriber FilterOutputRunner
 
@@ -21,6 +15,8 @@ type Subscription struct {
 // Matcher contains topic subscriptions and performs matches on them.
 // Matcher was borrowed from https://github.com/tylertreat/fast-topic-matching with
 // performance improvement.
+// A topic has the same syntax as the match items of router v1: exact ident,
+// segments with wildcards or regexp.
 type Matcher interface {
 	// Subscribe adds the Subscriber to the topic and returns a Subscription.
 	Subscribe(topic string, sub Subscriber) (*Subscription, error)
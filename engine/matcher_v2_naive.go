@@ -3,7 +3,6 @@
 package engine
 
 import (
-	"strings"
 	"sync"
 )
 
@@ -13,12 +12,16 @@ var (
 
 // naiveMatcher is an implementation of Matcher which is backed by a hashmap.
 type naiveMatcher struct {
-	subs map[string]map[Subscriber]struct{}
-	mu   sync.RWMutex
+	subs     map[string]map[Subscriber]struct{}
+	patterns map[string]*identPattern // nil for exact topic
+	mu       sync.RWMutex
 }
 
 func newNaiveMatcher() Matcher {
-	return &naiveMatcher{subs: make(map[string]map[Subscriber]struct{})}
+	return &naiveMatcher{
+		subs:     make(map[string]map[Subscriber]struct{}),
+		patterns: make(map[string]*identPattern),
+	}
 }
 
 // Subscribe adds the Subscriber to the topic and returns a Subscription.
@@ -26,6 +29,7 @@ func (n *naiveMatcher) Subscribe(topic string, sub Subscriber) (*Subscription, e
 	n.mu.Lock()
 	if _, ok := n.subs[topic]; !ok {
 		n.subs[topic] = make(map[Subscriber]struct{})
+		n.patterns[topic] = compileIdentPattern(topic)
 	}
 	n.subs[topic][sub] = struct{}{}
 	n.mu.Unlock()
@@ -53,7 +57,7 @@ func (n *naiveMatcher) Lookup(topic string, subs []Subscriber) int {
 	subscriberSet := make(map[Subscriber]struct{})
 	n.mu.RLock()
 	for existingTopic, subscribers := range n.subs {
-		if topicMatches(existingTopic, topic) {
+		if p := n.patterns[existingTopic]; existingTopic == topic || (p != nil && p.match(topic)) {
 			for sub, x := range subscribers {
 				subscriberSet[sub] = x
 			}
@@ -69,22 +73,3 @@ func (n *naiveMatcher) Lookup(topic string, subs []Subscriber) int {
 
 	return i
 }
-
-func topicMatches(sub, topic string) bool {
-	var (
-		subConstituents   = strings.Split(sub, delimiter)
-		topicConstituents = strings.Split(topic, delimiter)
-	)
-
-	if len(subConstituents) != len(topicConstituents) {
-		return false
-	}
-
-	for i, constituent := range topicConstituents {
-		if constituent != subConstituents[i] && subConstituents[i] != wildcard {
-			return false
-		}
-	}
-
-	return true
-}
@@ -1,6 +1,8 @@
 package engine
 
 import (
+	"strings"
+
 	"github.com/funkygao/go-metrics"
 )
 
@@ -22,3 +24,27 @@ func (m *routerMetrics) Update(pack *Packet) {
 
 	m.m[pack.Ident].Mark(1)
 }
+
+// pluginMetricsPrefix is the registry name prefix of plugin metrics exported by /metrics.
+const pluginMetricsPrefix = "plugin."
+
+// NewPluginMeter returns the meter named plugin.<plugin>.<name> which is exported by /metrics.
+func NewPluginMeter(plugin, name string) metrics.Meter {
+	return metrics.GetOrRegisterMeter(pluginMetricsPrefix+plugin+"."+name, metrics.DefaultRegistry)
+}
+
+// UnregisterPluginMeter removes the meter created by NewPluginMeter, typically when the plugin stops.
+func UnregisterPluginMeter(plugin, name string) {
+	metrics.DefaultRegistry.Unregister(pluginMetricsPrefix + plugin + "." + name)
+}
+
+// pluginMeters returns all the registered plugin meters keyed by name.
+func pluginMeters() map[string]metrics.Meter {
+	r := make(map[string]metrics.Meter)
+	metrics.DefaultRegistry.Each(func(name string, i interface{}) {
+		if m, ok := i.(metrics.Meter); ok && strings.HasPrefix(name, pluginMetricsPrefix) {
+			r[name] = m
+		}
+	})
+	return r
+}
@@ -17,4 +17,12 @@ type OutputRunner interface {
 
 	// Ack notifies the packet's source Input plugin that it is processed successfully.
 	Ack(*Packet) error
+
+	// Nack notifies that the packet fails to be processed, so that engine replays it to
+	// this Output with backoff. The packet must still be recycled.
+	// A packet recycled without Ack or Nack is skipped: it never checkpoints the Input.
+	Nack(*Packet)
+
+	// Stopper returns a channel for plugins to get notified when engine stops.
+	Stopper() <-chan struct{}
 }
@@ -23,6 +23,18 @@ type KeyValuer interface {
 
 	// Set stores a value for the key.
 	Set(k string, v interface{})
+
+	// Del removes the key.
+	Del(k string)
+}
+
+// Cloner is an interface that can be applied on Payloader.
+// ClonePacket deep copies the payload that implements it, so that a Filter can modify
+// the cloned payload without affecting the original one delivered to other plugins.
+type Cloner interface {
+
+	// ClonePayload returns a deep copy of the payload without cached encoding.
+	ClonePayload() Payloader
 }
 
 // Packet is the pipeline data structure that is transferred between plugins.
@@ -32,7 +44,8 @@ type Packet struct {
 	recycleChan chan *Packet
 
 	refCount int32
-	acker    Acker // the Input it originates from
+	acker    Acker     // the Input it originates from
+	entry    *ackEntry // ack tracking state of the Input packet it derives from
 	// buf []byte TODO reuse memory
 
 	// Ident is used for routing.
@@ -56,6 +69,17 @@ func newPacket(recycleChan chan *Packet) *Packet {
 
 func (p *Packet) incRef() *Packet {
 	atomic.AddInt32(&p.refCount, 1)
+	if p.entry != nil {
+		p.entry.incRef()
+	}
+	return p
+}
+
+// expectAck marks that the packet is dispatched to an Output which will ack it.
+func (p *Packet) expectAck() *Packet {
+	if p.entry != nil {
+		p.entry.expectAck()
+	}
 	return p
 }
 
@@ -65,9 +89,21 @@ func (p *Packet) String() string {
 
 // copyTo will copy itself to another Packet.
 func (p *Packet) copyTo(other *Packet) {
+	p.shareTo(other)
+	if c, ok := p.Payload.(Cloner); ok {
+		other.Payload = c.ClonePayload()
+	}
+}
+
+// shareTo will copy itself to another Packet with the payload shared.
+func (p *Packet) shareTo(other *Packet) {
 	other.Ident = p.Ident
 	other.acker = p.acker
-	other.Payload = p.Payload // FIXME clone deep copy
+	if p.entry != nil {
+		p.entry.incRef()
+		other.entry = p.entry
+	}
+	other.Payload = p.Payload
 }
 
 func (p *Packet) Reset() {
@@ -75,22 +111,43 @@ func (p *Packet) Reset() {
 	p.Ident = ""
 	p.Payload = nil
 	p.acker = nil
+	p.entry = nil
 }
 
 // ack notifies the Packet's source Input that it is successfully processed.
 // ack is called by Output plugin.
 func (p *Packet) ack() error {
+	if p.entry != nil {
+		// Input is acked in order by its ackTracker
+		return p.entry.ack()
+	}
+
 	return p.acker.Ack(p)
 }
 
+// nack notifies the Packet's source Input that the Output fails to process it, so that it
+// is replayed to the Output.
+func (p *Packet) nack(fo *foRunner) {
+	if p.entry != nil {
+		p.entry.nack(fo, p)
+	}
+}
+
 // Recycle decrement packet reference count and place it back
 // to its recycle pool if possible.
 func (p *Packet) Recycle() {
+	if p.entry != nil {
+		p.entry.release()
+	}
+
 	if atomic.AddInt32(&p.refCount, -1) == 0 {
 		p.Reset()
 
 		// reuse this pack to avoid re-alloc
 		// if recycleChan is full, will block
-		p.recycleChan <- p
+		if p.recycleChan != nil {
+			// nil for replayed packet
+			p.recycleChan <- p
+		}
 	}
 }
@@ -31,6 +31,8 @@ type Pauser interface {
 
 // Acker is a callback interface that is called when a packet
 // is processed successfully.
+// Input is acked in the order the packets are emitted. A packet that matches no
+// Output is acked right away.
 type Acker interface {
 	Ack(*Packet) error
 }
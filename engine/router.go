@@ -72,10 +72,24 @@ type Router struct {
 
 	filterMatchers []*matcher
 	outputMatchers []*matcher
+
+	// routes is the inverted index of ident to matched plugins, so that patterns
+	// are evaluated only once for each ident.
+	routes map[string]*route
+}
+
+// route is the matched Filter/Output plugins of an ident.
+type route struct {
+	filters []*matcher
+	outputs []*matcher
 }
 
+// maxRoutes bounds the routes cache in case idents are unbounded.
+const maxRoutes = 1 << 16
+
 func newRouter() *Router {
 	return &Router{
+		routes:         make(map[string]*route),
 		hub:            make(chan *Packet, Globals().HubChanSize),
 		stopper:        make(chan struct{}),
 		metrics:        newMetrics(),
@@ -86,10 +100,54 @@ func newRouter() *Router {
 
 func (r *Router) addFilterMatcher(matcher *matcher) {
 	r.filterMatchers = append(r.filterMatchers, matcher)
+	r.routes = make(map[string]*route)
 }
 
 func (r *Router) addOutputMatcher(matcher *matcher) {
 	r.outputMatchers = append(r.outputMatchers, matcher)
+	r.routes = make(map[string]*route)
+}
+
+// lookup returns the matched plugins of an ident.
+func (r *Router) lookup(ident string) *route {
+	if rt, present := r.routes[ident]; present {
+		return rt
+	}
+
+	rt := &route{}
+	for _, matcher := range r.outputMatchers {
+		if matcher != nil && matcher.matchIdent(ident) {
+			rt.outputs = append(rt.outputs, matcher)
+		}
+	}
+	for _, matcher := range r.filterMatchers {
+		if matcher != nil && matcher.matchIdent(ident) {
+			rt.filters = append(rt.filters, matcher)
+		}
+	}
+
+	if len(r.routes) >= maxRoutes {
+		r.routes = make(map[string]*route)
+	}
+	r.routes[ident] = rt
+	return rt
+}
+
+// dispatch sends the packet to all matched plugins and returns whether any matches.
+func (r *Router) dispatch(pack *Packet) bool {
+	rt := r.lookup(pack.Ident)
+
+	// dispatch pack to output plugins, 1 to many
+	for _, matcher := range rt.outputs {
+		matcher.InChan() <- pack.incRef().expectAck()
+	}
+
+	// dispatch pack to filter plugins, 1 to many
+	for _, matcher := range rt.filters {
+		matcher.InChan() <- pack.incRef()
+	}
+
+	return len(rt.outputs)+len(rt.filters) > 0
 }
 
 // Start starts the router: dispatch pack from Input to MatchRunners.
@@ -113,26 +171,7 @@ func (r *Router) Start(wg *sync.WaitGroup) {
 				r.metrics.Update(pack) // dryrun throughput 2.1M/s -> 1.6M/s
 			}
 
-			foundMatch := false
-			// dispatch pack to output plugins, 1 to many
-			for _, matcher := range r.outputMatchers {
-				if matcher != nil && matcher.Match(pack) {
-					foundMatch = true
-
-					matcher.InChan() <- pack.incRef()
-				}
-			}
-
-			// dispatch pack to filter plugins, 1 to many
-			for _, matcher := range r.filterMatchers {
-				if matcher != nil && matcher.Match(pack) {
-					foundMatch = true
-
-					matcher.InChan() <- pack.incRef()
-				}
-			}
-
-			if !foundMatch {
+			if !r.dispatch(pack) {
 				// Maybe we closed all filter/output inChan, but there
 				// still exits some remnant packs in router.hub.
 				// To handle r issue, Input/Output should be stateful.
@@ -153,22 +192,7 @@ func (r *Router) Start(wg *sync.WaitGroup) {
 						r.metrics.Update(pack)
 					}
 
-					foundMatch := false
-					for _, matcher := range r.outputMatchers {
-						if matcher != nil && matcher.Match(pack) {
-							foundMatch = true
-
-							matcher.InChan() <- pack.incRef()
-						}
-					}
-					for _, matcher := range r.filterMatchers {
-						if matcher != nil && matcher.Match(pack) {
-							foundMatch = true
-
-							matcher.InChan() <- pack.incRef()
-						}
-					}
-					if !foundMatch {
+					if !r.dispatch(pack) {
 						log.Debug("no match: %+v", pack)
 					}
 
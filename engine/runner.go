@@ -100,6 +100,14 @@ func (fo *foRunner) Ack(pack *Packet) error {
 	return pack.ack()
 }
 
+func (fo *foRunner) Nack(pack *Packet) {
+	pack.nack(fo)
+}
+
+func (fo *foRunner) Stopper() <-chan struct{} {
+	return fo.engine.stopper
+}
+
 func (fo *foRunner) Emit(pack *Packet) {
 	fo.engine.router.hub <- pack
 }
@@ -2,8 +2,12 @@ package checkpoint
 
 // All valid State scheme.
 const (
-	SchemeKafka  = "kafka"
-	SchemeBinlog = "myslave"
+	SchemeKafka        = "kafka"
+	SchemeBinlog       = "myslave"
+	SchemeBinlogGTID   = "myslave_gtid"
+	SchemeBinlogSchema = "myslave_schema"
+	SchemeBinlogTable  = "myslave_table"
+	SchemeBinlogSnap   = "myslave_snapshot"
 )
 
 // State is an interface for all event state information.
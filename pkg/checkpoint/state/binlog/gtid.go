@@ -0,0 +1,76 @@
+package binlog
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/funkygao/dbus/pkg/checkpoint"
+)
+
+var (
+	_ checkpoint.State = &GTIDState{}
+)
+
+// GTIDState is a mysql binlog state that is resumed by the executed GTID set
+// instead of binlog file/offset, which survives master failover.
+type GTIDState struct {
+	dsn string
+
+	Ident  string `json:"ident,omitempty"` // who updates this state
+	File   string `json:"file"`            // informative only, not used for resuming
+	Offset uint32 `json:"offset"`          // informative only, not used for resuming
+
+	// GTIDSet is the executed GTID set, e,g.
+	// 07c93cd7-a7d3-12a5-94e1-a0369a7c3790:1-313225133
+	GTIDSet string `json:"gtid"`
+}
+
+// NewGTID creates a mysql binlog GTID state.
+// dsn is the DSN of mysql connection, name is the Input plugin name.
+func NewGTID(dsn string, name string) *GTIDState {
+	return &GTIDState{dsn: dsn, Ident: name}
+}
+
+func (s *GTIDState) Marshal() []byte {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+func (s *GTIDState) Unmarshal(data []byte) {
+	json.Unmarshal(data, s)
+}
+
+func (s *GTIDState) reset() {
+	s.File = ""
+	s.Offset = 0
+	s.GTIDSet = ""
+}
+
+func (s *GTIDState) String() string {
+	return s.GTIDSet
+}
+
+func (s *GTIDState) Name() string {
+	return s.Ident
+}
+
+func (s *GTIDState) DSN() string {
+	return s.dsn
+}
+
+func (s *GTIDState) Scheme() string {
+	return checkpoint.SchemeBinlogGTID
+}
+
+func (s *GTIDState) Delta(that checkpoint.State) string {
+	s1, ok := that.(*GTIDState)
+	if !ok {
+		return ""
+	}
+
+	if s1.File != s.File {
+		return ""
+	}
+
+	return fmt.Sprintf("%d", s.Offset-s1.Offset)
+}
@@ -0,0 +1,32 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/pkg/checkpoint"
+)
+
+func TestGTIDState(t *testing.T) {
+	s := NewGTID("", "")
+	s.File = "f1"
+	s.Offset = 5
+	s.GTIDSet = "a0f36bb1-fdbb-11e5-8413-a0369f7c3bb4:1-16393135780"
+	assert.Equal(t, `{"file":"f1","offset":5,"gtid":"a0f36bb1-fdbb-11e5-8413-a0369f7c3bb4:1-16393135780"}`, string(s.Marshal()))
+	assert.Equal(t, checkpoint.SchemeBinlogGTID, s.Scheme())
+	assert.Equal(t, "a0f36bb1-fdbb-11e5-8413-a0369f7c3bb4:1-16393135780", s.String())
+
+	s.reset()
+	assert.Equal(t, "", s.GTIDSet)
+
+	s.Unmarshal([]byte(`{"file":"f1","offset":5,"gtid":"a0f36bb1-fdbb-11e5-8413-a0369f7c3bb4:1-3"}`))
+	assert.Equal(t, "f1", s.File)
+	assert.Equal(t, uint32(5), s.Offset)
+	assert.Equal(t, "a0f36bb1-fdbb-11e5-8413-a0369f7c3bb4:1-3", s.GTIDSet)
+
+	s1 := NewGTID("", "")
+	s1.File = "f1"
+	s1.Offset = 15
+	assert.Equal(t, "10", s1.Delta(s))
+	assert.Equal(t, "", s1.Delta(New("", "")))
+}
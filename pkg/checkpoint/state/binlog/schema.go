@@ -0,0 +1,284 @@
+package binlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/funkygao/dbus/pkg/checkpoint"
+	"github.com/funkygao/dbus/pkg/model"
+	"github.com/siddontang/go-mysql/mysql"
+)
+
+var (
+	_ checkpoint.State = &SchemaState{}
+	_ checkpoint.State = &TableSchemaState{}
+)
+
+// SchemaState is the versioned table schema history of a mysql instance,
+// so that rows event can be interpreted with the table schema at the binlog
+// position being replayed instead of the live one.
+//
+// The history is persisted per table: SchemaState itself persists only the table
+// names, and versions of each table are persisted as a TableSchemaState, so that
+// a DDL rewrites only the history of its own table.
+type SchemaState struct {
+	dsn string
+
+	Ident string `json:"ident,omitempty"` // who updates this state
+
+	// Names are the tables with history, in the form of db.table.
+	Names []string `json:"tables"`
+
+	tables map[string]*TableSchemaState
+}
+
+// TableSchemaState is the schema history of a table, versions are sorted by binlog position.
+type TableSchemaState struct {
+	dsn string
+
+	Ident    string           `json:"ident,omitempty"` // who updates this state
+	Table    string           `json:"table"`           // db.table
+	Versions []*SchemaVersion `json:"versions"`
+}
+
+// SchemaVersion is a table schema that takes effect since a binlog position.
+type SchemaVersion struct {
+	File    string             `json:"file"`
+	Offset  uint32             `json:"offset"`
+	GTIDSet string             `json:"gtid,omitempty"` // executed GTID set at the position, GTID mode only
+	Schema  *model.TableSchema `json:"schema"`         // nil means the table is dropped
+
+	gset mysql.GTIDSet // parsed GTIDSet on creation and decoding, read only since then
+}
+
+// Position is a position of the binlog stream.
+//
+// Binlog file and offset of the same event differ among masters of a failover, so in
+// GTID mode positions are ordered by the executed GTID set, which only grows along
+// the binlog stream.
+type Position struct {
+	File    string
+	Offset  uint32
+	GTIDSet mysql.GTIDSet // nil if not in GTID mode
+}
+
+// NewSchema creates a mysql table schema history state.
+// dsn is the DSN of mysql connection, name is the Input plugin name.
+func NewSchema(dsn string, name string) *SchemaState {
+	return &SchemaState{
+		dsn:    dsn,
+		Ident:  name,
+		tables: make(map[string]*TableSchemaState),
+	}
+}
+
+// NewTableSchema creates the schema history state of a table.
+func NewTableSchema(dsn string, name string, table string) *TableSchemaState {
+	return &TableSchemaState{dsn: dsn, Ident: name, Table: table}
+}
+
+func (s *SchemaState) Marshal() []byte {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+// Unmarshal loads the table names only, the history of each table is loaded into Table(name).
+func (s *SchemaState) Unmarshal(data []byte) {
+	json.Unmarshal(data, s)
+	for _, name := range s.Names {
+		if _, present := s.tables[name]; !present {
+			s.tables[name] = NewTableSchema(s.dsn, s.Ident, name)
+		}
+	}
+}
+
+func (s *SchemaState) String() string {
+	return fmt.Sprintf("%d tables", len(s.Names))
+}
+
+func (s *SchemaState) Name() string {
+	return s.Ident
+}
+
+func (s *SchemaState) DSN() string {
+	return s.dsn
+}
+
+func (s *SchemaState) Scheme() string {
+	return checkpoint.SchemeBinlogSchema
+}
+
+func (s *SchemaState) Delta(that checkpoint.State) string {
+	return ""
+}
+
+// Table returns the schema history of a table, which is created if not present.
+func (s *SchemaState) Table(table string) *TableSchemaState {
+	if t, present := s.tables[table]; present {
+		return t
+	}
+
+	t := NewTableSchema(s.dsn, s.Ident, table)
+	s.tables[table] = t
+	s.syncNames()
+	return t
+}
+
+func (s *SchemaState) syncNames() {
+	s.Names = s.Names[:0]
+	for name := range s.tables {
+		s.Names = append(s.Names, name)
+	}
+	sort.Strings(s.Names)
+}
+
+// Lookup returns the schema of a table that takes effect at the binlog position.
+// If the table is unknown or dropped at that position, ok is false.
+func (s *SchemaState) Lookup(table string, pos Position) (schema *model.TableSchema, ok bool) {
+	t, present := s.tables[table]
+	if !present {
+		return nil, false
+	}
+
+	i := t.search(pos)
+	if i < 0 || t.Versions[i].Schema == nil {
+		return nil, false
+	}
+
+	return t.Versions[i].Schema, true
+}
+
+// Add records a new schema version of a table since the binlog position, and returns
+// the history of the table and whether the table is new to the history.
+// nil schema means the table is dropped.
+func (s *SchemaState) Add(table string, pos Position, schema *model.TableSchema) (t *TableSchemaState, created bool) {
+	_, present := s.tables[table]
+	t = s.Table(table)
+
+	v := &SchemaVersion{File: pos.File, Offset: pos.Offset, Schema: schema}
+	if pos.GTIDSet != nil {
+		// a copy, the GTID set of position keeps growing
+		v.GTIDSet = pos.GTIDSet.String()
+		v.gset, _ = mysql.ParseMysqlGTIDSet(v.GTIDSet)
+	}
+
+	i := sort.Search(len(t.Versions), func(i int) bool {
+		return t.Versions[i].compare(pos) > 0
+	})
+	if i > 0 && t.Versions[i-1].compare(pos) == 0 {
+		// replayed, overwrite
+		t.Versions[i-1] = v
+		return t, !present
+	}
+
+	t.Versions = append(t.Versions, nil)
+	copy(t.Versions[i+1:], t.Versions[i:])
+	t.Versions[i] = v
+	return t, !present
+}
+
+// Prune discards versions that will never be looked up after the binlog position,
+// which is typically the checkpoint position.
+// It returns the tables whose history is pruned and whether any table is removed,
+// which happens if it is dropped and never recreated.
+func (s *SchemaState) Prune(pos Position) (pruned []*TableSchemaState, removed bool) {
+	for table, t := range s.tables {
+		i := t.search(pos)
+		switch {
+		case i >= 0 && i == len(t.Versions)-1 && t.Versions[i].Schema == nil:
+			// dropped and never recreated
+			t.Versions = nil
+			delete(s.tables, table)
+			removed = true
+
+		case i > 0:
+			t.Versions = t.Versions[i:]
+
+		default:
+			continue
+		}
+		pruned = append(pruned, t)
+	}
+
+	if removed {
+		s.syncNames()
+	}
+	return
+}
+
+func (t *TableSchemaState) Marshal() []byte {
+	b, _ := json.Marshal(t)
+	return b
+}
+
+func (t *TableSchemaState) Unmarshal(data []byte) {
+	json.Unmarshal(data, t)
+	for _, v := range t.Versions {
+		if len(v.GTIDSet) > 0 {
+			// compare falls back to binlog position if it is invalid
+			v.gset, _ = mysql.ParseMysqlGTIDSet(v.GTIDSet)
+		}
+	}
+}
+
+func (t *TableSchemaState) String() string {
+	return fmt.Sprintf("%s %d versions", t.Table, len(t.Versions))
+}
+
+func (t *TableSchemaState) Name() string {
+	return t.Ident
+}
+
+func (t *TableSchemaState) DSN() string {
+	return t.dsn
+}
+
+func (t *TableSchemaState) Scheme() string {
+	return checkpoint.SchemeBinlogTable
+}
+
+func (t *TableSchemaState) Delta(that checkpoint.State) string {
+	return ""
+}
+
+// search returns index of the last version that takes effect at the position, -1 if not found.
+func (t *TableSchemaState) search(pos Position) int {
+	return sort.Search(len(t.Versions), func(i int) bool {
+		return t.Versions[i].compare(pos) > 0
+	}) - 1
+}
+
+// compare returns -1, 0 or 1 if the version takes effect before, at or after the position.
+// GTID sets are compared if both have, otherwise binlog file and offset.
+func (v *SchemaVersion) compare(pos Position) int {
+	if pos.GTIDSet != nil && v.gset != nil {
+		switch {
+		case v.gset.Equal(pos.GTIDSet):
+			return 0
+		case pos.GTIDSet.Contain(v.gset):
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	return comparePosition(v.File, v.Offset, pos.File, pos.Offset)
+}
+
+// comparePosition compares 2 binlog positions of the same master.
+// Binlog file names are in the form of mysql-bin.000001, so can be compared as string.
+func comparePosition(file1 string, offset1 uint32, file2 string, offset2 uint32) int {
+	switch {
+	case file1 < file2:
+		return -1
+	case file1 > file2:
+		return 1
+	case offset1 < offset2:
+		return -1
+	case offset1 > offset2:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,109 @@
+package binlog
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/pkg/model"
+	"github.com/siddontang/go-mysql/mysql"
+)
+
+func TestSchemaState(t *testing.T) {
+	s := NewSchema("", "")
+	v1 := &model.TableSchema{Columns: []model.Column{{Name: "id", Type: "int(11)"}}, PKs: []int{0}}
+	v2 := &model.TableSchema{Columns: []model.Column{{Name: "id", Type: "int(11)"}, {Name: "name", Type: "varchar(20)", Nullable: true}}, PKs: []int{0}}
+
+	_, ok := s.Lookup("db.t", Position{File: "f1", Offset: 100})
+	assert.Equal(t, false, ok)
+
+	_, created := s.Add("db.t", Position{File: "f1", Offset: 200}, v2)
+	assert.Equal(t, true, created)
+	_, created = s.Add("db.t", Position{File: "f1", Offset: 100}, v1) // out of order
+	assert.Equal(t, false, created)
+	ts, _ := s.Add("db.t", Position{File: "f2", Offset: 50}, nil) // dropped
+	assert.Equal(t, 3, len(ts.Versions))
+
+	_, ok = s.Lookup("db.t", Position{File: "f1", Offset: 99})
+	assert.Equal(t, false, ok)
+	schema, ok := s.Lookup("db.t", Position{File: "f1", Offset: 100})
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 1, len(schema.Columns))
+	schema, ok = s.Lookup("db.t", Position{File: "f1", Offset: 300})
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []string{"id", "name"}, schema.ColumnNames())
+	_, ok = s.Lookup("db.t", Position{File: "f2", Offset: 60})
+	assert.Equal(t, false, ok)
+
+	// marshal roundtrip: table names and table history are persisted separately
+	s1 := NewSchema("", "")
+	s1.Unmarshal(s.Marshal())
+	assert.Equal(t, []string{"db.t"}, s1.Names)
+	assert.Equal(t, "1 tables", s1.String())
+	s1.Table("db.t").Unmarshal(ts.Marshal())
+	assert.Equal(t, 3, len(s1.Table("db.t").Versions))
+
+	pruned, removed := s.Prune(Position{File: "f1", Offset: 250})
+	assert.Equal(t, 1, len(pruned))
+	assert.Equal(t, false, removed)
+	assert.Equal(t, 2, len(ts.Versions))
+	pruned, removed = s.Prune(Position{File: "f2", Offset: 60})
+	assert.Equal(t, 1, len(pruned))
+	assert.Equal(t, true, removed)
+	assert.Equal(t, 0, len(s.Names))
+}
+
+func TestSchemaStateGTID(t *testing.T) {
+	gtid := func(set string) mysql.GTIDSet {
+		gset, err := mysql.ParseMysqlGTIDSet(set)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return gset
+	}
+
+	const uuid = "07c93cd7-a7d3-12a5-94e1-a0369a7c3790"
+	s := NewSchema("", "")
+	v1 := &model.TableSchema{Columns: []model.Column{{Name: "id", Type: "int(11)"}}}
+	v2 := &model.TableSchema{Columns: []model.Column{{Name: "id", Type: "bigint(20)"}}}
+	s.Add("db.t", Position{File: "a-bin.000009", Offset: 100, GTIDSet: gtid(uuid + ":1-10")}, v1)
+	s.Add("db.t", Position{File: "a-bin.000009", Offset: 900, GTIDSet: gtid(uuid + ":1-20")}, v2)
+
+	// after failover, binlog file of the new master is smaller, GTID set still works
+	schema, ok := s.Lookup("db.t", Position{File: "b-bin.000001", Offset: 4, GTIDSet: gtid(uuid + ":1-15")})
+	assert.Equal(t, true, ok)
+	assert.Equal(t, v1, schema)
+	schema, _ = s.Lookup("db.t", Position{File: "b-bin.000001", Offset: 4, GTIDSet: gtid(uuid + ":1-25")})
+	assert.Equal(t, v2, schema)
+	_, ok = s.Lookup("db.t", Position{File: "b-bin.000001", Offset: 4, GTIDSet: gtid(uuid + ":1-5")})
+	assert.Equal(t, false, ok)
+
+	// replayed DDL overwrites
+	ts, _ := s.Add("db.t", Position{File: "b-bin.000001", Offset: 4, GTIDSet: gtid(uuid + ":1-20")}, v2)
+	assert.Equal(t, 2, len(ts.Versions))
+}
+
+func TestSchemaStateConcurrentLookup(t *testing.T) {
+	const uuid = "07c93cd7-a7d3-12a5-94e1-a0369a7c3790"
+	gset, _ := mysql.ParseMysqlGTIDSet(uuid + ":1-10")
+	s := NewSchema("", "")
+	ts, _ := s.Add("db.t", Position{File: "f1", Offset: 100, GTIDSet: gset}, &model.TableSchema{})
+
+	// decoded versions are looked up by concurrent readers
+	s1 := NewSchema("", "")
+	s1.Unmarshal(s.Marshal())
+	s1.Table("db.t").Unmarshal(ts.Marshal())
+	pos := Position{File: "f2", Offset: 4}
+	pos.GTIDSet, _ = mysql.ParseMysqlGTIDSet(uuid + ":1-20")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok := s1.Lookup("db.t", pos)
+			assert.Equal(t, true, ok)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,131 @@
+package binlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/funkygao/dbus/pkg/checkpoint"
+)
+
+var (
+	_ checkpoint.State = &SnapshotState{}
+)
+
+// SnapshotState is the progress of the initial table data snapshot of a mysql instance.
+type SnapshotState struct {
+	dsn string
+
+	Ident string `json:"ident,omitempty"` // who updates this state
+
+	// binlog position captured before snapshot, from which replication continues.
+	File    string `json:"file"`
+	Offset  uint32 `json:"offset"`
+	GTIDSet string `json:"gtid,omitempty"`
+
+	// Tables key is db.table.
+	Tables map[string]*TableSnapshot `json:"tables"`
+
+	Done bool `json:"done"` // all tables are done
+}
+
+// TableSnapshot is the snapshot progress of a table.
+type TableSnapshot struct {
+	LastPK []string `json:"pk,omitempty"` // primary key values of the last processed row
+	Rows   int64    `json:"rows"`         // number of processed rows
+	Done   bool     `json:"done"`
+}
+
+// NewSnapshot creates a mysql table snapshot state.
+// dsn is the DSN of mysql connection, name is the Input plugin name.
+func NewSnapshot(dsn string, name string) *SnapshotState {
+	return &SnapshotState{
+		dsn:    dsn,
+		Ident:  name,
+		Tables: make(map[string]*TableSnapshot),
+	}
+}
+
+func (s *SnapshotState) Marshal() []byte {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+func (s *SnapshotState) Unmarshal(data []byte) {
+	json.Unmarshal(data, s)
+}
+
+func (s *SnapshotState) String() string {
+	if s.Done {
+		return fmt.Sprintf("%s-%d done", s.File, s.Offset)
+	}
+
+	return fmt.Sprintf("%s-%d %d/%d tables pending", s.File, s.Offset, len(s.Pending()), len(s.Tables))
+}
+
+func (s *SnapshotState) Name() string {
+	return s.Ident
+}
+
+func (s *SnapshotState) DSN() string {
+	return s.dsn
+}
+
+func (s *SnapshotState) Scheme() string {
+	return checkpoint.SchemeBinlogSnap
+}
+
+func (s *SnapshotState) Delta(that checkpoint.State) string {
+	return ""
+}
+
+// Started returns whether the binlog position has been captured.
+func (s *SnapshotState) Started() bool {
+	return len(s.File) > 0
+}
+
+// Start resets the snapshot with the captured binlog position and tables to dump.
+func (s *SnapshotState) Start(file string, offset uint32, gtidSet string, tables []string) {
+	s.File = file
+	s.Offset = offset
+	s.GTIDSet = gtidSet
+	s.Tables = make(map[string]*TableSnapshot, len(tables))
+	for _, t := range tables {
+		s.Tables[t] = &TableSnapshot{}
+	}
+	s.Done = len(tables) == 0
+}
+
+// Pending returns sorted tables whose snapshot is not done yet.
+func (s *SnapshotState) Pending() []string {
+	var tables []string
+	for t, ts := range s.Tables {
+		if !ts.Done {
+			tables = append(tables, t)
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// Progress returns the snapshot progress of a table, nil if not found.
+func (s *SnapshotState) Progress(table string) *TableSnapshot {
+	return s.Tables[table]
+}
+
+// Advance records that rows of a table up to the primary key have been processed.
+func (s *SnapshotState) Advance(table string, lastPK []string, rows int, done bool) {
+	ts, present := s.Tables[table]
+	if !present {
+		ts = &TableSnapshot{}
+		s.Tables[table] = ts
+	}
+
+	if len(lastPK) > 0 {
+		ts.LastPK = lastPK
+	}
+	ts.Rows += int64(rows)
+	ts.Done = ts.Done || done
+
+	s.Done = len(s.Pending()) == 0
+}
@@ -0,0 +1,40 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/pkg/checkpoint"
+)
+
+func TestSnapshotState(t *testing.T) {
+	s := NewSnapshot("", "")
+	assert.Equal(t, checkpoint.SchemeBinlogSnap, s.Scheme())
+	assert.Equal(t, false, s.Started())
+
+	s.Start("f1", 100, "", []string{"db.b", "db.a"})
+	assert.Equal(t, true, s.Started())
+	assert.Equal(t, false, s.Done)
+	assert.Equal(t, []string{"db.a", "db.b"}, s.Pending())
+	assert.Equal(t, "f1-100 2/2 tables pending", s.String())
+
+	s.Advance("db.a", []string{"5", "x"}, 5, false)
+	assert.Equal(t, []string{"5", "x"}, s.Progress("db.a").LastPK)
+	s.Advance("db.a", []string{"8", "y"}, 3, true)
+	assert.Equal(t, int64(8), s.Progress("db.a").Rows)
+	assert.Equal(t, []string{"db.b"}, s.Pending())
+
+	// marshal roundtrip
+	s1 := NewSnapshot("", "")
+	s1.Unmarshal(s.Marshal())
+	assert.Equal(t, []string{"8", "y"}, s1.Progress("db.a").LastPK)
+	assert.Equal(t, true, s1.Progress("db.a").Done)
+	assert.Equal(t, []string{"db.b"}, s1.Pending())
+
+	s.Advance("db.b", nil, 0, true)
+	assert.Equal(t, true, s.Done)
+	assert.Equal(t, "f1-100 done", s.String())
+
+	s.Start("f2", 4, "", nil)
+	assert.Equal(t, true, s.Done)
+}
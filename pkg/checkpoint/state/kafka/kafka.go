@@ -11,12 +11,13 @@ var (
 	_ checkpoint.State = &KafkaState{}
 )
 
+// KafkaState is the consuming state of a kafka partition.
 type KafkaState struct {
 	dsn  string
 	name string // who updates this state
 
 	PartitionID int32 `json:"pid"`
-	Offset      int64 `json:"offset"`
+	Offset      int64 `json:"offset"` // next offset to consume
 }
 
 // New creates a kafka state.
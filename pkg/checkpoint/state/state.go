@@ -3,6 +3,7 @@ package state
 import (
 	"errors"
 	"net/url"
+	"strings"
 
 	"github.com/funkygao/dbus/pkg/checkpoint"
 	"github.com/funkygao/dbus/pkg/checkpoint/state/binlog"
@@ -24,6 +25,22 @@ func Load(scheme string, rawDSN string, data []byte) (checkpoint.State, error) {
 	case checkpoint.SchemeBinlog:
 		s = binlog.New(dsn, "")
 
+	case checkpoint.SchemeBinlogGTID:
+		s = binlog.NewGTID(dsn, "")
+
+	case checkpoint.SchemeBinlogSchema:
+		s = binlog.NewSchema(dsn, "")
+
+	case checkpoint.SchemeBinlogTable:
+		// dsn#db.table
+		if i := strings.LastIndexByte(dsn, '#'); i > 0 {
+			dsn = dsn[:i]
+		}
+		s = binlog.NewTableSchema(dsn, "", "")
+
+	case checkpoint.SchemeBinlogSnap:
+		s = binlog.NewSnapshot(dsn, "")
+
 	default:
 		return nil, errors.New("invalid scheme")
 	}
@@ -19,3 +19,17 @@ func TestLoadKafka(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.Equal(t, "2-5", s.String())
 }
+
+func TestLoadBinlogGTID(t *testing.T) {
+	s, err := Load(checkpoint.SchemeBinlogGTID, "/dbus/checkpoint/myslave_gtid/12.12.1.2%3A3334", []byte(`{"file":"f1","offset":5,"gtid":"a0f36bb1-fdbb-11e5-8413-a0369f7c3bb4:1-5"}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "a0f36bb1-fdbb-11e5-8413-a0369f7c3bb4:1-5", s.String())
+	assert.Equal(t, checkpoint.SchemeBinlogGTID, s.Scheme())
+}
+
+func TestLoadBinlogSnapshot(t *testing.T) {
+	s, err := Load(checkpoint.SchemeBinlogSnap, "/dbus/checkpoint/myslave_snapshot/12.12.1.2%3A3334", []byte(`{"file":"f1","offset":5,"tables":{"db.t":{"rows":0,"done":false}},"done":false}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "f1-5 1/1 tables pending", s.String())
+	assert.Equal(t, checkpoint.SchemeBinlogSnap, s.Scheme())
+}
@@ -53,4 +53,7 @@ type Controller interface {
 
 	// RenounceResources declares the unrecognized resources.
 	RenounceResources([]Resource) error
+
+	// ReportLoads reports the actual load of the resources owned by the participant.
+	ReportLoads(ResourceLoads) error
 }
@@ -21,6 +21,18 @@ func (d Decision) Assign(p Participant, rs ...Resource) {
 	}
 }
 
+// RecoverDecision rebuilds the decision from the owners of resources, used when the last
+// decision is lost on leader failover. Orphan resources are excluded.
+func RecoverDecision(resources []Resource) Decision {
+	d := MakeDecision()
+	for _, r := range resources {
+		if !r.IsOrphan() {
+			d.Assign(Participant{Endpoint: r.State.Owner}, r)
+		}
+	}
+	return d
+}
+
 // Get returns all the assigned resources of a participant.
 func (d Decision) Get(p Participant) []Resource {
 	return d[p]
@@ -88,3 +100,24 @@ func (d Decision) Equals(that Decision) bool {
 
 	return true
 }
+
+// Moves returns the number of resources that are assigned to a different participant from the
+// previous decision. Participants are compared by endpoint, new resources are not counted.
+func (d Decision) Moves(prev Decision) int {
+	owners := make(map[string]string) // resource key:endpoint
+	for p, rs := range prev {
+		for _, r := range rs {
+			owners[r.key()] = p.Endpoint
+		}
+	}
+
+	n := 0
+	for p, rs := range d {
+		for _, r := range rs {
+			if owner, present := owners[r.key()]; present && owner != p.Endpoint {
+				n++
+			}
+		}
+	}
+	return n
+}
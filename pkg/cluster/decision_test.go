@@ -65,3 +65,31 @@ func TestDecisionEquals(t *testing.T) {
 	t.Logf("%+v", d1)
 	assert.Equal(t, false, d1.Equals(d2))
 }
+
+func TestDecisionMoves(t *testing.T) {
+	p1 := Participant{Endpoint: "p1"}
+	p2 := Participant{Endpoint: "p2", Weight: 100}
+	r1 := Resource{Name: "r1"}
+	r2 := Resource{Name: "r2"}
+	r3 := Resource{Name: "r3"}
+
+	prev := MakeDecision()
+	prev.Assign(p1, r1, r2)
+	d := MakeDecision()
+	d.Assign(p1, r1)
+	d.Assign(p2, r2, r3)
+	assert.Equal(t, 1, d.Moves(prev))
+	assert.Equal(t, 0, d.Moves(nil))
+	assert.Equal(t, 0, d.Moves(d))
+}
+
+func TestRecoverDecision(t *testing.T) {
+	r1 := Resource{Name: "r1", State: &ResourceState{Owner: "p1"}}
+	r2 := Resource{Name: "r2", State: NewResourceState()}
+	r2.State.BecomeOrphan()
+	r3 := Resource{Name: "r3"}
+
+	d := RecoverDecision([]Resource{r1, r2, r3})
+	assert.Equal(t, 1, len(d))
+	assert.Equal(t, 1, len(d[Participant{Endpoint: "p1"}]))
+}
@@ -5,5 +5,8 @@ import (
 )
 
 var (
-	ErrNoLeader = errors.New("no leader found")
+	ErrNoLeader        = errors.New("no leader found")
+	ErrInvalidStrategy = errors.New("invalid strategy")
+	ErrSkewNotWeighted = errors.New("load skew rebalance requires weighted strategy")
+	ErrUpdateConflict  = errors.New("too many concurrent updates")
 )
@@ -0,0 +1,47 @@
+package cluster
+
+import (
+	"sort"
+)
+
+// resourceGroup is the atomic unit of assignment: resources of the same non-zero Group,
+// or a single resource without group.
+type resourceGroup struct {
+	resources []Resource // sorted by name
+	cost      int
+}
+
+func (g *resourceGroup) name() string {
+	return g.resources[0].Name
+}
+
+func (g *resourceGroup) size() int {
+	return len(g.resources)
+}
+
+// groupResources returns the resource groups sorted by name.
+func groupResources(resources []Resource) []*resourceGroup {
+	sortedResources := make([]Resource, len(resources))
+	copy(sortedResources, resources)
+	sort.Sort(Resources(sortedResources))
+
+	var (
+		groups  []*resourceGroup
+		grouped = make(map[int]*resourceGroup)
+	)
+	for _, r := range sortedResources {
+		g, present := grouped[r.Group]
+		if !present {
+			g = &resourceGroup{}
+			groups = append(groups, g)
+			if r.Group != 0 {
+				grouped[r.Group] = g
+			}
+		}
+
+		g.resources = append(g.resources, r)
+		g.cost += resourceCost(r)
+	}
+
+	return groups
+}
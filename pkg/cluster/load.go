@@ -0,0 +1,135 @@
+package cluster
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+const (
+	// a cost unit is about 1K events/s or 1MB/s of a resource
+	costUnitEvents = 1000.
+	costUnitBytes  = 1 << 20
+
+	// lagging resource costs more to catch up
+	costLagThreshold = 60 // seconds
+	costLagFactor    = 2
+)
+
+// ResourceLoad is the actual load of a resource observed by its owner participant.
+type ResourceLoad struct {
+	EventsPerSecond float64 `json:"eps"`
+	BytesPerSecond  float64 `json:"bps"`
+	Lag             int64   `json:"lag"` // in seconds
+}
+
+// Cost converts the load into resource cost, which is at least 1.
+func (l ResourceLoad) Cost() int {
+	units := math.Max(l.EventsPerSecond/costUnitEvents, l.BytesPerSecond/costUnitBytes)
+	if l.Lag > costLagThreshold {
+		units *= costLagFactor
+	}
+
+	if cost := int(math.Ceil(units)); cost > 1 {
+		return cost
+	}
+	return 1
+}
+
+// ResourceLoads is the load report of a participant, keyed by resource name.
+type ResourceLoads map[string]ResourceLoad
+
+func (ls ResourceLoads) From(data []byte) {
+	json.Unmarshal(data, &ls)
+}
+
+func (ls ResourceLoads) Marshal() []byte {
+	b, _ := json.Marshal(ls)
+	return b
+}
+
+// LoadPolicy controls the load-driven rebalance of the leader.
+type LoadPolicy struct {
+	// Interval of load report and check, 0 to disable.
+	Interval time.Duration
+
+	// Skew of participant load to trigger rebalance, 0 to disable.
+	Skew float64
+
+	// Hysteresis to prevent flapping: after a triggered rebalance, skew has to drop below
+	// Skew-Hysteresis before next trigger.
+	Hysteresis float64
+
+	// Cooldown is the minimum interval between 2 triggered rebalances.
+	Cooldown time.Duration
+}
+
+// Validate checks the policy against the strategy: rebalance on load skew makes sense only if
+// the strategy is cost-aware, which currently is StrategyWeightedRoundRobin only.
+func (p LoadPolicy) Validate(strategy Strategy) error {
+	if p.Skew > 0 && strategy != StrategyWeightedRoundRobin {
+		return ErrSkewNotWeighted
+	}
+	return nil
+}
+
+// LoadSkew returns the skew of participants load in the decision: the max load per weight
+// divided by the cluster load per weight, 1 means perfectly balanced.
+// Resource cost is looked up in costs by name and falls back to Resource.Cost.
+func LoadSkew(d Decision, costs map[string]int) float64 {
+	var (
+		totalLoad, totalWeight int64
+		maxLoadPerWeight       float64
+	)
+	for p, rs := range d {
+		var load int64
+		for _, r := range rs {
+			cost, present := costs[r.Name]
+			if !present || cost < 1 {
+				cost = resourceCost(r)
+			}
+			load += int64(cost)
+		}
+
+		weight := int64(participantWeight(p))
+		totalLoad += load
+		totalWeight += weight
+		maxLoadPerWeight = math.Max(maxLoadPerWeight, float64(load)/float64(weight))
+	}
+
+	if totalLoad == 0 {
+		return 1
+	}
+	return maxLoadPerWeight / (float64(totalLoad) / float64(totalWeight))
+}
+
+// SkewTrigger decides when the participant load skew justifies a rebalance.
+type SkewTrigger struct {
+	policy LoadPolicy
+
+	armed       bool
+	lastTrigger time.Time
+}
+
+// NewSkewTrigger creates a SkewTrigger of the policy.
+func NewSkewTrigger(policy LoadPolicy) *SkewTrigger {
+	return &SkewTrigger{policy: policy, armed: true}
+}
+
+// Observe checks the skew at the time and returns true if a rebalance should be triggered.
+func (t *SkewTrigger) Observe(skew float64, now time.Time) bool {
+	if t.policy.Skew <= 0 {
+		return false
+	}
+
+	if skew < t.policy.Skew-t.policy.Hysteresis {
+		t.armed = true
+	}
+	if !t.armed || skew <= t.policy.Skew || now.Sub(t.lastTrigger) < t.policy.Cooldown {
+		return false
+	}
+
+	t.armed = false
+	t.lastTrigger = now
+	return true
+}
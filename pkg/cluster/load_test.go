@@ -0,0 +1,80 @@
+package cluster
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestResourceLoadCost(t *testing.T) {
+	assert.Equal(t, 1, ResourceLoad{}.Cost())
+	assert.Equal(t, 1, ResourceLoad{EventsPerSecond: 500}.Cost())
+	assert.Equal(t, 3, ResourceLoad{EventsPerSecond: 2500}.Cost())
+	assert.Equal(t, 4, ResourceLoad{EventsPerSecond: 100, BytesPerSecond: 4 << 20}.Cost())
+	assert.Equal(t, 5, ResourceLoad{EventsPerSecond: 2500, Lag: 120}.Cost())
+	assert.Equal(t, 3, ResourceLoad{EventsPerSecond: 2500, Lag: 60}.Cost())
+}
+
+func TestResourceLoadsMarshalAndFrom(t *testing.T) {
+	ls := ResourceLoads{"r1": {EventsPerSecond: 1.5, BytesPerSecond: 100, Lag: 3}}
+	assert.Equal(t, `{"r1":{"eps":1.5,"bps":100,"lag":3}}`, string(ls.Marshal()))
+
+	ls2 := make(ResourceLoads)
+	ls2.From(ls.Marshal())
+	assert.Equal(t, ls, ls2)
+}
+
+func TestLoadSkew(t *testing.T) {
+	p1 := Participant{Endpoint: "1", Weight: 100}
+	p2 := Participant{Endpoint: "2", Weight: 100}
+	p3 := Participant{Endpoint: "3", Weight: 200}
+
+	d := MakeDecision()
+	assert.Equal(t, 1., LoadSkew(d, nil))
+
+	d.Assign(p1, Resource{Name: "a"}, Resource{Name: "b"})
+	d.Assign(p2, Resource{Name: "c"}, Resource{Name: "d"})
+	assert.Equal(t, 1., LoadSkew(d, nil))
+
+	// p1: 4, p2: 2
+	if skew := LoadSkew(d, map[string]int{"a": 3}); math.Abs(skew-4./3) > 1e-9 {
+		t.Errorf("skew %v, expected 4/3", skew)
+	}
+
+	// p3 is idle: load per weight p1 2/100, cluster 4/400
+	d.Close(p3)
+	assert.Equal(t, 2., LoadSkew(d, nil))
+}
+
+func TestLoadPolicyValidate(t *testing.T) {
+	assert.Equal(t, nil, LoadPolicy{}.Validate(StrategySticky))
+	assert.Equal(t, nil, LoadPolicy{Skew: 1.5}.Validate(StrategyWeightedRoundRobin))
+	assert.Equal(t, ErrSkewNotWeighted, LoadPolicy{Skew: 1.5}.Validate(StrategyRoundRobin))
+	assert.Equal(t, ErrSkewNotWeighted, LoadPolicy{Skew: 1.5}.Validate(StrategySticky))
+}
+
+func TestSkewTrigger(t *testing.T) {
+	now := time.Now()
+	trigger := NewSkewTrigger(LoadPolicy{Skew: 1.5, Hysteresis: 0.2, Cooldown: time.Minute})
+	assert.Equal(t, false, trigger.Observe(1.2, now))
+	assert.Equal(t, false, trigger.Observe(1.5, now))
+	assert.Equal(t, true, trigger.Observe(1.6, now))
+
+	// disarmed till skew drops below 1.3
+	assert.Equal(t, false, trigger.Observe(2, now.Add(time.Hour)))
+	assert.Equal(t, false, trigger.Observe(1.4, now.Add(time.Hour)))
+	assert.Equal(t, false, trigger.Observe(1.6, now.Add(time.Hour)))
+	assert.Equal(t, false, trigger.Observe(1.2, now.Add(time.Hour)))
+	assert.Equal(t, true, trigger.Observe(1.6, now.Add(time.Hour)))
+
+	// cooldown
+	assert.Equal(t, false, trigger.Observe(1, now.Add(time.Hour+time.Second)))
+	assert.Equal(t, false, trigger.Observe(1.6, now.Add(time.Hour+time.Second)))
+	assert.Equal(t, true, trigger.Observe(1.6, now.Add(time.Hour+time.Minute)))
+
+	// disabled
+	trigger = NewSkewTrigger(LoadPolicy{})
+	assert.Equal(t, false, trigger.Observe(10, now))
+}
@@ -15,6 +15,9 @@ type Manager interface {
 	// UnregisterResource removes a resource.
 	UnregisterResource(resource Resource) error
 
+	// SetResourceGroup changes group of a registered resource, which takes effect on next rebalance.
+	SetResourceGroup(resource Resource, group int) error
+
 	// RegisteredResources returns all the registered resource in the cluster.
 	// The return map is in the form of {input: []resource}
 	RegisteredResources() ([]Resource, error)
@@ -4,7 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/http"
 	"strings"
+	"sync"
+
+	"github.com/funkygao/golib/version"
+	"github.com/funkygao/gorequest"
 )
 
 // State is state of a participant in a cluster.
@@ -96,3 +101,37 @@ func (ps Participants) Less(i, j int) bool {
 func (ps Participants) Swap(i, j int) {
 	ps[i], ps[j] = ps[j], ps[i]
 }
+
+// CallParticipants calls the API specified by the query string of each participant concurrently.
+func CallParticipants(ps []Participant, method string, q string) (err error) {
+	var wg sync.WaitGroup
+	for _, p := range ps {
+		wg.Add(1)
+
+		targetURI := fmt.Sprintf("%s/%s", p.APIEndpoint(), strings.TrimLeft(q, "/"))
+		go func(wg *sync.WaitGroup, p Participant, targetURI string) {
+			defer wg.Done()
+
+			r := gorequest.New()
+			switch strings.ToUpper(method) {
+			case "PUT":
+				r = r.Put(targetURI)
+			case "POST":
+				r = r.Post(targetURI)
+			case "GET":
+				r = r.Get(targetURI)
+			}
+
+			resp, _, errs := r.Set("User-Agent", fmt.Sprintf("dbus-%s", version.Revision)).End()
+			if len(errs) > 0 {
+				err = errs[0]
+			} else if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("%s %s", p, http.StatusText(resp.StatusCode))
+			}
+
+		}(&wg, p, targetURI)
+	}
+	wg.Wait()
+
+	return
+}
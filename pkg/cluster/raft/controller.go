@@ -0,0 +1,432 @@
+package raft
+
+import (
+	"sync"
+	"time"
+
+	"github.com/funkygao/dbus/pkg/cluster"
+	"github.com/funkygao/go-metrics"
+	"github.com/funkygao/golib/version"
+	log "github.com/funkygao/log4go"
+)
+
+var (
+	_ cluster.Controller = &controller{}
+	_ cluster.Manager    = &controller{}
+)
+
+// Config is the configuration of a raft cluster participant.
+type Config struct {
+	// Participant is the local participant, whose endpoint identifies the raft node.
+	Participant cluster.Participant
+
+	// Peers are all the raft nodes of the cluster including the local one,
+	// in the form of {participant endpoint: raft address}.
+	Peers map[string]string
+
+	Transport Transport
+	Storage   Storage
+
+	Strategy    cluster.Strategy
+	LoadPolicy  cluster.LoadPolicy
+	OnRebalance cluster.RebalanceCallback
+
+	// HeartbeatInterval of the raft leader, defaults to 100ms.
+	HeartbeatInterval time.Duration
+
+	// ElectionTimeout is randomized in [ElectionTimeout, 2*ElectionTimeout), defaults to 1s.
+	ElectionTimeout time.Duration
+
+	// SessionTimeout is how long the leader tolerates a silent participant before removing it
+	// from live participants, defaults to 10s.
+	SessionTimeout time.Duration
+}
+
+// controller is a participant in a cluster backed by the embedded raft group.
+// All cluster state lives in the replicated log, the raft leader is the controller leader.
+type controller struct {
+	participant    cluster.Participant
+	strategyFunc   cluster.StrategyFunc
+	loadPolicy     cluster.LoadPolicy
+	sessionTimeout time.Duration
+	proposeTimeout time.Duration
+
+	node *node
+	fsm  *fsm
+
+	// leader states, only written by the loop goroutine
+	mu           sync.RWMutex
+	leading      bool
+	epoch        int // raft term of the leader
+	lastDecision cluster.Decision
+
+	loadMu sync.Mutex
+	loads  map[string]cluster.ResourceLoads // reported to leader, keyed by participant endpoint
+	costs  map[string]int                   // observed resource cost by name, never replicated
+
+	changeC  chan struct{} // cluster changes that call for a rebalance
+	upgradeC chan struct{}
+	stopC    chan struct{}
+	wg       sync.WaitGroup
+
+	moves metrics.Histogram // resources moved per rebalance
+	skew  metrics.Gauge     // participants load skew in percentage
+
+	// only when participant is leader will this callback be triggered.
+	onRebalance cluster.RebalanceCallback
+}
+
+// NewController creates a Controller with embedded raft as underlying storage.
+// The returned Controller is also a Manager.
+func NewController(cfg Config) cluster.Controller {
+	if cfg.OnRebalance == nil {
+		panic("onRebalance nil not allowed")
+	}
+	if !cfg.Participant.Valid() {
+		panic("invalid participant")
+	}
+	if _, present := cfg.Peers[cfg.Participant.Endpoint]; !present {
+		panic("participant not in raft peers")
+	}
+	if cfg.Transport == nil || cfg.Storage == nil {
+		panic("raft transport and storage required")
+	}
+	strategyFunc := cluster.GetStrategyFunc(cfg.Strategy)
+	if strategyFunc == nil {
+		panic("strategy not implemented")
+	}
+
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = time.Millisecond * 100
+	}
+	if cfg.ElectionTimeout <= 0 {
+		cfg.ElectionTimeout = time.Second
+	}
+	if cfg.SessionTimeout <= 0 {
+		cfg.SessionTimeout = time.Second * 10
+	}
+
+	c := &controller{
+		participant:    cfg.Participant,
+		strategyFunc:   strategyFunc,
+		loadPolicy:     cfg.LoadPolicy,
+		onRebalance:    cfg.OnRebalance,
+		sessionTimeout: cfg.SessionTimeout,
+		proposeTimeout: cfg.ElectionTimeout * 5,
+		fsm:            newFSM(),
+		loads:          make(map[string]cluster.ResourceLoads),
+		costs:          make(map[string]int),
+		changeC:        make(chan struct{}, 1),
+		upgradeC:       make(chan struct{}, 1),
+		stopC:          make(chan struct{}),
+		moves: metrics.GetOrRegisterHistogram("dbus.cluster.rebalance.moves", metrics.DefaultRegistry,
+			metrics.NewUniformSample(1028)),
+		skew: metrics.GetOrRegisterGauge("dbus.cluster.load.skew", metrics.DefaultRegistry),
+	}
+	c.node = newNode(cfg.Participant.Endpoint, cfg.Peers, cfg.Storage, cfg.Transport,
+		cfg.HeartbeatInterval, cfg.ElectionTimeout)
+	c.node.apply = c.apply
+	c.node.forwardHandler = c.handleForward
+	return c
+}
+
+func (c *controller) Start() (err error) {
+	if err = c.node.start(); err != nil {
+		return
+	}
+
+	c.wg.Add(1)
+	go c.loop()
+
+	// there might be no leader yet, keepAlive will retry
+	c.keepAlive()
+	return
+}
+
+func (c *controller) Stop() (err error) {
+	close(c.stopC)
+	c.wg.Wait()
+
+	if err := c.submit(&command{Op: opLeave, Endpoint: c.participant.Endpoint}); err != nil {
+		log.Warn("[%s] leave: %v", c.participant, err)
+	}
+	c.node.stop()
+
+	log.Info("[%s] controller stopped", c.participant)
+	return
+}
+
+func (c *controller) loop() {
+	defer c.wg.Done()
+
+	keepalive := time.NewTicker(c.sessionTimeout / 3)
+	defer keepalive.Stop()
+
+	var loadTick <-chan time.Time
+	if c.loadPolicy.Interval > 0 {
+		t := time.NewTicker(c.loadPolicy.Interval)
+		defer t.Stop()
+		loadTick = t.C
+	}
+	trigger := cluster.NewSkewTrigger(c.loadPolicy)
+
+	for {
+		select {
+		case <-c.node.leaderC:
+			if c.onLeadershipChange() {
+				trigger = cluster.NewSkewTrigger(c.loadPolicy)
+				log.Trace("[%s] become controller leader and trigger rebalance!", c.participant)
+				c.doRebalance()
+			}
+
+		case <-c.changeC:
+			c.doRebalance()
+
+		case <-keepalive.C:
+			c.keepAlive()
+			c.expireParticipants()
+
+		case <-loadTick:
+			if c.checkLoads(trigger) {
+				log.Trace("[%s] participants load skewed, trigger rebalance", c.participant)
+				c.doRebalance()
+			}
+
+		case <-c.stopC:
+			return
+		}
+	}
+}
+
+// onLeadershipChange syncs the leader states with raft and returns true if becoming leader.
+func (c *controller) onLeadershipChange() bool {
+	leading, term := c.node.leadership()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if leading && c.leading && c.epoch == int(term) {
+		return false
+	}
+
+	c.leading = leading
+	c.lastDecision = nil
+	c.epoch = 0
+	if !leading {
+		log.Trace("[%s] resigned as leader", c.participant)
+		return false
+	}
+
+	c.epoch = int(term)
+	c.loadMu.Lock()
+	c.loads = make(map[string]cluster.ResourceLoads)
+	c.costs = make(map[string]int)
+	c.loadMu.Unlock()
+	return true
+}
+
+// apply applies a committed log entry to the cluster state.
+func (c *controller) apply(e Entry) error {
+	cmd := &command{}
+	if err := cmd.From(e.Data); err != nil {
+		log.Critical("[%s] log#%d: %v", c.participant, e.Index, err)
+		return ErrCorruptedLogEntry
+	}
+
+	rebalance, err := c.fsm.apply(cmd)
+	if rebalance {
+		select {
+		case c.changeC <- struct{}{}:
+		default:
+		}
+	}
+
+	// upgrade triggered before the participant starts has already taken effect
+	if cmd.Op == opUpgrade && e.Index > c.node.bootIndex && cmd.Revision != version.Revision {
+		select {
+		case c.upgradeC <- struct{}{}:
+		default:
+		}
+	}
+
+	return err
+}
+
+// submit handles the command on leader, or forwards it to the leader.
+func (c *controller) submit(cmd *command) error {
+	if leading, _ := c.node.leadership(); leading {
+		return c.handle(cmd)
+	}
+
+	return c.node.forward(cmd.Marshal())
+}
+
+func (c *controller) handleForward(data []byte) error {
+	if leading, _ := c.node.leadership(); !leading {
+		return ErrNotLeader
+	}
+
+	cmd := &command{}
+	if err := cmd.From(data); err != nil {
+		return ErrInvalidCommand
+	}
+
+	return c.handle(cmd)
+}
+
+func (c *controller) handle(cmd *command) error {
+	if cmd.Op == opLoads {
+		// loads change too often to be replicated, and are useless to a new leader
+		c.loadMu.Lock()
+		c.loads[cmd.Endpoint] = cmd.Loads
+		c.loadMu.Unlock()
+		return nil
+	}
+
+	return c.node.propose(cmd.Marshal(), c.proposeTimeout)
+}
+
+// keepAlive joins the cluster if the participant is not live, e,g. on startup or after
+// expired by the leader.
+func (c *controller) keepAlive() {
+	if p, present := c.fsm.participant(c.participant.Endpoint); present && p == c.participant {
+		return
+	}
+
+	if err := c.submit(&command{Op: opJoin, Participant: &c.participant}); err != nil {
+		log.Debug("[%s] join: %v", c.participant, err)
+		return
+	}
+
+	log.Trace("[%s] joined cluster", c.participant)
+}
+
+// expireParticipants removes the live participants that leader has not heard from for long.
+func (c *controller) expireParticipants() {
+	if leading, _ := c.node.leadership(); !leading {
+		return
+	}
+
+	for _, p := range c.fsm.liveParticipants() {
+		if time.Since(c.node.contacted(p.Endpoint)) < c.sessionTimeout {
+			continue
+		}
+
+		log.Warn("[%s] participant %s session expired", c.participant, p)
+		if err := c.handle(&command{Op: opLeave, Endpoint: p.Endpoint}); err != nil {
+			log.Error("[%s] expire %s: %v", c.participant, p, err)
+		}
+	}
+}
+
+// rebalance happens on controller leader when:
+// 1. participants change
+// 2. resources change
+// 3. becoming leader
+// 4. participants load skewed
+// rebalance runs sequentially in the loop goroutine
+func (c *controller) doRebalance() {
+	if leading, term := c.node.leadership(); !leading || int(term) != c.epoch {
+		return
+	}
+
+	liveParticipants := c.fsm.liveParticipants()
+	if len(liveParticipants) == 0 {
+		log.Critical("[%s] no live participants found", c.participant)
+		return
+	}
+
+	resources := c.fsm.registeredResources()
+	c.loadMu.Lock()
+	for i, r := range resources {
+		if cost, present := c.costs[r.Name]; present {
+			resources[i].Cost = cost
+		}
+	}
+	c.loadMu.Unlock()
+
+	lastDecision := c.lastDecision
+	if lastDecision == nil {
+		// just became leader: the last decision is persisted in resource states
+		lastDecision = cluster.RecoverDecision(resources)
+	}
+
+	newDecision := c.strategyFunc(liveParticipants, resources, lastDecision)
+	if newDecision.Equals(c.lastDecision) {
+		log.Trace("[%s] decision stay unchanged, quit rebalance", c.participant)
+		return
+	}
+
+	moves := newDecision.Moves(lastDecision)
+	c.moves.Update(int64(moves))
+	log.Trace("[%s] %d resources moved", c.participant, moves)
+
+	assignment := make(map[string][]string, len(newDecision))
+	for participant, resources := range newDecision {
+		for _, resource := range resources {
+			assignment[participant.Endpoint] = append(assignment[participant.Endpoint], resource.Name)
+		}
+	}
+
+	// WAL: the decision must survive leader failover before participants act on it
+	cmd := &command{Op: opAssign, Epoch: c.epoch, Assignment: assignment}
+	if err := c.node.propose(cmd.Marshal(), c.proposeTimeout); err != nil {
+		log.Critical("[%s] %v", c.participant, err)
+		return
+	}
+
+	c.mu.Lock()
+	c.lastDecision = newDecision
+	c.mu.Unlock()
+
+	c.onRebalance(c.epoch, newDecision)
+}
+
+// checkLoads recomputes resource cost from the load reported by its owner, which takes effect
+// on next rebalance, then returns true if the participants load skew calls for a rebalance.
+//
+// Cost changes too often to be replicated: it is kept by the leader only, and a new leader
+// rebalances with the registered cost until the loads are reported again.
+func (c *controller) checkLoads(trigger *cluster.SkewTrigger) bool {
+	if leading, _ := c.node.leadership(); !leading || c.lastDecision == nil {
+		return false
+	}
+
+	costs := make(map[string]int)
+	c.loadMu.Lock()
+	for p, rs := range c.lastDecision {
+		for _, r := range rs {
+			// the report of the former owner is stale
+			load, present := c.loads[p.Endpoint][r.Name]
+			if !present {
+				continue
+			}
+
+			costs[r.Name] = load.Cost()
+			c.costs[r.Name] = costs[r.Name]
+		}
+	}
+	c.loadMu.Unlock()
+
+	skew := cluster.LoadSkew(c.lastDecision, costs)
+	c.skew.Update(int64(skew * 100))
+	log.Debug("[%s] participants load skew %.2f", c.participant, skew)
+	return trigger.Observe(skew, time.Now())
+}
+
+func (c *controller) Upgrade() <-chan struct{} {
+	return c.upgradeC
+}
+
+func (c *controller) RenounceResources(rs []cluster.Resource) error {
+	names := make([]string, 0, len(rs))
+	for _, r := range rs {
+		names = append(names, r.Name)
+	}
+
+	return c.submit(&command{Op: opRenounce, Names: names})
+}
+
+func (c *controller) ReportLoads(loads cluster.ResourceLoads) error {
+	return c.submit(&command{Op: opLoads, Endpoint: c.participant.Endpoint, Loads: loads})
+}
@@ -0,0 +1,265 @@
+package raft
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/pkg/cluster"
+)
+
+type testParticipant struct {
+	cluster.Controller
+	cluster.Manager
+
+	mu        sync.Mutex
+	epoch     int
+	decisions []cluster.Decision
+}
+
+func (tp *testParticipant) onRebalance(epoch int, decision cluster.Decision) {
+	tp.mu.Lock()
+	tp.epoch = epoch
+	tp.decisions = append(tp.decisions, decision)
+	tp.mu.Unlock()
+}
+
+func (tp *testParticipant) lastDecision() (int, cluster.Decision) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	if len(tp.decisions) == 0 {
+		return 0, nil
+	}
+	return tp.epoch, tp.decisions[len(tp.decisions)-1]
+}
+
+// assigned returns number of participants with resources and total resources in the decision.
+func assigned(d cluster.Decision) (participants, resources int) {
+	for _, rs := range d {
+		if len(rs) > 0 {
+			participants++
+			resources += len(rs)
+		}
+	}
+	return
+}
+
+// latestDecision returns the decision made by the latest leader.
+func latestDecision(tps []*testParticipant) (decision cluster.Decision) {
+	var latest int
+	for _, tp := range tps {
+		if epoch, d := tp.lastDecision(); epoch > latest {
+			latest, decision = epoch, d
+		}
+	}
+	return
+}
+
+func startTestParticipants(t *testing.T, network *InmemNetwork, n int) []*testParticipant {
+	peers := make(map[string]string)
+	for i := 1; i <= n; i++ {
+		endpoint := fmt.Sprintf("127.0.0.1:%d", 10000+i)
+		peers[endpoint] = endpoint
+	}
+
+	var tps []*testParticipant
+	for endpoint := range peers {
+		tp := &testParticipant{}
+		c := NewController(Config{
+			Participant:       cluster.Participant{Endpoint: endpoint, Weight: 100, State: cluster.StateOnline},
+			Peers:             peers,
+			Transport:         network.Transport(endpoint),
+			Storage:           NewMemoryStorage(),
+			Strategy:          cluster.StrategyRoundRobin,
+			OnRebalance:       tp.onRebalance,
+			HeartbeatInterval: testHeartbeat,
+			ElectionTimeout:   testElection,
+			SessionTimeout:    testElection * 4,
+		})
+		tp.Controller, tp.Manager = c, c.(cluster.Manager)
+		if err := c.Start(); err != nil {
+			t.Fatal(err)
+		}
+		tps = append(tps, tp)
+	}
+	return tps
+}
+
+func leaderOf(t *testing.T, tps []*testParticipant) (leader *testParticipant) {
+	waitFor(t, "controller leader", func() bool {
+		leader = nil
+		for _, tp := range tps {
+			if tp.CurrentDecision() != nil {
+				leader = tp
+			}
+		}
+		return leader != nil
+	})
+	return
+}
+
+func TestControllerRebalance(t *testing.T) {
+	network := NewInmemNetwork()
+	tps := startTestParticipants(t, network, 3)
+
+	waitFor(t, "participants join", func() bool {
+		ps, _ := tps[0].LiveParticipants()
+		return len(ps) == 3
+	})
+
+	leader := leaderOf(t, tps)
+	var follower *testParticipant
+	for _, tp := range tps {
+		if tp != leader {
+			follower = tp
+		}
+	}
+	p, err := follower.Leader()
+	assert.Equal(t, nil, err)
+	_, leaderEpoch := leader.Controller.(*controller).node.leadership()
+	assert.Equal(t, leader.Controller.(*controller).participant, p)
+
+	// changes via follower are forwarded to leader
+	for i := 1; i <= 4; i++ {
+		assert.Equal(t, nil, follower.RegisterResource(cluster.Resource{InputPlugin: "in", Name: fmt.Sprintf("r%d", i)}))
+	}
+	assert.Equal(t, ErrResourceExists, follower.RegisterResource(cluster.Resource{InputPlugin: "in", Name: "r1"}))
+
+	waitFor(t, "rebalance", func() bool {
+		_, d := leader.lastDecision()
+		np, nr := assigned(d)
+		return np == 3 && nr == 4
+	})
+	epoch, _ := leader.lastDecision()
+	assert.Equal(t, int(leaderEpoch), epoch)
+
+	// the decision is replicated to followers
+	waitFor(t, "resource states replicated", func() bool {
+		rs, _ := follower.RegisteredResources()
+		for _, r := range rs {
+			if r.IsOrphan() {
+				return false
+			}
+		}
+		return len(rs) == 4
+	})
+
+	// a participant dies
+	var dead *testParticipant
+	for _, tp := range tps {
+		if tp != leader && tp != follower {
+			dead = tp
+		}
+	}
+	deadEndpoint := dead.Controller.(*controller).participant.Endpoint
+	network.Disconnect(deadEndpoint)
+
+	waitFor(t, "rebalance after participant dies", func() bool {
+		_, d := leader.lastDecision()
+		np, nr := assigned(d)
+		return np == 2 && nr == 4
+	})
+	ps, _ := leader.LiveParticipants()
+	assert.Equal(t, 2, len(ps))
+	_, d := leader.lastDecision()
+	for p := range d {
+		if p.Endpoint == deadEndpoint {
+			t.Fatalf("dead participant %s in decision", deadEndpoint)
+		}
+	}
+
+	// it comes back and joins again, leader might change due to its higher term
+	network.Reconnect(deadEndpoint)
+	waitFor(t, "rebalance after participant recovers", func() bool {
+		np, nr := assigned(latestDecision(tps))
+		return np == 3 && nr == 4
+	})
+
+	assert.Equal(t, nil, follower.UnregisterResource(cluster.Resource{Name: "r4"}))
+	assert.Equal(t, ErrResourceNotFound, follower.UnregisterResource(cluster.Resource{Name: "r4"}))
+	waitFor(t, "rebalance after resource removed", func() bool {
+		_, nr := assigned(latestDecision(tps))
+		return nr == 3
+	})
+
+	for _, tp := range tps {
+		assert.Equal(t, nil, tp.Stop())
+	}
+}
+
+func TestControllerFailover(t *testing.T) {
+	network := NewInmemNetwork()
+	tps := startTestParticipants(t, network, 3)
+	defer func() {
+		for _, tp := range tps {
+			tp.Stop()
+		}
+	}()
+
+	leader := leaderOf(t, tps)
+	for i := 1; i <= 3; i++ {
+		for leader.RegisterResource(cluster.Resource{InputPlugin: "in", Name: fmt.Sprintf("r%d", i)}) != nil {
+			time.Sleep(testHeartbeat)
+		}
+	}
+	waitFor(t, "rebalance", func() bool {
+		_, d := leader.lastDecision()
+		_, nr := assigned(d)
+		return nr == 3
+	})
+	oldEpoch, _ := leader.lastDecision()
+
+	network.Disconnect(leader.Controller.(*controller).participant.Endpoint)
+
+	var newLeader *testParticipant
+	waitFor(t, "new leader rebalance", func() bool {
+		for _, tp := range tps {
+			if tp == leader {
+				continue
+			}
+			if epoch, d := tp.lastDecision(); epoch > oldEpoch {
+				np, nr := assigned(d)
+				newLeader = tp
+				return np == 2 && nr == 3
+			}
+		}
+		return false
+	})
+
+	// the old leader has been removed from live participants
+	ps, _ := newLeader.LiveParticipants()
+	assert.Equal(t, 2, len(ps))
+}
+
+func TestControllerLoads(t *testing.T) {
+	tps := startTestParticipants(t, NewInmemNetwork(), 1)
+	defer tps[0].Stop()
+
+	leader := leaderOf(t, tps)
+	assert.Equal(t, nil, leader.RegisterResource(cluster.Resource{InputPlugin: "in", Name: "r1"}))
+	waitFor(t, "rebalance", func() bool {
+		_, d := leader.lastDecision()
+		_, nr := assigned(d)
+		return nr == 1
+	})
+
+	c := leader.Controller.(*controller)
+	assert.Equal(t, nil, c.ReportLoads(cluster.ResourceLoads{"r1": {EventsPerSecond: 5000}}))
+	c.node.mu.Lock()
+	lastIndex := c.node.lastIndex()
+	c.node.mu.Unlock()
+
+	// cost is kept by the leader and never replicated
+	c.checkLoads(cluster.NewSkewTrigger(cluster.LoadPolicy{}))
+	c.loadMu.Lock()
+	assert.Equal(t, 5, c.costs["r1"])
+	c.loadMu.Unlock()
+	c.node.mu.Lock()
+	assert.Equal(t, lastIndex, c.node.lastIndex())
+	c.node.mu.Unlock()
+	rs, _ := leader.RegisteredResources()
+	assert.Equal(t, 0, rs[0].Cost)
+}
@@ -1,2 +1,19 @@
 // Package raft implements cluster via Raft protocol.
+//
+// The participants of a cluster form a raft group embedded in dbusd, so that a small cluster
+// is coordinated without external zookeeper. The raft leader is the controller leader, and all cluster
+// state(live participants, resources, decision) is a state machine built from the replicated log.
+//
+// Changes made on a follower are forwarded to the leader, while reads are served by the local
+// replica, which might lag behind the leader for a heartbeat.
+//
+// A participant is live once its join is committed, and it is removed by the leader if the leader
+// has not heard from it for SessionTimeout.
+//
+// Limitations:
+//   - raft group membership is static: all peers are configured upfront
+//   - log is never compacted: it only grows on membership, resource and assignment changes, which
+//     are rare, while resource loads and costs are kept by the leader only
+//   - checkpoint of Input plugins is not managed by the cluster: MysqlbinlogInput and KafkaInput
+//     still keep them in zookeeper
 package raft
@@ -0,0 +1,30 @@
+package raft
+
+import (
+	"errors"
+)
+
+var (
+	ErrNotLeader         = errors.New("not leader")
+	ErrLeadershipLost    = errors.New("leadership lost")
+	ErrTimeout           = errors.New("timeout")
+	ErrStopped           = errors.New("raft stopped")
+	ErrUnreachable       = errors.New("peer unreachable")
+	ErrResourceExists    = errors.New("resource already exists")
+	ErrResourceNotFound  = errors.New("resource not found")
+	ErrInvalidCommand    = errors.New("invalid command")
+	ErrCorruptedLogEntry = errors.New("corrupted log entry")
+)
+
+// remoteError restores the error returned by a remote node from its text, so that callers
+// can compare it with the predefined errors.
+func remoteError(text string) error {
+	for _, err := range []error{ErrNotLeader, ErrLeadershipLost, ErrTimeout, ErrStopped,
+		ErrResourceExists, ErrResourceNotFound, ErrInvalidCommand} {
+		if err.Error() == text {
+			return err
+		}
+	}
+
+	return errors.New(text)
+}
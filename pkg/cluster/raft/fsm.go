@@ -0,0 +1,194 @@
+package raft
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/funkygao/dbus/pkg/cluster"
+)
+
+const (
+	opJoin       = "join"
+	opLeave      = "leave"
+	opRegister   = "register"
+	opUnregister = "unregister"
+	opGroup      = "group"
+	opAssign     = "assign"
+	opRenounce   = "renounce"
+	opUpgrade    = "upgrade"
+	opRebalance  = "rebalance"
+
+	// loads is only forwarded to the leader and never written to the log
+	opLoads = "loads"
+)
+
+// command is the cluster change replicated by the raft log.
+type command struct {
+	Op string `json:"op"`
+
+	Participant *cluster.Participant `json:"participant,omitempty"` // join
+	Endpoint    string               `json:"endpoint,omitempty"`    // leave, loads
+
+	Resource *cluster.Resource `json:"resource,omitempty"` // register, unregister, group
+	Names    []string          `json:"names,omitempty"`    // renounce
+	Group    int               `json:"group,omitempty"`
+
+	Epoch      int                 `json:"epoch,omitempty"`
+	Assignment map[string][]string `json:"assignment,omitempty"` // participant endpoint:resource names
+
+	Revision string                `json:"revision,omitempty"`
+	Loads    cluster.ResourceLoads `json:"loads,omitempty"`
+}
+
+func (c *command) Marshal() []byte {
+	b, _ := json.Marshal(c)
+	return b
+}
+
+func (c *command) From(data []byte) error {
+	return json.Unmarshal(data, c)
+}
+
+// fsm is the replicated cluster state built by applying the committed commands in order.
+type fsm struct {
+	mu sync.RWMutex
+
+	participants map[string]cluster.Participant   // endpoint:participant
+	resources    map[string]cluster.Resource      // name:resource
+	states       map[string]cluster.ResourceState // name:state, absent if not assigned
+	revision     string                           // the latest triggered upgrade
+}
+
+func newFSM() *fsm {
+	return &fsm{
+		participants: make(map[string]cluster.Participant),
+		resources:    make(map[string]cluster.Resource),
+		states:       make(map[string]cluster.ResourceState),
+	}
+}
+
+// apply applies the command and returns true if the change calls for a rebalance.
+func (f *fsm) apply(cmd *command) (rebalance bool, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch cmd.Op {
+	case opJoin:
+		if cmd.Participant == nil {
+			return false, ErrInvalidCommand
+		}
+		f.participants[cmd.Participant.Endpoint] = *cmd.Participant
+		return true, nil
+
+	case opLeave:
+		if _, present := f.participants[cmd.Endpoint]; !present {
+			return false, nil
+		}
+		delete(f.participants, cmd.Endpoint)
+		return true, nil
+
+	case opRegister:
+		if cmd.Resource == nil {
+			return false, ErrInvalidCommand
+		}
+		if _, present := f.resources[cmd.Resource.Name]; present {
+			return false, ErrResourceExists
+		}
+		r := *cmd.Resource
+		r.State = nil
+		f.resources[r.Name] = r
+		return true, nil
+
+	case opUnregister:
+		if cmd.Resource == nil {
+			return false, ErrInvalidCommand
+		}
+		if _, present := f.resources[cmd.Resource.Name]; !present {
+			return false, ErrResourceNotFound
+		}
+		delete(f.resources, cmd.Resource.Name)
+		delete(f.states, cmd.Resource.Name)
+		return true, nil
+
+	case opGroup:
+		if cmd.Resource == nil {
+			return false, ErrInvalidCommand
+		}
+		r, present := f.resources[cmd.Resource.Name]
+		if !present {
+			return false, ErrResourceNotFound
+		}
+		// takes effect on next rebalance
+		r.Group = cmd.Group
+		f.resources[r.Name] = r
+		return false, nil
+
+	case opAssign:
+		for endpoint, names := range cmd.Assignment {
+			for _, name := range names {
+				if _, present := f.resources[name]; present {
+					f.states[name] = cluster.ResourceState{LeaderEpoch: cmd.Epoch, Version: 1, Owner: endpoint}
+				}
+			}
+		}
+		return false, nil
+
+	case opRenounce:
+		for _, name := range cmd.Names {
+			delete(f.states, name)
+		}
+		return false, nil
+
+	case opUpgrade:
+		f.revision = cmd.Revision
+		return false, nil
+
+	case opRebalance:
+		return true, nil
+	}
+
+	return false, ErrInvalidCommand
+}
+
+func (f *fsm) liveParticipants() []cluster.Participant {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	r := make([]cluster.Participant, 0, len(f.participants))
+	for _, p := range f.participants {
+		r = append(r, p)
+	}
+	sort.Sort(cluster.Participants(r))
+	return r
+}
+
+func (f *fsm) participant(endpoint string) (cluster.Participant, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	p, present := f.participants[endpoint]
+	return p, present
+}
+
+// registeredResources returns the resources sorted by name, the owner of an unassigned
+// resource or of a resource whose owner has left is orphan.
+func (f *fsm) registeredResources() []cluster.Resource {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	r := make([]cluster.Resource, 0, len(f.resources))
+	for name, res := range f.resources {
+		res.State = cluster.NewResourceState()
+		res.State.BecomeOrphan()
+		if state, present := f.states[name]; present {
+			if _, alive := f.participants[state.Owner]; alive {
+				*res.State = state
+			}
+		}
+
+		r = append(r, res)
+	}
+	sort.Sort(cluster.Resources(r))
+	return r
+}
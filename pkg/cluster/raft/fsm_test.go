@@ -0,0 +1,84 @@
+package raft
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/pkg/cluster"
+)
+
+func TestCommandMarshal(t *testing.T) {
+	cmd := &command{Op: opRegister, Resource: &cluster.Resource{InputPlugin: "in", Name: "r1"}}
+	var cmd2 command
+	assert.Equal(t, nil, cmd2.From(cmd.Marshal()))
+	assert.Equal(t, *cmd, cmd2)
+}
+
+func TestFSMApply(t *testing.T) {
+	f := newFSM()
+	p1 := cluster.Participant{Endpoint: "1.1.1.1:9877", State: cluster.StateOnline}
+	p2 := cluster.Participant{Endpoint: "1.1.1.2:9877", State: cluster.StateOnline}
+	r1 := cluster.Resource{InputPlugin: "in", Name: "r1"}
+	r2 := cluster.Resource{InputPlugin: "in", Name: "r2"}
+
+	rebalance, err := f.apply(&command{Op: opJoin, Participant: &p2})
+	assert.Equal(t, true, rebalance)
+	assert.Equal(t, nil, err)
+	f.apply(&command{Op: opJoin, Participant: &p1})
+	assert.Equal(t, []cluster.Participant{p1, p2}, f.liveParticipants())
+
+	rebalance, err = f.apply(&command{Op: opRegister, Resource: &r1})
+	assert.Equal(t, true, rebalance)
+	assert.Equal(t, nil, err)
+	f.apply(&command{Op: opRegister, Resource: &r2})
+	_, err = f.apply(&command{Op: opRegister, Resource: &r1})
+	assert.Equal(t, ErrResourceExists, err)
+
+	// unassigned resources are orphan
+	rs := f.registeredResources()
+	assert.Equal(t, 2, len(rs))
+	assert.Equal(t, "r1", rs[0].Name)
+	assert.Equal(t, true, rs[0].IsOrphan())
+
+	rebalance, _ = f.apply(&command{Op: opAssign, Epoch: 3, Assignment: map[string][]string{
+		p1.Endpoint: {"r1"},
+		p2.Endpoint: {"r2", "r3"},
+	}})
+	assert.Equal(t, false, rebalance)
+	rs = f.registeredResources()
+	assert.Equal(t, cluster.ResourceState{LeaderEpoch: 3, Version: 1, Owner: p1.Endpoint}, *rs[0].State)
+	assert.Equal(t, p2.Endpoint, rs[1].State.Owner)
+	assert.Equal(t, 1, len(cluster.RecoverDecision(rs)[cluster.Participant{Endpoint: p2.Endpoint}]))
+
+	f.apply(&command{Op: opGroup, Resource: &r1, Group: 2})
+	rs = f.registeredResources()
+	assert.Equal(t, 2, rs[0].Group)
+
+	// resources of the left participant become orphan
+	rebalance, _ = f.apply(&command{Op: opLeave, Endpoint: p2.Endpoint})
+	assert.Equal(t, true, rebalance)
+	rs = f.registeredResources()
+	assert.Equal(t, false, rs[0].IsOrphan())
+	assert.Equal(t, true, rs[1].IsOrphan())
+	rebalance, _ = f.apply(&command{Op: opLeave, Endpoint: p2.Endpoint})
+	assert.Equal(t, false, rebalance)
+
+	f.apply(&command{Op: opRenounce, Names: []string{"r1"}})
+	assert.Equal(t, true, f.registeredResources()[0].IsOrphan())
+
+	_, err = f.apply(&command{Op: opUnregister, Resource: &r1})
+	assert.Equal(t, nil, err)
+	_, err = f.apply(&command{Op: opUnregister, Resource: &r1})
+	assert.Equal(t, ErrResourceNotFound, err)
+	_, err = f.apply(&command{Op: opGroup, Resource: &r1, Group: 1})
+	assert.Equal(t, ErrResourceNotFound, err)
+	assert.Equal(t, 1, len(f.registeredResources()))
+
+	rebalance, _ = f.apply(&command{Op: opRebalance})
+	assert.Equal(t, true, rebalance)
+
+	_, err = f.apply(&command{Op: "bad"})
+	assert.Equal(t, ErrInvalidCommand, err)
+	_, err = f.apply(&command{Op: opJoin})
+	assert.Equal(t, ErrInvalidCommand, err)
+}
@@ -0,0 +1,77 @@
+package raft
+
+import (
+	"github.com/funkygao/dbus/pkg/cluster"
+	"github.com/funkygao/golib/version"
+)
+
+// Manager reads the local replica of cluster state, which might lag behind the leader for
+// a heartbeat, while changes are always made through the leader.
+
+func (c *controller) Open() error {
+	return nil
+}
+
+func (c *controller) Close() {}
+
+func (c *controller) TriggerUpgrade() error {
+	return c.submit(&command{Op: opUpgrade, Revision: version.Revision})
+}
+
+func (c *controller) CurrentDecision() cluster.Decision {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.leading {
+		return nil
+	}
+
+	return c.lastDecision
+}
+
+func (c *controller) RegisterResource(resource cluster.Resource) error {
+	return c.submit(&command{Op: opRegister, Resource: &resource})
+}
+
+func (c *controller) UnregisterResource(resource cluster.Resource) error {
+	return c.submit(&command{Op: opUnregister, Resource: &resource})
+}
+
+func (c *controller) SetResourceGroup(resource cluster.Resource, group int) error {
+	return c.submit(&command{Op: opGroup, Resource: &resource, Group: group})
+}
+
+func (c *controller) RegisteredResources() ([]cluster.Resource, error) {
+	return c.fsm.registeredResources(), nil
+}
+
+func (c *controller) Leader() (cluster.Participant, error) {
+	id := c.node.leader()
+	if len(id) == 0 {
+		return cluster.Participant{}, cluster.ErrNoLeader
+	}
+
+	if p, present := c.fsm.participant(id); present {
+		return p, nil
+	}
+
+	// leader has not joined yet
+	return cluster.Participant{Endpoint: id}, nil
+}
+
+func (c *controller) CallParticipants(method string, q string) error {
+	ps, err := c.LiveParticipants()
+	if err != nil {
+		return err
+	}
+
+	return cluster.CallParticipants(ps, method, q)
+}
+
+func (c *controller) LiveParticipants() ([]cluster.Participant, error) {
+	return c.fsm.liveParticipants(), nil
+}
+
+func (c *controller) Rebalance() error {
+	return c.submit(&command{Op: opRebalance})
+}
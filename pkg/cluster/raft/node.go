@@ -0,0 +1,681 @@
+package raft
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	log "github.com/funkygao/log4go"
+)
+
+var (
+	_ Handler = &node{}
+)
+
+// max number of entries in an AppendRequest
+const maxAppendEntries = 64
+
+type role int
+
+const (
+	follower role = iota
+	candidate
+	leader
+)
+
+var roleText = map[role]string{
+	follower:  "follower",
+	candidate: "candidate",
+	leader:    "leader",
+}
+
+func (r role) String() string {
+	return roleText[r]
+}
+
+// node is a member of the raft group.
+//
+// The log is kept in memory and persisted in Storage. Log compaction is not supported:
+// the log only grows on membership, resource and assignment changes, which are rare.
+//
+// State and log are persisted before the node acts on them: if Storage fails, the node
+// halts instead of breaking its promises on term, vote and log.
+type node struct {
+	id        string
+	peers     map[string]string // id:address of the other nodes
+	storage   Storage
+	transport Transport
+
+	heartbeatInterval time.Duration
+	electionTimeout   time.Duration
+
+	// applies committed entries to state machine, the error is returned to the proposer
+	apply func(e Entry) error
+
+	// handles the command forwarded by followers
+	forwardHandler func(cmd []byte) error
+
+	mu               sync.Mutex
+	role             role
+	term             uint64
+	votedFor         string
+	leaderID         string
+	log              []Entry // log[0] is a sentinel so that log[i].Index == i
+	commitIndex      uint64
+	lastApplied      uint64
+	bootIndex        uint64 // last log index when the node starts
+	electionDeadline time.Time
+	err              error // storage failure that halted the node
+
+	// leader states
+	nextIndex   map[string]uint64
+	matchIndex  map[string]uint64
+	lastContact map[string]time.Time
+	inflight    map[string]bool
+	readyIndex  uint64 // the first entry of the leader term
+	ready       bool   // leader has applied all entries of previous terms
+	waiters     map[uint64]*waiter
+
+	leaderC  chan struct{} // notified when leadership changes
+	applyC   chan struct{} // notified when commitIndex advances
+	stopC    chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+type waiter struct {
+	term uint64
+	done chan error
+}
+
+func newNode(id string, peers map[string]string, storage Storage, transport Transport,
+	heartbeatInterval, electionTimeout time.Duration) *node {
+	others := make(map[string]string, len(peers))
+	for peerID, addr := range peers {
+		if peerID != id {
+			others[peerID] = addr
+		}
+	}
+
+	return &node{
+		id:                id,
+		peers:             others,
+		storage:           storage,
+		transport:         transport,
+		heartbeatInterval: heartbeatInterval,
+		electionTimeout:   electionTimeout,
+		apply:             func(Entry) error { return nil },
+		forwardHandler:    func([]byte) error { return ErrNotLeader },
+		nextIndex:         make(map[string]uint64),
+		matchIndex:        make(map[string]uint64),
+		lastContact:       make(map[string]time.Time),
+		inflight:          make(map[string]bool),
+		waiters:           make(map[uint64]*waiter),
+		leaderC:           make(chan struct{}, 1),
+		applyC:            make(chan struct{}, 1),
+		stopC:             make(chan struct{}),
+	}
+}
+
+func (n *node) start() (err error) {
+	if n.term, n.votedFor, err = n.storage.State(); err != nil {
+		return
+	}
+
+	entries, err := n.storage.Entries()
+	if err != nil {
+		return
+	}
+	n.log = append([]Entry{{}}, entries...)
+	n.bootIndex = n.lastIndex()
+	n.resetElectionDeadline()
+
+	if err = n.transport.Serve(n); err != nil {
+		return
+	}
+
+	n.wg.Add(2)
+	go n.run()
+	go n.runApplier()
+
+	log.Trace("[%s] raft started with term %d and %d entries", n.id, n.term, len(entries))
+	return
+}
+
+func (n *node) stop() {
+	n.stopOnce.Do(func() { close(n.stopC) })
+	n.transport.Close()
+	n.wg.Wait()
+
+	n.mu.Lock()
+	n.role = follower
+	n.failWaiters(ErrStopped)
+	n.mu.Unlock()
+
+	log.Trace("[%s] raft stopped", n.id)
+}
+
+// leadership returns whether the node is a leader ready to serve, and the term.
+func (n *node) leadership() (bool, uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.role == leader && n.ready, n.term
+}
+
+func (n *node) leader() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leaderID
+}
+
+// contacted returns when the leader heard from the peer for the last time.
+func (n *node) contacted(id string) time.Time {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if id == n.id {
+		return time.Now()
+	}
+	return n.lastContact[id]
+}
+
+// propose appends the command to the log of the leader and waits until it is applied.
+func (n *node) propose(cmd []byte, timeout time.Duration) error {
+	n.mu.Lock()
+	if n.err != nil {
+		n.mu.Unlock()
+		return n.err
+	}
+	if n.role != leader {
+		n.mu.Unlock()
+		return ErrNotLeader
+	}
+
+	index, err := n.appendLocal(cmd)
+	if err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	w := &waiter{term: n.term, done: make(chan error, 1)}
+	n.waiters[index] = w
+	n.advanceCommit()
+	n.broadcastAppend()
+	n.mu.Unlock()
+
+	select {
+	case err := <-w.done:
+		return err
+
+	case <-time.After(timeout):
+		n.mu.Lock()
+		delete(n.waiters, index)
+		n.mu.Unlock()
+		return ErrTimeout
+
+	case <-n.stopC:
+		return ErrStopped
+	}
+}
+
+// forward sends the command to the leader.
+func (n *node) forward(cmd []byte) error {
+	n.mu.Lock()
+	addr, present := n.peers[n.leaderID]
+	n.mu.Unlock()
+
+	if !present {
+		return ErrNotLeader
+	}
+	return n.transport.Forward(addr, cmd)
+}
+
+func (n *node) run() {
+	defer n.wg.Done()
+
+	tick := time.NewTicker(n.heartbeatInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			n.tick()
+
+		case <-n.stopC:
+			return
+		}
+	}
+}
+
+func (n *node) tick() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.role != leader {
+		if time.Now().After(n.electionDeadline) {
+			n.startElection()
+		}
+		return
+	}
+
+	// a leader that cannot reach the majority might have been replaced
+	if !n.hasQuorumContact() {
+		log.Warn("[%s] lost contact with the majority, step down", n.id)
+		n.becomeFollower(n.term, "")
+		return
+	}
+
+	n.broadcastAppend()
+}
+
+func (n *node) hasQuorumContact() bool {
+	contacts := 1
+	for id := range n.peers {
+		if time.Since(n.lastContact[id]) < n.electionTimeout {
+			contacts++
+		}
+	}
+	return contacts >= n.quorum()
+}
+
+func (n *node) quorum() int {
+	return (len(n.peers)+1)/2 + 1
+}
+
+func (n *node) lastIndex() uint64 {
+	return uint64(len(n.log) - 1)
+}
+
+func (n *node) lastTerm() uint64 {
+	return n.log[len(n.log)-1].Term
+}
+
+// resetElectionDeadline randomizes the election timeout to avoid split votes.
+func (n *node) resetElectionDeadline() {
+	n.electionDeadline = time.Now().Add(n.electionTimeout + time.Duration(rand.Int63n(int64(n.electionTimeout))))
+}
+
+func (n *node) persistState() error {
+	if err := n.storage.SetState(n.term, n.votedFor); err != nil {
+		n.halt(err)
+		return err
+	}
+	return nil
+}
+
+// halt stops the node on storage failure: it steps down, rejects the pending proposals and
+// becomes unreachable, so that the leader expires its participant.
+func (n *node) halt(err error) {
+	if n.err != nil {
+		return
+	}
+
+	log.Critical("[%s] raft halted on storage failure: %v", n.id, err)
+	n.err = err
+	wasLeader := n.role == leader
+	n.role = follower
+	n.leaderID = ""
+	n.ready = false
+	n.failWaiters(err)
+	if wasLeader {
+		n.notifyLeadership()
+	}
+
+	n.stopOnce.Do(func() { close(n.stopC) })
+	// transport might be waiting for the handlers that are blocked on the lock
+	go n.transport.Close()
+}
+
+func (n *node) notifyLeadership() {
+	select {
+	case n.leaderC <- struct{}{}:
+	default:
+	}
+}
+
+func (n *node) notifyApply() {
+	select {
+	case n.applyC <- struct{}{}:
+	default:
+	}
+}
+
+func (n *node) failWaiters(err error) {
+	for index, w := range n.waiters {
+		w.done <- err
+		delete(n.waiters, index)
+	}
+}
+
+func (n *node) becomeFollower(term uint64, leaderID string) {
+	if term > n.term {
+		n.term, n.votedFor = term, ""
+		if n.persistState() != nil {
+			return
+		}
+	}
+
+	wasLeader := n.role == leader
+	n.role = follower
+	n.leaderID = leaderID
+	n.ready = false
+	n.resetElectionDeadline()
+
+	if wasLeader {
+		n.failWaiters(ErrLeadershipLost)
+		n.notifyLeadership()
+	}
+}
+
+func (n *node) startElection() {
+	n.role = candidate
+	n.term++
+	n.votedFor = n.id
+	n.leaderID = ""
+	if n.persistState() != nil {
+		return
+	}
+	n.resetElectionDeadline()
+
+	votes := 1
+	if votes >= n.quorum() {
+		n.becomeLeader()
+		return
+	}
+
+	req := &VoteRequest{
+		Term:         n.term,
+		CandidateID:  n.id,
+		LastLogIndex: n.lastIndex(),
+		LastLogTerm:  n.lastTerm(),
+	}
+	for _, addr := range n.peers {
+		go func(addr string) {
+			resp, err := n.transport.RequestVote(addr, req)
+			if err != nil {
+				return
+			}
+
+			n.mu.Lock()
+			defer n.mu.Unlock()
+
+			if resp.Term > n.term {
+				n.becomeFollower(resp.Term, "")
+				return
+			}
+			if n.role != candidate || n.term != req.Term || !resp.Granted {
+				return
+			}
+
+			if votes++; votes == n.quorum() {
+				n.becomeLeader()
+			}
+		}(addr)
+	}
+}
+
+func (n *node) becomeLeader() {
+	log.Trace("[%s] become raft leader of term %d", n.id, n.term)
+
+	n.role = leader
+	n.leaderID = n.id
+	n.ready = false
+	now := time.Now()
+	for id := range n.peers {
+		n.nextIndex[id] = n.lastIndex() + 1
+		n.matchIndex[id] = 0
+		n.lastContact[id] = now
+	}
+
+	// entries of previous terms are committed by an entry of the current term
+	var err error
+	if n.readyIndex, err = n.appendLocal(nil); err != nil {
+		return
+	}
+	n.advanceCommit()
+	n.broadcastAppend()
+}
+
+func (n *node) appendLocal(data []byte) (uint64, error) {
+	e := Entry{Term: n.term, Index: n.lastIndex() + 1, Data: data}
+	if err := n.storage.Append(e); err != nil {
+		n.halt(err)
+		return 0, err
+	}
+
+	n.log = append(n.log, e)
+	return e.Index, nil
+}
+
+func (n *node) broadcastAppend() {
+	for id := range n.peers {
+		if !n.inflight[id] {
+			n.inflight[id] = true
+			go n.replicate(id)
+		}
+	}
+}
+
+// replicate sends an AppendRequest to the peer and handles its response.
+func (n *node) replicate(id string) {
+	n.mu.Lock()
+	if n.role != leader {
+		n.inflight[id] = false
+		n.mu.Unlock()
+		return
+	}
+
+	next := n.nextIndex[id]
+	end := next + maxAppendEntries
+	if end > n.lastIndex()+1 {
+		end = n.lastIndex() + 1
+	}
+	req := &AppendRequest{
+		Term:         n.term,
+		LeaderID:     n.id,
+		PrevLogIndex: next - 1,
+		PrevLogTerm:  n.log[next-1].Term,
+		Entries:      append([]Entry(nil), n.log[next:end]...),
+		LeaderCommit: n.commitIndex,
+	}
+	addr := n.peers[id]
+	n.mu.Unlock()
+
+	resp, err := n.transport.AppendEntries(addr, req)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.inflight[id] = false
+	if err != nil {
+		return
+	}
+	if resp.Term > n.term {
+		n.becomeFollower(resp.Term, "")
+		return
+	}
+	if n.role != leader || n.term != req.Term {
+		return
+	}
+
+	n.lastContact[id] = time.Now()
+	if resp.Success {
+		if match := req.PrevLogIndex + uint64(len(req.Entries)); match > n.matchIndex[id] {
+			n.matchIndex[id] = match
+		}
+		n.nextIndex[id] = n.matchIndex[id] + 1
+		n.advanceCommit()
+	} else {
+		next = req.PrevLogIndex
+		if resp.LastIndex+1 < next {
+			next = resp.LastIndex + 1
+		}
+		if next < 1 {
+			next = 1
+		}
+		n.nextIndex[id] = next
+	}
+
+	// catch up without waiting for next heartbeat
+	if n.nextIndex[id] <= n.lastIndex() {
+		n.inflight[id] = true
+		go n.replicate(id)
+	}
+}
+
+// advanceCommit commits the entries of current term that are replicated on the majority.
+func (n *node) advanceCommit() {
+	for index := n.lastIndex(); index > n.commitIndex && n.log[index].Term == n.term; index-- {
+		replicas := 1
+		for id := range n.peers {
+			if n.matchIndex[id] >= index {
+				replicas++
+			}
+		}
+
+		if replicas >= n.quorum() {
+			n.commitIndex = index
+			n.notifyApply()
+			return
+		}
+	}
+}
+
+func (n *node) runApplier() {
+	defer n.wg.Done()
+
+	for {
+		select {
+		case <-n.applyC:
+		case <-n.stopC:
+			return
+		}
+
+		for {
+			n.mu.Lock()
+			if n.lastApplied >= n.commitIndex {
+				n.mu.Unlock()
+				break
+			}
+			n.lastApplied++
+			e := n.log[n.lastApplied]
+			n.mu.Unlock()
+
+			var err error
+			if e.Data != nil {
+				err = n.apply(e)
+			}
+
+			n.mu.Lock()
+			if w, present := n.waiters[e.Index]; present {
+				delete(n.waiters, e.Index)
+				if w.term != e.Term {
+					// overwritten by another leader
+					err = ErrLeadershipLost
+				}
+				w.done <- err
+			}
+			if n.role == leader && !n.ready && e.Index >= n.readyIndex {
+				n.ready = true
+				n.notifyLeadership()
+			}
+			n.mu.Unlock()
+		}
+	}
+}
+
+func (n *node) HandleVote(req *VoteRequest) *VoteResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.err == nil && req.Term > n.term {
+		n.becomeFollower(req.Term, "")
+	}
+
+	resp := &VoteResponse{Term: n.term}
+	if n.err != nil || req.Term < n.term {
+		return resp
+	}
+
+	upToDate := req.LastLogTerm > n.lastTerm() ||
+		(req.LastLogTerm == n.lastTerm() && req.LastLogIndex >= n.lastIndex())
+	if (n.votedFor == "" || n.votedFor == req.CandidateID) && upToDate {
+		n.votedFor = req.CandidateID
+		if n.persistState() != nil {
+			return resp
+		}
+		n.resetElectionDeadline()
+		resp.Granted = true
+	}
+
+	return resp
+}
+
+func (n *node) HandleAppend(req *AppendRequest) *AppendResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	resp := &AppendResponse{Term: n.term}
+	if n.err != nil || req.Term < n.term {
+		return resp
+	}
+
+	if req.Term > n.term || n.role != follower {
+		n.becomeFollower(req.Term, req.LeaderID)
+		if n.err != nil {
+			return resp
+		}
+	}
+	n.leaderID = req.LeaderID
+	n.resetElectionDeadline()
+	resp.Term = n.term
+
+	if req.PrevLogIndex > n.lastIndex() {
+		resp.LastIndex = n.lastIndex()
+		return resp
+	}
+	if n.log[req.PrevLogIndex].Term != req.PrevLogTerm {
+		resp.LastIndex = req.PrevLogIndex - 1
+		return resp
+	}
+
+	for i, e := range req.Entries {
+		if e.Index <= n.lastIndex() {
+			if n.log[e.Index].Term == e.Term {
+				continue
+			}
+
+			// conflicts with the leader, which never happens on committed entries
+			if err := n.storage.TruncateFrom(e.Index); err != nil {
+				n.halt(err)
+				return resp
+			}
+			n.log = n.log[:e.Index]
+		}
+
+		if err := n.storage.Append(req.Entries[i:]...); err != nil {
+			n.halt(err)
+			return resp
+		}
+		n.log = append(n.log, req.Entries[i:]...)
+		break
+	}
+
+	resp.Success = true
+	resp.LastIndex = n.lastIndex()
+	// only entries known to match the leader can be committed, and a stale request
+	// never moves commitIndex backwards
+	commit := req.LeaderCommit
+	if last := req.PrevLogIndex + uint64(len(req.Entries)); last < commit {
+		commit = last
+	}
+	if commit > n.commitIndex {
+		n.commitIndex = commit
+		n.notifyApply()
+	}
+
+	return resp
+}
+
+func (n *node) HandleForward(cmd []byte) error {
+	return n.forwardHandler(cmd)
+}
@@ -0,0 +1,317 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+const (
+	testHeartbeat = time.Millisecond * 10
+	testElection  = time.Millisecond * 50
+	testWait      = time.Second * 5
+)
+
+// waitFor polls the condition until it holds or times out.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(testWait)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+// testCluster is a raft group running in process.
+type testCluster struct {
+	t        *testing.T
+	network  *InmemNetwork
+	peers    map[string]string
+	storages map[string]*MemoryStorage
+	nodes    map[string]*node
+
+	mu      sync.Mutex
+	applied map[string][]string
+}
+
+func newTestCluster(t *testing.T, n int) *testCluster {
+	tc := &testCluster{
+		t:        t,
+		network:  NewInmemNetwork(),
+		peers:    make(map[string]string),
+		storages: make(map[string]*MemoryStorage),
+		nodes:    make(map[string]*node),
+		applied:  make(map[string][]string),
+	}
+	for i := 1; i <= n; i++ {
+		id := fmt.Sprintf("n%d", i)
+		tc.peers[id] = id
+		tc.storages[id] = NewMemoryStorage()
+	}
+	for id := range tc.peers {
+		tc.start(id)
+	}
+	return tc
+}
+
+func (tc *testCluster) start(id string) *node {
+	n := newNode(id, tc.peers, tc.storages[id], tc.network.Transport(id), testHeartbeat, testElection)
+	n.apply = func(e Entry) error {
+		tc.mu.Lock()
+		tc.applied[id] = append(tc.applied[id], string(e.Data))
+		tc.mu.Unlock()
+		return nil
+	}
+	n.forwardHandler = func(cmd []byte) error {
+		return n.propose(cmd, testWait)
+	}
+
+	tc.mu.Lock()
+	tc.applied[id] = nil
+	tc.mu.Unlock()
+
+	if err := n.start(); err != nil {
+		tc.t.Fatal(err)
+	}
+	tc.nodes[id] = n
+	return n
+}
+
+func (tc *testCluster) stop() {
+	for _, n := range tc.nodes {
+		n.stop()
+	}
+}
+
+func (tc *testCluster) appliedOf(id string) []string {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return append([]string(nil), tc.applied[id]...)
+}
+
+// leader waits for the only ready leader among the connected nodes.
+func (tc *testCluster) leader(excludes ...string) (l *node) {
+	waitFor(tc.t, "leader", func() bool {
+		l = nil
+		for id, n := range tc.nodes {
+			excluded := false
+			for _, ex := range excludes {
+				excluded = excluded || ex == id
+			}
+			if leading, _ := n.leadership(); leading && !excluded {
+				if l != nil {
+					return false
+				}
+				l = n
+			}
+		}
+		return l != nil
+	})
+	return
+}
+
+func (tc *testCluster) followers(l *node) (r []*node) {
+	for _, n := range tc.nodes {
+		if n != l {
+			r = append(r, n)
+		}
+	}
+	return
+}
+
+func TestNodeElectLeader(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	defer tc.stop()
+
+	l := tc.leader()
+	for _, f := range tc.followers(l) {
+		waitFor(t, "follower knows leader", func() bool { return f.leader() == l.id })
+		leading, _ := f.leadership()
+		assert.Equal(t, false, leading)
+	}
+}
+
+func TestNodeReplicate(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	defer tc.stop()
+
+	l := tc.leader()
+	assert.Equal(t, nil, l.propose([]byte("a"), testWait))
+	assert.Equal(t, nil, l.propose([]byte("b"), testWait))
+
+	for id := range tc.nodes {
+		waitFor(t, id+" applied", func() bool { return len(tc.appliedOf(id)) == 2 })
+		assert.Equal(t, []string{"a", "b"}, tc.appliedOf(id))
+	}
+}
+
+func TestNodeProposeOnFollower(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	defer tc.stop()
+
+	l := tc.leader()
+	f := tc.followers(l)[0]
+	assert.Equal(t, ErrNotLeader, f.propose([]byte("a"), testWait))
+
+	waitFor(t, "follower knows leader", func() bool { return f.leader() == l.id })
+	assert.Equal(t, nil, f.forward([]byte("a")))
+	waitFor(t, "applied", func() bool { return len(tc.appliedOf(f.id)) == 1 })
+	assert.Equal(t, []string{"a"}, tc.appliedOf(f.id))
+}
+
+func TestNodeFailover(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	defer tc.stop()
+
+	old := tc.leader()
+	_, oldTerm := old.leadership()
+	assert.Equal(t, nil, old.propose([]byte("a"), testWait))
+
+	tc.network.Disconnect(old.id)
+	l := tc.leader(old.id)
+	_, term := l.leadership()
+	if term <= oldTerm {
+		t.Fatalf("new term %d <= old term %d", term, oldTerm)
+	}
+
+	// the isolated leader cannot commit and steps down
+	if err := old.propose([]byte("lost"), testElection*4); err == nil {
+		t.Fatal("isolated leader committed")
+	}
+	waitFor(t, "old leader steps down", func() bool {
+		leading, _ := old.leadership()
+		return !leading
+	})
+
+	assert.Equal(t, nil, l.propose([]byte("b"), testWait))
+
+	tc.network.Reconnect(old.id)
+	waitFor(t, "old leader catches up", func() bool { return len(tc.appliedOf(old.id)) == 2 })
+	assert.Equal(t, []string{"a", "b"}, tc.appliedOf(old.id))
+	assert.Equal(t, l.id, tc.leader().id)
+}
+
+func TestNodeRestart(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	defer tc.stop()
+
+	l := tc.leader()
+	assert.Equal(t, nil, l.propose([]byte("a"), testWait))
+
+	f := tc.followers(l)[0]
+	waitFor(t, "applied", func() bool { return len(tc.appliedOf(f.id)) == 1 })
+	f.stop()
+
+	assert.Equal(t, nil, l.propose([]byte("b"), testWait))
+
+	// replays the retained log and catches up
+	f = tc.start(f.id)
+	waitFor(t, "restarted node catches up", func() bool { return len(tc.appliedOf(f.id)) == 2 })
+	assert.Equal(t, []string{"a", "b"}, tc.appliedOf(f.id))
+	assert.Equal(t, uint64(2), f.bootIndex) // the no-op of leader and "a"
+}
+
+func TestNodeSingle(t *testing.T) {
+	tc := newTestCluster(t, 1)
+	defer tc.stop()
+
+	l := tc.leader()
+	assert.Equal(t, nil, l.propose([]byte("a"), testWait))
+	assert.Equal(t, []string{"a"}, tc.appliedOf(l.id))
+}
+
+var errDiskFull = errors.New("disk full")
+
+// faultyStorage fails all the writes.
+type faultyStorage struct {
+	Storage
+}
+
+func (faultyStorage) SetState(uint64, string) error {
+	return errDiskFull
+}
+
+func (faultyStorage) Append(...Entry) error {
+	return errDiskFull
+}
+
+func (faultyStorage) TruncateFrom(uint64) error {
+	return errDiskFull
+}
+
+func (n *node) breakStorage() {
+	n.mu.Lock()
+	n.storage = faultyStorage{n.storage}
+	n.mu.Unlock()
+}
+
+func (n *node) halted() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.err
+}
+
+func TestNodeStorageFailure(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	defer tc.stop()
+
+	// leader halts instead of replicating the entry it cannot persist
+	l := tc.leader()
+	l.breakStorage()
+	assert.Equal(t, errDiskFull, l.propose([]byte("a"), testWait))
+	assert.Equal(t, errDiskFull, l.halted())
+	leading, _ := l.leadership()
+	assert.Equal(t, false, leading)
+	assert.Equal(t, errDiskFull, l.propose([]byte("a"), testWait))
+
+	l2 := tc.leader(l.id)
+	assert.Equal(t, nil, l2.propose([]byte("b"), testWait))
+
+	// follower halts on append, the leader loses the majority
+	var f *node
+	for _, n := range tc.followers(l2) {
+		if n != l {
+			f = n
+		}
+	}
+	waitFor(t, "applied", func() bool { return len(tc.appliedOf(f.id)) == 1 })
+	f.breakStorage()
+	if err := l2.propose([]byte("c"), testElection*4); err == nil {
+		t.Fatal("committed without majority")
+	}
+	assert.Equal(t, errDiskFull, f.halted())
+	assert.Equal(t, []string{"b"}, tc.appliedOf(f.id))
+	assert.Equal(t, 0, len(tc.appliedOf(l.id)))
+
+	// halted node rejects the requests
+	resp := f.HandleVote(&VoteRequest{Term: 100, CandidateID: l2.id, LastLogIndex: 100, LastLogTerm: 100})
+	assert.Equal(t, false, resp.Granted)
+}
+
+func TestNodeCommitIndexNeverBackwards(t *testing.T) {
+	network := NewInmemNetwork()
+	n := newNode("n1", map[string]string{"n1": "n1", "n2": "n2"}, NewMemoryStorage(), network.Transport("n1"),
+		testHeartbeat, testElection)
+	n.log = []Entry{{}}
+
+	entries := []Entry{{Index: 1, Term: 1}, {Index: 2, Term: 1}, {Index: 3, Term: 1}}
+	resp := n.HandleAppend(&AppendRequest{Term: 1, LeaderID: "n2", Entries: entries, LeaderCommit: 2})
+	assert.Equal(t, true, resp.Success)
+	assert.Equal(t, uint64(2), n.commitIndex)
+
+	// stale request delayed by the network
+	resp = n.HandleAppend(&AppendRequest{Term: 1, LeaderID: "n2", Entries: entries[:1], LeaderCommit: 3})
+	assert.Equal(t, true, resp.Success)
+	assert.Equal(t, uint64(2), n.commitIndex)
+	assert.Equal(t, uint64(3), n.lastIndex())
+
+	// commit only the entries known to match the leader
+	entries = append(entries, Entry{Index: 4, Term: 1}, Entry{Index: 5, Term: 1})
+	n.HandleAppend(&AppendRequest{Term: 1, LeaderID: "n2", PrevLogIndex: 3, PrevLogTerm: 1, Entries: entries[3:4], LeaderCommit: 5})
+	assert.Equal(t, uint64(4), n.commitIndex)
+}
@@ -0,0 +1,273 @@
+package raft
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	_ Storage = &MemoryStorage{}
+	_ Storage = &FileStorage{}
+)
+
+// Storage persists the raft state and log entries.
+type Storage interface {
+
+	// State returns the persisted current term and the voted candidate of the term.
+	State() (term uint64, votedFor string, err error)
+
+	// SetState persists current term and the voted candidate.
+	SetState(term uint64, votedFor string) error
+
+	// Entries returns all the log entries in order.
+	Entries() ([]Entry, error)
+
+	// Append appends log entries.
+	Append(entries ...Entry) error
+
+	// TruncateFrom deletes the log entries from the index on.
+	TruncateFrom(index uint64) error
+}
+
+// MemoryStorage is a Storage in memory, which survives node restart but not process restart.
+type MemoryStorage struct {
+	mu       sync.Mutex
+	term     uint64
+	votedFor string
+	entries  []Entry
+}
+
+// NewMemoryStorage creates a MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+func (s *MemoryStorage) State() (uint64, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.term, s.votedFor, nil
+}
+
+func (s *MemoryStorage) SetState(term uint64, votedFor string) error {
+	s.mu.Lock()
+	s.term, s.votedFor = term, votedFor
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStorage) Entries() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Entry(nil), s.entries...), nil
+}
+
+func (s *MemoryStorage) Append(entries ...Entry) error {
+	s.mu.Lock()
+	s.entries = append(s.entries, entries...)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStorage) TruncateFrom(index uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, e := range s.entries {
+		if e.Index >= index {
+			s.entries = s.entries[:i]
+			break
+		}
+	}
+	return nil
+}
+
+// FileStorage is a Storage in a directory: the state is a JSON file replaced atomically,
+// and the log is a JSON-lines file that is synced on each append.
+type FileStorage struct {
+	mu  sync.Mutex
+	dir string
+	log *os.File
+}
+
+// NewFileStorage creates a FileStorage in the directory.
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &FileStorage{dir: dir}
+	if err := s.openLog(); err != nil {
+		return nil, err
+	}
+
+	// drop the torn tail before appending to it
+	entries, torn, err := s.readEntries()
+	if err != nil {
+		return nil, err
+	}
+	if torn {
+		if err = s.rewriteLog(entries); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+type fileState struct {
+	Term     uint64 `json:"term"`
+	VotedFor string `json:"voted_for"`
+}
+
+func (s *FileStorage) statePath() string {
+	return filepath.Join(s.dir, "state")
+}
+
+func (s *FileStorage) logPath() string {
+	return filepath.Join(s.dir, "log")
+}
+
+func (s *FileStorage) openLog() (err error) {
+	s.log, err = os.OpenFile(s.logPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	return
+}
+
+func (s *FileStorage) State() (uint64, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := ioutil.ReadFile(s.statePath())
+	if os.IsNotExist(err) {
+		return 0, "", nil
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	var st fileState
+	if err = json.Unmarshal(b, &st); err != nil {
+		return 0, "", err
+	}
+	return st.Term, st.VotedFor, nil
+}
+
+func (s *FileStorage) SetState(term uint64, votedFor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, _ := json.Marshal(fileState{Term: term, VotedFor: votedFor})
+	return writeFileAtomic(s.statePath(), b)
+}
+
+func (s *FileStorage) Entries() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, _, err := s.readEntries()
+	return entries, err
+}
+
+// readEntries reads the log and tells whether its last line is torn.
+func (s *FileStorage) readEntries() (entries []Entry, torn bool, err error) {
+	f, err := os.Open(s.logPath())
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			// a partially written last line is discarded: it was never acknowledged
+			return entries, len(line) > 0, nil
+		}
+
+		var e Entry
+		if err = json.Unmarshal(line, &e); err != nil {
+			return nil, false, ErrCorruptedLogEntry
+		}
+		entries = append(entries, e)
+	}
+}
+
+func (s *FileStorage) Append(entries ...Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var buf []byte
+	for _, e := range entries {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, b...), '\n')
+	}
+
+	if _, err := s.log.Write(buf); err != nil {
+		return err
+	}
+	return s.log.Sync()
+}
+
+func (s *FileStorage) TruncateFrom(index uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, _, err := s.readEntries()
+	if err != nil {
+		return err
+	}
+
+	for i, e := range entries {
+		if e.Index >= index {
+			entries = entries[:i]
+			break
+		}
+	}
+	return s.rewriteLog(entries)
+}
+
+func (s *FileStorage) rewriteLog(entries []Entry) (err error) {
+	var buf []byte
+	for _, e := range entries {
+		b, _ := json.Marshal(e)
+		buf = append(append(buf, b...), '\n')
+	}
+
+	s.log.Close()
+	if err = writeFileAtomic(s.logPath(), buf); err != nil {
+		return
+	}
+	return s.openLog()
+}
+
+// Close closes the log file.
+func (s *FileStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.log.Close()
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
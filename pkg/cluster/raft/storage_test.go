@@ -0,0 +1,97 @@
+package raft
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func testStorage(t *testing.T, s Storage) {
+	term, votedFor, err := s.State()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(0), term)
+	assert.Equal(t, "", votedFor)
+
+	assert.Equal(t, nil, s.SetState(3, "n2"))
+	term, votedFor, _ = s.State()
+	assert.Equal(t, uint64(3), term)
+	assert.Equal(t, "n2", votedFor)
+
+	entries := []Entry{{Term: 1, Index: 1}, {Term: 1, Index: 2, Data: []byte("a")}, {Term: 2, Index: 3, Data: []byte("b")}}
+	assert.Equal(t, nil, s.Append(entries[:2]...))
+	assert.Equal(t, nil, s.Append(entries[2]))
+	got, err := s.Entries()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, entries, got)
+
+	assert.Equal(t, nil, s.TruncateFrom(2))
+	got, _ = s.Entries()
+	assert.Equal(t, entries[:1], got)
+
+	assert.Equal(t, nil, s.Append(Entry{Term: 3, Index: 2, Data: []byte("c")}))
+	got, _ = s.Entries()
+	assert.Equal(t, 2, len(got))
+	assert.Equal(t, "c", string(got[1].Data))
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, NewMemoryStorage())
+}
+
+func TestFileStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, s)
+	s.Close()
+
+	// reopen
+	s, err = NewFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	term, votedFor, _ := s.State()
+	assert.Equal(t, uint64(3), term)
+	assert.Equal(t, "n2", votedFor)
+	entries, _ := s.Entries()
+	assert.Equal(t, 2, len(entries))
+	s.Close()
+}
+
+func TestFileStorageTornTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := NewFileStorage(dir)
+	s.Append(Entry{Term: 1, Index: 1})
+	s.Close()
+
+	// crash in the middle of writing an entry
+	f, _ := os.OpenFile(filepath.Join(dir, "log"), os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"term":1,"ind`)
+	f.Close()
+
+	s, err = NewFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	assert.Equal(t, nil, s.Append(Entry{Term: 1, Index: 2}))
+	entries, err := s.Entries()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []Entry{{Term: 1, Index: 1}, {Term: 1, Index: 2}}, entries)
+}
@@ -0,0 +1,68 @@
+package raft
+
+// Entry is a raft log entry.
+type Entry struct {
+	Term  uint64 `json:"term"`
+	Index uint64 `json:"index"`
+	Data  []byte `json:"data,omitempty"` // nil for the no-op entry of a new leader
+}
+
+// VoteRequest is sent by candidate to gather votes.
+type VoteRequest struct {
+	Term         uint64 `json:"term"`
+	CandidateID  string `json:"candidate_id"`
+	LastLogIndex uint64 `json:"last_log_index"`
+	LastLogTerm  uint64 `json:"last_log_term"`
+}
+
+// VoteResponse is the response of VoteRequest.
+type VoteResponse struct {
+	Term    uint64 `json:"term"`
+	Granted bool   `json:"granted"`
+}
+
+// AppendRequest is sent by leader to replicate log entries, and used as heartbeat.
+type AppendRequest struct {
+	Term         uint64  `json:"term"`
+	LeaderID     string  `json:"leader_id"`
+	PrevLogIndex uint64  `json:"prev_log_index"`
+	PrevLogTerm  uint64  `json:"prev_log_term"`
+	Entries      []Entry `json:"entries,omitempty"`
+	LeaderCommit uint64  `json:"leader_commit"`
+}
+
+// AppendResponse is the response of AppendRequest.
+type AppendResponse struct {
+	Term    uint64 `json:"term"`
+	Success bool   `json:"success"`
+
+	// LastIndex is a hint of where the log of the follower diverges, so that leader
+	// can skip the mismatched entries at once.
+	LastIndex uint64 `json:"last_index"`
+}
+
+// Handler handles the raft requests on the receiving node.
+type Handler interface {
+	HandleVote(req *VoteRequest) *VoteResponse
+	HandleAppend(req *AppendRequest) *AppendResponse
+
+	// HandleForward handles the command forwarded from a follower to the leader.
+	HandleForward(cmd []byte) error
+}
+
+// Transport carries raft requests between nodes.
+type Transport interface {
+
+	// Serve starts serving the requests to the local node.
+	Serve(h Handler) error
+
+	// Close stops serving.
+	Close() error
+
+	RequestVote(addr string, req *VoteRequest) (*VoteResponse, error)
+
+	AppendEntries(addr string, req *AppendRequest) (*AppendResponse, error)
+
+	// Forward sends the command to the leader and waits for its result.
+	Forward(addr string, cmd []byte) error
+}
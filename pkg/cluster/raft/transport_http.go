@@ -0,0 +1,138 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+var (
+	_ Transport = &httpTransport{}
+)
+
+const maxHTTPBodyLen = 64 << 20
+
+type httpTransport struct {
+	addr   string
+	client *http.Client
+
+	listener net.Listener
+	server   *http.Server
+}
+
+// NewHTTPTransport creates a Transport that sends JSON encoded requests over HTTP and
+// serves on the listen address.
+func NewHTTPTransport(addr string, timeout time.Duration) Transport {
+	return &httpTransport{
+		addr:   addr,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (t *httpTransport) Serve(h Handler) (err error) {
+	if t.listener, err = net.Listen("tcp", t.addr); err != nil {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/raft/vote", func(w http.ResponseWriter, r *http.Request) {
+		var req VoteRequest
+		if decodeHTTPRequest(w, r, &req) {
+			json.NewEncoder(w).Encode(h.HandleVote(&req))
+		}
+	})
+	mux.HandleFunc("/raft/append", func(w http.ResponseWriter, r *http.Request) {
+		var req AppendRequest
+		if decodeHTTPRequest(w, r, &req) {
+			json.NewEncoder(w).Encode(h.HandleAppend(&req))
+		}
+	})
+	mux.HandleFunc("/raft/forward", func(w http.ResponseWriter, r *http.Request) {
+		cmd, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxHTTPBodyLen))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err = h.HandleForward(cmd); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+		}
+	})
+
+	t.server = &http.Server{Handler: mux}
+	go t.server.Serve(t.listener)
+	return
+}
+
+func decodeHTTPRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHTTPBodyLen)).Decode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+func (t *httpTransport) Close() error {
+	if t.server == nil {
+		return nil
+	}
+
+	return t.server.Close()
+}
+
+func (t *httpTransport) RequestVote(addr string, req *VoteRequest) (*VoteResponse, error) {
+	var resp VoteResponse
+	if err := t.call(addr, "vote", req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (t *httpTransport) AppendEntries(addr string, req *AppendRequest) (*AppendResponse, error) {
+	var resp AppendResponse
+	if err := t.call(addr, "append", req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (t *httpTransport) Forward(addr string, cmd []byte) error {
+	resp, err := t.client.Post(fmt.Sprintf("http://%s/raft/forward", addr), "application/json", bytes.NewReader(cmd))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return remoteError(string(bytes.TrimSpace(b)))
+	}
+
+	return nil
+}
+
+func (t *httpTransport) call(addr, method string, req, resp interface{}) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	r, err := t.client.Post(fmt.Sprintf("http://%s/raft/%s", addr, method), "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s", addr, r.Status)
+	}
+
+	return json.NewDecoder(r.Body).Decode(resp)
+}
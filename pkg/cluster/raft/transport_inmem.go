@@ -0,0 +1,108 @@
+package raft
+
+import (
+	"sync"
+)
+
+var (
+	_ Transport = &inmemTransport{}
+)
+
+// InmemNetwork connects in-process transports, so that a whole cluster can run in a single
+// process for testing. Messages to or from a disconnected address are dropped.
+type InmemNetwork struct {
+	mu           sync.RWMutex
+	handlers     map[string]Handler
+	disconnected map[string]bool
+}
+
+// NewInmemNetwork creates an InmemNetwork.
+func NewInmemNetwork() *InmemNetwork {
+	return &InmemNetwork{
+		handlers:     make(map[string]Handler),
+		disconnected: make(map[string]bool),
+	}
+}
+
+// Transport returns the transport of an address in the network.
+func (n *InmemNetwork) Transport(addr string) Transport {
+	return &inmemTransport{network: n, addr: addr}
+}
+
+// Disconnect isolates the address from the network.
+func (n *InmemNetwork) Disconnect(addr string) {
+	n.mu.Lock()
+	n.disconnected[addr] = true
+	n.mu.Unlock()
+}
+
+// Reconnect heals the isolated address.
+func (n *InmemNetwork) Reconnect(addr string) {
+	n.mu.Lock()
+	delete(n.disconnected, addr)
+	n.mu.Unlock()
+}
+
+func (n *InmemNetwork) route(from, to string) (Handler, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	h, present := n.handlers[to]
+	if !present || n.disconnected[from] || n.disconnected[to] {
+		return nil, ErrUnreachable
+	}
+	return h, nil
+}
+
+type inmemTransport struct {
+	network *InmemNetwork
+	addr    string
+}
+
+func (t *inmemTransport) Serve(h Handler) error {
+	t.network.mu.Lock()
+	t.network.handlers[t.addr] = h
+	t.network.mu.Unlock()
+	return nil
+}
+
+func (t *inmemTransport) Close() error {
+	t.network.mu.Lock()
+	delete(t.network.handlers, t.addr)
+	t.network.mu.Unlock()
+	return nil
+}
+
+func (t *inmemTransport) RequestVote(addr string, req *VoteRequest) (*VoteResponse, error) {
+	h, err := t.network.route(t.addr, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	r := *req
+	return h.HandleVote(&r), nil
+}
+
+func (t *inmemTransport) AppendEntries(addr string, req *AppendRequest) (*AppendResponse, error) {
+	h, err := t.network.route(t.addr, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	r := *req
+	r.Entries = append([]Entry(nil), req.Entries...)
+	return h.HandleAppend(&r), nil
+}
+
+func (t *inmemTransport) Forward(addr string, cmd []byte) error {
+	h, err := t.network.route(t.addr, addr)
+	if err != nil {
+		return err
+	}
+
+	if err = h.HandleForward(cmd); err != nil {
+		// the error crosses the network as text
+		return remoteError(err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package raft
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+type echoHandler struct{}
+
+func (echoHandler) HandleVote(req *VoteRequest) *VoteResponse {
+	return &VoteResponse{Term: req.Term, Granted: req.CandidateID == "n1"}
+}
+
+func (echoHandler) HandleAppend(req *AppendRequest) *AppendResponse {
+	return &AppendResponse{Term: req.Term, Success: true, LastIndex: req.PrevLogIndex + uint64(len(req.Entries))}
+}
+
+func (echoHandler) HandleForward(cmd []byte) error {
+	if string(cmd) == "dup" {
+		return ErrResourceExists
+	}
+	return nil
+}
+
+func testTransport(t *testing.T, tr Transport, addr string) {
+	vote, err := tr.RequestVote(addr, &VoteRequest{Term: 2, CandidateID: "n1"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, VoteResponse{Term: 2, Granted: true}, *vote)
+
+	appended, err := tr.AppendEntries(addr, &AppendRequest{Term: 2, PrevLogIndex: 3,
+		Entries: []Entry{{Term: 2, Index: 4, Data: []byte("a")}}})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, AppendResponse{Term: 2, Success: true, LastIndex: 4}, *appended)
+
+	assert.Equal(t, nil, tr.Forward(addr, []byte("a")))
+	assert.Equal(t, ErrResourceExists, tr.Forward(addr, []byte("dup")))
+}
+
+func TestInmemTransport(t *testing.T) {
+	network := NewInmemNetwork()
+	server, client := network.Transport("n2"), network.Transport("n1")
+	server.Serve(echoHandler{})
+	testTransport(t, client, "n2")
+
+	network.Disconnect("n2")
+	_, err := client.RequestVote("n2", &VoteRequest{})
+	assert.Equal(t, ErrUnreachable, err)
+	network.Reconnect("n2")
+	testTransport(t, client, "n2")
+
+	server.Close()
+	assert.Equal(t, ErrUnreachable, client.Forward("n2", nil))
+}
+
+func TestHTTPTransport(t *testing.T) {
+	// pick a free port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	server := NewHTTPTransport(addr, time.Second)
+	if err = server.Serve(echoHandler{}); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	testTransport(t, NewHTTPTransport("127.0.0.1:0", time.Second), addr)
+}
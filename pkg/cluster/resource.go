@@ -10,7 +10,7 @@ type Resource struct {
 	Name        string `json:"name,omitempty"`
 	Cost        int    `json:"cost,omitempty"`
 
-	// Resources within a group will be assign to a single participant. TODO
+	// Resources with the same non-zero group are assigned to a single participant as a whole.
 	Group int `json:"group,omitempty"`
 
 	// will not persist in json
@@ -42,6 +42,11 @@ func (r Resource) Equals(that Resource) bool {
 	return r.InputPlugin == that.InputPlugin && r.Name == that.Name
 }
 
+// key is the identity of the resource.
+func (r Resource) key() string {
+	return r.InputPlugin + "/" + r.Name
+}
+
 func (r *Resource) From(data []byte) {
 	json.Unmarshal(data, r)
 }
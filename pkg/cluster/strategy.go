@@ -4,8 +4,8 @@ package cluster
 type Strategy uint8
 
 // StrategyFunc is a func that implements the load balance: assign resources to participants
-// and return the final decision.
-type StrategyFunc func(participants []Participant, resources []Resource) (decision Decision)
+// and return the final decision. lastDecision is the assignment before this rebalance, might be nil.
+type StrategyFunc func(participants []Participant, resources []Resource, lastDecision Decision) (decision Decision)
 
 const (
 	// StrategyRoundRobin is a round-robin.
@@ -14,15 +14,39 @@ const (
 	// StrategyWeightedRoundRobin is based upon StrategyRoundRobin while taking consideration of the weight.
 	StrategyWeightedRoundRobin Strategy = 2
 
-	StrategySticky = 3
+	// StrategySticky is based upon StrategyRoundRobin while keeping resources on their last owners.
+	StrategySticky Strategy = 3
 )
 
 var (
 	strategies = map[Strategy]StrategyFunc{
-		StrategyRoundRobin: assignRoundRobin,
+		StrategyRoundRobin:         assignRoundRobin,
+		StrategyWeightedRoundRobin: assignWeightedRoundRobin,
+		StrategySticky:             assignSticky,
+	}
+
+	strategyNames = map[Strategy]string{
+		StrategyRoundRobin:         "roundrobin",
+		StrategyWeightedRoundRobin: "weighted",
+		StrategySticky:             "sticky",
 	}
 )
 
+// ParseStrategy returns the strategy by name, e,g. roundrobin, weighted.
+func ParseStrategy(name string) (Strategy, error) {
+	for s, n := range strategyNames {
+		if n == name {
+			return s, nil
+		}
+	}
+
+	return 0, ErrInvalidStrategy
+}
+
+func (s Strategy) String() string {
+	return strategyNames[s]
+}
+
 // GetStrategyFunc returns the func according to the specified strategy.
 // IMPORTANT the returned func might be nil: it is caller's job to check.
 func GetStrategyFunc(s Strategy) StrategyFunc {
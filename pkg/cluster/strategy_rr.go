@@ -2,11 +2,9 @@ package cluster
 
 import (
 	"sort"
-
-	"github.com/funkygao/golib/math"
 )
 
-func assignRoundRobin(participants []Participant, resources []Resource) (decision Decision) {
+func assignRoundRobin(participants []Participant, resources []Resource, lastDecision Decision) (decision Decision) {
 	var onlineParticipants []Participant
 	for _, p := range participants {
 		if p.AccceptResources() {
@@ -16,25 +14,29 @@ func assignRoundRobin(participants []Participant, resources []Resource) (decisio
 	participants = onlineParticipants
 
 	sortedParticipants := Participants(participants)
-	sortedResources := Resources(resources)
 	sort.Sort(sortedParticipants)
-	sort.Sort(sortedResources)
-
-	rLen, pLen := len(resources), len(participants)
-	nResourcesPerParticipant, nparticipantsWithExtraResource := rLen/pLen, rLen%pLen
+	groups := groupResources(resources)
 
 	decision = MakeDecision()
+	pLen := len(participants)
+	if pLen == 0 {
+		return
+	}
+
+	var assigned, gid int
 	for pid := 0; pid < pLen; pid++ {
-		extraN := 1
-		if pid+1 > nparticipantsWithExtraResource {
-			extraN = 0
+		// ceil of the remaining per participant, so the first participants take the extra resource
+		nResources := (len(resources) - assigned + pLen - pid - 1) / (pLen - pid)
+		for n := 0; gid < len(groups) && (n < nResources || pid == pLen-1); gid++ {
+			decision.Assign(sortedParticipants[pid], groups[gid].resources...)
+			n += groups[gid].size()
+			assigned += groups[gid].size()
 		}
+	}
 
-		nResources := nResourcesPerParticipant + extraN
-		startResourceIdx := nResourcesPerParticipant*pid + math.MinInt(pid, nparticipantsWithExtraResource)
-		for j := startResourceIdx; j < startResourceIdx+nResources; j++ {
-			decision.Assign(sortedParticipants[pid], sortedResources[j])
-		}
+	for p, rs := range decision {
+		sort.Sort(Resources(rs))
+		decision[p] = rs
 	}
 
 	// notify the idle participants
@@ -1,5 +1,138 @@
 package cluster
 
-func assignSticky(participants []Participant, resources []Resource) (decision Decision) {
+import (
+	"sort"
+)
+
+// assignSticky keeps resources on their owners of the last decision as long as the cluster
+// stays balanced, so that only the minimal set of resources is moved when participants
+// join or leave.
+//
+// Like round-robin, each participant gets len(resources)/len(participants) resources, and the
+// remainder goes to the participants that own more resources in the last decision.
+// A resource group moves as a whole, to the owner of most of its members.
+func assignSticky(participants []Participant, resources []Resource, lastDecision Decision) (decision Decision) {
+	var onlineParticipants []Participant
+	for _, p := range participants {
+		if p.AccceptResources() {
+			onlineParticipants = append(onlineParticipants, p)
+		}
+	}
+	participants = onlineParticipants
+
+	sortedParticipants := Participants(participants)
+	sort.Sort(sortedParticipants)
+	groups := groupResources(resources)
+
+	decision = MakeDecision()
+	if len(participants) == 0 {
+		return
+	}
+
+	index := make(map[string]int, len(participants)) // endpoint:index of sortedParticipants
+	for i, p := range sortedParticipants {
+		index[p.Endpoint] = i
+	}
+	owners := make(map[string]int) // resource key:index of owner
+	for p, rs := range lastDecision {
+		if i, present := index[p.Endpoint]; present {
+			for _, r := range rs {
+				owners[r.key()] = i
+			}
+		}
+	}
+
+	var (
+		owned  = make([][]*resourceGroup, len(participants))
+		counts = make([]int, len(participants)) // number of resources owned
+		pool   []*resourceGroup                 // groups to move
+	)
+	for _, g := range groups {
+		// a group is owned by the participant owning most of its members
+		votes, owner := make(map[int]int), -1
+		for _, r := range g.resources {
+			if i, present := owners[r.key()]; present {
+				votes[i]++
+				if owner == -1 || votes[i] > votes[owner] || (votes[i] == votes[owner] && i < owner) {
+					owner = i
+				}
+			}
+		}
+
+		if owner == -1 {
+			pool = append(pool, g)
+		} else {
+			owned[owner] = append(owned[owner], g)
+			counts[owner] += g.size()
+		}
+	}
+
+	// the participants that own more get the extra resource
+	order := make([]int, len(participants))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return counts[order[a]] > counts[order[b]]
+	})
+	quota := make([]int, len(participants))
+	nResourcesPerParticipant, nparticipantsWithExtraResource := len(resources)/len(participants), len(resources)%len(participants)
+	for rank, i := range order {
+		quota[i] = nResourcesPerParticipant
+		if rank < nparticipantsWithExtraResource {
+			quota[i]++
+		}
+	}
+
+	// revoke the surplus, a group larger than the quota stays if it is the only one kept
+	for i := range owned {
+		var kept []*resourceGroup
+		counts[i] = 0
+		for _, g := range owned[i] {
+			if counts[i]+g.size() <= quota[i] || (counts[i] == 0 && g.size() > quota[i]) {
+				kept = append(kept, g)
+				counts[i] += g.size()
+			} else {
+				pool = append(pool, g)
+			}
+		}
+		owned[i] = kept
+	}
+
+	// the larger groups first
+	sort.Slice(pool, func(i, j int) bool {
+		if pool[i].size() != pool[j].size() {
+			return pool[i].size() > pool[j].size()
+		}
+		return pool[i].name() < pool[j].name()
+	})
+	for _, g := range pool {
+		// the participant with the most vacancies first
+		best := 0
+		for i := 1; i < len(owned); i++ {
+			if quota[i]-counts[i] > quota[best]-counts[best] {
+				best = i
+			}
+		}
+
+		owned[best] = append(owned[best], g)
+		counts[best] += g.size()
+	}
+
+	for i, p := range sortedParticipants {
+		if len(owned[i]) == 0 {
+			// notify the idle participant
+			decision.Close(p)
+			continue
+		}
+
+		var rs []Resource
+		for _, g := range owned[i] {
+			rs = append(rs, g.resources...)
+		}
+		sort.Sort(Resources(rs))
+		decision.Assign(p, rs...)
+	}
+
 	return
 }
@@ -1,6 +1,8 @@
 package cluster
 
 import (
+	"fmt"
+	"math/rand"
 	"testing"
 
 	"github.com/funkygao/assert"
@@ -21,7 +23,7 @@ func TestStategyRoundRobin(t *testing.T) {
 		p2,
 	}
 
-	decision := GetStrategyFunc(StrategyRoundRobin)(participants, resources)
+	decision := GetStrategyFunc(StrategyRoundRobin)(participants, resources, nil)
 
 	// p1: a,b,c
 	// p2: d,e
@@ -31,3 +33,311 @@ func TestStategyRoundRobin(t *testing.T) {
 	assert.Equal(t, 3, len(decision[p1]))
 	assert.Equal(t, 2, len(decision[p2]))
 }
+
+func TestStrategyWeighted(t *testing.T) {
+	resources := []Resource{
+		{Name: "a", Cost: 8},
+		{Name: "b", Cost: 4},
+		{Name: "c", Cost: 4},
+		{Name: "d", Cost: 2},
+		{Name: "e", Cost: 2},
+	}
+	p1 := Participant{Endpoint: "1", State: StateOnline, Weight: 100}
+	p2 := Participant{Endpoint: "2", State: StateOnline, Weight: 300}
+	p3 := Participant{Endpoint: "3", State: StateOffline, Weight: 800}
+
+	decision := GetStrategyFunc(StrategyWeightedRoundRobin)([]Participant{p3, p2, p1}, resources, nil)
+
+	// p1: b
+	// p2: a,c,d,e
+	assert.Equal(t, []Resource{{Name: "b", Cost: 4}}, decision[p1])
+	assert.Equal(t, 4, len(decision[p2]))
+	assert.Equal(t, "a", decision[p2][0].Name)
+	assert.Equal(t, false, decision.IsAssigned(p3))
+}
+
+func TestStrategyWeightedIdle(t *testing.T) {
+	p1 := Participant{Endpoint: "1", State: StateOnline, Weight: 100}
+	p2 := Participant{Endpoint: "2", State: StateOnline, Weight: 100}
+	decision := assignWeightedRoundRobin([]Participant{p1, p2}, []Resource{{Name: "a"}}, nil)
+	assert.Equal(t, 1, len(decision[p1]))
+	assert.Equal(t, true, decision.IsAssigned(p2))
+	assert.Equal(t, 0, len(decision[p2]))
+
+	assert.Equal(t, true, assignWeightedRoundRobin(nil, []Resource{{Name: "a"}}, nil).Empty())
+}
+
+// TestStrategyWeightedProperties checks on random clusters that:
+//   - each resource is assigned exactly once, and only to online participants
+//   - the decision does not depend on the order of input
+//   - cost per weight of each participant exceeds the ideal by at most n*maxCost/totalWeight
+func TestStrategyWeightedProperties(t *testing.T) {
+	rand.Seed(1)
+	for round := 0; round < 500; round++ {
+		var (
+			participants []Participant
+			resources    []Resource
+			totalWeight  int
+			totalCost    int
+			maxCost      int
+		)
+		for i, n := 0, 1+rand.Intn(8); i < n; i++ {
+			p := Participant{
+				Endpoint: fmt.Sprintf("10.0.0.%d:9877", i),
+				State:    StateOnline,
+				Weight:   100 * (1 + rand.Intn(32)),
+			}
+			if rand.Intn(5) == 0 {
+				p.State = StateOffline
+			} else {
+				totalWeight += p.Weight
+			}
+			participants = append(participants, p)
+		}
+		for i, n := 0, rand.Intn(64); i < n; i++ {
+			r := Resource{InputPlugin: "in", Name: fmt.Sprintf("r%d", i), Cost: 1 + rand.Intn(100)}
+			totalCost += r.Cost
+			if r.Cost > maxCost {
+				maxCost = r.Cost
+			}
+			resources = append(resources, r)
+		}
+
+		decision := assignWeightedRoundRobin(participants, resources, nil)
+
+		shuffledParticipants := append([]Participant(nil), participants...)
+		shuffledResources := append([]Resource(nil), resources...)
+		rand.Shuffle(len(shuffledParticipants), func(i, j int) {
+			shuffledParticipants[i], shuffledParticipants[j] = shuffledParticipants[j], shuffledParticipants[i]
+		})
+		rand.Shuffle(len(shuffledResources), func(i, j int) {
+			shuffledResources[i], shuffledResources[j] = shuffledResources[j], shuffledResources[i]
+		})
+		if !decision.Equals(assignWeightedRoundRobin(shuffledParticipants, shuffledResources, nil)) {
+			t.Fatalf("round %d: decision depends on input order", round)
+		}
+
+		online := 0
+		for _, p := range participants {
+			if p.AccceptResources() {
+				online++
+			}
+		}
+
+		assigned := make(map[string]int)
+		for _, p := range participants {
+			if !p.AccceptResources() {
+				if decision.IsAssigned(p) {
+					t.Fatalf("round %d: offline %s assigned", round, p)
+				}
+				continue
+			}
+
+			if !decision.IsAssigned(p) {
+				t.Fatalf("round %d: %s not notified", round, p)
+			}
+
+			load := 0
+			for _, r := range decision[p] {
+				assigned[r.Name]++
+				load += r.Cost
+			}
+
+			// load/weight - totalCost/totalWeight <= n*maxCost/totalWeight
+			if totalWeight > 0 && load*totalWeight-totalCost*p.Weight > online*maxCost*p.Weight {
+				t.Fatalf("round %d: %s overloaded %d/%d, total %d/%d", round, p, load, p.Weight, totalCost, totalWeight)
+			}
+		}
+
+		if online == 0 {
+			continue
+		}
+		for _, r := range resources {
+			if assigned[r.Name] != 1 {
+				t.Fatalf("round %d: %s assigned %d times", round, r, assigned[r.Name])
+			}
+		}
+	}
+}
+
+func TestStrategySticky(t *testing.T) {
+	resources := []Resource{
+		{Name: "a"},
+		{Name: "b"},
+		{Name: "c"},
+		{Name: "d"},
+		{Name: "e"},
+	}
+	p1 := Participant{Endpoint: "1", State: StateOnline}
+	p2 := Participant{Endpoint: "2", State: StateOnline}
+	p3 := Participant{Endpoint: "3", State: StateOnline}
+
+	last := MakeDecision()
+	last.Assign(p1, resources[0], resources[2], resources[4])
+	last.Assign(p2, resources[1], resources[3])
+
+	// p3 joins: only 1 resource of p1 moves to p3
+	decision := GetStrategyFunc(StrategySticky)([]Participant{p1, p2, p3}, resources, last)
+	assert.Equal(t, []Resource{{Name: "a"}, {Name: "c"}}, decision[p1])
+	assert.Equal(t, []Resource{{Name: "b"}, {Name: "d"}}, decision[p2])
+	assert.Equal(t, []Resource{{Name: "e"}}, decision[p3])
+	assert.Equal(t, 1, decision.Moves(last))
+
+	// p1 leaves: its resources are shared by p2 and p3
+	decision = assignSticky([]Participant{p2, p3}, resources, decision)
+	assert.Equal(t, 3, len(decision[p2]))
+	assert.Equal(t, 2, len(decision[p3]))
+	assert.Equal(t, "e", decision[p3][1].Name)
+}
+
+// TestStrategyStickyProperties checks on random clusters that the decision is balanced as
+// round-robin, stays unchanged if nothing changes, and only the minimal set of resources is
+// moved when a participant joins or leaves.
+func TestStrategyStickyProperties(t *testing.T) {
+	rand.Seed(1)
+	balanced := func(d Decision, nParticipants, nResources int) bool {
+		for _, rs := range d {
+			if n := len(rs); n != nResources/nParticipants && n != (nResources+nParticipants-1)/nParticipants {
+				return false
+			}
+		}
+		return true
+	}
+
+	for round := 0; round < 500; round++ {
+		var (
+			participants []Participant
+			resources    []Resource
+		)
+		for i, n := 0, 1+rand.Intn(8); i < n; i++ {
+			participants = append(participants, Participant{Endpoint: fmt.Sprintf("10.0.0.%d:9877", i), State: StateOnline})
+		}
+		for i, n := 0, rand.Intn(64); i < n; i++ {
+			resources = append(resources, Resource{InputPlugin: "in", Name: fmt.Sprintf("r%d", i)})
+		}
+
+		d0 := assignSticky(participants, resources, nil)
+		if !balanced(d0, len(participants), len(resources)) {
+			t.Fatalf("round %d: unbalanced %+v", round, d0)
+		}
+		if d := assignSticky(participants, resources, d0); !d.Equals(d0) || d.Moves(d0) != 0 {
+			t.Fatalf("round %d: unchanged cluster got new decision", round)
+		}
+
+		// a participant joins: it takes its share and nothing else moves
+		joined := Participant{Endpoint: "10.0.0.100:9877", State: StateOnline}
+		d1 := assignSticky(append(participants, joined), resources, d0)
+		if !balanced(d1, len(participants)+1, len(resources)) {
+			t.Fatalf("round %d: unbalanced after join %+v", round, d1)
+		}
+		if moves := d1.Moves(d0); moves != len(d1[joined]) || moves > (len(resources)+len(participants))/(len(participants)+1) {
+			t.Fatalf("round %d: %d moved after join, %d for new participant", round, moves, len(d1[joined]))
+		}
+
+		// a participant leaves: only its resources move
+		if len(participants) == 1 {
+			continue
+		}
+		left := participants[rand.Intn(len(participants))]
+		var remained []Participant
+		for _, p := range participants {
+			if p != left {
+				remained = append(remained, p)
+			}
+		}
+		d2 := assignSticky(remained, resources, d0)
+		if !balanced(d2, len(remained), len(resources)) {
+			t.Fatalf("round %d: unbalanced after leave %+v", round, d2)
+		}
+		if moves := d2.Moves(d0); moves != len(d0[left]) {
+			t.Fatalf("round %d: %d moved after leave, %d owned by %s", round, moves, len(d0[left]), left)
+		}
+	}
+}
+
+func TestGroupResources(t *testing.T) {
+	groups := groupResources([]Resource{
+		{Name: "e", Group: 2, Cost: 3},
+		{Name: "a", Group: 2},
+		{Name: "d"},
+		{Name: "c", Group: 1},
+		{Name: "b"},
+	})
+	assert.Equal(t, 4, len(groups))
+	assert.Equal(t, []Resource{{Name: "a", Group: 2}, {Name: "e", Group: 2, Cost: 3}}, groups[0].resources)
+	assert.Equal(t, 4, groups[0].cost)
+	assert.Equal(t, "b", groups[1].name())
+	assert.Equal(t, "c", groups[2].name())
+	assert.Equal(t, "d", groups[3].name())
+}
+
+// TestStrategyGroup checks that all strategies assign a resource group to a single participant.
+func TestStrategyGroup(t *testing.T) {
+	rand.Seed(1)
+	for _, strategy := range []Strategy{StrategyRoundRobin, StrategyWeightedRoundRobin, StrategySticky} {
+		var last Decision
+		for round := 0; round < 100; round++ {
+			var (
+				participants []Participant
+				resources    []Resource
+			)
+			for i, n := 0, 1+rand.Intn(6); i < n; i++ {
+				participants = append(participants, Participant{Endpoint: fmt.Sprintf("10.0.0.%d:9877", i), State: StateOnline, Weight: 1 + rand.Intn(4)})
+			}
+			for i, n := 0, rand.Intn(32); i < n; i++ {
+				resources = append(resources, Resource{InputPlugin: "in", Name: fmt.Sprintf("r%d", i), Group: rand.Intn(5), Cost: rand.Intn(8)})
+			}
+
+			d := GetStrategyFunc(strategy)(participants, resources, last)
+			owners, n := make(map[int]string), 0
+			for p, rs := range d {
+				for _, r := range rs {
+					n++
+					if r.Group == 0 {
+						continue
+					}
+					if owner, present := owners[r.Group]; present && owner != p.Endpoint {
+						t.Fatalf("%s round %d: group %d split %+v", strategy, round, r.Group, d)
+					}
+					owners[r.Group] = p.Endpoint
+				}
+			}
+			if n != len(resources) {
+				t.Fatalf("%s round %d: %d resources assigned, expected %d", strategy, round, n, len(resources))
+			}
+
+			last = d
+		}
+	}
+}
+
+func TestStrategyStickyGroup(t *testing.T) {
+	resources := []Resource{
+		{Name: "a", Group: 1},
+		{Name: "b", Group: 1},
+		{Name: "c"},
+		{Name: "d"},
+	}
+	p1 := Participant{Endpoint: "1", State: StateOnline}
+	p2 := Participant{Endpoint: "2", State: StateOnline}
+
+	// b is newly grouped with a: b moves to the owner of a
+	last := MakeDecision()
+	last.Assign(p1, resources[0], resources[2])
+	last.Assign(p2, resources[1], resources[3])
+	decision := assignSticky([]Participant{p1, p2}, resources, last)
+	assert.Equal(t, []Resource{resources[0], resources[1]}, decision[p1])
+	assert.Equal(t, []Resource{resources[2], resources[3]}, decision[p2])
+
+	// the group larger than the quota stays when p3 joins
+	p3 := Participant{Endpoint: "3", State: StateOnline}
+	resources[2].Group = 1
+	last = MakeDecision()
+	last.Assign(p1, resources[:3]...)
+	last.Assign(p2, resources[3])
+	decision = assignSticky([]Participant{p1, p2, p3}, resources, last)
+	assert.Equal(t, resources[:3], decision[p1])
+	assert.Equal(t, []Resource{resources[3]}, decision[p2])
+	assert.Equal(t, 0, len(decision[p3]))
+	assert.Equal(t, 0, decision.Moves(last))
+}
@@ -1,6 +1,76 @@
 package cluster
 
+import (
+	"sort"
+)
+
 // assignWeightedRoundRobin takes participant weight and resource cost into consideration.
-func assignWeightedRoundRobin(participants []Participant, resources []Resource) (decision Decision) {
+//
+// It is a greedy bin packing: resource groups are assigned from the most costly one, each to
+// the participant that will have the least cost per weight after taking it.
+// Resource cost and participant weight are at least 1, cost of a group is the sum of its resources.
+func assignWeightedRoundRobin(participants []Participant, resources []Resource, lastDecision Decision) (decision Decision) {
+	var onlineParticipants []Participant
+	for _, p := range participants {
+		if p.AccceptResources() {
+			onlineParticipants = append(onlineParticipants, p)
+		}
+	}
+	participants = onlineParticipants
+
+	sortedParticipants := Participants(participants)
+	sort.Sort(sortedParticipants)
+	groups := groupResources(resources)
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].cost > groups[j].cost
+	})
+
+	decision = MakeDecision()
+	if len(participants) == 0 {
+		return
+	}
+
+	loads := make([]int64, len(participants))
+	for _, g := range groups {
+		cost := int64(g.cost)
+		best := 0
+		for i := 1; i < len(participants); i++ {
+			// (loads[i]+cost)/weight[i] < (loads[best]+cost)/weight[best]
+			if (loads[i]+cost)*int64(participantWeight(sortedParticipants[best])) <
+				(loads[best]+cost)*int64(participantWeight(sortedParticipants[i])) {
+				best = i
+			}
+		}
+
+		loads[best] += cost
+		decision.Assign(sortedParticipants[best], g.resources...)
+	}
+
+	for p, rs := range decision {
+		sort.Sort(Resources(rs))
+		decision[p] = rs
+	}
+
+	// notify the idle participants
+	for _, p := range participants {
+		if !decision.IsAssigned(p) {
+			decision.Close(p)
+		}
+	}
+
 	return
 }
+
+func resourceCost(r Resource) int {
+	if r.Cost < 1 {
+		return 1
+	}
+	return r.Cost
+}
+
+func participantWeight(p Participant) int {
+	if p.Weight < 1 {
+		return 1
+	}
+	return p.Weight
+}
@@ -21,6 +21,7 @@ type controller struct {
 	zc *zkclient.Client
 
 	strategyFunc cluster.StrategyFunc
+	loadPolicy   cluster.LoadPolicy
 	participant  cluster.Participant
 
 	leader   *leader
@@ -33,7 +34,8 @@ type controller struct {
 }
 
 // NewController creates a Controller with zookeeper as underlying storage.
-func NewController(zkSvr string, clusterName string, participant cluster.Participant, strategy cluster.Strategy, onRebalance cluster.RebalanceCallback) cluster.Controller {
+func NewController(zkSvr string, clusterName string, participant cluster.Participant, strategy cluster.Strategy,
+	loadPolicy cluster.LoadPolicy, onRebalance cluster.RebalanceCallback) cluster.Controller {
 	if onRebalance == nil {
 		panic("onRebalance nil not allowed")
 	}
@@ -55,6 +57,7 @@ func NewController(zkSvr string, clusterName string, participant cluster.Partici
 		participant:  participant,
 		onRebalance:  onRebalance,
 		strategyFunc: strategyFunc,
+		loadPolicy:   loadPolicy,
 		zc:           zkclient.New(zkSvr, zkclient.WithWrapErrorWithPath()),
 	}
 }
@@ -118,6 +121,7 @@ func (c *controller) Stop() (err error) {
 	// participant, controller if leader
 	c.zc.Disconnect()
 
+	c.leader.stopWatchingLoads()
 	c.elector.close()
 	c.hc.close()
 	c.upgrader.close()
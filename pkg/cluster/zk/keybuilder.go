@@ -46,6 +46,14 @@ func (kb *keyBuilder) resourceState(resource string) string {
 	return path.Join(kb.resource(resource), "state")
 }
 
+func (kb *keyBuilder) loads() string {
+	return path.Join(rootPath, "loads")
+}
+
+func (kb *keyBuilder) participantLoads(id string) string {
+	return path.Join(kb.loads(), id)
+}
+
 func (kb *keyBuilder) encodeResource(resource string) string {
 	return url.QueryEscape(resource)
 }
@@ -63,5 +71,6 @@ func (kb *keyBuilder) persistentKeys() []string {
 	return []string{
 		kb.participants(),
 		kb.resources(),
+		kb.loads(),
 	}
 }
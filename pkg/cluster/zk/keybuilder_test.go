@@ -21,6 +21,9 @@ func TestKeyBuilder(t *testing.T) {
 	assert.Equal(t, "/dbus/cluster/resources/local%3A%2F%2Froot%3A%40localhost%3A3306", kb.resource("local://root:@localhost:3306"))
 	assert.Equal(t, "/dbus/cluster/resources/local%3A%2F%2Froot%3A%40localhost%3A3306/state", kb.resourceState("local://root:@localhost:3306"))
 
+	// load related
+	assert.Equal(t, "/dbus/cluster/loads/12.11.11.11-9876", kb.participantLoads("12.11.11.11-9876"))
+
 	// controller related
 	assert.Equal(t, "/dbus/cluster/leader", kb.leader())
 	assert.Equal(t, "/dbus/cluster/leader_epoch", kb.leaderEpoch())
@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"github.com/funkygao/dbus/pkg/cluster"
+	"github.com/funkygao/go-metrics"
 	log "github.com/funkygao/log4go"
 	"github.com/funkygao/zkclient"
 )
@@ -13,6 +14,7 @@ type leader struct {
 	ctx *controller
 
 	lastDecision cluster.Decision
+	costs        map[string]int // resource cost persisted since lastDecision, by name
 
 	epoch          int // should never overflow
 	epochZkVersion int32
@@ -21,6 +23,12 @@ type leader struct {
 	rcl zkclient.ZkChildListener // leader watches resources
 
 	rbLockStep sync.Mutex
+
+	loadMu      sync.Mutex
+	loadStopper chan struct{} // closed to stop watching participants load
+
+	moves metrics.Histogram // resources moved per rebalance
+	skew  metrics.Gauge     // participants load skew in percentage
 }
 
 func newLeader(ctx *controller) *leader {
@@ -28,6 +36,9 @@ func newLeader(ctx *controller) *leader {
 		ctx: ctx,
 		pcl: newParticipantChangeListener(ctx),
 		rcl: newResourceChangeListener(ctx),
+		moves: metrics.GetOrRegisterHistogram("dbus.cluster.rebalance.moves", metrics.DefaultRegistry,
+			metrics.NewUniformSample(1028)),
+		skew: metrics.GetOrRegisterGauge("dbus.cluster.load.skew", metrics.DefaultRegistry),
 	}
 }
 
@@ -89,8 +100,10 @@ func (l *leader) incrementEpoch() (ok bool) {
 func (l *leader) onResigningAsLeader() {
 	l.ctx.zc.UnsubscribeChildChanges(l.ctx.kb.participants(), l.pcl)
 	l.ctx.zc.UnsubscribeChildChanges(l.ctx.kb.resources(), l.rcl)
+	l.stopWatchingLoads()
 
 	l.lastDecision = nil
+	l.costs = nil
 	l.ctx.elector.leaderID = ""
 	l.epoch = 0
 	l.epochZkVersion = 0
@@ -109,12 +122,14 @@ func (l *leader) onBecomingLeader() {
 
 	log.Trace("[%s] become controller leader and trigger rebalance!", l.ctx.participant)
 	l.doRebalance()
+	l.startWatchingLoads()
 }
 
 /// rebalance happens on controller leader when:
 // 1. participants change
 // 2. resources change
 // 3. becoming leader
+// 4. participants load skewed
 // rebalance runs sequentially
 func (l *leader) doRebalance() {
 	l.rbLockStep.Lock()
@@ -138,9 +153,20 @@ func (l *leader) doRebalance() {
 		return
 	}
 
-	newDecision := l.ctx.strategyFunc(liveParticipants, resources)
+	lastDecision := l.lastDecision
+	if lastDecision == nil {
+		// just became leader: the last decision is persisted in resource states
+		lastDecision = cluster.RecoverDecision(resources)
+	}
+
+	newDecision := l.ctx.strategyFunc(liveParticipants, resources, lastDecision)
 	if !newDecision.Equals(l.lastDecision) {
+		moves := newDecision.Moves(lastDecision)
+		l.moves.Update(int64(moves))
+		log.Trace("[%s] %d resources moved", l.ctx.participant, moves)
+
 		l.lastDecision = newDecision
+		l.costs = make(map[string]int)
 
 		WALok := true
 		for participant, resources := range newDecision {
@@ -0,0 +1,133 @@
+package zk
+
+import (
+	"time"
+
+	"github.com/funkygao/dbus/pkg/cluster"
+	log "github.com/funkygao/log4go"
+	"github.com/funkygao/zkclient"
+)
+
+func (c *controller) ReportLoads(loads cluster.ResourceLoads) error {
+	path := c.kb.participantLoads(c.participant.Endpoint)
+	err := c.zc.Set(path, loads.Marshal())
+	if zkclient.IsErrNoNode(err) {
+		// first report, or the ephemeral znode has gone with the expired session
+		err = c.zc.CreateLiveNode(path, loads.Marshal(), 3)
+	}
+
+	return err
+}
+
+// participantLoads returns the load reports of all participants, keyed by participant endpoint.
+func (c *controller) participantLoads() (map[string]cluster.ResourceLoads, error) {
+	endpoints, marshalled, err := c.zc.ChildrenValues(c.kb.loads())
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(map[string]cluster.ResourceLoads, len(endpoints))
+	for i, endpoint := range endpoints {
+		loads := make(cluster.ResourceLoads)
+		loads.From(marshalled[i])
+		r[endpoint] = loads
+	}
+
+	return r, nil
+}
+
+func (l *leader) startWatchingLoads() {
+	if l.ctx.loadPolicy.Interval <= 0 {
+		return
+	}
+
+	l.loadMu.Lock()
+	defer l.loadMu.Unlock()
+
+	if l.loadStopper == nil {
+		l.loadStopper = make(chan struct{})
+		go l.watchLoads(l.loadStopper)
+	}
+}
+
+func (l *leader) stopWatchingLoads() {
+	l.loadMu.Lock()
+	defer l.loadMu.Unlock()
+
+	if l.loadStopper != nil {
+		close(l.loadStopper)
+		l.loadStopper = nil
+	}
+}
+
+// watchLoads periodically checks the participants load and rebalance if it is skewed.
+func (l *leader) watchLoads(stopper <-chan struct{}) {
+	trigger := cluster.NewSkewTrigger(l.ctx.loadPolicy)
+	tick := time.NewTicker(l.ctx.loadPolicy.Interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			if l.checkLoads(trigger) && l.ctx.amLeader() {
+				log.Trace("[%s] participants load skewed, trigger rebalance", l.ctx.participant)
+				l.doRebalance()
+			}
+
+		case <-stopper:
+			return
+		}
+	}
+}
+
+// checkLoads recomputes resource cost from the load reported by its owner and persists the
+// changed cost, then returns true if the participants load skew calls for a rebalance.
+func (l *leader) checkLoads(trigger *cluster.SkewTrigger) bool {
+	l.rbLockStep.Lock()
+	defer l.rbLockStep.Unlock()
+
+	if l.lastDecision == nil {
+		return false
+	}
+
+	reports, err := l.ctx.participantLoads()
+	if err != nil {
+		log.Error("[%s] %v", l.ctx.participant, err)
+		return false
+	}
+
+	costs := make(map[string]int)
+	for p, rs := range l.lastDecision {
+		for _, r := range rs {
+			// the report of the former owner is stale
+			load, present := reports[p.Endpoint][r.Name]
+			if !present {
+				continue
+			}
+
+			cost := load.Cost()
+			costs[r.Name] = cost
+			persisted, present := l.costs[r.Name]
+			if !present {
+				persisted = r.Cost
+			}
+			if cost == persisted {
+				continue
+			}
+
+			// takes effect on next rebalance
+			if err := l.ctx.updateResource(r.Name, func(res *cluster.Resource) { res.Cost = cost }); err != nil {
+				log.Error("[%s] %s %v", l.ctx.participant, r.Name, err)
+				continue
+			}
+
+			// lastDecision is shared with the rebalance callback and never modified
+			l.costs[r.Name] = cost
+		}
+	}
+
+	skew := cluster.LoadSkew(l.lastDecision, costs)
+	l.skew.Update(int64(skew * 100))
+	log.Debug("[%s] participants load skew %.2f", l.ctx.participant, skew)
+	return trigger.Observe(skew, time.Now())
+}
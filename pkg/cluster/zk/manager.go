@@ -1,18 +1,15 @@
 package zk
 
 import (
-	"fmt"
-	"net/http"
-	"strings"
-	"sync"
-
 	"github.com/funkygao/dbus/pkg/cluster"
 	"github.com/funkygao/gafka/zk"
 	"github.com/funkygao/golib/version"
-	"github.com/funkygao/gorequest"
 	"github.com/funkygao/zkclient"
 )
 
+// maxUpdateRetries is the max attempts of CAS update on a znode.
+const maxUpdateRetries = 5
+
 // NewManager creates a Manager with zookeeper as underlying storage.
 func NewManager(zkSvr string, clusterName string) cluster.Manager {
 	rootPath = zk.DbusClusterRoot(clusterName)
@@ -66,6 +63,31 @@ func (c *controller) UnregisterResource(resource cluster.Resource) (err error) {
 	return
 }
 
+func (c *controller) SetResourceGroup(resource cluster.Resource, group int) error {
+	return c.updateResource(resource.Name, func(res *cluster.Resource) { res.Group = group })
+}
+
+// updateResource reads the registered resource, applies the update and writes it back.
+// The write is a CAS on znode version, retried if another writer wins the race.
+func (c *controller) updateResource(name string, update func(*cluster.Resource)) error {
+	path := c.kb.resource(name)
+	for i := 0; i < maxUpdateRetries; i++ {
+		data, stat, err := c.zc.GetWithStat(path)
+		if err != nil {
+			return err
+		}
+
+		res := cluster.Resource{}
+		res.From(data)
+		update(&res)
+		if _, err = c.zc.SetWithVersion(path, res.Marshal(), stat.Version); !zkclient.IsErrVersionConflict(err) {
+			return err
+		}
+	}
+
+	return cluster.ErrUpdateConflict
+}
+
 func (c *controller) RegisteredResources() ([]cluster.Resource, error) {
 	resources, marshalled, err := c.zc.ChildrenValues(c.kb.resources())
 	if err != nil {
@@ -115,43 +137,13 @@ func (c *controller) Leader() (cluster.Participant, error) {
 	return p, nil
 }
 
-func (c *controller) CallParticipants(method string, q string) (err error) {
-	var ps []cluster.Participant
-	ps, err = c.LiveParticipants()
+func (c *controller) CallParticipants(method string, q string) error {
+	ps, err := c.LiveParticipants()
 	if err != nil {
-		return
-	}
-
-	var wg sync.WaitGroup
-	for _, p := range ps {
-		wg.Add(1)
-
-		targetURI := fmt.Sprintf("%s/%s", p.APIEndpoint(), strings.TrimLeft(q, "/"))
-		go func(wg *sync.WaitGroup, p cluster.Participant, targetURI string) {
-			defer wg.Done()
-
-			r := gorequest.New()
-			switch strings.ToUpper(method) {
-			case "PUT":
-				r = r.Put(targetURI)
-			case "POST":
-				r = r.Post(targetURI)
-			case "GET":
-				r = r.Get(targetURI)
-			}
-
-			resp, _, errs := r.Set("User-Agent", fmt.Sprintf("dbus-%s", version.Revision)).End()
-			if len(errs) > 0 {
-				err = errs[0]
-			} else if resp.StatusCode != http.StatusOK {
-				err = fmt.Errorf("%s %s", p, http.StatusText(resp.StatusCode))
-			}
-
-		}(&wg, p, targetURI)
+		return err
 	}
-	wg.Wait()
 
-	return
+	return cluster.CallParticipants(ps, method, q)
 }
 
 func (c *controller) LiveParticipants() ([]cluster.Participant, error) {
@@ -0,0 +1,10 @@
+package es
+
+import (
+	"errors"
+)
+
+var (
+	ErrUnknownColumns = errors.New("column names unknown")
+	ErrNoPrimaryKey   = errors.New("table has no primary key")
+)
@@ -2,24 +2,230 @@ package es
 
 import (
 	"bytes"
-
-	"github.com/hailocab/elastigo/api"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
 )
 
+// Indexer buffers bulk actions and sends them to ElasticSearch in a single bulk request.
+// It is not goroutine safe.
 type Indexer struct {
-	events int
-	buffer *bytes.Buffer
+	addrs  []string
+	next   int // index of addrs to send bulk request
+	client *http.Client
+
+	actions int
+	buffer  *bytes.Buffer
+	offsets []int // buffer offset of each action
+}
+
+// NewIndexer creates an Indexer that sends bulk requests to the ElasticSearch nodes in turn.
+// addrs is in the form of http://host:port.
+func NewIndexer(addrs []string, timeout time.Duration) *Indexer {
+	if len(addrs) == 0 {
+		panic("empty ElasticSearch addrs")
+	}
+
+	return &Indexer{
+		addrs:  addrs,
+		client: &http.Client{Timeout: timeout},
+		buffer: &bytes.Buffer{},
+	}
 }
 
-func NewIndexer() *Indexer {
-	return &Indexer{}
+type bulkMeta struct {
+	Index string `json:"_index"`
+	Type  string `json:"_type,omitempty"`
+	ID    string `json:"_id,omitempty"`
 }
 
-func bulkSend(buf *bytes.Buffer) error {
-	_, err := api.DoCommand("POST", "/_bulk", buf)
+// Index adds an index action that creates or replaces the document.
+// If id is empty, ElasticSearch generates one.
+func (i *Indexer) Index(index, typ, id string, doc interface{}) error {
+	return i.add("index", bulkMeta{index, typ, id}, doc)
+}
+
+// Update adds an update action that merges the partial document, creating it if absent.
+func (i *Indexer) Update(index, typ, id string, doc interface{}) error {
+	return i.add("update", bulkMeta{index, typ, id}, map[string]interface{}{
+		"doc":           doc,
+		"doc_as_upsert": true,
+	})
+}
+
+// Delete adds a delete action.
+func (i *Indexer) Delete(index, typ, id string) error {
+	return i.add("delete", bulkMeta{index, typ, id}, nil)
+}
+
+func (i *Indexer) add(action string, meta bulkMeta, source interface{}) error {
+	header, err := json.Marshal(map[string]bulkMeta{action: meta})
 	if err != nil {
 		return err
 	}
 
+	var body []byte
+	if source != nil {
+		if body, err = json.Marshal(source); err != nil {
+			return err
+		}
+	}
+
+	i.offsets = append(i.offsets, i.buffer.Len())
+	i.buffer.Write(header)
+	i.buffer.WriteByte('\n')
+	if body != nil {
+		i.buffer.Write(body)
+		i.buffer.WriteByte('\n')
+	}
+	i.actions++
 	return nil
 }
+
+// Actions returns number of buffered actions.
+func (i *Indexer) Actions() int {
+	return i.actions
+}
+
+// Size returns bytes of buffered actions.
+func (i *Indexer) Size() int {
+	return i.buffer.Len()
+}
+
+// Reset discards all the buffered actions.
+func (i *Indexer) Reset() {
+	i.actions = 0
+	i.buffer.Reset()
+	i.offsets = i.offsets[:0]
+}
+
+// keep discards the buffered actions except those of the given indexes in order.
+func (i *Indexer) keep(items []int) {
+	buffer := &bytes.Buffer{}
+	offsets := make([]int, 0, len(items))
+	data := i.buffer.Bytes()
+	for _, j := range items {
+		end := len(data)
+		if j+1 < len(i.offsets) {
+			end = i.offsets[j+1]
+		}
+		offsets = append(offsets, buffer.Len())
+		buffer.Write(data[i.offsets[j]:end])
+	}
+
+	i.actions = len(items)
+	i.buffer = buffer
+	i.offsets = offsets
+}
+
+// BulkItemError is a bulk action that ElasticSearch failed to execute.
+type BulkItemError struct {
+	Action string
+	Index  string
+	ID     string
+	Status int
+	Reason string
+}
+
+func (e BulkItemError) Error() string {
+	return fmt.Sprintf("%s %s/%s %d: %s", e.Action, e.Index, e.ID, e.Status, e.Reason)
+}
+
+// retriable checks whether the action might succeed if retried.
+func (e BulkItemError) retriable() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status >= http.StatusInternalServerError
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Index  string          `json:"_index"`
+		ID     string          `json:"_id"`
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// Flush sends the buffered actions in a bulk request.
+//
+// Actions permanently rejected by ElasticSearch, e,g. mapping conflict, are returned
+// in rejected and will never be retried. If err is not nil, the actions to retry are
+// kept so that Flush can be retried: only the failed actions if ElasticSearch executes
+// the bulk, or else all of them. Actions with id are idempotent, but index action
+// without id might duplicate the document if the bulk request fails as a whole.
+func (i *Indexer) Flush() (rejected []BulkItemError, err error) {
+	if i.actions == 0 {
+		return
+	}
+
+	addr := i.addrs[i.next]
+	resp, err := i.client.Post(strings.TrimSuffix(addr, "/")+"/_bulk", "application/x-ndjson",
+		bytes.NewReader(i.buffer.Bytes()))
+	if err != nil {
+		i.next = (i.next + 1) % len(i.addrs)
+		return
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		i.next = (i.next + 1) % len(i.addrs)
+		err = fmt.Errorf("%s bulk: %s %s", addr, resp.Status, body)
+		return
+	}
+
+	var result bulkResponse
+	if err = json.Unmarshal(body, &result); err != nil {
+		return
+	}
+
+	var (
+		retries    []BulkItemError
+		retryItems []int
+	)
+	if result.Errors {
+		for j, item := range result.Items {
+			for action, r := range item {
+				if r.Status < http.StatusMultipleChoices ||
+					(action == "delete" && r.Status == http.StatusNotFound) {
+					continue
+				}
+
+				e := BulkItemError{
+					Action: action,
+					Index:  r.Index,
+					ID:     r.ID,
+					Status: r.Status,
+					Reason: string(r.Error),
+				}
+				if e.retriable() {
+					retries = append(retries, e)
+					retryItems = append(retryItems, j)
+				} else {
+					rejected = append(rejected, e)
+				}
+			}
+		}
+	}
+
+	if len(retries) > 0 {
+		err = fmt.Errorf("%d/%d actions failed, e,g. %s", len(retries), i.actions, retries[0])
+		if len(result.Items) == i.actions {
+			// the succeeded actions are never resent
+			i.keep(retryItems)
+		} else {
+			rejected = nil // reported when retry succeeds
+		}
+		return
+	}
+
+	i.Reset()
+	return
+}
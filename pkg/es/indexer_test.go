@@ -0,0 +1,133 @@
+package es
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestIndexerBulkBody(t *testing.T) {
+	i := NewIndexer([]string{"http://localhost:9200"}, time.Second)
+	i.Index("db_t", "doc", "1", map[string]interface{}{"id": 1})
+	i.Update("db_t", "doc", "2", map[string]interface{}{"id": 2})
+	i.Delete("db_t", "", "3")
+	assert.Equal(t, 3, i.Actions())
+	assert.Equal(t, `{"index":{"_index":"db_t","_type":"doc","_id":"1"}}
+{"id":1}
+{"update":{"_index":"db_t","_type":"doc","_id":"2"}}
+{"doc":{"id":2},"doc_as_upsert":true}
+{"delete":{"_index":"db_t","_id":"3"}}
+`, i.buffer.String())
+	assert.Equal(t, i.buffer.Len(), i.Size())
+
+	i.Reset()
+	assert.Equal(t, 0, i.Actions())
+	assert.Equal(t, 0, i.Size())
+}
+
+func TestIndexerFlush(t *testing.T) {
+	var requests int
+	var lastBody string
+	responses := []string{
+		`{"errors":true,"items":[{"index":{"_index":"db_t","_id":"1","status":429,"error":{"type":"es_rejected_execution_exception"}}},{"delete":{"_index":"db_t","_id":"2","status":404}}]}`,
+		`{"errors":true,"items":[{"index":{"_index":"db_t","_id":"1","status":201}},{"index":{"_index":"db_t","_id":"4","status":400,"error":{"type":"mapper_parsing_exception"}}}]}`,
+		`{"errors":false,"items":[{"index":{"_index":"db_t","_id":"3","status":201}}]}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/_bulk", r.URL.Path)
+		b, _ := ioutil.ReadAll(r.Body)
+		lastBody = string(b)
+		w.Write([]byte(responses[requests]))
+		requests++
+	}))
+	defer ts.Close()
+
+	i := NewIndexer([]string{ts.URL}, time.Second)
+	rejected, err := i.Flush()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, requests) // nothing to flush
+
+	i.Index("db_t", "doc", "1", map[string]interface{}{"id": 1})
+	i.Delete("db_t", "doc", "2")
+
+	// retriable failure keeps the failed action only, delete not found is ok
+	rejected, err = i.Flush()
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, 0, len(rejected))
+	assert.Equal(t, 1, i.Actions())
+	assert.Equal(t, "{\"index\":{\"_index\":\"db_t\",\"_type\":\"doc\",\"_id\":\"1\"}}\n{\"id\":1}\n", i.buffer.String())
+
+	// permanent failure is rejected
+	i.Index("db_t", "doc", "4", map[string]interface{}{"id": 4})
+	rejected, err = i.Flush()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(rejected))
+	assert.Equal(t, 400, rejected[0].Status)
+	assert.Equal(t, "4", rejected[0].ID)
+	assert.Equal(t, 0, i.Actions())
+	assert.Equal(t, true, strings.HasPrefix(lastBody, "{\"index\":{\"_index\":\"db_t\",\"_type\":\"doc\",\"_id\":\"1\"}}\n"))
+
+	i.Index("db_t", "doc", "3", map[string]interface{}{"id": 3})
+	rejected, err = i.Flush()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(rejected))
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, "{\"index\":{\"_index\":\"db_t\",\"_type\":\"doc\",\"_id\":\"3\"}}\n{\"id\":3}\n", lastBody)
+}
+
+func TestIndexerFlushServerError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	i := NewIndexer([]string{ts.URL, ts.URL + "/"}, time.Second)
+	i.Delete("db_t", "doc", "1")
+	_, err := i.Flush()
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, 1, i.Actions())
+	assert.Equal(t, 1, i.next) // failover to next node
+}
+
+func TestIndexerRetryFailedOnly(t *testing.T) {
+	var bodies []string
+	responses := []string{
+		`{"errors":true,"items":[{"index":{"_index":"db_t","_id":"a","status":201}},{"index":{"_index":"db_t","_id":"b","status":503,"error":{}}},{"delete":{"_index":"db_t","_id":"1","status":400,"error":{}}},{"update":{"_index":"db_t","_id":"2","status":429,"error":{}}}]}`,
+		`{"errors":false,"items":[{"index":{"_index":"db_t","_id":"c","status":201}},{"update":{"_index":"db_t","_id":"2","status":200}}]}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(responses[len(bodies)]))
+		bodies = append(bodies, string(b))
+	}))
+	defer ts.Close()
+
+	// documents of table without primary key
+	i := NewIndexer([]string{ts.URL}, time.Second)
+	i.Index("db_t", "", "", map[string]interface{}{"v": 1})
+	i.Index("db_t", "", "", map[string]interface{}{"v": 2})
+	i.Delete("db_t", "", "1")
+	i.Update("db_t", "", "2", map[string]interface{}{"v": 3})
+
+	rejected, err := i.Flush()
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, 1, len(rejected))
+	assert.Equal(t, "1", rejected[0].ID)
+	assert.Equal(t, 2, i.Actions())
+
+	rejected, err = i.Flush()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(rejected))
+	assert.Equal(t, `{"index":{"_index":"db_t"}}
+{"v":2}
+{"update":{"_index":"db_t","_id":"2"}}
+{"doc":{"v":3},"doc_as_upsert":true}
+`, bodies[1])
+	assert.Equal(t, 0, i.Actions())
+	assert.Equal(t, 0, len(i.offsets))
+}
@@ -0,0 +1,91 @@
+package es
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/funkygao/dbus/pkg/model"
+)
+
+// AddRowsEvent maps a mysql rows event to bulk actions keyed by primary key:
+// insert as index, update as update with upsert, delete as delete.
+//
+// Rows of initial snapshot are indexed as insert. Update that changes the primary
+// key is mapped to delete of the old document and index of the new one.
+func (i *Indexer) AddRowsEvent(r *model.RowsEvent, index, typ string) error {
+	if len(r.Rows) > 0 && len(r.Columns) != len(r.Rows[0]) {
+		return ErrUnknownColumns
+	}
+
+	switch r.Action {
+	case "I", model.ActionSnapshot:
+		for _, row := range r.Rows {
+			if err := i.Index(index, typ, documentID(row, r.PKs), document(r.Columns, row)); err != nil {
+				return err
+			}
+		}
+
+	case "U":
+		if len(r.PKs) == 0 {
+			return ErrNoPrimaryKey
+		}
+
+		// [before update row, after update row]
+		for j := 0; j+1 < len(r.Rows); j += 2 {
+			before, after := r.Rows[j], r.Rows[j+1]
+			id := documentID(after, r.PKs)
+			if oldID := documentID(before, r.PKs); oldID != id {
+				if err := i.Delete(index, typ, oldID); err != nil {
+					return err
+				}
+				if err := i.Index(index, typ, id, document(r.Columns, after)); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := i.Update(index, typ, id, document(r.Columns, after)); err != nil {
+				return err
+			}
+		}
+
+	case "D":
+		if len(r.PKs) == 0 {
+			return ErrNoPrimaryKey
+		}
+
+		for _, row := range r.Rows {
+			if err := i.Delete(index, typ, documentID(row, r.PKs)); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("unknown action: %s", r.Action)
+	}
+
+	return nil
+}
+
+// documentID joins primary key values with underscore, empty if no primary key.
+func documentID(row []interface{}, pks []int) string {
+	ids := make([]string, len(pks))
+	for i, idx := range pks {
+		ids[i] = fmt.Sprint(row[idx])
+	}
+	return strings.Join(ids, "_")
+}
+
+func document(columns []string, row []interface{}) map[string]interface{} {
+	doc := make(map[string]interface{}, len(columns))
+	for i, c := range columns {
+		doc[c] = row[i]
+	}
+	return doc
+}
+
+// IndexName renders the index name template with {db} and {table} placeholders.
+// ElasticSearch index name must be lowercase.
+func IndexName(template string, db, table string) string {
+	return strings.ToLower(strings.NewReplacer("{db}", db, "{table}", table).Replace(template))
+}
@@ -0,0 +1,55 @@
+package es
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/pkg/model"
+)
+
+func TestAddRowsEvent(t *testing.T) {
+	i := NewIndexer([]string{"http://localhost:9200"}, time.Second)
+	r := &model.RowsEvent{
+		Action:  "U",
+		Columns: []string{"id", "name"},
+		PKs:     []int{0},
+		Rows:    [][]interface{}{{1, "a"}, {1, "b"}, {2, "c"}, {3, "c"}},
+	}
+	assert.Equal(t, nil, i.AddRowsEvent(r, "db_t", "doc"))
+	assert.Equal(t, `{"update":{"_index":"db_t","_type":"doc","_id":"1"}}
+{"doc":{"id":1,"name":"b"},"doc_as_upsert":true}
+{"delete":{"_index":"db_t","_type":"doc","_id":"2"}}
+{"index":{"_index":"db_t","_type":"doc","_id":"3"}}
+{"id":3,"name":"c"}
+`, i.buffer.String())
+	assert.Equal(t, 3, i.Actions())
+
+	i.Reset()
+	r.Action = "D"
+	r.Rows = [][]interface{}{{1, "a"}}
+	assert.Equal(t, nil, i.AddRowsEvent(r, "db_t", ""))
+	assert.Equal(t, "{\"delete\":{\"_index\":\"db_t\",\"_id\":\"1\"}}\n", i.buffer.String())
+
+	// no primary key
+	i.Reset()
+	r.Action = model.ActionSnapshot
+	r.PKs = nil
+	assert.Equal(t, nil, i.AddRowsEvent(r, "db_t", ""))
+	assert.Equal(t, "{\"index\":{\"_index\":\"db_t\"}}\n{\"id\":1,\"name\":\"a\"}\n", i.buffer.String())
+	r.Action = "D"
+	assert.Equal(t, ErrNoPrimaryKey, i.AddRowsEvent(r, "db_t", ""))
+
+	r.Columns = nil
+	assert.Equal(t, ErrUnknownColumns, i.AddRowsEvent(r, "db_t", ""))
+}
+
+func TestDocumentID(t *testing.T) {
+	assert.Equal(t, "1_a", documentID([]interface{}{1, "x", "a"}, []int{0, 2}))
+	assert.Equal(t, "", documentID([]interface{}{1}, nil))
+}
+
+func TestIndexName(t *testing.T) {
+	assert.Equal(t, "mydb_user", IndexName("{db}_{table}", "MyDB", "User"))
+	assert.Equal(t, "dbus-user", IndexName("dbus-{table}", "db", "user"))
+}
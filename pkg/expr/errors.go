@@ -0,0 +1,9 @@
+package expr
+
+import (
+	"errors"
+)
+
+var (
+	ErrUnterminated = errors.New("unterminated string")
+)
@@ -0,0 +1,393 @@
+// Package expr provides compiled boolean expressions over named fields, e,g.
+//
+//	db == "order" && dml in ["U", "D"] && row.status == 3
+//
+// Supported syntax:
+//   - logical: && || ! and parentheses
+//   - comparison: == != < <= > >=, numeric if either side is number, and exact if both
+//     sides are integers
+//   - membership: x in [v1, v2], x not in [v1, v2]
+//   - regexp: x =~ "^foo", x !~ "^foo"
+//   - literals: "string", 'string', number, true, false, null
+//   - fields: identifiers with dots, resolved by Env at evaluation
+//
+// A field alone is evaluated as truthy: not null, false, 0 or "".
+package expr
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// Env resolves field values of an expression.
+type Env interface {
+	Lookup(field string) (v interface{}, ok bool)
+}
+
+// MapEnv is an Env backed by map.
+type MapEnv map[string]interface{}
+
+// Lookup implements Env.
+func (m MapEnv) Lookup(field string) (interface{}, bool) {
+	v, ok := m[field]
+	return v, ok
+}
+
+// Expr is a compiled expression, safe for concurrent use.
+type Expr struct {
+	src    string
+	root   node
+	fields []string
+}
+
+// Compile parses an expression.
+func Compile(src string) (*Expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, fields: make(map[string]struct{})}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+	}
+
+	e := &Expr{src: src, root: root}
+	for f := range p.fields {
+		e.fields = append(e.fields, f)
+	}
+	return e, nil
+}
+
+// MustCompile is like Compile but panics if the expression cannot be parsed.
+func MustCompile(src string) *Expr {
+	e, err := Compile(src)
+	if err != nil {
+		panic(fmt.Sprintf("expr %s: %v", src, err))
+	}
+	return e
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Fields returns the fields referenced by the expression.
+func (e *Expr) Fields() []string {
+	return e.fields
+}
+
+// Eval evaluates the expression.
+func (e *Expr) Eval(env Env) bool {
+	return truthy(e.root.eval(env))
+}
+
+type node interface {
+	eval(env Env) interface{}
+}
+
+type (
+	orNode  struct{ l, r node }
+	andNode struct{ l, r node }
+	notNode struct{ n node }
+	cmpNode struct {
+		op   string
+		l, r node
+	}
+	inNode struct {
+		n      node
+		set    []interface{}
+		negate bool
+	}
+	regexpNode struct {
+		n      node
+		re     *regexp.Regexp
+		negate bool
+	}
+	literalNode struct{ v interface{} }
+	fieldNode   struct{ name string }
+)
+
+func (n *orNode) eval(env Env) interface{} {
+	return truthy(n.l.eval(env)) || truthy(n.r.eval(env))
+}
+
+func (n *andNode) eval(env Env) interface{} {
+	return truthy(n.l.eval(env)) && truthy(n.r.eval(env))
+}
+
+func (n *notNode) eval(env Env) interface{} {
+	return !truthy(n.n.eval(env))
+}
+
+func (n *cmpNode) eval(env Env) interface{} {
+	l, r := n.l.eval(env), n.r.eval(env)
+	switch n.op {
+	case "==":
+		return equal(l, r)
+	case "!=":
+		return !equal(l, r)
+	}
+
+	c, ok := compare(l, r)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default: // >=
+		return c >= 0
+	}
+}
+
+func (n *inNode) eval(env Env) interface{} {
+	v := n.n.eval(env)
+	for _, x := range n.set {
+		if equal(v, x) {
+			return !n.negate
+		}
+	}
+	return n.negate
+}
+
+func (n *regexpNode) eval(env Env) interface{} {
+	v := n.n.eval(env)
+	if v == nil {
+		return n.negate
+	}
+	return n.re.MatchString(toString(v)) != n.negate
+}
+
+func (n *literalNode) eval(env Env) interface{} {
+	return n.v
+}
+
+func (n *fieldNode) eval(env Env) interface{} {
+	if v, ok := env.Lookup(n.name); ok {
+		return normalize(v)
+	}
+	return nil
+}
+
+// normalize converts values into one of: nil, bool, int64, uint64, float64, string.
+// Integers are kept as integer, e,g. BIGINT beyond the precision of float64.
+// uint64 is only for values beyond int64.
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case nil, bool, int64, float64, string:
+		return x
+	case []byte:
+		return string(x)
+	case int:
+		return int64(x)
+	case int8:
+		return int64(x)
+	case int16:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case uint:
+		return normalizeUint(uint64(x))
+	case uint8:
+		return int64(x)
+	case uint16:
+		return int64(x)
+	case uint32:
+		return int64(x)
+	case uint64:
+		return normalizeUint(x)
+	case float32:
+		return float64(x)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+func normalizeUint(x uint64) interface{} {
+	if x <= math.MaxInt64 {
+		return int64(x)
+	}
+	return x
+}
+
+func truthy(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case int64:
+		return x != 0
+	case uint64:
+		return x != 0
+	case float64:
+		return x != 0
+	case string:
+		return x != ""
+	}
+	return true
+}
+
+func toString(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case uint64:
+		return strconv.FormatUint(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int64, uint64, float64:
+		return true
+	}
+	return false
+}
+
+// toNumber converts number or numeric string to normalized number.
+func toNumber(v interface{}) (interface{}, bool) {
+	switch x := v.(type) {
+	case int64, uint64, float64:
+		return x, true
+	case string:
+		return parseNumber(x)
+	}
+	return nil, false
+}
+
+// parseNumber parses s as integer if possible, or else float64.
+func parseNumber(s string) (interface{}, bool) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, true
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return u, true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+// compareNumbers compares 2 normalized numbers, exactly if both are integers.
+func compareNumbers(l, r interface{}) int {
+	switch lx := l.(type) {
+	case int64:
+		switch rx := r.(type) {
+		case int64:
+			return compareInt64(lx, rx)
+		case uint64:
+			// uint64 is beyond int64
+			return -1
+		}
+	case uint64:
+		switch rx := r.(type) {
+		case int64:
+			return 1
+		case uint64:
+			switch {
+			case lx < rx:
+				return -1
+			case lx > rx:
+				return 1
+			}
+			return 0
+		}
+	}
+
+	lf, rf := toFloat(l), toFloat(r)
+	switch {
+	case lf < rf:
+		return -1
+	case lf > rf:
+		return 1
+	}
+	return 0
+}
+
+func compareInt64(l, r int64) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(v interface{}) float64 {
+	switch x := v.(type) {
+	case int64:
+		return float64(x)
+	case uint64:
+		return float64(x)
+	}
+	return v.(float64)
+}
+
+func equal(l, r interface{}) bool {
+	if l == nil || r == nil {
+		return l == nil && r == nil
+	}
+
+	if c, ok := compare(l, r); ok {
+		return c == 0
+	}
+	return false
+}
+
+// compare compares 2 values numerically if either is number, or else as string.
+func compare(l, r interface{}) (int, bool) {
+	if l == nil || r == nil {
+		return 0, false
+	}
+
+	lb, lIsBool := l.(bool)
+	rb, rIsBool := r.(bool)
+	if lIsBool || rIsBool {
+		// false < true
+		switch {
+		case !lIsBool || !rIsBool:
+			return 0, false
+		case lb == rb:
+			return 0, true
+		case rb:
+			return -1, true
+		}
+		return 1, true
+	}
+
+	if isNumber(l) || isNumber(r) {
+		ln, ok1 := toNumber(l)
+		rn, ok2 := toNumber(r)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		return compareNumbers(ln, rn), true
+	}
+
+	ls, rs := toString(l), toString(r)
+	switch {
+	case ls < rs:
+		return -1, true
+	case ls > rs:
+		return 1, true
+	}
+	return 0, true
+}
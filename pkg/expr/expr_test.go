@@ -0,0 +1,120 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestExprEval(t *testing.T) {
+	env := MapEnv{
+		"db":         "order",
+		"dml":        "U",
+		"row.status": int64(3),
+		"row.name":   []byte("alice"),
+		"row.amount": "12.5",
+		"row.memo":   nil,
+		"ddl":        false,
+		"row.id":     int64(9007199254740993), // beyond float64 precision
+		"row.uid":    uint64(18446744073709551615),
+		"row.price":  2.5,
+		"row.qty":    uint8(2),
+	}
+
+	fixtures := []struct {
+		src string
+		ok  bool
+	}{
+		{`db == "order"`, true},
+		{`db != 'order'`, false},
+		{`row.status == 3`, true},
+		{`row.status >= 3 && row.status < 4`, true},
+		{`row.amount > 12`, true},
+		{`row.amount <= 12`, false},
+		{`dml in ["U", "D"]`, true},
+		{`dml not in ["U", "D"]`, false},
+		{`row.status in [1, 2, 3]`, true},
+		{`db == "order" && dml in ["U","D"] && row.status == 3`, true},
+		{`db == "user" || row.name == "alice"`, true},
+		{`!(db == "user")`, true},
+		{`row.name =~ "^ali"`, true},
+		{`row.name !~ "^ali"`, false},
+		{`row.memo == null`, true},
+		{`row.memo =~ ".*"`, false},
+		{`row.missing == null`, true},
+		{`row.missing`, false},
+		{`db`, true},
+		{`ddl == false`, true},
+		{`!ddl && true`, true},
+		{`row.status > "abc"`, false},
+		{`db < "p"`, true},
+		{`row.status == -3`, false},
+		{`false < true`, true},
+		{`true > false`, true},
+		{`false > true`, false},
+		{`true < false`, false},
+		{`ddl <= true`, true},
+		{`ddl == 0`, false},
+		{`ddl != 0`, true},
+		{`row.id == 9007199254740993`, true},
+		{`row.id == 9007199254740992`, false},
+		{`row.id > 9007199254740992`, true},
+		{`row.id in [9007199254740992, 9007199254740994]`, false},
+		{`row.id == "9007199254740993"`, true},
+		{`row.uid == 18446744073709551615`, true},
+		{`row.uid > 9223372036854775807`, true},
+		{`row.uid > row.id`, true},
+		{`-1 < row.uid`, true},
+		{`row.price > 2`, true},
+		{`row.price < 3`, true},
+		{`row.price == 2.5`, true},
+		{`row.qty == 2.0`, true},
+		{`row.qty`, true},
+		{`row.amount == 12.5`, true},
+	}
+	for _, f := range fixtures {
+		e, err := Compile(f.src)
+		if err != nil {
+			t.Errorf("%s: %v", f.src, err)
+			continue
+		}
+		if e.Eval(env) != f.ok {
+			t.Errorf("%s: expected %v", f.src, f.ok)
+		}
+	}
+}
+
+func TestExprFields(t *testing.T) {
+	e := MustCompile(`db == "order" && (row.status == 3 || db == "user")`)
+	assert.Equal(t, 2, len(e.Fields()))
+	assert.Equal(t, `db == "order" && (row.status == 3 || db == "user")`, e.String())
+}
+
+func TestCompileError(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`db ==`,
+		`db == "order`,
+		`(db == "order"`,
+		`db in "order"`,
+		`db in [x]`,
+		`db not "order"`,
+		`db =~ x`,
+		`db =~ "("`,
+		`db == "order" db`,
+		`db = "order"`,
+		`1.2.3 == 1`,
+	} {
+		if _, err := Compile(src); err == nil {
+			t.Errorf("%s: expected error", src)
+		}
+	}
+}
+
+func BenchmarkExprEval(b *testing.B) {
+	e := MustCompile(`db == "order" && dml in ["U","D"] && row.status == 3`)
+	env := MapEnv{"db": "order", "dml": "U", "row.status": int64(3)}
+	for i := 0; i < b.N; i++ {
+		e.Eval(env)
+	}
+}
@@ -0,0 +1,232 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// parser is a recursive descent parser, precedence from low to high:
+// ||, &&, !, comparison.
+type parser struct {
+	tokens []token
+	i      int
+	fields map[string]struct{}
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == op
+}
+
+func (p *parser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && t.text == kw
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, fmt.Errorf("expect %s, got %s at %d", what, t, t.pos)
+	}
+	return t, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("||") {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = &orNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("&&") {
+		p.next()
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = &andNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.isOp("!") {
+		p.next()
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{n}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	l, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	switch {
+	case t.kind == tokOp && (t.text == "==" || t.text == "!=" || t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">="):
+		p.next()
+		r, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return &cmpNode{op: t.text, l: l, r: r}, nil
+
+	case t.kind == tokOp && (t.text == "=~" || t.text == "!~"):
+		p.next()
+		s, err := p.expect(tokString, "regexp string")
+		if err != nil {
+			return nil, err
+		}
+		re, err := regexp.Compile(s.text)
+		if err != nil {
+			return nil, err
+		}
+		return &regexpNode{n: l, re: re, negate: t.text == "!~"}, nil
+
+	case p.isKeyword("in"):
+		p.next()
+		set, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &inNode{n: l, set: set}, nil
+
+	case p.isKeyword("not"):
+		p.next()
+		if !p.isKeyword("in") {
+			return nil, fmt.Errorf("expect in after not at %d", p.peek().pos)
+		}
+		p.next()
+		set, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &inNode{n: l, set: set, negate: true}, nil
+	}
+
+	return l, nil
+}
+
+func (p *parser) parseList() ([]interface{}, error) {
+	if _, err := p.expect(tokLBrack, "["); err != nil {
+		return nil, err
+	}
+
+	var set []interface{}
+	for {
+		if p.peek().kind == tokRBrack && len(set) == 0 {
+			p.next()
+			return set, nil
+		}
+
+		t := p.next()
+		v, ok, err := literal(t)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("expect literal, got %s at %d", t, t.pos)
+		}
+		set = append(set, v)
+
+		t = p.next()
+		switch t.kind {
+		case tokComma:
+		case tokRBrack:
+			return set, nil
+		default:
+			return nil, fmt.Errorf("expect , or ], got %s at %d", t, t.pos)
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	if t.kind == tokLParen {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = p.expect(tokRParen, ")"); err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+
+	v, ok, err := literal(t)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return &literalNode{v}, nil
+	}
+
+	if t.kind == tokIdent && t.text != "in" && t.text != "not" {
+		p.fields[t.text] = struct{}{}
+		return &fieldNode{t.text}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+}
+
+// literal returns the value of a literal token, ok is false if it is not literal.
+func literal(t token) (v interface{}, ok bool, err error) {
+	switch t.kind {
+	case tokString:
+		return t.text, true, nil
+
+	case tokNumber:
+		n, ok := parseNumber(t.text)
+		if !ok {
+			return nil, false, fmt.Errorf("invalid number %s at %d", t.text, t.pos)
+		}
+		return n, true, nil
+
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return true, true, nil
+		case "false":
+			return false, true, nil
+		case "null":
+			return nil, true, nil
+		}
+	}
+
+	return nil, false, nil
+}
@@ -0,0 +1,176 @@
+package idempotent
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+)
+
+var _ Repository = &Disk{}
+
+// Disk is an embedded on-disk Repository.
+// It keeps the latest ids in memory and persists them in an append-only file, one
+// id per line. Ids beyond the capacity are evicted in FIFO order, and the file is
+// compacted when it grows twice as large as the capacity.
+//
+// Each id is written to the file without buffering, so that it survives process
+// crash, but not necessarily OS crash.
+type Disk struct {
+	mu       sync.Mutex
+	path     string
+	capacity int
+	f        *os.File
+	lines    int // lines of the file
+
+	ids   map[string]struct{}
+	order []string // ids in insertion order
+}
+
+// NewDisk opens or creates a Disk repository that remembers the latest capacity ids.
+func NewDisk(path string, capacity int) (*Disk, error) {
+	d := &Disk{
+		path:     path,
+		capacity: capacity,
+		ids:      make(map[string]struct{}, capacity),
+	}
+
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if d.f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Disk) load() error {
+	f, err := os.Open(d.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		d.lines++
+		if id := scanner.Text(); id != "" {
+			d.remember(id)
+		}
+	}
+
+	// a torn last line of crash is harmless: it is just an unknown id
+	return scanner.Err()
+}
+
+func (d *Disk) remember(id string) {
+	if _, present := d.ids[id]; present {
+		return
+	}
+
+	d.ids[id] = struct{}{}
+	d.order = append(d.order, id)
+	if len(d.order) > d.capacity {
+		delete(d.ids, d.order[0])
+		d.order[0] = ""
+		d.order = d.order[1:]
+	}
+}
+
+// Add implements Repository.
+func (d *Disk) Add(id string) error {
+	if id == "" || strings.IndexByte(id, '\n') >= 0 {
+		return ErrInvalidID
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.f == nil {
+		return ErrClosed
+	}
+
+	if _, present := d.ids[id]; present {
+		return nil
+	}
+
+	if _, err := d.f.WriteString(id + "\n"); err != nil {
+		return err
+	}
+	d.lines++
+	d.remember(id)
+
+	if d.lines > 2*d.capacity {
+		return d.compact()
+	}
+	return nil
+}
+
+// Contains implements Repository.
+func (d *Disk) Contains(id string) bool {
+	d.mu.Lock()
+	_, present := d.ids[id]
+	d.mu.Unlock()
+	return present
+}
+
+// Len returns number of ids in the repository.
+func (d *Disk) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.order)
+}
+
+// compact rewrites the file with the ids in memory.
+// The rewritten file is swapped in only if it is fully written, and its handle survives
+// the rename, so that the current file keeps working on any failure.
+func (d *Disk) compact() error {
+	tmp := d.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, id := range d.order {
+		w.WriteString(id)
+		w.WriteByte('\n')
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, d.path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	d.f.Close()
+	d.f = f
+	d.lines = len(d.order)
+	return nil
+}
+
+// Close implements Repository.
+func (d *Disk) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.f == nil {
+		return nil
+	}
+
+	err := d.f.Sync()
+	if e := d.f.Close(); err == nil {
+		err = e
+	}
+	d.f = nil
+	return err
+}
@@ -0,0 +1,94 @@
+package idempotent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func tempRepoFile(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "idempotent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "ids"), func() { os.RemoveAll(dir) }
+}
+
+func TestDiskAddContains(t *testing.T) {
+	path, cleanup := tempRepoFile(t)
+	defer cleanup()
+
+	d, err := NewDisk(path, 10)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, d.Contains("a"))
+	assert.Equal(t, nil, d.Add("a"))
+	assert.Equal(t, nil, d.Add("a"))
+	assert.Equal(t, true, d.Contains("a"))
+	assert.Equal(t, 1, d.Len())
+	assert.Equal(t, ErrInvalidID, d.Add(""))
+	assert.Equal(t, ErrInvalidID, d.Add("a\nb"))
+	assert.Equal(t, nil, d.Close())
+	assert.Equal(t, ErrClosed, d.Add("b"))
+
+	// reload
+	d, err = NewDisk(path, 10)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, d.Contains("a"))
+	assert.Equal(t, false, d.Contains("b"))
+	d.Close()
+}
+
+func TestDiskEvictAndCompact(t *testing.T) {
+	path, cleanup := tempRepoFile(t)
+	defer cleanup()
+
+	d, err := NewDisk(path, 3)
+	assert.Equal(t, nil, err)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, nil, d.Add(fmt.Sprintf("id%d", i)))
+	}
+	assert.Equal(t, 3, d.Len())
+	assert.Equal(t, false, d.Contains("id6"))
+	assert.Equal(t, true, d.Contains("id7"))
+	assert.Equal(t, true, d.Contains("id9"))
+	assert.Equal(t, true, d.lines <= 6)
+	d.Close()
+
+	d, err = NewDisk(path, 3)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, d.Len())
+	assert.Equal(t, true, d.Contains("id7"))
+	assert.Equal(t, false, d.Contains("id6"))
+	d.Close()
+}
+
+func TestDiskCompactFailure(t *testing.T) {
+	path, cleanup := tempRepoFile(t)
+	defer cleanup()
+
+	d, err := NewDisk(path, 1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, d.Add("id0"))
+
+	// the compacted file can not be created
+	assert.Equal(t, nil, os.Mkdir(path+".tmp", 0755))
+	assert.Equal(t, nil, d.Add("id1"))
+	assert.NotEqual(t, nil, d.Add("id2"))
+	assert.NotEqual(t, nil, d.Add("id3"))
+
+	// compacted once the failure is gone, and appended to the compacted file
+	assert.Equal(t, nil, os.Remove(path+".tmp"))
+	assert.Equal(t, nil, d.Add("id4"))
+	assert.Equal(t, nil, d.Add("id5"))
+	assert.Equal(t, nil, d.Close())
+
+	d, err = NewDisk(path, 1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, d.Contains("id5"))
+	assert.Equal(t, 2, d.lines)
+	d.Close()
+}
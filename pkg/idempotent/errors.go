@@ -0,0 +1,10 @@
+package idempotent
+
+import (
+	"errors"
+)
+
+var (
+	ErrInvalidID = errors.New("invalid id")
+	ErrClosed    = errors.New("repository closed")
+)
@@ -1,5 +1,16 @@
 // Package idempotent provides storage to filter duplicated content.
 package idempotent
 
+// Repository records the ids of processed content, so that content replayed after
+// a crash can be recognized and dropped.
 type Repository interface {
+
+	// Add records the id as processed.
+	Add(id string) error
+
+	// Contains checks whether the id is processed.
+	Contains(id string) bool
+
+	// Close flushes and closes the repository.
+	Close() error
 }
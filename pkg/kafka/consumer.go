@@ -5,8 +5,16 @@ import (
 
 	"github.com/Shopify/sarama"
 	"github.com/funkygao/dbus/engine"
+	log "github.com/funkygao/log4go"
 )
 
+// Message is a consumed kafka message with the DSN of the partition it comes from.
+type Message struct {
+	*sarama.ConsumerMessage
+
+	DSN string
+}
+
 // Consumer is a kafka low level consumer that can consumer multiple zone/cluster kafka clusters.
 type Consumer struct {
 	dsns    []string
@@ -19,8 +27,10 @@ type Consumer struct {
 	wg   sync.WaitGroup
 	once sync.Once
 
+	offsets map[string]int64 // dsn:offset to resume from
+
 	errors   chan error
-	messages chan *sarama.ConsumerMessage
+	messages chan *Message
 }
 
 // NewConsumer returns a kafka consumer.
@@ -28,14 +38,21 @@ func NewConsumer(dsns []string, cf *Config) *Consumer {
 	return &Consumer{
 		dsns:      dsns,
 		cf:        cf,
-		messages:  make(chan *sarama.ConsumerMessage, cf.consumeChanBufSize),
+		messages:  make(chan *Message, cf.consumeChanBufSize),
 		errors:    make(chan error, cf.consumeChanBufSize),
 		stopper:   make(chan struct{}),
 		consumers: make(map[zoneCluster]sarama.Consumer),
+		offsets:   make(map[string]int64),
 	}
 }
 
-func (c *Consumer) Messages() <-chan *sarama.ConsumerMessage {
+// ResumeFrom sets the offset from which a partition starts consuming, must be called before Start.
+// Partitions without resume offset start from Config.Sarama.Consumer.Offsets.Initial.
+func (c *Consumer) ResumeFrom(dsn string, offset int64) {
+	c.offsets[dsn] = offset
+}
+
+func (c *Consumer) Messages() <-chan *Message {
 	return c.messages
 }
 
@@ -97,12 +114,19 @@ func (c *Consumer) consumerCluster(tp topicPartitions) {
 	var wg sync.WaitGroup
 	for topic, partitions := range tp.tps {
 		for _, partitionID := range partitions {
-			// FIXME initial offset, integration with checkpoint pkg
+			dsn := tp.dsns[topic][partitionID]
+			offset, present := c.offsets[dsn]
+			if !present {
+				offset = c.cf.Sarama.Consumer.Offsets.Initial
+			}
+
 		RETRY:
-			pc, err := consumer.ConsumePartition(topic, partitionID, sarama.OffsetNewest)
+			pc, err := consumer.ConsumePartition(topic, partitionID, offset)
 			if err != nil {
-				if err == sarama.ErrOffsetOutOfRange {
-					// TODO reset offset and retry
+				if err == sarama.ErrOffsetOutOfRange && offset != sarama.OffsetOldest {
+					// e,g. the resume offset has been deleted by retention
+					log.Warn("%s offset %d out of range, reset to oldest", dsn, offset)
+					offset = sarama.OffsetOldest
 					goto RETRY
 				}
 
@@ -111,14 +135,14 @@ func (c *Consumer) consumerCluster(tp topicPartitions) {
 			}
 
 			wg.Add(1)
-			go c.consumePartition(pc, &wg)
+			go c.consumePartition(pc, dsn, &wg)
 		}
 	}
 
 	wg.Wait()
 }
 
-func (c *Consumer) consumePartition(pc sarama.PartitionConsumer, wg *sync.WaitGroup) {
+func (c *Consumer) consumePartition(pc sarama.PartitionConsumer, dsn string, wg *sync.WaitGroup) {
 	defer func() {
 		pc.Close()
 		wg.Done()
@@ -139,7 +163,7 @@ func (c *Consumer) consumePartition(pc sarama.PartitionConsumer, wg *sync.WaitGr
 			}
 
 			// TODO if blocked, consumer can't be stopped
-			c.messages <- msg
+			c.messages <- &Message{ConsumerMessage: msg, DSN: dsn}
 		}
 	}
 }
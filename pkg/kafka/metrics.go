@@ -2,6 +2,7 @@ package kafka
 
 import (
 	"strings"
+	"sync"
 
 	"github.com/funkygao/gafka/telemetry"
 	"github.com/funkygao/go-metrics"
@@ -17,6 +18,19 @@ type producerMetrics struct {
 
 	syncOk   metrics.Meter
 	syncFail metrics.Meter
+
+	topicsLock sync.Mutex
+	topics     map[string]*topicMetrics
+}
+
+// topicMetrics is the per topic metrics of a producer, which is useful when
+// messages are routed to dynamic topics.
+type topicMetrics struct {
+	prefix string
+
+	send metrics.Meter
+	ok   metrics.Meter
+	fail metrics.Meter
 }
 
 func newMetrics(name string) *producerMetrics {
@@ -30,9 +44,30 @@ func newMetrics(name string) *producerMetrics {
 
 		//syncOk:    metrics.NewRegisteredMeter(tag+"dbus.kafka.sync.ok", metrics.DefaultRegistry),
 		//syncFail:  metrics.NewRegisteredMeter(tag+"dbus.kafka.sync.fail", metrics.DefaultRegistry),
+
+		topics: make(map[string]*topicMetrics),
 	}
 }
 
+func (m *producerMetrics) topic(topic string) *topicMetrics {
+	m.topicsLock.Lock()
+	defer m.topicsLock.Unlock()
+
+	if tm, present := m.topics[topic]; present {
+		return tm
+	}
+
+	prefix := m.tag + "dbus.kafka.topic." + strings.Replace(topic, ".", "_", -1)
+	tm := &topicMetrics{
+		prefix: prefix,
+		send:   metrics.NewRegisteredMeter(prefix+".send", metrics.DefaultRegistry),
+		ok:     metrics.NewRegisteredMeter(prefix+".ok", metrics.DefaultRegistry),
+		fail:   metrics.NewRegisteredMeter(prefix+".fail", metrics.DefaultRegistry),
+	}
+	m.topics[topic] = tm
+	return tm
+}
+
 func (m *producerMetrics) Close() {
 	// TODO flush metrics
 	metrics.Unregister(m.tag + "dbus.kafka.async.send")
@@ -41,4 +76,12 @@ func (m *producerMetrics) Close() {
 
 	//metrics.Unregister(m.tag + "dbus.kafka.sync.ok")
 	//metrics.Unregister(m.tag + "dbus.kafka.sync.fail")
+
+	m.topicsLock.Lock()
+	for _, tm := range m.topics {
+		metrics.Unregister(tm.prefix + ".send")
+		metrics.Unregister(tm.prefix + ".ok")
+		metrics.Unregister(tm.prefix + ".fail")
+	}
+	m.topicsLock.Unlock()
 }
@@ -0,0 +1,81 @@
+package kafka
+
+import (
+	"sort"
+	"sync"
+)
+
+// OffsetTracker tracks the acked offsets of a partition whose messages might be
+// acked out of order, and finds the offset from which consuming can safely resume.
+//
+// Offsets of a partition are not necessarily contiguous, e,g. compacted topic, so
+// it tracks the delivered offsets instead of assuming offset+1.
+type OffsetTracker struct {
+	mu       sync.Mutex
+	inflight []int64 // delivered and not yet committed offsets in delivery order
+	acked    map[int64]struct{}
+	next     int64
+}
+
+// NewOffsetTracker creates an OffsetTracker that resumes from the next offset.
+func NewOffsetTracker(next int64) *OffsetTracker {
+	return &OffsetTracker{
+		acked: make(map[int64]struct{}),
+		next:  next,
+	}
+}
+
+// Deliver records that a message is delivered and waiting for ack.
+// It must be called in offset order before the message can be acked.
+func (t *OffsetTracker) Deliver(offset int64) {
+	t.mu.Lock()
+	t.inflight = append(t.inflight, offset)
+	t.mu.Unlock()
+}
+
+// Ack marks a delivered message as processed.
+// It returns the next offset to resume from and whether it advances, which
+// happens only when all the messages delivered before are acked.
+func (t *OffsetTracker) Ack(offset int64) (next int64, advanced bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.delivered(offset) {
+		// duplicated ack or never delivered offset
+		return t.next, false
+	}
+
+	t.acked[offset] = struct{}{}
+
+	i := 0
+	for ; i < len(t.inflight); i++ {
+		head := t.inflight[i]
+		if _, present := t.acked[head]; !present {
+			break
+		}
+
+		delete(t.acked, head)
+		t.next = head + 1
+	}
+
+	if i == 0 {
+		return t.next, false
+	}
+
+	t.inflight = t.inflight[i:]
+	return t.next, true
+}
+
+// delivered checks whether the offset is delivered and not yet committable.
+// inflight is in ascending order because messages of a partition are delivered in order.
+func (t *OffsetTracker) delivered(offset int64) bool {
+	i := sort.Search(len(t.inflight), func(i int) bool { return t.inflight[i] >= offset })
+	return i < len(t.inflight) && t.inflight[i] == offset
+}
+
+// Pending returns number of delivered messages that are not committable yet.
+func (t *OffsetTracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.inflight)
+}
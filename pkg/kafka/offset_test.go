@@ -0,0 +1,52 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	tr := NewOffsetTracker(10)
+	for _, offset := range []int64{10, 11, 13, 14} { // 12 compacted
+		tr.Deliver(offset)
+	}
+
+	next, advanced := tr.Ack(11)
+	assert.Equal(t, false, advanced)
+	assert.Equal(t, int64(10), next)
+
+	next, advanced = tr.Ack(14)
+	assert.Equal(t, false, advanced)
+
+	next, advanced = tr.Ack(10)
+	assert.Equal(t, true, advanced)
+	assert.Equal(t, int64(12), next)
+	assert.Equal(t, 2, tr.Pending())
+
+	// duplicated ack
+	next, advanced = tr.Ack(10)
+	assert.Equal(t, false, advanced)
+	assert.Equal(t, int64(12), next)
+
+	// never delivered offsets
+	for _, offset := range []int64{9, 12, 20} {
+		next, advanced = tr.Ack(offset)
+		assert.Equal(t, false, advanced)
+		assert.Equal(t, int64(12), next)
+	}
+
+	next, advanced = tr.Ack(13)
+	assert.Equal(t, true, advanced)
+	assert.Equal(t, int64(15), next)
+	assert.Equal(t, 0, tr.Pending())
+	assert.Equal(t, 0, len(tr.acked))
+}
+
+func BenchmarkOffsetTracker(b *testing.B) {
+	tr := NewOffsetTracker(0)
+	for i := 0; i < b.N; i++ {
+		tr.Deliver(int64(i))
+		tr.Ack(int64(i))
+	}
+}
@@ -6,8 +6,8 @@ import (
 	"time"
 
 	"github.com/Shopify/sarama"
-	"github.com/funkygao/dbus/engine"
 	"github.com/funkygao/dbus/pkg/batcher"
+	"github.com/funkygao/dbus/pkg/idempotent"
 	log "github.com/funkygao/log4go"
 )
 
@@ -21,6 +21,7 @@ type Producer struct {
 	b       batcher.Batcher
 	m       *producerMetrics
 
+	c  sarama.Client
 	p  sarama.SyncProducer
 	ap sarama.AsyncProducer
 
@@ -29,6 +30,14 @@ type Producer struct {
 
 	onError   func(*sarama.ProducerError)
 	onSuccess func(*sarama.ProducerMessage)
+
+	repo idempotent.Repository
+}
+
+// Identifier is implemented by message metadata that has a deterministic id,
+// which is required for idempotent producing.
+type Identifier interface {
+	MessageID() string
 }
 
 // NewProducer creates a uniform kafka producer.
@@ -59,20 +68,29 @@ func (p *Producer) Start() error {
 		return nil
 	}
 
+	if p.cf.async && (p.onError == nil || p.onSuccess == nil) {
+		return ErrNotReady
+	}
+
+	// the client is shared with topic metadata queries
+	if p.c, err = sarama.NewClient(p.brokers, p.cf.Sarama); err != nil {
+		return err
+	}
+
 	if !p.cf.async {
 		// sync mode
-		p.p, err = sarama.NewSyncProducer(p.brokers, p.cf.Sarama)
+		if p.p, err = sarama.NewSyncProducerFromClient(p.c); err != nil {
+			p.c.Close()
+			return err
+		}
 		p.Send = p.syncSend
-		return err
+		return nil
 	}
 
 	// async mode
-	if p.onError == nil || p.onSuccess == nil {
-		return ErrNotReady
-	}
-
 	p.b = batcher.NewDisruptor(p.cf.Sarama.Producer.Flush.Messages)
-	if p.ap, err = sarama.NewAsyncProducer(p.brokers, p.cf.Sarama); err != nil {
+	if p.ap, err = sarama.NewAsyncProducerFromClient(p.c); err != nil {
+		p.c.Close()
 		return err
 	}
 
@@ -99,10 +117,37 @@ func (p *Producer) Close() error {
 		p.ap.AsyncClose()
 		p.b.Close()
 		p.wg.Wait()
-		return nil
+		return p.c.Close()
+	}
+
+	if err := p.p.Close(); err != nil {
+		return err
+	}
+	return p.c.Close()
+}
+
+// TopicExists checks whether the topic exists in the kafka cluster.
+// Cluster metadata is reloaded from brokers for all topics, which never auto creates the topic.
+// In dryrun mode, all topics exist.
+func (p *Producer) TopicExists(topic string) (bool, error) {
+	if p.cf.dryrun {
+		return true, nil
+	}
+
+	if err := p.c.RefreshMetadata(); err != nil {
+		return false, err
 	}
 
-	return p.p.Close()
+	topics, err := p.c.Topics()
+	if err != nil {
+		return false, err
+	}
+	for _, t := range topics {
+		if t == topic {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 // ClientID returns the client id for the kafka connection.
@@ -130,6 +175,19 @@ func (p *Producer) SetErrorHandler(f func(err *sarama.ProducerError)) error {
 	return nil
 }
 
+// SetRepository enables idempotent producing for async producer: ids of successfully
+// produced messages are recorded in the repository before success handler is called,
+// and messages that are already produced are not sent again when the batch retries.
+// Messages without Identifier metadata are not deduplicated.
+func (p *Producer) SetRepository(repo idempotent.Repository) error {
+	if !p.cf.async || p.cf.dryrun {
+		return ErrNotAllowed
+	}
+
+	p.repo = repo
+	return nil
+}
+
 // SetSuccessHandler sets the success produced message callback for async producer.
 // And it is *REQUIRED* for async producer.
 // For sync producer it is not allowed.
@@ -152,8 +210,10 @@ func (p *Producer) syncSend(m *sarama.ProducerMessage) error {
 	_, _, err := p.p.SendMessage(m)
 	if err != nil {
 		p.m.syncFail.Mark(1)
+		p.m.topic(m.Topic).fail.Mark(1)
 	} else {
 		p.m.syncOk.Mark(1)
+		p.m.topic(m.Topic).ok.Mark(1)
 	}
 	return err
 }
@@ -161,8 +221,12 @@ func (p *Producer) syncSend(m *sarama.ProducerMessage) error {
 func (p *Producer) dryrunSend(m *sarama.ProducerMessage) error {
 	p.b.Put(m)
 	p.b.Succeed() // i,e. onSuccess called silently
-	pack := m.Metadata.(*engine.Packet)
-	pack.Recycle()
+	if pack, ok := m.Metadata.(interface {
+		Recycle()
+	}); ok {
+		// e,g. *engine.Packet
+		pack.Recycle()
+	}
 	return nil
 }
 
@@ -171,6 +235,15 @@ func (p *Producer) asyncSend(m *sarama.ProducerMessage) error {
 	return nil
 }
 
+func (p *Producer) produced(m *sarama.ProducerMessage) bool {
+	if p.repo == nil {
+		return false
+	}
+
+	id, ok := m.Metadata.(Identifier)
+	return ok && p.repo.Contains(id.MessageID())
+}
+
 func (p *Producer) asyncSendWorker() {
 	defer p.wg.Done()
 
@@ -187,8 +260,16 @@ func (p *Producer) asyncSendWorker() {
 				default:
 				}
 
-				p.ap.Input() <- msg.(*sarama.ProducerMessage)
+				m := msg.(*sarama.ProducerMessage)
+				if p.produced(m) {
+					// batch retry of an already produced message
+					p.b.Succeed()
+					continue
+				}
+
+				p.ap.Input() <- m
 				p.m.asyncSend.Mark(1)
+				p.m.topic(m.Topic).send.Mark(1)
 			} else {
 				log.Trace("[%s] batcher closed", p.name)
 				return
@@ -214,8 +295,15 @@ func (p *Producer) dispatchCallbacks() {
 			if !ok {
 				okChan = nil
 			} else {
+				if id, ok := msg.Metadata.(Identifier); ok && p.repo != nil {
+					if err := p.repo.Add(id.MessageID()); err != nil {
+						log.Error("[%s] %s: %v", p.name, id.MessageID(), err)
+					}
+				}
+
 				p.b.Succeed()
 				p.m.asyncOk.Mark(1)
+				p.m.topic(msg.Topic).ok.Mark(1)
 				p.onSuccess(msg)
 			}
 
@@ -231,6 +319,7 @@ func (p *Producer) dispatchCallbacks() {
 					time.Sleep(time.Second)
 				}
 				p.m.asyncFail.Mark(1)
+				p.m.topic(err.Msg.Topic).fail.Mark(1)
 				p.onError(err)
 			}
 		}
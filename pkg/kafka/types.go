@@ -7,12 +7,14 @@ type zoneCluster struct {
 
 // TODO rename
 type topicPartitions struct {
-	zc  zoneCluster
-	tps map[string][]int32 // topic:partitions
+	zc   zoneCluster
+	tps  map[string][]int32          // topic:partitions
+	dsns map[string]map[int32]string // topic:partition:dsn
 }
 
 func parseDSNs(dsns []string) ([]topicPartitions, error) {
 	var m = make(map[zoneCluster]map[string][]int32)
+	var d = make(map[zoneCluster]map[string]map[int32]string)
 	for _, dsn := range dsns {
 		zone, cluster, topic, partitionID, err := ParseDSN(dsn)
 		if err != nil {
@@ -22,18 +24,21 @@ func parseDSNs(dsns []string) ([]topicPartitions, error) {
 		zc := zoneCluster{zone: zone, cluster: cluster}
 		if _, present := m[zc]; !present {
 			m[zc] = make(map[string][]int32)
+			d[zc] = make(map[string]map[int32]string)
 		}
 		if _, present := m[zc][topic]; !present {
 			m[zc][topic] = make([]int32, 0)
+			d[zc][topic] = make(map[int32]string)
 		}
 
 		// TODO check dup partitionID
 		m[zc][topic] = append(m[zc][topic], partitionID)
+		d[zc][topic][partitionID] = dsn
 	}
 
 	var r []topicPartitions
 	for zc, tps := range m {
-		r = append(r, topicPartitions{zc: zc, tps: tps})
+		r = append(r, topicPartitions{zc: zc, tps: tps, dsns: d[zc]})
 	}
 
 	return r, nil
@@ -21,6 +21,7 @@ func TestParseDSNs(t *testing.T) {
 	assert.Equal(t, 2, len(getByZoneCluster(tps, "prod", "user").tps))            // prod.user has 2 topics
 	assert.Equal(t, 1, len(getByZoneCluster(tps, "prod", "user").tps["foobar"]))  // foobar has 1 partition
 	assert.Equal(t, 2, len(getByZoneCluster(tps, "prod", "user").tps["teacher"])) // teacher has 2 partitions
+	assert.Equal(t, "kafka:prod://user/teacher#3", getByZoneCluster(tps, "prod", "user").dsns["teacher"][3])
 }
 
 func getByZoneCluster(tps []topicPartitions, zone, cluster string) *topicPartitions {
@@ -0,0 +1,14 @@
+package model
+
+import (
+	"github.com/funkygao/dbus/engine"
+)
+
+// BinlogEvent is a mysql binlog event that can be transferred between plugins.
+// Currently RowsEvent and DDLEvent.
+type BinlogEvent interface {
+	engine.Payloader
+
+	// MetaInfo returns the brief description of the event for logging.
+	MetaInfo() string
+}
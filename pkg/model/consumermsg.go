@@ -7,6 +7,7 @@ import (
 
 var (
 	_ engine.Payloader = &ConsumerMessage{}
+	_ engine.Cloner    = &ConsumerMessage{}
 )
 
 // ConsumerMessage is a kafka consumer messsage that is also a payloader.
@@ -21,3 +22,15 @@ func (m ConsumerMessage) Length() int {
 func (m ConsumerMessage) Encode() ([]byte, error) {
 	return m.Value, nil
 }
+
+// ClonePayload implements engine.Cloner.
+func (m ConsumerMessage) ClonePayload() engine.Payloader {
+	if m.ConsumerMessage == nil {
+		return m
+	}
+
+	msg := *m.ConsumerMessage
+	msg.Key = append([]byte(nil), m.Key...)
+	msg.Value = append([]byte(nil), m.Value...)
+	return ConsumerMessage{ConsumerMessage: &msg}
+}
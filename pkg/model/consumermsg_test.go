@@ -2,8 +2,26 @@ package model
 
 import (
 	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/assert"
 )
 
 func TestConsumerMessage(t *testing.T) {
 	t.SkipNow()
 }
+
+func TestConsumerMessageClonePayload(t *testing.T) {
+	m := ConsumerMessage{ConsumerMessage: &sarama.ConsumerMessage{
+		Key:    []byte("k"),
+		Value:  []byte("hello"),
+		Offset: 10,
+	}}
+
+	c := m.ClonePayload().(ConsumerMessage)
+	c.Value[0] = 'j'
+	assert.Equal(t, "hello", string(m.Value))
+	assert.Equal(t, int64(10), c.Offset)
+
+	assert.Equal(t, ConsumerMessage{}, ConsumerMessage{}.ClonePayload())
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/dbus/engine"
+)
+
+var (
+	_ engine.Payloader = &DDLEvent{}
+	_ engine.Cloner    = &DDLEvent{}
+	_ sarama.Encoder   = &DDLEvent{}
+	_ BinlogEvent      = &DDLEvent{}
+)
+
+// All DDL actions.
+const (
+	DDLCreate   = "CREATE"
+	DDLAlter    = "ALTER"
+	DDLDrop     = "DROP"
+	DDLRename   = "RENAME"
+	DDLTruncate = "TRUNCATE"
+)
+
+// DDLEvent is a structured mysql binlog table schema change event.
+// It implements engine.Payloader interface and can be transferred between plugins.
+type DDLEvent struct {
+	Log           string `json:"log"`
+	Position      uint32 `json:"pos"`
+	Schema        string `json:"db"`  // default database of the statement session
+	Action        string `json:"ddl"` // CREATE|ALTER|DROP|RENAME|TRUNCATE
+	Timestamp     uint32 `json:"ts"`  // timestamp of binlog from master
+	DbusTimestamp int64  `json:"dt"`  // timestamp of dbus receiving the binlog
+	GTID          string `json:"gtid,omitempty"`
+
+	// Tables are the affected tables in the form of db.table.
+	// For RENAME, tables are pairs of [from, to].
+	Tables []string `json:"tbls"`
+
+	// Query is the original DDL SQL statement.
+	Query string `json:"sql"`
+
+	// executed GTID set after this DDL, used for checkpoint.
+	gtidSet string
+
+	encoded []byte
+	err     error
+}
+
+func (e *DDLEvent) ensureEncoded() {
+	if e.encoded == nil {
+		e.encoded, e.err = json.Marshal(e)
+	}
+}
+
+// Used for debugging.
+func (e *DDLEvent) String() string {
+	return fmt.Sprintf("%s %d %d %s %s %+v %s", e.Log, e.Position, e.Timestamp, e.Action, e.Schema, e.Tables, e.Query)
+}
+
+func (e *DDLEvent) MetaInfo() string {
+	return fmt.Sprintf("{%s %d %d %s %s %+v}", e.Log, e.Position, e.Timestamp, e.Action, e.Schema, e.Tables)
+}
+
+// Encode implements engine.Payloader and sarama.Encoder.
+func (e *DDLEvent) Encode() (b []byte, err error) {
+	e.ensureEncoded()
+	return e.encoded, e.err
+}
+
+// Length implements engine.Payloader and sarama.Encoder.
+func (e *DDLEvent) Length() int {
+	e.ensureEncoded()
+	return len(e.encoded)
+}
+
+// Clone returns a deep copy of the event that can be modified without affecting
+// the original one, which might be shared by other plugins.
+func (e *DDLEvent) Clone() *DDLEvent {
+	c := *e
+	c.encoded, c.err = nil, nil
+	c.Tables = append([]string(nil), e.Tables...)
+	return &c
+}
+
+// ClonePayload implements engine.Cloner.
+func (e *DDLEvent) ClonePayload() engine.Payloader {
+	return e.Clone()
+}
+
+// Invalidate discards the cached encoding, it must be called after modifying the event
+// that might have been encoded.
+func (e *DDLEvent) Invalidate() {
+	e.encoded, e.err = nil, nil
+}
+
+// SetGTIDSet records the executed GTID set from which replication can
+// safely resume after this event.
+func (e *DDLEvent) SetGTIDSet(set string) *DDLEvent {
+	e.gtidSet = set
+	return e
+}
+
+// GTIDSet returns the resumable executed GTID set of this event.
+func (e *DDLEvent) GTIDSet() string {
+	return e.gtidSet
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestDDLEventEncode(t *testing.T) {
+	e := &DDLEvent{
+		Log:       "mysql-bin.0001",
+		Position:  498876,
+		Schema:    "mydabase",
+		Action:    DDLRename,
+		Timestamp: 1486554654,
+		Tables:    []string{"mydabase.user", "mydabase._user_del", "mydabase._user_gho", "mydabase.user"},
+		Query:     "RENAME TABLE user TO _user_del, _user_gho TO user",
+	}
+	b, err := e.Encode()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `{"log":"mysql-bin.0001","pos":498876,"db":"mydabase","ddl":"RENAME","ts":1486554654,"dt":0,"tbls":["mydabase.user","mydabase._user_del","mydabase._user_gho","mydabase.user"],"sql":"RENAME TABLE user TO _user_del, _user_gho TO user"}`, string(b))
+	assert.Equal(t, len(b), e.Length())
+}
+
+func TestDDLEventClone(t *testing.T) {
+	e := &DDLEvent{
+		Schema: "mydabase",
+		Action: DDLRename,
+		Tables: []string{"mydabase.user", "mydabase._user_del"},
+	}
+	b, _ := e.Encode()
+
+	c := e.ClonePayload().(*DDLEvent)
+	c.Tables[0] = "mydabase.foo"
+	assert.Equal(t, "mydabase.user", e.Tables[0])
+	assert.Equal(t, 0, len(c.encoded))
+
+	c.Invalidate()
+	b1, _ := c.Encode()
+	assert.NotEqual(t, string(b), string(b1))
+}
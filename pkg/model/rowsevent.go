@@ -11,9 +11,14 @@ import (
 	"github.com/siddontang/go-mysql/replication"
 )
 
+// ActionSnapshot is the RowsEvent action of rows dumped by initial snapshot.
+const ActionSnapshot = "S"
+
 var (
 	_ engine.Payloader = &RowsEvent{}
+	_ engine.Cloner    = &RowsEvent{}
 	_ sarama.Encoder   = &RowsEvent{}
+	_ BinlogEvent      = &RowsEvent{}
 
 	rowsEventMarshaller func(v interface{}) ([]byte, error)
 )
@@ -28,11 +33,20 @@ type RowsEvent struct {
 	Position      uint32 `json:"pos"`
 	Schema        string `json:"db"`
 	Table         string `json:"tbl"`
-	Action        string `json:"dml"`
-	Timestamp     uint32 `json:"ts"` // timestamp of binlog from master
-	DbusTimestamp int64  `json:"dt"` // timestamp of dbus receiving the binlog
+	Action        string `json:"dml"`            // I|U|D, or S for row of initial snapshot
+	Timestamp     uint32 `json:"ts"`             // timestamp of binlog from master
+	DbusTimestamp int64  `json:"dt"`             // timestamp of dbus receiving the binlog
+	GTID          string `json:"gtid,omitempty"` // GTID of the transaction, only in GTID mode
+
+	// transaction boundary info, only available in txn boundary mode, except that TxnSeq
+	// is also available in GTID mode.
+	TxnID  uint32 `json:"txid,omitempty"`  // binlog position of the transaction BEGIN, unique within Log
+	TxnSeq int    `json:"txseq,omitempty"` // sequence of the event within the transaction, starting from 1
+	TxnEnd bool   `json:"txend,omitempty"` // whether it is the last event of the transaction
 
-	Columns []string `json:"cols"` // column names
+	Columns     []string `json:"cols"`            // column names
+	ColumnTypes []Column `json:"types,omitempty"` // column metadata in the same order of Columns
+	PKs         []int    `json:"pks,omitempty"`   // indexes of primary key columns
 
 	// binlog has three update event version, v0, v1 and v2.
 	// for v1 and v2, the rows number must be even.
@@ -44,6 +58,19 @@ type RowsEvent struct {
 	// e,g. RowsEventStmtEndFlag
 	flags uint16
 
+	// executed GTID set before this transaction, used for checkpoint.
+	gtidSet string
+
+	// binlog position of the transaction commit, used for checkpoint.
+	txnCommitPos uint32
+
+	// snapshot progress: primary key of the last row and whether the table is done.
+	snapshotPK  []string
+	snapshotEnd bool
+
+	// offset of Rows in the original event, set by SplitRows.
+	rowIndex int
+
 	encoded []byte
 	err     error
 }
@@ -84,6 +111,109 @@ func (r *RowsEvent) IsStmtEnd() bool {
 	return (r.flags & replication.RowsEventStmtEndFlag) > 0
 }
 
+// Clone returns a deep copy of the event that can be modified without affecting
+// the original one, which might be shared by other plugins.
+func (r *RowsEvent) Clone() *RowsEvent {
+	return r.CloneWithRows(r.Rows)
+}
+
+// CloneWithRows returns a deep copy of the event with only the given rows, which are
+// typically a subset of the event rows.
+func (r *RowsEvent) CloneWithRows(rows [][]interface{}) *RowsEvent {
+	e := *r
+	e.encoded, e.err = nil, nil
+	e.Columns = append([]string(nil), r.Columns...)
+	e.ColumnTypes = append([]Column(nil), r.ColumnTypes...)
+	e.PKs = append([]int(nil), r.PKs...)
+	e.Rows = make([][]interface{}, len(rows))
+	for i, row := range rows {
+		e.Rows[i] = append([]interface{}(nil), row...)
+	}
+	return &e
+}
+
+// ClonePayload implements engine.Cloner.
+func (r *RowsEvent) ClonePayload() engine.Payloader {
+	return r.Clone()
+}
+
+// Invalidate discards the cached encoding, it must be called after modifying the event
+// that might have been encoded.
+func (r *RowsEvent) Invalidate() {
+	r.encoded, r.err = nil, nil
+}
+
+// SplitRows splits the event into events of a single row each, or a single
+// [before update row, after update row] pair for update, so that each row can be
+// routed independently. The event itself is returned if no need to split.
+func (r *RowsEvent) SplitRows() []*RowsEvent {
+	step := 1
+	if r.Action == "U" {
+		step = 2
+	}
+	if len(r.Rows) <= step {
+		return []*RowsEvent{r}
+	}
+
+	events := make([]*RowsEvent, 0, len(r.Rows)/step)
+	for i := 0; i+step <= len(r.Rows); i += step {
+		e := *r
+		e.Rows = r.Rows[i : i+step]
+		e.TxnEnd = false
+		e.encoded, e.err = nil, nil
+		e.rowIndex = r.rowIndex + i
+		events = append(events, &e)
+	}
+	events[len(events)-1].TxnEnd = r.TxnEnd
+	return events
+}
+
+// RowIndex returns the index of the 1st row in the original event before split.
+func (r *RowsEvent) RowIndex() int {
+	return r.rowIndex
+}
+
+// IsSnapshot returns whether the rows are from initial snapshot instead of binlog.
+func (r *RowsEvent) IsSnapshot() bool {
+	return r.Action == ActionSnapshot
+}
+
+// SetSnapshotCursor records the primary key values of the last row of a snapshot event,
+// and whether it is the last event of the table.
+func (r *RowsEvent) SetSnapshotCursor(pk []string, end bool) *RowsEvent {
+	r.snapshotPK = pk
+	r.snapshotEnd = end
+	return r
+}
+
+// SnapshotCursor returns the snapshot progress of the event.
+func (r *RowsEvent) SnapshotCursor() (pk []string, end bool) {
+	return r.snapshotPK, r.snapshotEnd
+}
+
+// SetGTIDSet records the executed GTID set from which replication can
+// safely resume without skipping this event.
+func (r *RowsEvent) SetGTIDSet(set string) *RowsEvent {
+	r.gtidSet = set
+	return r
+}
+
+// GTIDSet returns the resumable executed GTID set of this event.
+func (r *RowsEvent) GTIDSet() string {
+	return r.gtidSet
+}
+
+// SetTxnCommitPos records the binlog position right after the transaction commit.
+func (r *RowsEvent) SetTxnCommitPos(pos uint32) *RowsEvent {
+	r.txnCommitPos = pos
+	return r
+}
+
+// TxnCommitPos returns the binlog position right after the transaction commit.
+func (r *RowsEvent) TxnCommitPos() uint32 {
+	return r.txnCommitPos
+}
+
 func init() {
 	if os.Getenv("USE_FFJSON") == "1" {
 		rowsEventMarshaller = ffjson.Marshal
@@ -2,10 +2,32 @@ package model
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
 
 	"github.com/linkedin/goavro"
 )
 
+const columnAvroSchema = `
+{
+	"namespace": "model",
+	"type": "record",
+	"name": "Column",
+	"fields": [
+		{"name": "name", "type": "string"},
+		{"name": "type", "type": "string"},
+		{"name": "nullable", "type": "boolean"},
+		{"name": "unsigned", "type": "boolean"},
+		{"name": "charset", "type": "string"},
+		{"name": "scale", "type": "int"},
+		{"name": "elems", "type": {"type": "array", "items": "string"}}
+	]
+}
+`
+
 const rowsEventAvroSchema = `
 {
 	"namespace": "model",
@@ -43,29 +65,402 @@ const rowsEventAvroSchema = `
 	    	"type": "int",
 	    	"doc": "the binlog event timestamp, never null"
 	    },
+	    {
+	    	"name": "dt",
+	    	"type": "long",
+	    	"doc": "timestamp of dbus receiving the binlog in nanoseconds, never null"
+	    },
+	    {
+	    	"name": "cols",
+	    	"type": {
+	    		"type": "array",
+	    		"items": "string"
+	    	},
+	    	"doc": "column names"
+	    },
+	    {
+	    	"name": "types",
+	    	"type": {
+	    		"type": "array",
+	    		"items": ` + columnAvroSchema + `
+	    	},
+	    	"doc": "column metadata"
+	    },
+	    {
+	    	"name": "pks",
+	    	"type": {
+	    		"type": "array",
+	    		"items": "int"
+	    	},
+	    	"doc": "indexes of primary key columns"
+	    },
 	    {
 	    	"name": "rows",
 	    	"type": {
 	    		"type": "array",
-	    		"items": "bytes"
+	    		"items": {
+	    			"type": "array",
+	    			"items": ["null", "boolean", "long", "double", "string", "bytes"]
+	    		}
 	    	},
-	    	"doc": "list of rows"
+	    	"doc": "list of rows, unsigned bigint overflowing long is string"
 	    }
 	]
 }
 `
 
+// rowsEventAvroName is the full name of the generic RowsEvent avro record.
+const rowsEventAvroName = "model.RowsEvent"
+
+// maxAvroCodecs is the max number of cached avro codecs: each table schema version has one.
+const maxAvroCodecs = 1024
+
+var (
+	errNotRowsEvent = errors.New("not a RowsEvent")
+
+	avroCodecsMu sync.RWMutex
+	avroCodecs   = make(map[string]goavro.Codec) // key is schema
+)
+
+// avroCodec returns the cached codec of the schema.
+// The cache is reset once full, because codecs of obsolete table schema are never used again.
+func avroCodec(schema string) (goavro.Codec, error) {
+	avroCodecsMu.RLock()
+	codec, present := avroCodecs[schema]
+	avroCodecsMu.RUnlock()
+	if present {
+		return codec, nil
+	}
+
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	avroCodecsMu.Lock()
+	if len(avroCodecs) >= maxAvroCodecs {
+		avroCodecs = make(map[string]goavro.Codec)
+	}
+	avroCodecs[schema] = codec
+	avroCodecsMu.Unlock()
+	return codec, nil
+}
+
+// avroMarshaller encodes RowsEvent with the generic schema where rows are array of union values.
 func avroMarshaller(v interface{}) ([]byte, error) {
-	codec, err := goavro.NewCodec(rowsEventAvroSchema)
+	r, ok := v.(*RowsEvent)
+	if !ok {
+		return nil, errNotRowsEvent
+	}
+
+	codec, err := avroCodec(rowsEventAvroSchema)
 	if err != nil {
 		return nil, err
 	}
 
+	record, err := r.avroRecord(rowsEventAvroSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	types := make([]interface{}, len(r.ColumnTypes))
+	for i, c := range r.ColumnTypes {
+		col, err := goavro.NewRecord(goavro.RecordSchema(columnAvroSchema))
+		if err != nil {
+			return nil, err
+		}
+
+		elems := make([]interface{}, len(c.Elems))
+		for j, e := range c.Elems {
+			elems[j] = e
+		}
+		col.Set("name", c.Name)
+		col.Set("type", c.Type)
+		col.Set("nullable", c.Nullable)
+		col.Set("unsigned", c.Unsigned)
+		col.Set("charset", c.Charset)
+		col.Set("scale", int32(c.Scale))
+		col.Set("elems", elems)
+		types[i] = col
+	}
+	record.Set("types", types)
+
+	rows := make([]interface{}, len(r.Rows))
+	for i, row := range r.Rows {
+		values := make([]interface{}, len(row))
+		for j, v := range row {
+			values[j] = avroValue(v)
+		}
+		rows[i] = values
+	}
+	record.Set("rows", rows)
+
 	w := bytes.NewBuffer(nil) // TODO reuse memory
 
-	if err = codec.Encode(w, v); err != nil {
+	if err = codec.Encode(w, record); err != nil {
 		return nil, err
 	}
 
 	return w.Bytes(), nil
 }
+
+// avroRecord creates an avro record with the common fields populated.
+func (r *RowsEvent) avroRecord(schema string) (*goavro.Record, error) {
+	record, err := goavro.NewRecord(goavro.RecordSchema(schema))
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make([]interface{}, len(r.Columns))
+	for i, c := range r.Columns {
+		cols[i] = c
+	}
+	pks := make([]interface{}, len(r.PKs))
+	for i, pk := range r.PKs {
+		pks[i] = int32(pk)
+	}
+
+	record.Set("log", r.Log)
+	record.Set("pos", int32(r.Position))
+	record.Set("db", r.Schema)
+	record.Set("tbl", r.Table)
+	record.Set("dml", r.Action)
+	record.Set("ts", int32(r.Timestamp))
+	record.Set("dt", r.DbusTimestamp)
+	record.Set("cols", cols)
+	record.Set("pks", pks)
+	return record, nil
+}
+
+// AvroSchema generates the per-table avro record schema of the RowsEvent from its table metadata.
+// Each row is a record whose fields are the table columns. If column metadata is unavailable,
+// the generic schema is returned.
+func (r *RowsEvent) AvroSchema() string {
+	return r.avroSchemas().schema
+}
+
+// avroTableSchema is the avro schema generated from table metadata.
+type avroTableSchema struct {
+	name       string // full name of the record
+	schema     string
+	rowSchema  string // nested row record schema, empty for the generic schema
+	fieldNames []string
+}
+
+// avroSchemas returns the per-table schema, the nested row schema and the row field names.
+//
+// All column fields are nullable because with binlog_row_image=MINIMAL, unchanged columns are null.
+func (r *RowsEvent) avroSchemas() avroTableSchema {
+	if len(r.ColumnTypes) == 0 {
+		return avroTableSchema{name: rowsEventAvroName, schema: rowsEventAvroSchema}
+	}
+
+	namespace := "dbus." + avroName(r.Schema)
+	fieldNames := make([]string, len(r.ColumnTypes))
+	rowFields := make([]interface{}, len(r.ColumnTypes))
+	for i, c := range r.ColumnTypes {
+		name := c.Name
+		if len(name) == 0 && i < len(r.Columns) {
+			name = r.Columns[i]
+		}
+		if len(name) == 0 {
+			name = fmt.Sprintf("c%d", i)
+		}
+
+		fieldNames[i] = avroName(name)
+		rowFields[i] = map[string]interface{}{
+			"name":    fieldNames[i],
+			"type":    []interface{}{"null", avroColumnType(&r.ColumnTypes[i])},
+			"default": nil,
+			"doc":     c.Type,
+		}
+	}
+
+	rowSchema, _ := json.Marshal(map[string]interface{}{
+		"namespace": namespace,
+		"type":      "record",
+		"name":      avroName(r.Table) + "_row",
+		"fields":    rowFields,
+	})
+	arrayOf := func(items interface{}) map[string]interface{} {
+		return map[string]interface{}{"type": "array", "items": items}
+	}
+	record := map[string]interface{}{
+		"namespace": namespace,
+		"type":      "record",
+		"name":      avroName(r.Table),
+		"doc":       r.Schema + "." + r.Table + " rows event record",
+		"fields": []interface{}{
+			map[string]interface{}{"name": "log", "type": "string"},
+			map[string]interface{}{"name": "pos", "type": "int"},
+			map[string]interface{}{"name": "db", "type": "string"},
+			map[string]interface{}{"name": "tbl", "type": "string"},
+			map[string]interface{}{"name": "dml", "type": "string"},
+			map[string]interface{}{"name": "ts", "type": "int"},
+			map[string]interface{}{"name": "dt", "type": "long"},
+			map[string]interface{}{"name": "cols", "type": arrayOf("string")},
+			map[string]interface{}{"name": "pks", "type": arrayOf("int")},
+			// embedded as is to not marshal the row schema again
+			map[string]interface{}{"name": "rows", "type": arrayOf(json.RawMessage(rowSchema))},
+		},
+	}
+
+	schema, _ := json.Marshal(record)
+	return avroTableSchema{
+		name:       namespace + "." + avroName(r.Table),
+		schema:     string(schema),
+		rowSchema:  string(rowSchema),
+		fieldNames: fieldNames,
+	}
+}
+
+// MarshalAvro encodes the RowsEvent with the schema generated by AvroSchema.
+func (r *RowsEvent) MarshalAvro() ([]byte, error) {
+	b, _, _, err := r.EncodeAvro()
+	return b, err
+}
+
+// EncodeAvro encodes the RowsEvent like MarshalAvro, and returns the schema together with
+// the full name of its record, so that the schema is generated only once per event.
+func (r *RowsEvent) EncodeAvro() (b []byte, schema string, name string, err error) {
+	s := r.avroSchemas()
+	if s.rowSchema == "" {
+		b, err = avroMarshaller(r)
+		return b, s.schema, s.name, err
+	}
+
+	codec, err := avroCodec(s.schema)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	record, err := r.avroRecord(s.schema)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	rows := make([]interface{}, len(r.Rows))
+	for i, row := range r.Rows {
+		rec, err := goavro.NewRecord(goavro.RecordSchema(s.rowSchema))
+		if err != nil {
+			return nil, "", "", err
+		}
+
+		for j, name := range s.fieldNames {
+			var v interface{}
+			if j < len(row) {
+				v = avroColumnValue(row[j], &r.ColumnTypes[j])
+			}
+			rec.Set(name, v)
+		}
+		rows[i] = rec
+	}
+	record.Set("rows", rows)
+
+	w := bytes.NewBuffer(nil) // TODO reuse memory
+	if err = codec.Encode(w, record); err != nil {
+		return nil, "", "", err
+	}
+
+	return w.Bytes(), s.schema, s.name, nil
+}
+
+// avroColumnType maps mysql column type to avro primitive type.
+func avroColumnType(c *Column) string {
+	switch c.BaseType() {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "year", "bit":
+		return "long"
+	case "bigint":
+		if c.Unsigned {
+			// avro has no unsigned 64 bits integer
+			return "string"
+		}
+		return "long"
+	case "float", "double", "real":
+		return "double"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob", "geometry":
+		return "bytes"
+	default:
+		// char, varchar, text, json, enum, set, decimal, date, time, datetime, timestamp
+		return "string"
+	}
+}
+
+// avroColumnValue converts a column value to the type of avroColumnType.
+func avroColumnValue(v interface{}, c *Column) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	switch avroColumnType(c) {
+	case "long":
+		if n, ok := avroValue(v).(int64); ok {
+			return n
+		}
+	case "double":
+		if f, ok := avroValue(v).(float64); ok {
+			return f
+		}
+	case "bytes":
+		switch b := v.(type) {
+		case []byte:
+			return b
+		case string:
+			return []byte(b)
+		}
+	case "string":
+		switch s := v.(type) {
+		case string:
+			return s
+		case []byte:
+			return string(s)
+		}
+	}
+
+	return fmt.Sprintf("%v", v)
+}
+
+// avroName converts a mysql identifier to a valid avro name: [A-Za-z_][A-Za-z0-9_]*
+func avroName(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 || (b[0] >= '0' && b[0] <= '9') {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+// avroValue converts a column value to avro union member type: null|boolean|long|double|string|bytes.
+func avroValue(v interface{}) interface{} {
+	switch n := v.(type) {
+	case nil, bool, int64, float64, string, []byte:
+		return v
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int:
+		return int64(n)
+	case uint8:
+		return int64(n)
+	case uint16:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	case uint64:
+		if n > math.MaxInt64 {
+			return fmt.Sprintf("%d", n)
+		}
+		return int64(n)
+	case float32:
+		return float64(n)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/engine"
 	"gopkg.in/vmihailenco/msgpack.v2"
 )
 
@@ -29,12 +30,143 @@ func TestAvroMarshaller(t *testing.T) {
 	assert.Equal(t, "exp", string(b))
 }
 
+func TestAvroValue(t *testing.T) {
+	assert.Equal(t, nil, avroValue(nil))
+	assert.Equal(t, int64(15), avroValue(int32(15)))
+	assert.Equal(t, int64(4294967295), avroValue(uint32(4294967295)))
+	assert.Equal(t, "18446744073709551615", avroValue(uint64(18446744073709551615)))
+	assert.Equal(t, "12.30", avroValue("12.30"))
+	assert.Equal(t, []byte{1}, avroValue([]byte{1}))
+}
+
+func TestRowsEventAvroSchema(t *testing.T) {
+	r := makeRowsEvent()
+	assert.Equal(t, rowsEventAvroSchema, r.AvroSchema())
+
+	r.Columns = []string{"name", "age", "bio"}
+	r.ColumnTypes = []Column{
+		{Name: "name", Type: "varchar(20)"},
+		{Name: "age", Type: "bigint(20) unsigned", Unsigned: true},
+		{Name: "bio", Type: "blob", Nullable: true},
+	}
+	var schema struct {
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+		Fields    []struct {
+			Name string `json:"name"`
+		} `json:"fields"`
+	}
+	assert.Equal(t, nil, json.Unmarshal([]byte(r.AvroSchema()), &schema))
+	assert.Equal(t, "dbus.mydabase", schema.Namespace)
+	assert.Equal(t, "user_account", schema.Name)
+	assert.Equal(t, "rows", schema.Fields[len(schema.Fields)-1].Name)
+
+	s := r.avroSchemas()
+	assert.Equal(t, "dbus.mydabase.user_account", s.name)
+	assert.Equal(t, []string{"name", "age", "bio"}, s.fieldNames)
+	assert.Equal(t, `{"fields":[{"default":null,"doc":"varchar(20)","name":"name","type":["null","string"]},{"default":null,"doc":"bigint(20) unsigned","name":"age","type":["null","string"]},{"default":null,"doc":"blob","name":"bio","type":["null","bytes"]}],"name":"user_account_row","namespace":"dbus.mydabase","type":"record"}`, s.rowSchema)
+
+	// the row schema is embedded in the record schema
+	b, schemaText, name, err := r.EncodeAvro()
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, 0, len(b))
+	assert.Equal(t, s.schema, schemaText)
+	assert.Equal(t, s.name, name)
+}
+
+func TestAvroName(t *testing.T) {
+	assert.Equal(t, "user_account", avroName("user_account"))
+	assert.Equal(t, "_2017_log", avroName("2017-log"))
+	assert.Equal(t, "_", avroName(""))
+}
+
 func TestRowsEventFlags(t *testing.T) {
 	r := makeRowsEvent()
 	r.SetFlags(1)
 	assert.Equal(t, true, r.IsStmtEnd())
 }
 
+func TestRowsEventClone(t *testing.T) {
+	r := makeRowsEvent()
+	r.Columns = []string{"name", "age", "memo"}
+	r.PKs = []int{0}
+	r.Encode()
+
+	c := r.Clone()
+	assert.Equal(t, r.Rows, c.Rows)
+	assert.Equal(t, 0, len(c.encoded))
+
+	c.Rows[0][0] = "bar"
+	c.Columns[0] = "nick"
+	c.PKs[0] = 1
+	assert.Equal(t, "user", r.Rows[0][0])
+	assert.Equal(t, "name", r.Columns[0])
+	assert.Equal(t, 0, r.PKs[0])
+}
+
+func TestRowsEventCloneWithRows(t *testing.T) {
+	r := makeRowsEvent()
+	r.Rows = append(r.Rows, []interface{}{"bar", 2, "y"})
+	r.Encode()
+
+	c := r.CloneWithRows(r.Rows[1:])
+	assert.Equal(t, 1, len(c.Rows))
+	assert.Equal(t, "bar", c.Rows[0][0])
+	assert.Equal(t, 0, len(c.encoded))
+
+	c.Rows[0][0] = "baz"
+	assert.Equal(t, "bar", r.Rows[1][0])
+	assert.Equal(t, 2, len(r.Rows))
+}
+
+func TestRowsEventClonePayload(t *testing.T) {
+	r := makeRowsEvent()
+	var p engine.Payloader = r
+	c, ok := p.(engine.Cloner)
+	assert.Equal(t, true, ok)
+
+	e := c.ClonePayload().(*RowsEvent)
+	e.Rows[0][0] = "bar"
+	assert.Equal(t, "user", r.Rows[0][0])
+}
+
+func TestRowsEventInvalidate(t *testing.T) {
+	r := makeRowsEvent()
+	b1, _ := r.Encode()
+	r.Rows[0][0] = "bar"
+	b2, _ := r.Encode()
+	assert.Equal(t, string(b1), string(b2)) // cached
+
+	r.Invalidate()
+	b3, _ := r.Encode()
+	assert.NotEqual(t, string(b1), string(b3))
+	assert.Equal(t, len(b3), r.Length())
+}
+
+func TestRowsEventSplitRows(t *testing.T) {
+	r := makeRowsEvent()
+	assert.Equal(t, 1, len(r.SplitRows()))
+
+	r.Rows = [][]interface{}{{"a", 1}, {"b", 2}, {"c", 3}}
+	r.TxnEnd = true
+	r.Encode()
+	events := r.SplitRows()
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, [][]interface{}{{"b", 2}}, events[1].Rows)
+	assert.Equal(t, r.Position, events[1].Position)
+	assert.Equal(t, false, events[1].TxnEnd)
+	assert.Equal(t, true, events[2].TxnEnd)
+	assert.Equal(t, 2, events[2].RowIndex())
+	assert.Equal(t, 0, len(events[1].encoded))
+
+	r.Action = "U"
+	r.Rows = [][]interface{}{{"a", 1}, {"a", 2}, {"b", 1}, {"b", 2}}
+	events = r.SplitRows()
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, [][]interface{}{{"b", 1}, {"b", 2}}, events[1].Rows)
+	assert.Equal(t, 2, events[1].RowIndex())
+}
+
 func TestRowsEventEncode(t *testing.T) {
 	r := makeRowsEvent()
 	b, err := r.Encode()
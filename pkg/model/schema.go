@@ -0,0 +1,40 @@
+package model
+
+import (
+	"strings"
+)
+
+// Column is the metadata of a mysql table column.
+type Column struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"` // column type, e,g. int(10) unsigned, varchar(64), decimal(10,2)
+	Nullable bool     `json:"nullable,omitempty"`
+	Unsigned bool     `json:"unsigned,omitempty"`
+	Charset  string   `json:"charset,omitempty"`
+	Scale    int      `json:"scale,omitempty"` // scale of DECIMAL
+	Elems    []string `json:"elems,omitempty"` // elements of ENUM and SET
+}
+
+// BaseType returns the lower case column type without length and attributes, e,g. int, varchar, enum.
+func (c *Column) BaseType() string {
+	t := c.Type
+	if i := strings.IndexAny(t, "( "); i > 0 {
+		t = t[:i]
+	}
+	return strings.ToLower(t)
+}
+
+// TableSchema is the schema of a mysql table.
+type TableSchema struct {
+	Columns []Column `json:"cols"`
+	PKs     []int    `json:"pks,omitempty"` // indexes of primary key columns
+}
+
+// ColumnNames returns names of all the columns.
+func (s *TableSchema) ColumnNames() []string {
+	names := make([]string, len(s.Columns))
+	for i, c := range s.Columns {
+		names[i] = c.Name
+	}
+	return names
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestColumnBaseType(t *testing.T) {
+	c := Column{Type: "int(10) unsigned"}
+	assert.Equal(t, "int", c.BaseType())
+	c.Type = "DECIMAL(10,2)"
+	assert.Equal(t, "decimal", c.BaseType())
+	c.Type = "json"
+	assert.Equal(t, "json", c.BaseType())
+	c.Type = "enum('a','b')"
+	assert.Equal(t, "enum", c.BaseType())
+}
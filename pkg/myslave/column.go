@@ -0,0 +1,216 @@
+package myslave
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/funkygao/dbus/pkg/model"
+	conf "github.com/funkygao/jsconf"
+)
+
+const (
+	columnKeep = iota
+	columnDrop
+	columnHash
+	columnNull
+)
+
+// columnRule filters and masks the columns of tables that match the pattern,
+// so that sensitive columns never leave dbusd.
+type columnRule struct {
+	table tablePattern
+
+	include map[string]struct{} // if present, other columns are dropped
+	exclude map[string]struct{}
+	hash    map[string]struct{} // replaced with HMAC-SHA256 hex of the value
+	null    map[string]struct{} // replaced with null
+
+	hashKey []byte // secret key of HMAC, so that hashed values cannot be brute forced
+}
+
+// loadColumnRules parses the column rules config, e,g.
+//
+//	column_hash_key: "secret"
+//	column_rules: [
+//	    {
+//	        table: "db1.user*"
+//	        exclude: ["password"]
+//	        hash: ["mobile"]
+//	        null: ["email"]
+//	    }
+//	]
+//
+// The 1st rule whose table pattern matches takes effect.
+// column_hash_key is required if any rule has hash columns.
+func loadColumnRules(config *conf.Conf) []*columnRule {
+	hashKey := []byte(config.String("column_hash_key", ""))
+	var rules []*columnRule
+	for i := 0; i < len(config.List("column_rules", nil)); i++ {
+		section, err := config.Section(fmt.Sprintf("column_rules[%d]", i))
+		if err != nil {
+			panic(err)
+		}
+
+		table := section.String("table", "")
+		if len(table) == 0 {
+			panic("column rule table cannot be empty")
+		}
+
+		rule := &columnRule{
+			table:   compileTablePatterns([]string{table})[0],
+			include: columnSet(section.StringList("include", nil)),
+			exclude: columnSet(section.StringList("exclude", nil)),
+			hash:    columnSet(section.StringList("hash", nil)),
+			null:    columnSet(section.StringList("null", nil)),
+			hashKey: hashKey,
+		}
+		if len(rule.hash) > 0 && len(hashKey) == 0 {
+			panic("column rule hash requires column_hash_key")
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+func columnSet(cols []string) map[string]struct{} {
+	if len(cols) == 0 {
+		return nil
+	}
+
+	s := make(map[string]struct{}, len(cols))
+	for _, c := range cols {
+		s[c] = struct{}{}
+	}
+	return s
+}
+
+// columnRule returns the column rule of a table, nil if none.
+func (m *MySlave) columnRule(schema, table string) *columnRule {
+	if len(m.columnRules) == 0 {
+		return nil
+	}
+
+	key := schema + "." + table
+	if rule, present := m.columnRuleCache[key]; present {
+		return rule
+	}
+
+	var rule *columnRule
+	for _, r := range m.columnRules {
+		if r.table.match(key) {
+			rule = r
+			break
+		}
+	}
+
+	m.columnRuleCache[key] = rule
+	return rule
+}
+
+func (r *columnRule) action(col string) int {
+	if r.include != nil {
+		if _, present := r.include[col]; !present {
+			return columnDrop
+		}
+	}
+	if _, present := r.exclude[col]; present {
+		return columnDrop
+	}
+	if _, present := r.hash[col]; present {
+		return columnHash
+	}
+	if _, present := r.null[col]; present {
+		return columnNull
+	}
+
+	return columnKeep
+}
+
+// apply filters and masks the columns of the rows event in place.
+// If column names are unknown or mismatch the rows, it returns false and the rows must not be emitted.
+func (r *columnRule) apply(e *model.RowsEvent) bool {
+	if len(e.Rows) > 0 && len(e.Columns) != len(e.Rows[0]) {
+		return false
+	}
+
+	actions := make([]int, len(e.Columns))
+	kept := make([]int, 0, len(e.Columns)) // old index of kept columns
+	remap := make(map[int]int, len(e.Columns))
+	for i, col := range e.Columns {
+		actions[i] = r.action(col)
+		if actions[i] != columnDrop {
+			remap[i] = len(kept)
+			kept = append(kept, i)
+		}
+	}
+
+	for i, row := range e.Rows {
+		newRow := make([]interface{}, len(kept))
+		for j, idx := range kept {
+			if idx >= len(row) {
+				continue
+			}
+
+			switch actions[idx] {
+			case columnHash:
+				newRow[j] = r.hashValue(row[idx])
+			case columnNull:
+				newRow[j] = nil
+			default:
+				newRow[j] = row[idx]
+			}
+		}
+		e.Rows[i] = newRow
+	}
+
+	if len(e.ColumnTypes) == len(e.Columns) {
+		types := make([]model.Column, len(kept))
+		for j, idx := range kept {
+			types[j] = e.ColumnTypes[idx]
+			if actions[idx] == columnHash {
+				types[j] = model.Column{Name: types[j].Name, Type: "char(64)", Nullable: types[j].Nullable}
+			}
+		}
+		e.ColumnTypes = types
+	}
+
+	if len(kept) == len(e.Columns) {
+		return true
+	}
+
+	cols := make([]string, len(kept))
+	for j, idx := range kept {
+		cols[j] = e.Columns[idx]
+	}
+	var pks []int
+	for _, pk := range e.PKs {
+		if idx, present := remap[pk]; present {
+			pks = append(pks, idx)
+		}
+	}
+	e.Columns, e.PKs = cols, pks
+
+	return true
+}
+
+// hashValue returns the HMAC-SHA256 hex of the value.
+func (r *columnRule) hashValue(v interface{}) interface{} {
+	var b []byte
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		b = x
+	case string:
+		b = []byte(x)
+	default:
+		b = []byte(fmt.Sprint(x))
+	}
+
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,72 @@
+package myslave
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/pkg/model"
+)
+
+func TestColumnRuleApply(t *testing.T) {
+	rule := &columnRule{
+		table:   compileTablePatterns([]string{"db.user*"})[0],
+		exclude: columnSet([]string{"password"}),
+		hash:    columnSet([]string{"mobile"}),
+		null:    columnSet([]string{"email"}),
+		hashKey: []byte("secret"),
+	}
+
+	e := &model.RowsEvent{
+		Columns: []string{"password", "id", "mobile", "email"},
+		ColumnTypes: []model.Column{
+			{Name: "password", Type: "varchar(20)"},
+			{Name: "id", Type: "int(11)"},
+			{Name: "mobile", Type: "bigint(20)", Nullable: true},
+			{Name: "email", Type: "varchar(50)"},
+		},
+		PKs:  []int{1},
+		Rows: [][]interface{}{{"pass", int32(1), int64(13800000000), "a@b.c"}, {"pass", int32(2), nil, "d@e.f"}},
+	}
+	assert.Equal(t, true, rule.apply(e))
+	assert.Equal(t, []string{"id", "mobile", "email"}, e.Columns)
+	assert.Equal(t, []int{0}, e.PKs)
+	assert.Equal(t, "char(64)", e.ColumnTypes[1].Type)
+	assert.Equal(t, true, e.ColumnTypes[1].Nullable)
+	assert.Equal(t, []interface{}{int32(1), rule.hashValue("13800000000"), nil}, e.Rows[0])
+	assert.Equal(t, []interface{}{int32(2), nil, nil}, e.Rows[1])
+
+	// include list
+	rule = &columnRule{include: columnSet([]string{"id"})}
+	e = &model.RowsEvent{
+		Columns: []string{"id", "name"},
+		Rows:    [][]interface{}{{1, "foo"}},
+	}
+	assert.Equal(t, true, rule.apply(e))
+	assert.Equal(t, []string{"id"}, e.Columns)
+	assert.Equal(t, []interface{}{1}, e.Rows[0])
+
+	// column names unknown
+	e = &model.RowsEvent{Rows: [][]interface{}{{1, "foo"}}}
+	assert.Equal(t, false, rule.apply(e))
+}
+
+func TestHashValue(t *testing.T) {
+	r := &columnRule{hashKey: []byte("secret")}
+	assert.Equal(t, nil, r.hashValue(nil))
+	assert.Equal(t, "773ba44693c7553d6ee20f61ea5d2757a9a4f4a44d2841ae4e95b52e4cd62db4", r.hashValue("foo"))
+	assert.Equal(t, r.hashValue("foo"), r.hashValue([]byte("foo")))
+	assert.Equal(t, r.hashValue("15"), r.hashValue(15))
+
+	// different key, different hash
+	assert.NotEqual(t, r.hashValue("foo"), (&columnRule{hashKey: []byte("other")}).hashValue("foo"))
+}
+
+func TestColumnRuleOfTable(t *testing.T) {
+	m := New("", "", "")
+	r1 := &columnRule{table: compileTablePatterns([]string{"db.user"})[0]}
+	r2 := &columnRule{table: compileTablePatterns([]string{"db.*"})[0]}
+	m.columnRules = []*columnRule{r1, r2}
+	assert.Equal(t, r1, m.columnRule("db", "user"))
+	assert.Equal(t, r2, m.columnRule("db", "order"))
+	assert.Equal(t, (*columnRule)(nil), m.columnRule("db2", "user"))
+}
@@ -0,0 +1,155 @@
+package myslave
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/funkygao/dbus/pkg/model"
+)
+
+const (
+	// db.table, db and table might be quoted with backtick
+	expTableName = "(?:`[^`]+`|[\\w$]+)(?:\\s*\\.\\s*(?:`[^`]+`|[\\w$]+))?"
+)
+
+var (
+	expComments = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+	expCreateTable   = regexp.MustCompile("(?is)^CREATE\\s+(?:TEMPORARY\\s+)?TABLE\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?(" + expTableName + ")")
+	expAlterTable    = regexp.MustCompile("(?is)^ALTER\\s+(?:ONLINE\\s+|OFFLINE\\s+)?(?:IGNORE\\s+)?TABLE\\s+(" + expTableName + ")(.*)")
+	expAlterRename   = regexp.MustCompile("(?is)\\bRENAME\\s+(?:TO\\s+|AS\\s+)?(" + expTableName + ")")
+	expDropTable     = regexp.MustCompile("(?is)^DROP\\s+(?:TEMPORARY\\s+)?TABLE\\s+(?:IF\\s+EXISTS\\s+)?(.+?)(?:\\s+RESTRICT|\\s+CASCADE)?\\s*;?\\s*$")
+	expRenameTable   = regexp.MustCompile("(?is)^RENAME\\s+TABLES?\\s+(.+?)\\s*;?\\s*$")
+	expRenamePair    = regexp.MustCompile("(?is)^(" + expTableName + ")\\s+TO\\s+(" + expTableName + ")$")
+	expTruncateTable = regexp.MustCompile("(?is)^TRUNCATE\\s+(?:TABLE\\s+)?(" + expTableName + ")")
+)
+
+// ddlStmt is a classified DDL statement.
+type ddlStmt struct {
+	action string
+
+	// tables affected by the statement, db might be empty which means the default database.
+	// For RENAME, tables are pairs of [from, to].
+	tables []tableName
+}
+
+type tableName struct {
+	db, table string
+}
+
+func (t tableName) String() string {
+	return t.db + "." + t.table
+}
+
+// parseDDL classifies a QueryEvent SQL statement and extracts the affected tables.
+// OnlineSchemaChange tools like gh-ost and pt-osc will not apply 'ALTER TABLE' on the
+// original table, but 'RENAME', which is also recognized.
+func parseDDL(q []byte) (stmt ddlStmt, yes bool) {
+	// e,g. rename /* gh-ost */ table `test`.`foo` to `test`.`_foo_del`, `test`.`_foo_gho` to `test`.`foo`
+	sql := strings.TrimSpace(expComments.ReplaceAllString(string(q), " "))
+	if len(sql) < 6 {
+		// fast path: BEGIN, COMMIT
+		return
+	}
+
+	switch strings.ToUpper(sql[:4]) {
+	case "CREA":
+		if tuples := expCreateTable.FindStringSubmatch(sql); tuples != nil {
+			stmt.action = model.DDLCreate
+			stmt.tables = []tableName{parseTableName(tuples[1])}
+		}
+
+	case "ALTE":
+		if tuples := expAlterTable.FindStringSubmatch(sql); tuples != nil {
+			stmt.action = model.DDLAlter
+			stmt.tables = []tableName{parseTableName(tuples[1])}
+			if to := expAlterRename.FindStringSubmatch(tuples[2]); to != nil {
+				// ALTER TABLE foo RENAME TO bar
+				// but not ALTER TABLE foo RENAME COLUMN|INDEX|KEY a TO b
+				switch strings.ToUpper(to[1]) {
+				case "COLUMN", "INDEX", "KEY":
+				default:
+					stmt.tables = append(stmt.tables, parseTableName(to[1]))
+				}
+			}
+		}
+
+	case "DROP":
+		if tuples := expDropTable.FindStringSubmatch(sql); tuples != nil {
+			stmt.action = model.DDLDrop
+			for _, name := range splitTableList(tuples[1]) {
+				stmt.tables = append(stmt.tables, parseTableName(name))
+			}
+		}
+
+	case "RENA":
+		if tuples := expRenameTable.FindStringSubmatch(sql); tuples != nil {
+			for _, pair := range splitTableList(tuples[1]) {
+				names := expRenamePair.FindStringSubmatch(pair)
+				if names == nil {
+					return ddlStmt{}, false
+				}
+
+				stmt.tables = append(stmt.tables, parseTableName(names[1]), parseTableName(names[2]))
+			}
+			stmt.action = model.DDLRename
+		}
+
+	case "TRUN":
+		if tuples := expTruncateTable.FindStringSubmatch(sql); tuples != nil {
+			stmt.action = model.DDLTruncate
+			stmt.tables = []tableName{parseTableName(tuples[1])}
+		}
+	}
+
+	yes = len(stmt.tables) > 0
+	return
+}
+
+// parseTableName parses db.table form name, db and table might be quoted with backtick.
+func parseTableName(name string) (t tableName) {
+	var parts []string
+	inQuote := false
+	start := 0
+	for i, c := range name {
+		switch c {
+		case '`':
+			inQuote = !inQuote
+		case '.':
+			if !inQuote {
+				parts = append(parts, name[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, name[start:])
+
+	unquote := func(s string) string {
+		return strings.Trim(strings.TrimSpace(s), "`")
+	}
+	if len(parts) == 1 {
+		t.table = unquote(parts[0])
+	} else {
+		t.db, t.table = unquote(parts[0]), unquote(parts[1])
+	}
+	return
+}
+
+// splitTableList splits comma separated list which is not within backtick.
+func splitTableList(list string) []string {
+	var r []string
+	inQuote := false
+	start := 0
+	for i, c := range list {
+		switch c {
+		case '`':
+			inQuote = !inQuote
+		case ',':
+			if !inQuote {
+				r = append(r, strings.TrimSpace(list[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(r, strings.TrimSpace(list[start:]))
+}
@@ -0,0 +1,65 @@
+package myslave
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/pkg/model"
+)
+
+func TestParseDDL(t *testing.T) {
+	_, yes := parseDDL([]byte("commit"))
+	assert.Equal(t, false, yes)
+	_, yes = parseDDL([]byte("BEGIN"))
+	assert.Equal(t, false, yes)
+	_, yes = parseDDL([]byte("flush tables"))
+	assert.Equal(t, false, yes)
+	_, yes = parseDDL([]byte("insert into bar(id) values(4); alTer table foo add id int"))
+	assert.Equal(t, false, yes)
+
+	stmt, yes := parseDDL([]byte("alTer table foo add id int"))
+	assert.Equal(t, true, yes)
+	assert.Equal(t, model.DDLAlter, stmt.action)
+	assert.Equal(t, []tableName{{"", "foo"}}, stmt.tables)
+
+	stmt, yes = parseDDL([]byte("/* gh-ost */ ALTER TABLE `db1`.`foo` RENAME TO bar"))
+	assert.Equal(t, true, yes)
+	assert.Equal(t, model.DDLAlter, stmt.action)
+	assert.Equal(t, []tableName{{"db1", "foo"}, {"", "bar"}}, stmt.tables)
+
+	stmt, yes = parseDDL([]byte("create table if not exists db1.y(id int)"))
+	assert.Equal(t, true, yes)
+	assert.Equal(t, model.DDLCreate, stmt.action)
+	assert.Equal(t, []tableName{{"db1", "y"}}, stmt.tables)
+
+	stmt, yes = parseDDL([]byte("DROP TABLE IF EXISTS `a`, db2.b, `c.d` /* generated by server */"))
+	assert.Equal(t, true, yes)
+	assert.Equal(t, model.DDLDrop, stmt.action)
+	assert.Equal(t, 3, len(stmt.tables))
+	assert.Equal(t, tableName{"", "a"}, stmt.tables[0])
+	assert.Equal(t, tableName{"db2", "b"}, stmt.tables[1])
+
+	stmt, yes = parseDDL([]byte("rename /* gh-ost */ table `test`.`foo` to `test`.`_foo_del`, `test`.`_foo_gho` to `test`.`foo`"))
+	assert.Equal(t, true, yes)
+	assert.Equal(t, model.DDLRename, stmt.action)
+	assert.Equal(t, []tableName{{"test", "foo"}, {"test", "_foo_del"}, {"test", "_foo_gho"}, {"test", "foo"}}, stmt.tables)
+
+	stmt, yes = parseDDL([]byte("truncate foo"))
+	assert.Equal(t, true, yes)
+	assert.Equal(t, model.DDLTruncate, stmt.action)
+	assert.Equal(t, []tableName{{"", "foo"}}, stmt.tables)
+}
+
+func BenchmarkParseDDLNo(b *testing.B) {
+	q := []byte("commit")
+	for i := 0; i < b.N; i++ {
+		parseDDL(q)
+	}
+}
+
+func BenchmarkParseDDLYes(b *testing.B) {
+	q := []byte("alTer table foo add id int")
+	for i := 0; i < b.N; i++ {
+		parseDDL(q)
+	}
+}
@@ -6,4 +6,6 @@ import (
 
 var (
 	ErrInvalidRowFormat = errors.New("binlog must be ROW format")
+	ErrGTIDModeOff      = errors.New("gtid_mode must be ON")
+	ErrTableNotFound    = errors.New("table not found")
 )
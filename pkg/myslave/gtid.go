@@ -0,0 +1,62 @@
+package myslave
+
+import (
+	"fmt"
+
+	log "github.com/funkygao/log4go"
+	uuid "github.com/satori/go.uuid"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+)
+
+// resumeGTIDSet returns the executed GTID set from which replication resumes.
+// If no checkpoint found, resumes from the current master executed GTID set.
+func (m *MySlave) resumeGTIDSet() (mysql.GTIDSet, error) {
+	m.stateLock.Lock()
+	gtidSet := m.gtidState.GTIDSet
+	m.stateLock.Unlock()
+	if len(gtidSet) > 0 {
+		return mysql.ParseMysqlGTIDSet(gtidSet)
+	}
+
+	if err := m.AssertGTIDModeOn(); err != nil {
+		return nil, err
+	}
+
+	gset, err := m.MasterGTIDSet()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Warn("[%s] no GTID checkpoint found, resume from master %s", m.name, gset)
+	return gset, nil
+}
+
+// onGTIDEvent marks the beginning of a new transaction.
+func (m *MySlave) onGTIDEvent(e *replication.GTIDEvent) {
+	sid, err := uuid.FromBytes(e.SID)
+	if err != nil {
+		log.Error("[%s] invalid GTID SID: %v", m.name, err)
+		return
+	}
+
+	// SID:GNO
+	m.gtidNext = fmt.Sprintf("%s:%d", sid.String(), e.GNO)
+	m.gtidResume = m.gset.String()
+	m.txnSeq = 0
+}
+
+// onTxnCommitted adds the ongoing transaction to the executed GTID set.
+// DML transaction ends with XIDEvent, while DDL has no XIDEvent and ends with QueryEvent.
+func (m *MySlave) onTxnCommitted() {
+	if len(m.gtidNext) == 0 {
+		return
+	}
+
+	if err := m.gset.Update(m.gtidNext); err != nil {
+		log.Error("[%s] GTID %s: %v", m.name, m.gtidNext, err)
+	}
+
+	m.gtidNext = ""
+	m.gtidResume = m.gset.String()
+}
@@ -13,7 +13,7 @@ func (m *MySlave) handleRowsEvent(f string, h *replication.EventHeader, e *repli
 	table := string(e.Table.Table)
 	if !m.Predicate(schema, table) {
 		log.Debug("[%s] ignored[%s.%s]: %+v %+v", m.dsn, schema, table, h, e)
-		m.CommitPosition(f, h.LogPos) // FIXME batcher partial failure?
+		m.ignoreRowsEvent(f, h)
 		return
 	}
 
@@ -41,8 +41,88 @@ func (m *MySlave) handleRowsEvent(f string, h *replication.EventHeader, e *repli
 		Action:        action,
 		Timestamp:     h.Timestamp,
 		DbusTimestamp: time.Now().UnixNano(),
-		Columns:       m.getTableColumns(schema, table),
 		Rows:          e.Rows,
 	}
-	m.rowsEvent <- rowsEvent.SetFlags(e.Flags)
+	if tableSchema := m.tableSchema(schema, table, f, h.LogPos); tableSchema != nil {
+		rowsEvent.Columns = tableSchema.ColumnNames()
+		if len(tableSchema.Columns) == len(e.Table.ColumnType) {
+			rowsEvent.ColumnTypes = tableSchema.Columns
+			rowsEvent.PKs = tableSchema.PKs
+		} else {
+			log.Warn("[%s] %s.%s columns mismatch %d/%d at %s:%d", m.name, schema, table,
+				len(tableSchema.Columns), len(e.Table.ColumnType), f, h.LogPos)
+		}
+	}
+	if rowsEvent.ColumnTypes == nil {
+		// column types from binlog are always accurate
+		rowsEvent.ColumnTypes = tableMapColumns(e.Table)
+	}
+	normalizeRows(rowsEvent.Rows, rowsEvent.ColumnTypes)
+	if rule := m.columnRule(schema, table); rule != nil && !rule.apply(rowsEvent) {
+		// never leak the masked columns
+		log.Error("[%s] %s.%s dropped: column rule unapplicable at %s:%d", m.name, schema, table, f, h.LogPos)
+		m.ignoreRowsEvent(f, h)
+		return
+	}
+	if m.GTID {
+		rowsEvent.GTID = m.gtidNext
+		rowsEvent.SetGTIDSet(m.gtidResume)
+	}
+	m.emitRowsEvent(rowsEvent.SetFlags(e.Flags))
+}
+
+// ignoreRowsEvent checkpoints the rows event that will not be emitted.
+func (m *MySlave) ignoreRowsEvent(f string, h *replication.EventHeader) {
+	if m.txnBoundary {
+		// checkpoint at transaction commit
+	} else if m.GTID {
+		m.CommitGTIDSet(f, h.LogPos, m.gtidResume) // FIXME batcher partial failure?
+	} else {
+		m.CommitPosition(f, h.LogPos) // FIXME batcher partial failure?
+	}
+}
+
+func (m *MySlave) handleDDLEvent(f string, h *replication.EventHeader, e *replication.QueryEvent, stmt ddlStmt, gtid string) {
+	schema := string(e.Schema)
+	tables := make([]string, len(stmt.tables))
+	allowed := false
+	for i := range stmt.tables {
+		t := &stmt.tables[i]
+		if len(t.db) == 0 {
+			t.db = schema
+		}
+
+		log.Trace("[%s] %s table schema changed: %s", m.name, t, stmt.action)
+
+		tables[i] = t.String()
+		if m.Predicate(t.db, t.table) {
+			allowed = true
+		}
+	}
+
+	if !allowed {
+		return
+	}
+
+	m.onSchemaChange(stmt, f, h.LogPos)
+
+	if !m.emitDDL {
+		return
+	}
+
+	ddlEvent := &model.DDLEvent{
+		Log:           f,
+		Position:      h.LogPos, // next binlog pos
+		Schema:        schema,
+		Action:        stmt.action,
+		Timestamp:     h.Timestamp,
+		DbusTimestamp: time.Now().UnixNano(),
+		Tables:        tables,
+		Query:         string(e.Query),
+	}
+	if m.GTID {
+		ddlEvent.GTID = gtid
+		ddlEvent.SetGTIDSet(m.gtidResume)
+	}
+	m.events <- ddlEvent
 }
@@ -13,6 +13,7 @@ type slaveMetrics struct {
 	Lag    metrics.Gauge
 	TPS    metrics.Meter
 	Events metrics.Meter
+	Bytes  metrics.Meter
 }
 
 func newMetrics(name string) *slaveMetrics {
@@ -22,6 +23,7 @@ func newMetrics(name string) *slaveMetrics {
 		Lag:    metrics.NewRegisteredGauge(tag+"mysql.binlog.lag", metrics.DefaultRegistry),
 		TPS:    metrics.NewRegisteredMeter(tag+"mysql.binlog.tps", metrics.DefaultRegistry),
 		Events: metrics.NewRegisteredMeter(tag+"mysql.binlog.evt", metrics.DefaultRegistry),
+		Bytes:  metrics.NewRegisteredMeter(tag+"mysql.binlog.bytes", metrics.DefaultRegistry),
 	}
 }
 
@@ -30,4 +32,5 @@ func (m *slaveMetrics) Close() {
 	metrics.Unregister(m.tag + "mysql.binlog.lag")
 	metrics.Unregister(m.tag + "mysql.binlog.tps")
 	metrics.Unregister(m.tag + "mysql.binlog.evt")
+	metrics.Unregister(m.tag + "mysql.binlog.bytes")
 }
@@ -15,6 +15,7 @@ import (
 	conf "github.com/funkygao/jsconf"
 	mylog "github.com/ngaut/log"
 	"github.com/siddontang/go-mysql/client"
+	"github.com/siddontang/go-mysql/mysql"
 	"github.com/siddontang/go-mysql/replication"
 )
 
@@ -27,6 +28,21 @@ type MySlave struct {
 	conn  *client.Conn
 	state *binlog.BinlogState
 
+	// guards state, gtidState and p: committed by both Ack and replication goroutines
+	stateLock sync.Mutex
+
+	// GTID mode
+	gtidState  *binlog.GTIDState
+	gset       mysql.GTIDSet // executed GTID set of all the completed transactions
+	gtidNext   string        // GTID of the ongoing transaction
+	gtidResume string        // executed GTID set before the ongoing transaction
+
+	// txn boundary mode
+	txnBoundary bool
+	txnID       uint32
+	txnSeq      int
+	txnPending  *model.RowsEvent
+
 	name string
 
 	Predicate func(schema, table string) bool
@@ -42,12 +58,27 @@ type MySlave struct {
 	dbAllowed  map[string]struct{}
 	dbExcluded map[string]struct{}
 
-	started   sync2.AtomicBool
-	errors    chan error
-	rowsEvent chan *model.RowsEvent
+	tableAllowed    []tablePattern
+	tableExcluded   []tablePattern
+	columnRules     []*columnRule
+	columnRuleCache map[string]*columnRule // key is db.table
+
+	started sync2.AtomicBool
+	errors  chan error
+	events  chan model.BinlogEvent
+	emitDDL bool
 
-	tablesLock sync.RWMutex
-	tables     map[string][]string // table:column names
+	sp          checkpoint.Checkpoint            // checkpoint of table names of schema history
+	tsp         map[string]checkpoint.Checkpoint // checkpoint of schema history of each table
+	newTsp      func(t *binlog.TableSchemaState) checkpoint.Checkpoint
+	schemasLock sync.RWMutex
+	schemas     *binlog.SchemaState
+
+	// snapshot mode
+	snapshotMode bool
+	snp          checkpoint.Checkpoint // checkpoint of snapshot progress
+	snapshotLock sync.Mutex
+	snapshot     *binlog.SnapshotState
 }
 
 var setupLogger sync.Once
@@ -68,7 +99,12 @@ func New(name, dsn string, cluster string) *MySlave {
 		dbExcluded: map[string]struct{}{},
 		dbAllowed:  map[string]struct{}{},
 		state:      binlog.New(dsn, name),
-		tables:     make(map[string][]string, 16),
+		gtidState:  binlog.NewGTID(dsn, name),
+		schemas:    binlog.NewSchema(dsn, name),
+		tsp:        make(map[string]checkpoint.Checkpoint),
+		snapshot:   binlog.NewSnapshot(dsn, name),
+
+		columnRuleCache: map[string]*columnRule{},
 	}
 }
 
@@ -94,19 +130,39 @@ func (m *MySlave) LoadConfig(config *conf.Conf) *MySlave {
 	if len(m.dbAllowed) > 0 && len(m.dbExcluded) > 0 {
 		panic("db_excluded and db allowed cannot be set at the same time")
 	}
+	m.tableAllowed = compileTablePatterns(config.StringList("table_allowed", nil))
+	m.tableExcluded = compileTablePatterns(config.StringList("table_excluded", nil))
 	m.setupPredicate()
+	m.columnRules = loadColumnRules(config)
 
 	m.name = m.c.String("name", m.masterAddr)
 	m.GTID = m.c.Bool("GTID", false)
-	if m.GTID {
-		panic("GTID not implemented")
+	if m.GTID && m.c.String("flavor", mysql.MySQLFlavor) != mysql.MySQLFlavor {
+		panic("GTID mode only supports mysql flavor")
 	}
 
+	m.txnBoundary = m.c.Bool("txn_boundary", false)
+	m.emitDDL = m.c.Bool("ddl_event", false)
+	m.snapshotMode = m.c.Bool("snapshot", false)
+
 	m.m = newMetrics(m.name)
 	if len(m.cluster) == 0 {
 		m.p = discard.New()
+		m.sp = discard.New()
+		m.newTsp = func(t *binlog.TableSchemaState) checkpoint.Checkpoint {
+			return discard.New()
+		}
+		m.snp = discard.New()
 	} else {
-		m.p = czk.New(engine.Globals().GetOrRegisterZkzone(zone), m.state, m.cluster,
+		zkzone := engine.Globals().GetOrRegisterZkzone(zone)
+		m.p = czk.New(zkzone, m.checkpointState(), m.cluster,
+			m.dsn, m.c.Duration("pos_commit_interval", time.Second))
+		// schema changes are rare, persist each of them immediately
+		m.sp = czk.New(zkzone, m.schemas, m.cluster, m.dsn, 0)
+		m.newTsp = func(t *binlog.TableSchemaState) checkpoint.Checkpoint {
+			return czk.New(zkzone, t, m.cluster, m.dsn+"#"+t.Table, 0)
+		}
+		m.snp = czk.New(zkzone, m.snapshot, m.cluster,
 			m.dsn, m.c.Duration("pos_commit_interval", time.Second))
 	}
 
@@ -116,6 +172,24 @@ func (m *MySlave) LoadConfig(config *conf.Conf) *MySlave {
 // MarkAsProcessed notifies the checkpoint that a certain binlog event
 // has been successfully processed and should be committed.
 func (m *MySlave) MarkAsProcessed(r *model.RowsEvent) error {
+	if r.IsSnapshot() {
+		pk, end := r.SnapshotCursor()
+		return m.markSnapshotAsProcessed(r.Schema+"."+r.Table, pk, len(r.Rows), end)
+	}
+
+	if m.txnBoundary {
+		// checkpoint only at transaction commit
+		if !r.TxnEnd {
+			return nil
+		}
+
+		if m.GTID {
+			return m.CommitGTIDSet(r.Log, r.TxnCommitPos(), r.GTIDSet())
+		}
+
+		return m.CommitPosition(r.Log, r.TxnCommitPos())
+	}
+
 	if !r.IsStmtEnd() {
 		// +--------------------+-----------+------------+-----------+-------------+-----------------------------------------------------------------------------+
 		// | Log_name           | Pos       | Event_type | Server_id | End_log_pos | Info                                                                        |
@@ -146,19 +220,87 @@ func (m *MySlave) MarkAsProcessed(r *model.RowsEvent) error {
 		return nil
 	}
 
+	if m.GTID {
+		return m.CommitGTIDSet(r.Log, r.Position, r.GTIDSet())
+	}
+
 	return m.CommitPosition(r.Log, r.Position)
 }
 
+// MarkDDLAsProcessed notifies the checkpoint that a certain DDL event
+// has been successfully processed and should be committed.
+func (m *MySlave) MarkDDLAsProcessed(e *model.DDLEvent) error {
+	if m.GTID {
+		return m.CommitGTIDSet(e.Log, e.Position, e.GTIDSet())
+	}
+
+	return m.CommitPosition(e.Log, e.Position)
+}
+
 // CommitPosition persists the binlog position to checkpointer.
+// In GTID mode, the executed GTID set is left untouched.
 func (m *MySlave) CommitPosition(file string, offset uint32) error {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+
+	if m.GTID {
+		if len(m.gtidState.GTIDSet) == 0 {
+			// the 1st transaction after a fresh start without checkpoint
+			return nil
+		}
+
+		m.gtidState.File = file
+		m.gtidState.Offset = offset
+		return m.p.Commit(m.gtidState)
+	}
+
 	m.state.File = file
 	m.state.Offset = offset
 	return m.p.Commit(m.state)
 }
 
-// Events returns the iterator of mysql binlog rows event.
-func (m *MySlave) Events() <-chan *model.RowsEvent {
-	return m.rowsEvent
+// CommitGTIDSet persists the executed GTID set to checkpointer.
+// The binlog file and offset are persisted for informative purpose only.
+func (m *MySlave) CommitGTIDSet(file string, offset uint32, gtidSet string) error {
+	if len(gtidSet) == 0 {
+		// the 1st transaction after a fresh start without checkpoint
+		return nil
+	}
+
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+
+	m.gtidState.File = file
+	m.gtidState.Offset = offset
+	m.gtidState.GTIDSet = gtidSet
+	return m.p.Commit(m.gtidState)
+}
+
+// checkpointPosition returns the binlog position of the last commit, before which
+// binlog will never be replayed.
+func (m *MySlave) checkpointPosition() (binlog.Position, error) {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+
+	if !m.GTID {
+		return binlog.Position{File: m.state.File, Offset: m.state.Offset}, nil
+	}
+
+	gset, err := mysql.ParseMysqlGTIDSet(m.gtidState.GTIDSet)
+	return binlog.Position{File: m.gtidState.File, Offset: m.gtidState.Offset, GTIDSet: gset}, err
+}
+
+func (m *MySlave) checkpointState() checkpoint.State {
+	if m.GTID {
+		return m.gtidState
+	}
+
+	return m.state
+}
+
+// Events returns the iterator of mysql binlog events: RowsEvent and DDLEvent.
+func (m *MySlave) Events() <-chan model.BinlogEvent {
+	return m.events
 }
 
 // Errors returns the iterator of unexpected errors.
@@ -166,6 +308,11 @@ func (m *MySlave) Errors() <-chan error {
 	return m.errors
 }
 
+// Load returns the 1 minute rate of binlog events and bytes per second, and the replication lag in seconds.
+func (m *MySlave) Load() (eventsPerSecond, bytesPerSecond float64, lag int64) {
+	return m.m.Events.Rate1(), m.m.Bytes.Rate1(), m.m.Lag.Value()
+}
+
 // DSN returns the data source name of the mysql connection.
 func (m *MySlave) DSN() string {
 	return m.dsn
@@ -2,7 +2,9 @@ package myslave
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/funkygao/dbus/pkg/model"
 	"github.com/siddontang/go-mysql/client"
 	"github.com/siddontang/go-mysql/mysql"
 )
@@ -22,6 +24,36 @@ func (m *MySlave) TableColumns(db, table string) ([]string, error) {
 	return cols, nil
 }
 
+// TableSchema returns the schema of a table in mysql.
+func (m *MySlave) TableSchema(db, table string) (*model.TableSchema, error) {
+	res, err := m.execute(`SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY, CHARACTER_SET_NAME
+		FROM information_schema.COLUMNS WHERE TABLE_SCHEMA=? AND TABLE_NAME=? ORDER BY ORDINAL_POSITION`, db, table)
+	if err != nil {
+		return nil, err
+	}
+	if res.RowNumber() == 0 {
+		return nil, ErrTableNotFound
+	}
+
+	schema := &model.TableSchema{Columns: make([]model.Column, res.RowNumber())}
+	for i := 0; i < res.RowNumber(); i++ {
+		c := &schema.Columns[i]
+		c.Name, _ = res.GetString(i, 0)
+		c.Type, _ = res.GetString(i, 1)
+		c.Unsigned = strings.Contains(c.Type, "unsigned")
+		if nullable, _ := res.GetString(i, 2); nullable == "YES" {
+			c.Nullable = true
+		}
+		if key, _ := res.GetString(i, 3); key == "PRI" {
+			schema.PKs = append(schema.PKs, i)
+		}
+		c.Charset, _ = res.GetString(i, 4)
+		parseColumnType(c)
+	}
+
+	return schema, nil
+}
+
 // BinlogRowImage checks MySQL binlog row image, must be in FULL, MINIMAL, NOBLOB.
 func (m *MySlave) BinlogRowImage() (string, error) {
 	if m.c.String("flavor", mysql.MySQLFlavor) != mysql.MySQLFlavor {
@@ -53,6 +85,38 @@ func (m *MySlave) AssertValidRowFormat() error {
 	return nil
 }
 
+// AssertGTIDModeOn asserts the mysql master has GTID enabled.
+func (m *MySlave) AssertGTIDModeOn() error {
+	res, err := m.execute(`SHOW GLOBAL VARIABLES LIKE "gtid_mode"`)
+	if err != nil {
+		return err
+	}
+
+	if mode, err := res.GetString(0, 1); err != nil {
+		return err
+	} else if mode != "ON" {
+		return ErrGTIDModeOff
+	}
+
+	return nil
+}
+
+// MasterGTIDSet returns the executed GTID set of mysql master.
+func (m *MySlave) MasterGTIDSet() (mysql.GTIDSet, error) {
+	rr, err := m.execute("SELECT @@GLOBAL.gtid_executed")
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := rr.GetString(0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// multiple UUID sets are separated by comma and newline
+	return mysql.ParseMysqlGTIDSet(strings.Replace(s, "\n", "", -1))
+}
+
 // BinlogByPos fetches a single binlog event by position.
 func (m *MySlave) BinlogByPos(file string, pos int) (*mysql.Result, error) {
 	res, err := m.execute(fmt.Sprintf(`SHOW BINLOG EVENTS IN '%s' FROM %d LIMIT 1`, file, pos))
@@ -1,12 +1,28 @@
 package myslave
 
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
 func (m *MySlave) setupPredicate() {
+	var dbPredicate func(schema, table string) bool
 	if len(m.dbAllowed)+len(m.dbExcluded) == 0 {
-		m.Predicate = m.predicateAllowAll
+		dbPredicate = m.predicateAllowAll
 	} else if len(m.dbAllowed) > 0 {
-		m.Predicate = m.predicateUseAllow
+		dbPredicate = m.predicateUseAllow
 	} else {
-		m.Predicate = m.predicateUseExclude
+		dbPredicate = m.predicateUseExclude
+	}
+
+	if len(m.tableAllowed)+len(m.tableExcluded) == 0 {
+		m.Predicate = dbPredicate
+		return
+	}
+
+	m.Predicate = func(schema, table string) bool {
+		return dbPredicate(schema, table) && m.predicateTable(schema, table)
 	}
 }
 
@@ -29,3 +45,57 @@ func (m *MySlave) predicateUseExclude(schema, table string) bool {
 
 	return true
 }
+
+// predicateTable checks db.table against the table allow/deny list: it must match
+// any of the allowed patterns if present, and none of the excluded patterns.
+func (m *MySlave) predicateTable(schema, table string) bool {
+	name := schema + "." + table
+	if len(m.tableAllowed) > 0 && !matchAny(m.tableAllowed, name) {
+		return false
+	}
+
+	return !matchAny(m.tableExcluded, name)
+}
+
+// tablePattern matches db.table with glob, e,g. db1.user_*, or with regexp if
+// prefixed with "re:", e,g. re:^db1\.log_\d+$
+type tablePattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func compileTablePatterns(patterns []string) []tablePattern {
+	r := make([]tablePattern, 0, len(patterns))
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "re:") {
+			r = append(r, tablePattern{re: regexp.MustCompile(p[3:])})
+			continue
+		}
+
+		if _, err := path.Match(p, ""); err != nil {
+			panic("invalid table pattern: " + p)
+		}
+		r = append(r, tablePattern{glob: p})
+	}
+
+	return r
+}
+
+func (p tablePattern) match(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+
+	matched, _ := path.Match(p.glob, name)
+	return matched
+}
+
+func matchAny(patterns []tablePattern, name string) bool {
+	for _, p := range patterns {
+		if p.match(name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -25,6 +25,30 @@ func TestPredicate(t *testing.T) {
 	assert.Equal(t, true, m.Predicate("db1", ""))
 }
 
+func TestPredicateTable(t *testing.T) {
+	m := New("", "", "")
+	m.dbAllowed = map[string]struct{}{
+		"db1": {},
+		"db2": {},
+	}
+	m.tableAllowed = compileTablePatterns([]string{"db1.user*", `re:^db2\.log_\d+$`})
+	m.tableExcluded = compileTablePatterns([]string{"db1.user_secret"})
+	m.setupPredicate()
+
+	assert.Equal(t, true, m.Predicate("db1", "user"))
+	assert.Equal(t, true, m.Predicate("db1", "user_profile"))
+	assert.Equal(t, false, m.Predicate("db1", "user_secret"))
+	assert.Equal(t, false, m.Predicate("db1", "order"))
+	assert.Equal(t, true, m.Predicate("db2", "log_201706"))
+	assert.Equal(t, false, m.Predicate("db2", "log_x"))
+	assert.Equal(t, false, m.Predicate("db3", "user")) // db not allowed
+
+	m.tableAllowed = nil
+	m.setupPredicate()
+	assert.Equal(t, true, m.Predicate("db1", "order"))
+	assert.Equal(t, false, m.Predicate("db1", "user_secret"))
+}
+
 func BenchmarkPredicateAllow(b *testing.B) {
 	m := New("", "", "")
 	m.dbAllowed = map[string]struct{}{
@@ -47,3 +71,13 @@ func BenchmarkPredicateDisallow(b *testing.B) {
 		m.Predicate("db2", "table")
 	}
 }
+
+func BenchmarkPredicateTable(b *testing.B) {
+	m := New("", "", "")
+	m.tableAllowed = compileTablePatterns([]string{"db1.user*", "db2.*"})
+	m.tableExcluded = compileTablePatterns([]string{"db1.user_secret"})
+	m.setupPredicate()
+	for i := 0; i < b.N; i++ {
+		m.Predicate("db2", "table")
+	}
+}
@@ -2,13 +2,12 @@ package myslave
 
 import (
 	"context"
-	"fmt"
+	"strings"
 	"time"
 
 	"github.com/funkygao/dbus/pkg/checkpoint"
 	"github.com/funkygao/dbus/pkg/model"
 	log "github.com/funkygao/log4go"
-	uuid "github.com/satori/go.uuid"
 	"github.com/siddontang/go-mysql/mysql"
 	"github.com/siddontang/go-mysql/replication"
 )
@@ -24,20 +23,36 @@ func (m *MySlave) StopReplication() {
 	m.r.Close()
 	m.m.Close()
 
+	m.stateLock.Lock()
 	if err := m.p.Shutdown(); err != nil {
 		log.Error("[%s] %s", m.name, err)
 	}
+	m.stateLock.Unlock()
+	m.schemasLock.Lock()
+	if err := m.sp.Shutdown(); err != nil {
+		log.Error("[%s] %s", m.name, err)
+	}
+	for table, cp := range m.tsp {
+		if err := cp.Shutdown(); err != nil {
+			log.Error("[%s] %s: %s", m.name, table, err)
+		}
+	}
+	m.schemasLock.Unlock()
+	m.snapshotLock.Lock()
+	if err := m.snp.Shutdown(); err != nil {
+		log.Error("[%s] %s", m.name, err)
+	}
+	m.snapshotLock.Unlock()
 
 	m.started.Set(false)
 }
 
 // StartReplication start the mysql binlog replication.
 // TODO graceful shutdown
-// TODO GTID
 func (m *MySlave) StartReplication(ready chan struct{}) {
 	m.started.Set(true)
 
-	m.rowsEvent = make(chan *model.RowsEvent, m.c.Int("event_buffer_len", 100))
+	m.events = make(chan model.BinlogEvent, m.c.Int("event_buffer_len", 100))
 	m.errors = make(chan error, 1)
 
 	m.r = replication.NewBinlogSyncer(&replication.BinlogSyncerConfig{
@@ -49,26 +64,69 @@ func (m *MySlave) StartReplication(ready chan struct{}) {
 		Password:        m.passwd,
 		RecvBufferSize:  m.c.Int("recv_buffer", 512<<10),
 		SemiSyncEnabled: m.c.Bool("semi_sync", false),
+		UseDecimal:      true, // DECIMAL as float64 loses precision
 	})
 
 	// resume replication position from the checkpoint
-	err := m.p.LastPersistedState(m.state)
+	err := m.p.LastPersistedState(m.checkpointState())
+	if err != nil && err != checkpoint.ErrStateNotFound {
+		close(ready)
+		m.emitFatalError(err)
+		return
+	}
+
+	m.schemasLock.Lock()
+	err = m.loadSchemas()
+	m.schemasLock.Unlock()
 	if err != nil && err != checkpoint.ErrStateNotFound {
 		close(ready)
 		m.emitFatalError(err)
 		return
 	}
 
+	var snapshotPending bool
+	if m.snapshotMode {
+		if snapshotPending, err = m.prepareSnapshot(); err != nil {
+			close(ready)
+			m.emitFatalError(err)
+			return
+		}
+	}
+
+	if snapshotPending {
+		// dump before binlog syncing, otherwise master might disconnect the idle dump thread
+		close(ready)
+		if err = m.runSnapshot(); err != nil {
+			m.emitFatalError(err)
+			return
+		}
+
+		if !m.started.Get() {
+			return
+		}
+	}
+
+	m.stateLock.Lock()
 	file, offset := m.state.File, m.state.Offset
+	gtidFile := m.gtidState.File
+	m.stateLock.Unlock()
+	m.txnPending = nil
 
 	var syncer *replication.BinlogStreamer
 	if m.GTID {
-		// SELECT @@gtid_mode
-		// SHOW GLOBAL VARIABLES LIKE 'SERVER_UUID'
-		var masterUUID uuid.UUID
 		// 07c93cd7-a7d3-12a5-94e1-a0369a7c3790:1-313225133
-		set, _ := mysql.ParseMysqlGTIDSet(fmt.Sprintf("%s:%d-%d", masterUUID.String(), 1, 2))
-		syncer, err = m.r.StartSyncGTID(set)
+		if m.gset, err = m.resumeGTIDSet(); err == nil {
+			m.gtidNext = ""
+			m.gtidResume = m.gset.String()
+			file = gtidFile
+
+			// syncer owns the set it is given, we keep a separate copy for tracking
+			var set mysql.GTIDSet
+			if set, err = mysql.ParseMysqlGTIDSet(m.gtidResume); err == nil {
+				log.Trace("[%s] resume replication from GTID %s", m.name, m.gtidResume)
+				syncer, err = m.r.StartSyncGTID(set)
+			}
+		}
 	} else {
 		syncer, err = m.r.StartSync(mysql.Position{
 			Name: file,
@@ -80,12 +138,16 @@ func (m *MySlave) StartReplication(ready chan struct{}) {
 		// unrecoverable err encountered
 		// e,g.
 		// ERROR 1045 (28000): Access denied for user 'xx'@'1.1.1.1'
-		close(ready)
+		if !snapshotPending {
+			close(ready)
+		}
 		m.emitFatalError(err)
 		return
 	}
 
-	close(ready)
+	if !snapshotPending {
+		close(ready)
+	}
 	log.Debug("[%s] ready to receive mysql binlog from %s", m.name, m.masterAddr)
 
 	timeout := time.Second
@@ -147,6 +209,7 @@ func (m *MySlave) StartReplication(ready chan struct{}) {
 		}
 
 		m.m.Events.Mark(1)
+		m.m.Bytes.Mark(int64(ev.Header.EventSize))
 
 		// insert into tbtest values(1) will trigger the following events:
 		// QueryEvent    BEGIN, Log position: 4800
@@ -179,18 +242,34 @@ func (m *MySlave) StartReplication(ready chan struct{}) {
 			// e,g. BEGIN
 			// e,g. flush tables
 			// e,g. ALTER TABLE
-			//
-			// only handles alter table query
-			if db, table, yes := isAlterTableQuery(e.Query); yes {
-				if len(db) == 0 {
-					db = string(e.Schema)
+			// e,g. RENAME TABLE, used by OnlineSchemaChange tools
+			isBegin := strings.EqualFold(string(e.Query), "BEGIN")
+			gtid := m.gtidNext
+			if m.GTID && !isBegin {
+				// DDL is an implicitly committed transaction without XIDEvent
+				m.onTxnCommitted()
+			}
+			if m.txnBoundary {
+				if isBegin {
+					m.onTxnBegin(ev.Header.LogPos)
+				} else if strings.EqualFold(string(e.Query), "COMMIT") {
+					// non-transactional engine, e,g. MyISAM
+					m.onTxnEnd(file, ev.Header.LogPos)
 				}
-				log.Trace("[%s] %s.%s table schema changed", m.name, db, table)
-				m.clearTableCache(db, table)
+			}
+
+			if stmt, yes := parseDDL(e.Query); yes {
+				m.handleDDLEvent(file, ev.Header, e, stmt, gtid)
 			}
 
 		case *replication.XIDEvent:
 			// e,g. COMMIT /* xid=403013040 */
+			if m.GTID {
+				m.onTxnCommitted()
+			}
+			if m.txnBoundary {
+				m.onTxnEnd(file, ev.Header.LogPos)
+			}
 
 		case *replication.FormatDescriptionEvent:
 			// Version: 4
@@ -239,6 +318,9 @@ func (m *MySlave) StartReplication(ready chan struct{}) {
 			// 8182213e-7c1e-11e2-a6e2-080027635ef5:2  SID:GNO
 			// SID is 128 bit server uuid which identifies where the transaction was originated
 			// GNO is txn id which increments with every new transaction
+			if m.GTID {
+				m.onGTIDEvent(e)
+			}
 
 		default:
 			log.Warn("[%s] unexpected event: %+v", m.name, e)
@@ -0,0 +1,276 @@
+package myslave
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/funkygao/dbus/pkg/checkpoint"
+	"github.com/funkygao/dbus/pkg/model"
+	log "github.com/funkygao/log4go"
+)
+
+// Snapshot mode dumps the existing rows of all the allowed tables before binlog
+// replication, so that a new downstream consumer starts with a full copy of data.
+//
+// The binlog position is captured before any table is dumped, and replication
+// continues from it after the snapshot is done. Tables are dumped in chunks ordered
+// by primary key without locking, so a dumped row might be newer than the captured
+// position: replaying binlog since the captured position converges it.
+// Snapshot progress is checkpointed on ack, so that restart resumes from the last
+// acked chunk instead of dumping from scratch.
+
+// prepareSnapshot loads the snapshot progress, capturing the binlog position on
+// a fresh start. Replication position is rewound to the captured one.
+// It returns whether there are pending tables to dump.
+func (m *MySlave) prepareSnapshot() (bool, error) {
+	m.snapshotLock.Lock()
+	defer m.snapshotLock.Unlock()
+
+	err := m.snp.LastPersistedState(m.snapshot)
+	if err != nil && err != checkpoint.ErrStateNotFound {
+		return false, err
+	}
+
+	if m.snapshot.Started() {
+		return !m.snapshot.Done, nil
+	}
+
+	pos, err := m.MasterPosition()
+	if err != nil {
+		return false, err
+	}
+
+	var gtidSet string
+	if m.GTID {
+		gset, err := m.MasterGTIDSet()
+		if err != nil {
+			return false, err
+		}
+		gtidSet = gset.String()
+	}
+
+	tables, err := m.snapshotTables()
+	if err != nil {
+		return false, err
+	}
+
+	log.Trace("[%s] snapshot %d tables at %s:%d %s", m.name, len(tables), pos.Name, pos.Pos, gtidSet)
+	m.snapshot.Start(pos.Name, pos.Pos, gtidSet, tables)
+	if err = m.snp.Commit(m.snapshot); err != nil {
+		return false, err
+	}
+
+	// continue replication from the captured position
+	if m.GTID {
+		err = m.CommitGTIDSet(pos.Name, pos.Pos, gtidSet)
+	} else {
+		err = m.CommitPosition(pos.Name, pos.Pos)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return !m.snapshot.Done, nil
+}
+
+// snapshotTables returns all the allowed tables in the form of db.table.
+func (m *MySlave) snapshotTables() ([]string, error) {
+	res, err := m.execute(`SELECT TABLE_SCHEMA, TABLE_NAME FROM information_schema.TABLES
+		WHERE TABLE_TYPE='BASE TABLE' AND TABLE_SCHEMA NOT IN ('mysql','information_schema','performance_schema','sys')`)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []string
+	for i := 0; i < res.RowNumber(); i++ {
+		db, _ := res.GetString(i, 0)
+		table, _ := res.GetString(i, 1)
+		if m.Predicate(db, table) {
+			tables = append(tables, db+"."+table)
+		}
+	}
+
+	return tables, nil
+}
+
+// runSnapshot dumps all the pending tables.
+func (m *MySlave) runSnapshot() error {
+	m.snapshotLock.Lock()
+	tables := m.snapshot.Pending()
+	m.snapshotLock.Unlock()
+
+	for _, key := range tables {
+		if !m.started.Get() {
+			return nil
+		}
+
+		if err := m.dumpTable(key); err != nil {
+			return err
+		}
+	}
+
+	log.Trace("[%s] snapshot dumped %d tables", m.name, len(tables))
+	return nil
+}
+
+func (m *MySlave) dumpTable(key string) error {
+	dot := strings.IndexByte(key, '.')
+	db, table := key[:dot], key[dot+1:]
+
+	m.snapshotLock.Lock()
+	file, pos := m.snapshot.File, m.snapshot.Offset
+	var lastPK []string
+	if ts := m.snapshot.Progress(key); ts != nil {
+		lastPK = ts.LastPK
+	}
+	m.snapshotLock.Unlock()
+
+	schema, err := m.TableSchema(db, table)
+	if err == ErrTableNotFound {
+		// dropped after the position captured, binlog will replay it
+		log.Warn("[%s] snapshot %s: %v", m.name, key, err)
+		return m.markSnapshotAsProcessed(key, nil, 0, true)
+	} else if err != nil {
+		return err
+	}
+
+	if len(schema.PKs) == 0 {
+		log.Warn("[%s] snapshot %s skipped: no primary key", m.name, key)
+		return m.markSnapshotAsProcessed(key, nil, 0, true)
+	}
+
+	chunk := m.c.Int("snapshot_chunk", 1000)
+	columns := schema.ColumnNames()
+	log.Trace("[%s] snapshot %s from %v", m.name, key, lastPK)
+
+	// the latest chunk is held back until the next one is fetched, so that the last
+	// chunk of the table can be marked
+	var pending *model.RowsEvent
+	for m.started.Get() {
+		query, args := snapshotQuery(db, table, schema, lastPK, chunk)
+		res, err := m.execute(query, args...)
+		if err != nil {
+			return err
+		}
+		if res.RowNumber() == 0 {
+			break
+		}
+
+		rows := make([][]interface{}, res.RowNumber())
+		for i := range rows {
+			row := make([]interface{}, len(columns))
+			for j := range row {
+				if j < len(res.Values[i]) && res.Values[i][j] != nil {
+					row[j] = normalizeSnapshotValue(res.Values[i][j], &schema.Columns[j])
+				}
+			}
+			rows[i] = row
+		}
+		lastPK = snapshotPK(rows[len(rows)-1], schema.PKs)
+
+		if pending != nil {
+			m.events <- pending
+		}
+		pending = &model.RowsEvent{
+			Log:           file,
+			Position:      pos,
+			Schema:        db,
+			Table:         table,
+			Action:        model.ActionSnapshot,
+			Timestamp:     uint32(time.Now().Unix()),
+			DbusTimestamp: time.Now().UnixNano(),
+			Columns:       columns,
+			ColumnTypes:   schema.Columns,
+			PKs:           schema.PKs,
+			Rows:          rows,
+		}
+		pending.SetSnapshotCursor(lastPK, false)
+		if rule := m.columnRule(db, table); rule != nil {
+			rule.apply(pending) // columns are always from the live schema
+		}
+
+		if len(rows) < chunk {
+			break
+		}
+	}
+
+	if !m.started.Get() {
+		return nil
+	}
+
+	if pending == nil {
+		// empty table
+		return m.markSnapshotAsProcessed(key, nil, 0, true)
+	}
+
+	pending.SetSnapshotCursor(lastPK, true)
+	m.events <- pending
+	return nil
+}
+
+func (m *MySlave) markSnapshotAsProcessed(table string, lastPK []string, rows int, done bool) error {
+	m.snapshotLock.Lock()
+	defer m.snapshotLock.Unlock()
+
+	m.snapshot.Advance(table, lastPK, rows, done)
+	if m.snapshot.Done {
+		log.Trace("[%s] snapshot done: %s", m.name, m.snapshot)
+	}
+	return m.snp.Commit(m.snapshot)
+}
+
+// snapshotQuery builds the SELECT of the next chunk after the primary key.
+func snapshotQuery(db, table string, schema *model.TableSchema, lastPK []string, chunk int) (string, []interface{}) {
+	cols := make([]string, len(schema.Columns))
+	for i, c := range schema.Columns {
+		cols[i] = "`" + c.Name + "`"
+	}
+	pks := make([]string, len(schema.PKs))
+	for i, idx := range schema.PKs {
+		pks[i] = cols[idx]
+	}
+
+	var where string
+	var args []interface{}
+	if len(lastPK) == len(pks) {
+		// row constructor comparison uses the primary key range
+		where = fmt.Sprintf(" WHERE (%s) > (%s)", strings.Join(pks, ","),
+			strings.TrimSuffix(strings.Repeat("?,", len(pks)), ","))
+		args = make([]interface{}, len(pks))
+		for i, idx := range schema.PKs {
+			args[i] = snapshotPKArg(lastPK[i], &schema.Columns[idx])
+		}
+	}
+
+	return fmt.Sprintf("SELECT %s FROM `%s`.`%s`%s ORDER BY %s LIMIT %d",
+		strings.Join(cols, ","), db, table, where, strings.Join(pks, ","), chunk), args
+}
+
+// snapshotPK returns the primary key values of a row in string form, which survives
+// checkpoint serialization without losing precision.
+func snapshotPK(row []interface{}, pks []int) []string {
+	pk := make([]string, len(pks))
+	for i, idx := range pks {
+		pk[i] = fmt.Sprint(row[idx])
+	}
+	return pk
+}
+
+// snapshotPKArg converts primary key value back to the column type, so that integer
+// comparison is not done in float.
+func snapshotPKArg(v string, c *model.Column) interface{} {
+	switch c.BaseType() {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		if c.Unsigned {
+			if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+				return n
+			}
+		} else if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,35 @@
+package myslave
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/pkg/model"
+)
+
+func TestSnapshotQuery(t *testing.T) {
+	schema := &model.TableSchema{
+		Columns: []model.Column{
+			{Name: "uid", Type: "bigint(20) unsigned", Unsigned: true},
+			{Name: "name", Type: "varchar(20)"},
+			{Name: "seq", Type: "int(11)"},
+		},
+		PKs: []int{0, 2},
+	}
+
+	q, args := snapshotQuery("db", "t", schema, nil, 100)
+	assert.Equal(t, "SELECT `uid`,`name`,`seq` FROM `db`.`t` ORDER BY `uid`,`seq` LIMIT 100", q)
+	assert.Equal(t, 0, len(args))
+
+	q, args = snapshotQuery("db", "t", schema, []string{"18446744073709551615", "-2"}, 100)
+	assert.Equal(t, "SELECT `uid`,`name`,`seq` FROM `db`.`t` WHERE (`uid`,`seq`) > (?,?) ORDER BY `uid`,`seq` LIMIT 100", q)
+	assert.Equal(t, []interface{}{uint64(18446744073709551615), int64(-2)}, args)
+}
+
+func TestSnapshotPK(t *testing.T) {
+	row := []interface{}{uint64(5), "foo", "a-b"}
+	assert.Equal(t, []string{"5", "a-b"}, snapshotPK(row, []int{0, 2}))
+
+	c := model.Column{Type: "varchar(10)"}
+	assert.Equal(t, "5", snapshotPKArg("5", &c))
+}
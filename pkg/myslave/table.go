@@ -1,40 +1,165 @@
 package myslave
 
 import (
+	"github.com/funkygao/dbus/pkg/checkpoint"
+	"github.com/funkygao/dbus/pkg/checkpoint/state/binlog"
+	"github.com/funkygao/dbus/pkg/model"
 	log "github.com/funkygao/log4go"
 )
 
-func (m *MySlave) getTableColumns(db, table string) []string {
+// tableSchema returns the schema of a table that takes effect at the binlog position.
+// If the schema history has no such version, it is bootstrapped from the master.
+func (m *MySlave) tableSchema(db, table string, file string, pos uint32) *model.TableSchema {
 	key := db + "." + table
-	m.tablesLock.RLock()
-	cols, present := m.tables[key]
-	m.tablesLock.RUnlock()
+	at := m.binlogPosition(file, pos)
+	m.schemasLock.RLock()
+	schema, present := m.schemas.Lookup(key, at)
+	m.schemasLock.RUnlock()
 
 	if present {
-		return cols
+		return schema
 	}
 
-	m.tablesLock.Lock()
-	defer m.tablesLock.Unlock()
+	schema, err := m.TableSchema(db, table)
+	if err != nil {
+		log.Critical("%s.%s get schema: %v", db, table, err)
+		return nil
+	}
+
+	log.Trace("[%s] %s schema bootstrapped at %s:%d", m.name, key, file, pos)
+	m.addTableSchema(key, at, schema)
+	return schema
+}
 
-	if cols, present = m.tables[key]; present {
-		return cols
+// binlogPosition returns the position of the binlog event being replicated.
+// In GTID mode, it is the executed GTID set which survives master failover.
+func (m *MySlave) binlogPosition(file string, pos uint32) binlog.Position {
+	at := binlog.Position{File: file, Offset: pos}
+	if m.GTID {
+		at.GTIDSet = m.gset
 	}
+	return at
+}
+
+// onSchemaChange updates the schema history on DDL.
+// The new schema of CREATE/ALTER is fetched from the live master, which is accurate
+// except replaying binlog of DDL that has been followed by other DDL on the same table.
+func (m *MySlave) onSchemaChange(stmt ddlStmt, file string, pos uint32) {
+	at := m.binlogPosition(file, pos)
+	tables := stmt.tables
+	switch stmt.action {
+	case model.DDLTruncate:
+		return
+
+	case model.DDLDrop:
+		for _, t := range tables {
+			m.addTableSchema(t.String(), at, nil)
+		}
+
+	case model.DDLRename:
+		for i := 0; i+1 < len(tables); i += 2 {
+			m.renameTableSchema(tables[i], tables[i+1], at)
+		}
+
+	case model.DDLCreate, model.DDLAlter:
+		if len(tables) == 2 {
+			// ALTER TABLE foo RENAME TO bar
+			m.renameTableSchema(tables[0], tables[1], at)
+		}
 
-	var err error
-	cols, err = m.TableColumns(db, table)
+		t := tables[len(tables)-1]
+		schema, err := m.TableSchema(t.db, t.table)
+		if err != nil {
+			// dropped later on, will be bootstrapped on demand
+			log.Warn("[%s] %s get schema: %v", m.name, t, err)
+		}
+		m.addTableSchema(t.String(), at, schema)
+	}
+
+	// the checkpoint is committed by Ack goroutines
+	checkpointed, err := m.checkpointPosition()
 	if err != nil {
-		log.Critical("%s.%s get columns: %v", db, table, err)
-		return nil
+		log.Error("[%s] schema history prune: %v", m.name, err)
+		return
 	}
 
-	m.tables[key] = cols
-	return cols
+	m.schemasLock.Lock()
+	defer m.schemasLock.Unlock()
+
+	pruned, removed := m.schemas.Prune(checkpointed)
+	for _, t := range pruned {
+		m.commitTableSchema(t)
+		if len(t.Versions) == 0 {
+			delete(m.tsp, t.Table)
+		}
+	}
+	if removed {
+		m.commitSchemaNames()
+	}
 }
 
-func (m *MySlave) clearTableCache(db, table string) {
-	key := db + "." + table
-	m.tablesLock.Lock()
-	delete(m.tables, key)
-	m.tablesLock.Unlock()
+func (m *MySlave) renameTableSchema(from, to tableName, at binlog.Position) {
+	m.schemasLock.RLock()
+	schema, present := m.schemas.Lookup(from.String(), at)
+	m.schemasLock.RUnlock()
+
+	if !present {
+		// e,g. gh-ost ghost table which is never replicated, fetch the live one
+		var err error
+		if schema, err = m.TableSchema(to.db, to.table); err != nil {
+			log.Warn("[%s] %s get schema: %v", m.name, to, err)
+		}
+	}
+
+	m.addTableSchema(from.String(), at, nil)
+	m.addTableSchema(to.String(), at, schema)
+}
+
+// addTableSchema adds a schema version and persists only the history of that table.
+func (m *MySlave) addTableSchema(key string, at binlog.Position, schema *model.TableSchema) {
+	m.schemasLock.Lock()
+	defer m.schemasLock.Unlock()
+
+	t, created := m.schemas.Add(key, at, schema)
+	m.commitTableSchema(t)
+	if created {
+		m.commitSchemaNames()
+	}
+}
+
+// loadSchemas loads the persisted table names of schema history, then history of each table.
+func (m *MySlave) loadSchemas() error {
+	if err := m.sp.LastPersistedState(m.schemas); err != nil {
+		return err
+	}
+
+	for _, name := range m.schemas.Names {
+		t := m.schemas.Table(name)
+		if err := m.tableCheckpoint(t).LastPersistedState(t); err != nil && err != checkpoint.ErrStateNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableCheckpoint returns the checkpoint of the schema history of a table.
+func (m *MySlave) tableCheckpoint(t *binlog.TableSchemaState) checkpoint.Checkpoint {
+	cp, present := m.tsp[t.Table]
+	if !present {
+		cp = m.newTsp(t)
+		m.tsp[t.Table] = cp
+	}
+	return cp
+}
+
+func (m *MySlave) commitTableSchema(t *binlog.TableSchemaState) {
+	if err := m.tableCheckpoint(t).Commit(t); err != nil {
+		log.Error("[%s] %s schema history: %v", m.name, t.Table, err)
+	}
+}
+
+func (m *MySlave) commitSchemaNames() {
+	if err := m.sp.Commit(m.schemas); err != nil {
+		log.Error("[%s] schema history: %v", m.name, err)
+	}
 }
@@ -0,0 +1,65 @@
+package myslave
+
+import (
+	"github.com/funkygao/dbus/pkg/model"
+)
+
+// In txn boundary mode, each RowsEvent is tagged with the transaction it belongs to.
+// The latest RowsEvent is held back until the next one arrives or the transaction
+// commits, so that the last RowsEvent of a transaction can be marked with TxnEnd.
+// Checkpoint only happens on TxnEnd, so that restart never resumes in the middle of
+// a transaction.
+
+// onTxnBegin is called on QueryEvent BEGIN, pos is the next binlog position of BEGIN.
+func (m *MySlave) onTxnBegin(pos uint32) {
+	m.txnID = pos
+	m.txnSeq = 0
+}
+
+// emitRowsEvent sends the rows event to the events channel, taking txn boundary into account.
+func (m *MySlave) emitRowsEvent(r *model.RowsEvent) {
+	if !m.txnBoundary {
+		if m.GTID {
+			// GTID and sequence identify the event across master failover
+			m.txnSeq++
+			r.TxnSeq = m.txnSeq
+		}
+		m.events <- r
+		return
+	}
+
+	m.txnSeq++
+	r.TxnID = m.txnID
+	r.TxnSeq = m.txnSeq
+
+	if m.txnPending != nil {
+		m.events <- m.txnPending
+	}
+	m.txnPending = r
+}
+
+// onTxnEnd is called on XIDEvent or QueryEvent COMMIT, pos is the next binlog position of the commit.
+func (m *MySlave) onTxnEnd(file string, pos uint32) {
+	r := m.txnPending
+	m.txnPending = nil
+	m.txnID = 0
+	m.txnSeq = 0
+
+	if r == nil {
+		// all rows events of the transaction are ignored
+		if m.GTID {
+			m.CommitGTIDSet(file, pos, m.gtidResume) // FIXME batcher partial failure?
+		} else {
+			m.CommitPosition(file, pos) // FIXME batcher partial failure?
+		}
+		return
+	}
+
+	r.TxnEnd = true
+	r.SetTxnCommitPos(pos)
+	if m.GTID {
+		// the executed GTID set already contains this transaction
+		r.SetGTIDSet(m.gtidResume)
+	}
+	m.events <- r
+}
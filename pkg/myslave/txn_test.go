@@ -0,0 +1,46 @@
+package myslave
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/pkg/model"
+)
+
+func TestTxnBoundary(t *testing.T) {
+	m := New("", "", "")
+	m.txnBoundary = true
+	m.events = make(chan model.BinlogEvent, 10)
+
+	m.onTxnBegin(100)
+	m.emitRowsEvent(&model.RowsEvent{Position: 120})
+	assert.Equal(t, 0, len(m.events)) // held back
+	m.emitRowsEvent(&model.RowsEvent{Position: 140})
+	assert.Equal(t, 1, len(m.events))
+	m.onTxnEnd("f1", 170)
+	assert.Equal(t, 2, len(m.events))
+
+	r := (<-m.events).(*model.RowsEvent)
+	assert.Equal(t, uint32(100), r.TxnID)
+	assert.Equal(t, 1, r.TxnSeq)
+	assert.Equal(t, false, r.TxnEnd)
+
+	r = (<-m.events).(*model.RowsEvent)
+	assert.Equal(t, uint32(100), r.TxnID)
+	assert.Equal(t, 2, r.TxnSeq)
+	assert.Equal(t, true, r.TxnEnd)
+	assert.Equal(t, uint32(170), r.TxnCommitPos())
+	assert.Equal(t, uint32(140), r.Position)
+}
+
+func TestGTIDTxnSeq(t *testing.T) {
+	m := New("", "", "")
+	m.GTID = true
+	m.events = make(chan model.BinlogEvent, 10)
+
+	m.emitRowsEvent(&model.RowsEvent{Position: 120})
+	m.emitRowsEvent(&model.RowsEvent{Position: 140})
+	assert.Equal(t, 2, len(m.events)) // not held back
+	assert.Equal(t, 1, (<-m.events).(*model.RowsEvent).TxnSeq)
+	assert.Equal(t, 2, (<-m.events).(*model.RowsEvent).TxnSeq)
+}
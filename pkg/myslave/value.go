@@ -0,0 +1,206 @@
+package myslave
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/funkygao/dbus/pkg/model"
+	"github.com/shopspring/decimal"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+)
+
+// normalizeRows converts raw go-mysql row values to lossless typed values according to the column metadata.
+//
+// go-mysql decodes unsigned integers as signed, DECIMAL as decimal.Decimal, ENUM as index, SET as bitmask
+// and text as []byte, which are ambiguous for consumers.
+func normalizeRows(rows [][]interface{}, cols []model.Column) {
+	for _, row := range rows {
+		for i, v := range row {
+			if i < len(cols) && v != nil {
+				row[i] = normalizeValue(v, &cols[i])
+			}
+		}
+	}
+}
+
+func normalizeValue(v interface{}, c *model.Column) interface{} {
+	switch c.BaseType() {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		if !c.Unsigned {
+			return v
+		}
+
+		switch n := v.(type) {
+		case int8:
+			return uint8(n)
+		case int16:
+			return uint16(n)
+		case int32:
+			if c.BaseType() == "mediumint" {
+				return uint32(n) & 0xFFFFFF
+			}
+			return uint32(n)
+		case int64:
+			return uint64(n)
+		}
+
+	case "decimal", "numeric":
+		// rendered as string to avoid float precision issue
+		switch d := v.(type) {
+		case decimal.Decimal:
+			return d.StringFixed(int32(c.Scale))
+		case float64:
+			// decoded without UseDecimal, precision might already be lost
+			return strconv.FormatFloat(d, 'f', c.Scale, 64)
+		}
+
+	case "enum":
+		if idx, ok := v.(int64); ok {
+			if idx > 0 && int(idx) <= len(c.Elems) {
+				return c.Elems[idx-1]
+			}
+			return "" // invalid value inserted in non-strict sql mode
+		}
+
+	case "set":
+		if mask, ok := v.(int64); ok {
+			var elems []string
+			for i, e := range c.Elems {
+				if mask&(1<<uint(i)) != 0 {
+					elems = append(elems, e)
+				}
+			}
+			return strings.Join(elems, ",")
+		}
+
+	case "json", "char", "varchar", "tinytext", "text", "mediumtext", "longtext":
+		if b, ok := v.([]byte); ok {
+			return string(b)
+		}
+	}
+
+	return v
+}
+
+// normalizeSnapshotValue converts SELECT result values to be consistent with normalizeValue.
+// Unlike binlog, DECIMAL, ENUM and SET are returned in textual form.
+func normalizeSnapshotValue(v interface{}, c *model.Column) interface{} {
+	switch c.BaseType() {
+	case "decimal", "numeric", "enum", "set":
+		if b, ok := v.([]byte); ok {
+			return string(b)
+		}
+	}
+
+	return normalizeValue(v, c)
+}
+
+// parseColumnType parses scale of DECIMAL and elements of ENUM/SET from the column type.
+func parseColumnType(c *model.Column) {
+	switch c.BaseType() {
+	case "decimal", "numeric":
+		// decimal(10,2)
+		if i := strings.IndexByte(c.Type, ','); i > 0 {
+			if j := strings.IndexByte(c.Type[i:], ')'); j > 0 {
+				c.Scale, _ = strconv.Atoi(c.Type[i+1 : i+j])
+			}
+		}
+
+	case "enum", "set":
+		// enum('a','b''c')
+		start := strings.IndexByte(c.Type, '(')
+		end := strings.LastIndexByte(c.Type, ')')
+		if start < 0 || end < start {
+			return
+		}
+
+		var elem []byte
+		inQuote := false
+		list := c.Type[start+1 : end]
+		for i := 0; i < len(list); i++ {
+			ch := list[i]
+			switch {
+			case ch == '\'' && inQuote && i+1 < len(list) && list[i+1] == '\'':
+				// escaped quote
+				elem = append(elem, ch)
+				i++
+			case ch == '\'':
+				inQuote = !inQuote
+				if !inQuote {
+					c.Elems = append(c.Elems, string(elem))
+					elem = elem[:0]
+				}
+			case inQuote:
+				elem = append(elem, ch)
+			}
+		}
+	}
+}
+
+// tableMapColumns builds column metadata from TableMapEvent, used when the table schema is
+// unavailable or mismatches the binlog. Column names are unknown in this case.
+// Signedness of numeric columns is known only if the master has binlog_row_metadata=FULL
+// (mysql 8.0.1+), otherwise they are treated as signed.
+func tableMapColumns(t *replication.TableMapEvent) []model.Column {
+	unsigned := t.UnsignedMap() // nil if optional metadata unavailable
+	cols := make([]model.Column, len(t.ColumnType))
+	for i, typ := range t.ColumnType {
+		cols[i].Type = binlogColumnType(typ)
+		cols[i].Unsigned = unsigned[i]
+		if typ == mysql.MYSQL_TYPE_NEWDECIMAL && len(t.ColumnMeta) > i {
+			cols[i].Scale = int(t.ColumnMeta[i] & 0xFF) // precision<<8 | scale
+		}
+		if len(t.NullBitmap) > i/8 {
+			cols[i].Nullable = t.NullBitmap[i/8]&(1<<uint(i%8)) != 0
+		}
+	}
+	return cols
+}
+
+func binlogColumnType(t byte) string {
+	switch t {
+	case mysql.MYSQL_TYPE_TINY:
+		return "tinyint"
+	case mysql.MYSQL_TYPE_SHORT:
+		return "smallint"
+	case mysql.MYSQL_TYPE_INT24:
+		return "mediumint"
+	case mysql.MYSQL_TYPE_LONG:
+		return "int"
+	case mysql.MYSQL_TYPE_LONGLONG:
+		return "bigint"
+	case mysql.MYSQL_TYPE_FLOAT:
+		return "float"
+	case mysql.MYSQL_TYPE_DOUBLE:
+		return "double"
+	case mysql.MYSQL_TYPE_DECIMAL, mysql.MYSQL_TYPE_NEWDECIMAL:
+		return "decimal"
+	case mysql.MYSQL_TYPE_BIT:
+		return "bit"
+	case mysql.MYSQL_TYPE_YEAR:
+		return "year"
+	case mysql.MYSQL_TYPE_DATE, mysql.MYSQL_TYPE_NEWDATE:
+		return "date"
+	case mysql.MYSQL_TYPE_TIME, mysql.MYSQL_TYPE_TIME2:
+		return "time"
+	case mysql.MYSQL_TYPE_DATETIME, mysql.MYSQL_TYPE_DATETIME2:
+		return "datetime"
+	case mysql.MYSQL_TYPE_TIMESTAMP, mysql.MYSQL_TYPE_TIMESTAMP2:
+		return "timestamp"
+	case mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VAR_STRING:
+		return "varchar"
+	case mysql.MYSQL_TYPE_STRING:
+		return "char"
+	case mysql.MYSQL_TYPE_ENUM:
+		return "enum"
+	case mysql.MYSQL_TYPE_SET:
+		return "set"
+	case mysql.MYSQL_TYPE_JSON:
+		return "json"
+	case mysql.MYSQL_TYPE_GEOMETRY:
+		return "geometry"
+	default:
+		return "blob"
+	}
+}
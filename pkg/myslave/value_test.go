@@ -0,0 +1,79 @@
+package myslave
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/pkg/model"
+	"github.com/shopspring/decimal"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+)
+
+func TestParseColumnType(t *testing.T) {
+	c := model.Column{Type: "decimal(10,2)"}
+	parseColumnType(&c)
+	assert.Equal(t, 2, c.Scale)
+
+	c = model.Column{Type: "enum('a','b''c','')"}
+	parseColumnType(&c)
+	assert.Equal(t, []string{"a", "b'c", ""}, c.Elems)
+}
+
+func TestNormalizeValue(t *testing.T) {
+	c := model.Column{Type: "int(10) unsigned", Unsigned: true}
+	assert.Equal(t, uint32(4294967295), normalizeValue(int32(-1), &c))
+	c = model.Column{Type: "mediumint(8) unsigned", Unsigned: true}
+	assert.Equal(t, uint32(16777215), normalizeValue(int32(-1), &c))
+	c = model.Column{Type: "bigint(20) unsigned", Unsigned: true}
+	assert.Equal(t, uint64(18446744073709551615), normalizeValue(int64(-1), &c))
+	c = model.Column{Type: "int(10)"}
+	assert.Equal(t, int32(-1), normalizeValue(int32(-1), &c))
+
+	c = model.Column{Type: "decimal(10,2)", Scale: 2}
+	assert.Equal(t, "12.30", normalizeValue(12.3, &c))
+	c = model.Column{Type: "decimal(30,2)", Scale: 2}
+	assert.Equal(t, "1234567890123456789012345.60", normalizeValue(decimal.RequireFromString("1234567890123456789012345.6"), &c))
+
+	c = model.Column{Type: "enum('a','b')", Elems: []string{"a", "b"}}
+	assert.Equal(t, "b", normalizeValue(int64(2), &c))
+	c = model.Column{Type: "set('a','b','c')", Elems: []string{"a", "b", "c"}}
+	assert.Equal(t, "a,c", normalizeValue(int64(5), &c))
+
+	c = model.Column{Type: "json"}
+	assert.Equal(t, `{"a":1}`, normalizeValue([]byte(`{"a":1}`), &c))
+	c = model.Column{Type: "blob"}
+	assert.Equal(t, []byte{0, 1}, normalizeValue([]byte{0, 1}, &c))
+}
+
+func TestNormalizeSnapshotValue(t *testing.T) {
+	c := model.Column{Type: "decimal(10,2)", Scale: 2}
+	assert.Equal(t, "12.30", normalizeSnapshotValue([]byte("12.30"), &c))
+	c = model.Column{Type: "enum('a','b')", Elems: []string{"a", "b"}}
+	assert.Equal(t, "b", normalizeSnapshotValue([]byte("b"), &c))
+	c = model.Column{Type: "varchar(10)"}
+	assert.Equal(t, "foo", normalizeSnapshotValue([]byte("foo"), &c))
+	c = model.Column{Type: "blob"}
+	assert.Equal(t, []byte{1}, normalizeSnapshotValue([]byte{1}, &c))
+}
+
+func TestTableMapColumns(t *testing.T) {
+	e := &replication.TableMapEvent{
+		ColumnCount: 3,
+		ColumnType:  []byte{mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_NEWDECIMAL, mysql.MYSQL_TYPE_LONGLONG},
+		ColumnMeta:  []uint16{0, 10<<8 | 2, 0},
+		NullBitmap:  []byte{0x02},
+	}
+	cols := tableMapColumns(e)
+	assert.Equal(t, "int", cols[0].Type)
+	assert.Equal(t, false, cols[0].Unsigned)
+	assert.Equal(t, 2, cols[1].Scale)
+	assert.Equal(t, true, cols[1].Nullable)
+
+	// with binlog_row_metadata=FULL: the 1st and 3rd numeric columns are unsigned
+	e.SignednessBitmap = []byte{0xA0}
+	cols = tableMapColumns(e)
+	assert.Equal(t, true, cols[0].Unsigned)
+	assert.Equal(t, false, cols[1].Unsigned)
+	assert.Equal(t, true, cols[2].Unsigned)
+}
@@ -0,0 +1,164 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// magicByte is the 1st byte of Confluent wire format.
+const magicByte = 0
+
+// maxVersions is the max number of schema versions cached per subject.
+// Older versions are evicted: after ALTER TABLE the old schema is seldom used again.
+const maxVersions = 4
+
+// fingerprint is the sha256 of a schema.
+type fingerprint [sha256.Size]byte
+
+// schemaID is a cached schema id of a subject.
+type schemaID struct {
+	fp fingerprint
+	id int
+}
+
+// Client registers avro schemas to schema registry and caches the schema ids.
+type Client struct {
+	url        string
+	httpClient *http.Client
+
+	mu  sync.RWMutex
+	ids map[string][]schemaID // key is subject, latest version last
+}
+
+// New creates a schema registry client, url is like http://localhost:8081.
+func New(url string) *Client {
+	return &Client{
+		url:        strings.TrimSuffix(url, "/"),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		ids:        make(map[string][]schemaID),
+	}
+}
+
+// Register registers the schema under the subject and returns the schema id.
+// Registering an already registered schema is idempotent, and the ids of the latest
+// maxVersions schemas of each subject are cached locally.
+func (c *Client) Register(subject, schema string) (int, error) {
+	fp := fingerprint(sha256.Sum256([]byte(schema)))
+	if id, present := c.cached(subject, fp); present {
+		return id, nil
+	}
+
+	body, _ := json.Marshal(map[string]string{"schema": schema})
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/subjects/%s/versions", c.url, subject), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("schema registry %s: %s", resp.Status, string(b))
+	}
+
+	var r struct {
+		ID int `json:"id"`
+	}
+	if err = json.Unmarshal(b, &r); err != nil {
+		return 0, err
+	}
+
+	c.cache(subject, fp, r.ID)
+	return r.ID, nil
+}
+
+// cached returns the cached schema id of subject.
+func (c *Client) cached(subject string, fp fingerprint) (int, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, s := range c.ids[subject] {
+		if s.fp == fp {
+			return s.id, true
+		}
+	}
+	return 0, false
+}
+
+// cache caches the schema id of subject as its latest version, evicting the oldest version if full.
+func (c *Client) cache(subject string, fp fingerprint, id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	versions := c.ids[subject]
+	for _, s := range versions {
+		if s.fp == fp {
+			// registered concurrently
+			return
+		}
+	}
+	if len(versions) >= maxVersions {
+		versions = append(versions[:0:0], versions[len(versions)-maxVersions+1:]...)
+	}
+	c.ids[subject] = append(versions, schemaID{fp: fp, id: id})
+}
+
+// Frame prepends the Confluent wire format header to avro encoded payload:
+// magic byte 0, followed by 4 bytes big endian schema id.
+func Frame(id int, payload []byte) []byte {
+	b := make([]byte, 5+len(payload))
+	b[0] = magicByte
+	binary.BigEndian.PutUint32(b[1:5], uint32(id))
+	copy(b[5:], payload)
+	return b
+}
+
+// Subject name strategies of kafka message value.
+const (
+	StrategyTopic       = "topic"        // TopicNameStrategy: a topic has only one schema
+	StrategyRecord      = "record"       // RecordNameStrategy: a record has the same schema in all topics
+	StrategyTopicRecord = "topic_record" // TopicRecordNameStrategy: a topic has multiple record schemas
+)
+
+// Subject returns the subject name of a kafka topic message value: TopicNameStrategy.
+func Subject(topic string) string {
+	return topic + "-value"
+}
+
+// SubjectOf returns the subject name of a message value whose record full name is record
+// according to the subject name strategy.
+func SubjectOf(strategy, topic, record string) string {
+	switch strategy {
+	case StrategyTopic:
+		return Subject(topic)
+
+	case StrategyRecord:
+		return record
+
+	default:
+		return topic + "-" + record
+	}
+}
+
+// ValidStrategy checks whether the subject name strategy is supported.
+func ValidStrategy(strategy string) bool {
+	switch strategy {
+	case StrategyTopic, StrategyRecord, StrategyTopicRecord:
+		return true
+	}
+	return false
+}
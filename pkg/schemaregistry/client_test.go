@@ -0,0 +1,90 @@
+package schemaregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestRegister(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/subjects/foo-value/versions", r.URL.Path)
+
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		assert.Equal(t, `"string"`, req["schema"])
+		w.Write([]byte(`{"id":7}`))
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL + "/")
+	id, err := c.Register(Subject("foo"), `"string"`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 7, id)
+
+	// cached
+	id, err = c.Register(Subject("foo"), `"string"`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 7, id)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRegisterEvict(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(fmt.Sprintf(`{"id":%d}`, calls)))
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL)
+	for i := 0; i <= maxVersions; i++ {
+		id, err := c.Register("foo-value", fmt.Sprintf(`{"type":"fixed","size":%d}`, i))
+		assert.Equal(t, nil, err)
+		assert.Equal(t, i+1, id)
+	}
+	assert.Equal(t, maxVersions, len(c.ids["foo-value"]))
+
+	// latest versions are cached, the oldest is evicted
+	id, _ := c.Register("foo-value", fmt.Sprintf(`{"type":"fixed","size":%d}`, maxVersions))
+	assert.Equal(t, maxVersions+1, id)
+	c.Register("foo-value", `{"type":"fixed","size":1}`)
+	assert.Equal(t, maxVersions+1, calls)
+	c.Register("foo-value", `{"type":"fixed","size":0}`)
+	assert.Equal(t, maxVersions+2, calls)
+
+	// same schema of another subject
+	id, _ = c.Register("bar-value", `{"type":"fixed","size":1}`)
+	assert.Equal(t, maxVersions+3, id)
+	assert.Equal(t, maxVersions, len(c.ids["foo-value"]))
+}
+
+func TestRegisterError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"error_code":409,"message":"incompatible"}`))
+	}))
+	defer ts.Close()
+
+	_, err := New(ts.URL).Register("foo-value", `"string"`)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestFrame(t *testing.T) {
+	assert.Equal(t, []byte{0, 0, 0, 1, 2, 'a'}, Frame(258, []byte("a")))
+}
+
+func TestSubjectOf(t *testing.T) {
+	assert.Equal(t, "foo-value", SubjectOf(StrategyTopic, "foo", "dbus.db.tbl"))
+	assert.Equal(t, "dbus.db.tbl", SubjectOf(StrategyRecord, "foo", "dbus.db.tbl"))
+	assert.Equal(t, "foo-dbus.db.tbl", SubjectOf(StrategyTopicRecord, "foo", "dbus.db.tbl"))
+	assert.Equal(t, true, ValidStrategy(StrategyTopicRecord))
+	assert.Equal(t, false, ValidStrategy("bad"))
+}
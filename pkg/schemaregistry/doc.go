@@ -0,0 +1,2 @@
+// Package schemaregistry is a client of Confluent-compatible avro schema registry.
+package schemaregistry
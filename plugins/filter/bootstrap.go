@@ -4,4 +4,7 @@ package filter
 import (
 	// bootstrap internal filter plugins
 	_ "github.com/funkygao/dbus/plugins/filter/mysql"
+	_ "github.com/funkygao/dbus/plugins/filter/route"
+	_ "github.com/funkygao/dbus/plugins/filter/script"
+	_ "github.com/funkygao/dbus/plugins/filter/transform"
 )
@@ -36,16 +36,23 @@ func (*MysqlbinlogFilter) SampleConfig() string {
 
 func (this *MysqlbinlogFilter) Run(r engine.FilterRunner, h engine.PluginHelper) error {
 	for pack := range r.Exchange().InChan() {
-		row, ok := pack.Payload.(*model.RowsEvent)
-		if !ok {
+		var schema string
+		switch ev := pack.Payload.(type) {
+		case *model.RowsEvent:
+			schema = ev.Schema
+
+		case *model.DDLEvent:
+			schema = ev.Schema
+
+		default:
 			pack.Recycle()
 
 			log.Warn("illegal payload: %+v", pack.Payload)
 			continue
 		}
 
-		p := h.ClonePacket(pack)
-		p.Ident = row.Schema
+		p := h.ShallowClonePacket(pack)
+		p.Ident = schema
 		r.Exchange().Emit(p)
 
 		pack.Recycle()
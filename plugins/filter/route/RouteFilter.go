@@ -0,0 +1,198 @@
+package route
+
+import (
+	"fmt"
+
+	"github.com/funkygao/dbus/engine"
+	"github.com/funkygao/dbus/pkg/expr"
+	"github.com/funkygao/dbus/pkg/model"
+	"github.com/funkygao/go-metrics"
+	conf "github.com/funkygao/jsconf"
+)
+
+// RouteFilter is a filter plugin that routes packets by content instead of Ident.
+//
+// Each rule has a boolean expression and an Ident: payloads that match the expression
+// are emitted as cloned packets with the Ident of the rule.
+// RowsEvent is evaluated row by row, and only the matched rows are emitted.
+//
+// Expression fields:
+//
+//	RowsEvent  db tbl dml ts log pos gtid, row.<column> of the after image, old.<column> of the before image
+//	DDLEvent   db action sql ts log pos gtid, ddl is true
+//	KeyValuer  any key
+//
+// Matches of each rule are exported in /metrics as plugin.<name>.<ident>.
+type RouteFilter struct {
+	rules      []*rule
+	firstMatch bool
+	missed     metrics.Meter
+}
+
+type rule struct {
+	ident   string
+	expr    *expr.Expr
+	matched metrics.Meter
+}
+
+func (this *RouteFilter) Init(config *conf.Conf) {
+	name := config.String("name", "")
+	this.firstMatch = config.Bool("first_match", false)
+	idents := make(map[string]struct{})
+	for i := 0; i < len(config.List("rules", nil)); i++ {
+		section, err := config.Section(fmt.Sprintf("rules[%d]", i))
+		if err != nil {
+			panic(err)
+		}
+
+		r := &rule{ident: section.String("ident", "")}
+		if r.ident == "" {
+			panic(fmt.Sprintf("rules[%d]: empty ident", i))
+		}
+		if _, present := idents[r.ident]; present {
+			// the same event would be emitted twice with the same Ident
+			panic(fmt.Sprintf("rules[%d]: duplicated ident %s", i, r.ident))
+		}
+		idents[r.ident] = struct{}{}
+
+		if r.expr, err = expr.Compile(section.String("expr", "")); err != nil {
+			panic(fmt.Sprintf("rules[%d]: %v", i, err))
+		}
+		r.matched = engine.NewPluginMeter(name, r.ident)
+		this.rules = append(this.rules, r)
+	}
+	if len(this.rules) == 0 {
+		panic("empty rules")
+	}
+
+	this.missed = engine.NewPluginMeter(name, "missed")
+}
+
+func (*RouteFilter) SampleConfig() string {
+	return `
+	first_match: false // if true, a row is routed to the first matched rule only
+	rules: [
+	    {
+	        ident: "order_paid"
+	        expr: "db == 'order' && dml in ['U','D'] && row.status == 3"
+	    }
+	    {
+	        ident: "user_ddl"
+	        expr: "db == 'user' && ddl"
+	    }
+	]
+	`
+}
+
+func (this *RouteFilter) Run(r engine.FilterRunner, h engine.PluginHelper) error {
+	for pack := range r.Exchange().InChan() {
+		payloads := this.route(pack.Payload)
+		for i, payload := range payloads {
+			if payload == nil {
+				continue
+			}
+
+			p := h.ShallowClonePacket(pack)
+			p.Ident = this.rules[i].ident
+			p.Payload = payload
+			r.Exchange().Emit(p)
+		}
+
+		pack.Recycle()
+	}
+
+	return nil
+}
+
+// route returns the payload of each rule in the same order of rules, nil if not matched.
+func (this *RouteFilter) route(payload engine.Payloader) []engine.Payloader {
+	switch ev := payload.(type) {
+	case *model.RowsEvent:
+		return this.routeRows(ev)
+	case *model.DDLEvent:
+		return this.routeOne(payload, &ddlEnv{ev})
+	case engine.KeyValuer:
+		return this.routeOne(payload, &keyValuerEnv{ev})
+	}
+
+	this.missed.Mark(1)
+	return nil
+}
+
+func (this *RouteFilter) routeOne(payload engine.Payloader, env expr.Env) []engine.Payloader {
+	payloads := make([]engine.Payloader, len(this.rules))
+	hit := false
+	for i, rule := range this.rules {
+		if !rule.expr.Eval(env) {
+			continue
+		}
+
+		rule.matched.Mark(1)
+		payloads[i] = payload
+		hit = true
+		if this.firstMatch {
+			break
+		}
+	}
+
+	if !hit {
+		this.missed.Mark(1)
+	}
+	return payloads
+}
+
+// routeRows evaluates each row change of the event, the event is passed through to the 1st
+// rule that all rows match, or else each rule gets its own copy with the matched rows, so that
+// packets of different rules never share the same event.
+func (this *RouteFilter) routeRows(ev *model.RowsEvent) []engine.Payloader {
+	step := 1
+	if ev.Action == "U" {
+		// [before update row, after update row]
+		step = 2
+	}
+
+	rows := make([][][]interface{}, len(this.rules))
+	env := &rowEnv{ev: ev}
+	for i := 0; i+step <= len(ev.Rows); i += step {
+		env.row, env.old = ev.Rows[i+step-1], nil
+		if step == 2 {
+			env.old = ev.Rows[i]
+		}
+
+		hit := false
+		for j, rule := range this.rules {
+			if !rule.expr.Eval(env) {
+				continue
+			}
+
+			rule.matched.Mark(1)
+			rows[j] = append(rows[j], ev.Rows[i:i+step]...)
+			hit = true
+			if this.firstMatch {
+				break
+			}
+		}
+
+		if !hit {
+			this.missed.Mark(1)
+		}
+	}
+
+	payloads := make([]engine.Payloader, len(this.rules))
+	shared := false
+	for j := range this.rules {
+		switch len(rows[j]) {
+		case 0:
+		case len(ev.Rows):
+			if !shared {
+				payloads[j] = ev
+				shared = true
+			} else {
+				payloads[j] = ev.Clone()
+			}
+		default:
+			payloads[j] = ev.CloneWithRows(rows[j])
+		}
+	}
+	return payloads
+}
@@ -0,0 +1,229 @@
+package route
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/engine"
+	"github.com/funkygao/dbus/pkg/expr"
+	"github.com/funkygao/dbus/pkg/model"
+)
+
+// kv is a KeyValuer payload.
+type kv map[string]interface{}
+
+func (m kv) Length() int {
+	return len(m)
+}
+
+func (m kv) Encode() ([]byte, error) {
+	return nil, nil
+}
+
+func (m kv) Get(k string) (interface{}, bool) {
+	v, ok := m[k]
+	return v, ok
+}
+
+func (m kv) Set(k string, v interface{}) {
+	m[k] = v
+}
+
+func (m kv) Del(k string) {
+	delete(m, k)
+}
+
+// newTestFilter creates a RouteFilter with rules of ident and expr pairs.
+func newTestFilter(name string, firstMatch bool, rules ...string) *RouteFilter {
+	f := &RouteFilter{
+		firstMatch: firstMatch,
+		missed:     engine.NewPluginMeter(name, "missed"),
+	}
+	for i := 0; i+1 < len(rules); i += 2 {
+		f.rules = append(f.rules, &rule{
+			ident:   rules[i],
+			expr:    expr.MustCompile(rules[i+1]),
+			matched: engine.NewPluginMeter(name, rules[i]),
+		})
+	}
+	return f
+}
+
+func makeOrders() *model.RowsEvent {
+	return &model.RowsEvent{
+		Log:       "mysql-bin.000001",
+		Position:  120,
+		Schema:    "db",
+		Table:     "orders",
+		Action:    "I",
+		Timestamp: 1500000000,
+		GTID:      "uuid:1",
+		Columns:   []string{"id", "status"},
+		Rows:      [][]interface{}{{int64(1), int64(1)}, {int64(2), int64(3)}, {int64(3), int64(3)}},
+	}
+}
+
+func TestRouteRows(t *testing.T) {
+	f := newTestFilter("TestRouteRows", false,
+		"paid", "row.status == 3",
+		"all", "tbl == 'orders'",
+		"all2", "db == 'db'",
+		"none", "row.status == 9")
+	ev := makeOrders()
+
+	payloads := f.route(ev)
+	assert.Equal(t, 4, len(payloads))
+	assert.Equal(t, [][]interface{}{{int64(2), int64(3)}, {int64(3), int64(3)}}, payloads[0].(*model.RowsEvent).Rows)
+	assert.Equal(t, true, payloads[0].(*model.RowsEvent) != ev)
+	assert.Equal(t, 3, len(ev.Rows))
+
+	// the 1st full match shares the event, the others get their own copy
+	assert.Equal(t, true, payloads[1].(*model.RowsEvent) == ev)
+	assert.Equal(t, ev.Rows, payloads[2].(*model.RowsEvent).Rows)
+	assert.Equal(t, true, payloads[2].(*model.RowsEvent) != ev)
+	assert.Equal(t, nil, payloads[3])
+
+	// per rule meters count matched rows
+	assert.Equal(t, int64(2), f.rules[0].matched.Count())
+	assert.Equal(t, int64(3), f.rules[1].matched.Count())
+	assert.Equal(t, int64(0), f.rules[3].matched.Count())
+	assert.Equal(t, int64(0), f.missed.Count())
+}
+
+func TestRouteRowsFirstMatch(t *testing.T) {
+	f := newTestFilter("TestRouteRowsFirstMatch", true,
+		"paid", "row.status == 3",
+		"all", "tbl == 'orders'")
+	ev := makeOrders()
+
+	payloads := f.route(ev)
+	assert.Equal(t, 2, len(payloads[0].(*model.RowsEvent).Rows))
+	assert.Equal(t, [][]interface{}{{int64(1), int64(1)}}, payloads[1].(*model.RowsEvent).Rows)
+	assert.Equal(t, int64(2), f.rules[0].matched.Count())
+	assert.Equal(t, int64(1), f.rules[1].matched.Count())
+
+	// missed rows
+	f = newTestFilter("TestRouteRowsMissed", true, "paid", "row.status == 3")
+	payloads = f.route(ev)
+	assert.Equal(t, 2, len(payloads[0].(*model.RowsEvent).Rows))
+	assert.Equal(t, int64(1), f.missed.Count())
+}
+
+func TestRouteRowsUpdate(t *testing.T) {
+	f := newTestFilter("TestRouteRowsUpdate", false,
+		"paid", "old.status != 3 && row.status == 3",
+		"changed", "old.status != row.status")
+	ev := makeOrders()
+	ev.Action = "U"
+	ev.Rows = [][]interface{}{
+		{int64(1), int64(1)}, {int64(1), int64(3)}, // paid
+		{int64(2), int64(3)}, {int64(2), int64(3)}, // not changed
+		{int64(3), int64(2)}, {int64(3), int64(1)},
+	}
+
+	payloads := f.route(ev)
+	// before and after images are routed together
+	assert.Equal(t, [][]interface{}{{int64(1), int64(1)}, {int64(1), int64(3)}}, payloads[0].(*model.RowsEvent).Rows)
+	assert.Equal(t, [][]interface{}{
+		{int64(1), int64(1)}, {int64(1), int64(3)},
+		{int64(3), int64(2)}, {int64(3), int64(1)},
+	}, payloads[1].(*model.RowsEvent).Rows)
+	assert.Equal(t, int64(1), f.rules[0].matched.Count())
+	assert.Equal(t, int64(2), f.rules[1].matched.Count())
+	assert.Equal(t, int64(1), f.missed.Count())
+}
+
+func TestRouteOne(t *testing.T) {
+	f := newTestFilter("TestRouteOne", false,
+		"user_ddl", "db == 'user' && ddl",
+		"alter", "action == 'ALTER'",
+		"kv", "k == 1")
+	ddl := &model.DDLEvent{Schema: "user", Action: "ALTER", Query: "alter table t add c int"}
+
+	payloads := f.route(ddl)
+	assert.Equal(t, []engine.Payloader{ddl, ddl, nil}, payloads)
+
+	f.firstMatch = true
+	assert.Equal(t, []engine.Payloader{ddl, nil, nil}, f.route(ddl))
+
+	m := kv{"k": 1}
+	assert.Equal(t, []engine.Payloader{nil, nil, m}, f.route(m))
+	assert.Equal(t, []engine.Payloader{nil, nil, nil}, f.route(kv{"k": 2}))
+	assert.Equal(t, int64(1), f.missed.Count())
+
+	// unsupported payload
+	assert.Equal(t, 0, len(f.route(model.Bytes("x"))))
+	assert.Equal(t, int64(2), f.missed.Count())
+}
+
+func TestRowEnv(t *testing.T) {
+	ev := makeOrders()
+	env := &rowEnv{ev: ev, row: ev.Rows[1], old: ev.Rows[0]}
+	for field, expected := range map[string]interface{}{
+		"db":         "db",
+		"tbl":        "orders",
+		"table":      "orders",
+		"dml":        "I",
+		"action":     "I",
+		"ts":         uint32(1500000000),
+		"log":        "mysql-bin.000001",
+		"pos":        uint32(120),
+		"gtid":       "uuid:1",
+		"ddl":        false,
+		"row.id":     int64(2),
+		"row.status": int64(3),
+		"old.id":     int64(1),
+	} {
+		v, ok := env.Lookup(field)
+		assert.Equal(t, true, ok)
+		assert.Equal(t, expected, v)
+	}
+
+	for _, field := range []string{"row.none", "none", "sql"} {
+		_, ok := env.Lookup(field)
+		assert.Equal(t, false, ok)
+	}
+
+	// no before image
+	env.old = nil
+	_, ok := env.Lookup("old.id")
+	assert.Equal(t, false, ok)
+}
+
+func TestDDLEnv(t *testing.T) {
+	env := &ddlEnv{&model.DDLEvent{
+		Log:       "mysql-bin.000001",
+		Position:  4,
+		Schema:    "user",
+		Action:    "ALTER",
+		Timestamp: 1500000000,
+		GTID:      "uuid:2",
+		Query:     "alter table t add c int",
+	}}
+	for field, expected := range map[string]interface{}{
+		"db":     "user",
+		"ddl":    true,
+		"action": "ALTER",
+		"sql":    "alter table t add c int",
+		"ts":     uint32(1500000000),
+		"log":    "mysql-bin.000001",
+		"pos":    uint32(4),
+		"gtid":   "uuid:2",
+	} {
+		v, ok := env.Lookup(field)
+		assert.Equal(t, true, ok)
+		assert.Equal(t, expected, v)
+	}
+
+	_, ok := env.Lookup("tbl")
+	assert.Equal(t, false, ok)
+}
+
+func TestKeyValuerEnv(t *testing.T) {
+	env := &keyValuerEnv{kv{"a": 1}}
+	v, ok := env.Lookup("a")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 1, v)
+	_, ok = env.Lookup("b")
+	assert.Equal(t, false, ok)
+}
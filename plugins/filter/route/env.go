@@ -0,0 +1,100 @@
+package route
+
+import (
+	"strings"
+
+	"github.com/funkygao/dbus/engine"
+	"github.com/funkygao/dbus/pkg/expr"
+	"github.com/funkygao/dbus/pkg/model"
+)
+
+var (
+	_ expr.Env = &rowEnv{}
+	_ expr.Env = &ddlEnv{}
+	_ expr.Env = &keyValuerEnv{}
+)
+
+const (
+	rowPrefix = "row." // column of the after image
+	oldPrefix = "old." // column of the before image, only for update
+)
+
+// rowEnv evaluates expression on a single row change of the rows event.
+type rowEnv struct {
+	ev       *model.RowsEvent
+	row, old []interface{}
+}
+
+func (e *rowEnv) Lookup(field string) (interface{}, bool) {
+	switch field {
+	case "db":
+		return e.ev.Schema, true
+	case "tbl", "table":
+		return e.ev.Table, true
+	case "dml", "action":
+		return e.ev.Action, true
+	case "ts":
+		return e.ev.Timestamp, true
+	case "log":
+		return e.ev.Log, true
+	case "pos":
+		return e.ev.Position, true
+	case "gtid":
+		return e.ev.GTID, true
+	case "ddl":
+		return false, true
+	}
+
+	switch {
+	case strings.HasPrefix(field, rowPrefix):
+		return column(e.ev, e.row, field[len(rowPrefix):])
+	case strings.HasPrefix(field, oldPrefix):
+		return column(e.ev, e.old, field[len(oldPrefix):])
+	}
+
+	return nil, false
+}
+
+func column(ev *model.RowsEvent, row []interface{}, name string) (interface{}, bool) {
+	for i, col := range ev.Columns {
+		if col == name && i < len(row) {
+			return row[i], true
+		}
+	}
+	return nil, false
+}
+
+type ddlEnv struct {
+	ev *model.DDLEvent
+}
+
+func (e *ddlEnv) Lookup(field string) (interface{}, bool) {
+	switch field {
+	case "db":
+		return e.ev.Schema, true
+	case "ddl":
+		return true, true
+	case "action":
+		return e.ev.Action, true
+	case "sql":
+		return e.ev.Query, true
+	case "ts":
+		return e.ev.Timestamp, true
+	case "log":
+		return e.ev.Log, true
+	case "pos":
+		return e.ev.Position, true
+	case "gtid":
+		return e.ev.GTID, true
+	}
+
+	return nil, false
+}
+
+type keyValuerEnv struct {
+	kv engine.KeyValuer
+}
+
+func (e *keyValuerEnv) Lookup(field string) (interface{}, bool) {
+	return e.kv.Get(field)
+}
@@ -0,0 +1,15 @@
+package route
+
+import (
+	"github.com/funkygao/dbus/engine"
+)
+
+var (
+	_ engine.Filter = &RouteFilter{}
+)
+
+func init() {
+	engine.RegisterPlugin("RouteFilter", func() engine.Plugin {
+		return new(RouteFilter)
+	})
+}
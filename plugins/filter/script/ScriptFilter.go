@@ -0,0 +1,259 @@
+package script
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/funkygao/dbus/engine"
+	"github.com/funkygao/dbus/pkg/model"
+	"github.com/funkygao/go-metrics"
+	conf "github.com/funkygao/jsconf"
+	log "github.com/funkygao/log4go"
+	"github.com/yuin/gopher-lua"
+)
+
+// ScriptFilter is a filter plugin that runs a lua script on each RowsEvent, so that custom
+// logic needs no Go plugin compiled into dbusd.
+//
+// The script defines a function process(ev) where ev is the event table, and calls
+// emit(ev[, ident]) zero or more times: the event is dropped if not emitted, and it can be
+// modified or copied before emitting. Other payloads are emitted as is without running the
+// script, but with the ident: the received Ident would route them back to this filter.
+//
+// The script runs in a sandbox without io, os, package and debug libs, and each call is
+// limited by the timeout. The lua state has no memory limit, only string.rep is bounded.
+// A script file is reloaded without restart when it changes.
+type ScriptFilter struct {
+	name           string
+	ident          string
+	file           string
+	modTime        time.Time
+	reloadInterval time.Duration
+	timeout        time.Duration
+	dropOnError    bool
+
+	proto *lua.FunctionProto
+	vm    *vm
+
+	// states of the event being processed
+	ev      *model.RowsEvent
+	origins map[*lua.LTable][]interface{}
+	emitted []emission
+
+	errors   metrics.Meter
+	timeouts metrics.Meter
+}
+
+type emission struct {
+	ident   string
+	payload engine.Payloader
+}
+
+func (this *ScriptFilter) Init(config *conf.Conf) {
+	this.name = config.String("name", "")
+	this.ident = config.String("ident", "")
+	if this.ident == "" {
+		// emitted packets with the received Ident would be routed back to itself
+		panic("empty ident")
+	}
+	this.timeout = config.Duration("timeout", time.Millisecond*10)
+	this.reloadInterval = config.Duration("reload_interval", time.Second*10)
+	switch onError := config.String("on_error", "pass"); onError {
+	case "pass":
+	case "drop":
+		this.dropOnError = true
+	default:
+		panic("invalid on_error: " + onError)
+	}
+
+	src := config.String("script", "")
+	this.file = config.String("file", "")
+	if (src == "") == (this.file == "") {
+		panic("requires either script or file")
+	}
+	if this.file != "" {
+		fi, err := os.Stat(this.file)
+		if err != nil {
+			panic(err)
+		}
+		b, err := ioutil.ReadFile(this.file)
+		if err != nil {
+			panic(err)
+		}
+
+		this.modTime, src = fi.ModTime(), string(b)
+	}
+
+	if err := this.load(src); err != nil {
+		panic(err)
+	}
+
+	this.errors = engine.NewPluginMeter(this.name, "error")
+	this.timeouts = engine.NewPluginMeter(this.name, "timeout")
+}
+
+func (*ScriptFilter) SampleConfig() string {
+	return `
+	ident: "scripted" // default Ident of emitted packets
+	timeout: "10ms" // execution time budget of each event
+	on_error: "pass" // pass|drop the event on script error or timeout
+	// file is reloaded when changed, while inline script changes restart dbusd
+	// file: "/etc/dbus/order.lua"
+	// reload_interval: "10s"
+	script: "function process(ev) if ev.dml ~= 'D' then emit(ev) end end"
+	`
+}
+
+func (this *ScriptFilter) Run(r engine.FilterRunner, h engine.PluginHelper) error {
+	defer func() {
+		// vm is replaced on reload
+		this.vm.close()
+	}()
+
+	var reload <-chan time.Time
+	if this.file != "" {
+		ticker := time.NewTicker(this.reloadInterval)
+		defer ticker.Stop()
+		reload = ticker.C
+	}
+
+	for {
+		select {
+		case <-reload:
+			this.reload(r.Name())
+
+		case pack, ok := <-r.Exchange().InChan():
+			if !ok {
+				return nil
+			}
+
+			for _, e := range this.process(r.Name(), pack.Payload) {
+				p := h.ShallowClonePacket(pack)
+				p.Ident = e.ident
+				p.Payload = e.payload
+				r.Exchange().Emit(p)
+			}
+
+			pack.Recycle()
+		}
+	}
+}
+
+// load compiles the script and replaces the vm.
+func (this *ScriptFilter) load(src string) error {
+	proto, err := compile(this.name, src)
+	if err != nil {
+		return err
+	}
+
+	v, err := newVM(proto, this.builtins(), this.timeout)
+	if err != nil {
+		return err
+	}
+
+	if this.vm != nil {
+		this.vm.close()
+	}
+	this.proto, this.vm = proto, v
+	return nil
+}
+
+// reload loads the script file if it is modified, the running script is kept on error.
+func (this *ScriptFilter) reload(name string) {
+	fi, err := os.Stat(this.file)
+	if err != nil {
+		log.Error("[%s] %v", name, err)
+		return
+	}
+	if fi.ModTime().Equal(this.modTime) {
+		return
+	}
+
+	// the broken version is not retried until it changes again
+	this.modTime = fi.ModTime()
+	b, err := ioutil.ReadFile(this.file)
+	if err == nil {
+		err = this.load(string(b))
+	}
+	if err != nil {
+		log.Error("[%s] reload %s: %v", name, this.file, err)
+		return
+	}
+
+	log.Info("[%s] %s reloaded", name, this.file)
+}
+
+func (this *ScriptFilter) builtins() map[string]lua.LGFunction {
+	return map[string]lua.LGFunction{
+		"emit":  this.emit,
+		"print": this.print,
+	}
+}
+
+// emit(ev[, ident]) emits the event table as a new packet.
+func (this *ScriptFilter) emit(L *lua.LState) int {
+	if this.ev == nil {
+		L.RaiseError("emit outside of process")
+		return 0
+	}
+
+	t := L.CheckTable(1)
+	ident := L.OptString(2, this.ident)
+	e, err := eventFromTable(t, this.ev, this.origins)
+	if err != nil {
+		L.RaiseError("emit: %v", err)
+		return 0
+	}
+
+	this.emitted = append(this.emitted, emission{ident: ident, payload: e})
+	return 0
+}
+
+// print writes the arguments to log instead of stdout.
+func (this *ScriptFilter) print(L *lua.LState) int {
+	args := make([]interface{}, L.GetTop())
+	for i := range args {
+		args[i] = L.ToStringMeta(L.Get(i + 1)).String()
+	}
+
+	log.Info("[%s] %v", this.name, args)
+	return 0
+}
+
+// process runs the script on a RowsEvent and returns the emitted events.
+// Other payloads are emitted as is with the ident.
+func (this *ScriptFilter) process(name string, payload engine.Payloader) []emission {
+	ev, ok := payload.(*model.RowsEvent)
+	if !ok {
+		return []emission{{ident: this.ident, payload: payload}}
+	}
+
+	this.ev, this.origins, this.emitted = ev, make(map[*lua.LTable][]interface{}, len(ev.Rows)), nil
+	err := this.vm.call(eventTable(this.vm.L, ev, this.origins), this.timeout)
+	emitted := this.emitted
+	this.ev, this.origins, this.emitted = nil, nil, nil
+	if err == nil {
+		return emitted
+	}
+
+	if err == ErrTimeout {
+		this.timeouts.Mark(1)
+
+		// the interrupted script might leave its globals inconsistent
+		if v, e := newVM(this.proto, this.builtins(), this.timeout); e != nil {
+			log.Error("[%s] recreate vm: %v", name, e)
+		} else {
+			this.vm.close()
+			this.vm = v
+		}
+	} else {
+		this.errors.Mark(1)
+	}
+
+	log.Error("[%s] %s %s: %v", name, ev.Schema, ev.Table, err)
+	if this.dropOnError {
+		return nil
+	}
+	return []emission{{ident: this.ident, payload: payload}}
+}
@@ -0,0 +1,193 @@
+package script
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/engine"
+	"github.com/funkygao/dbus/pkg/model"
+)
+
+type bytesPayload []byte
+
+func (b bytesPayload) Length() int {
+	return len(b)
+}
+
+func (b bytesPayload) Encode() ([]byte, error) {
+	return b, nil
+}
+
+func newTestFilter(t *testing.T, name, src string) *ScriptFilter {
+	f := &ScriptFilter{
+		name:     name,
+		ident:    "scripted",
+		timeout:  time.Millisecond * 50,
+		errors:   engine.NewPluginMeter(name, "error"),
+		timeouts: engine.NewPluginMeter(name, "timeout"),
+	}
+	if err := f.load(src); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func makeOrder() *model.RowsEvent {
+	return &model.RowsEvent{
+		Schema:      "db",
+		Table:       "orders",
+		Action:      "I",
+		Columns:     []string{"id", "price", "qty"},
+		ColumnTypes: []model.Column{{Name: "id", Type: "bigint(20)"}, {Name: "price", Type: "double"}, {Name: "qty", Type: "int(11)"}},
+		PKs:         []int{0},
+		Rows:        [][]interface{}{{int64(1<<60 + 1), 2.5, int32(2)}, {int64(2), 1.5, int32(4)}},
+	}
+}
+
+func TestProcessEmit(t *testing.T) {
+	f := newTestFilter(t, "TestProcessEmit", `
+function process(ev)
+    if ev.dml == 'D' then return end
+    for _, row in ipairs(ev.rows) do row.amount = row.price * row.qty end
+    table.insert(ev.cols, 'amount')
+    emit(ev)
+    ev.tbl = 'orders_copy'
+    emit(ev, 'copied')
+end`)
+	defer f.vm.close()
+
+	ev := makeOrder()
+	out := f.process("x", ev)
+	assert.Equal(t, 2, len(out))
+	assert.Equal(t, "scripted", out[0].ident)
+	assert.Equal(t, "copied", out[1].ident)
+
+	e := out[0].payload.(*model.RowsEvent)
+	assert.Equal(t, []string{"id", "price", "qty", "amount"}, e.Columns)
+	assert.Equal(t, []interface{}{int64(1<<60 + 1), 2.5, int32(2), int64(5)}, e.Rows[0])
+	assert.Equal(t, "orders", e.Table)
+	assert.Equal(t, "orders_copy", out[1].payload.(*model.RowsEvent).Table)
+	assert.Equal(t, 3, len(ev.Columns)) // original untouched
+
+	// dropped
+	ev.Action = "D"
+	assert.Equal(t, 0, len(f.process("x", ev)))
+
+	// other payloads are emitted as is
+	out = f.process("x", bytesPayload("hello"))
+	assert.Equal(t, 1, len(out))
+	assert.Equal(t, "scripted", out[0].ident)
+	assert.Equal(t, bytesPayload("hello"), out[0].payload)
+}
+
+func TestProcessError(t *testing.T) {
+	f := newTestFilter(t, "TestProcessError", `function process(ev) emit(1) end`)
+	defer f.vm.close()
+
+	ev := makeOrder()
+	out := f.process("x", ev)
+	assert.Equal(t, 1, len(out))
+	assert.Equal(t, true, out[0].payload.(*model.RowsEvent) == ev)
+	assert.Equal(t, int64(1), f.errors.Count())
+
+	f.dropOnError = true
+	assert.Equal(t, 0, len(f.process("x", ev)))
+	assert.Equal(t, int64(2), f.errors.Count())
+}
+
+func TestProcessTimeout(t *testing.T) {
+	f := newTestFilter(t, "TestProcessTimeout", `
+n = 0
+function process(ev)
+    n = n + 1
+    if n == 1 then while true do end end
+    emit(ev)
+end`)
+	defer func() {
+		f.vm.close()
+	}()
+
+	f.dropOnError = true
+	vm := f.vm
+	assert.Equal(t, 0, len(f.process("x", makeOrder())))
+	assert.Equal(t, int64(1), f.timeouts.Count())
+
+	// vm is rebuilt with globals reset, so it loops again
+	assert.Equal(t, false, vm == f.vm)
+	assert.Equal(t, 0, len(f.process("x", makeOrder())))
+	assert.Equal(t, int64(2), f.timeouts.Count())
+}
+
+func TestSandbox(t *testing.T) {
+	f := newTestFilter(t, "TestSandbox", `
+function process(ev)
+    if os or io or require or dofile or load or loadstring or collectgarbage then error('unsafe') end
+    ev.tbl = string.rep('ab', 2)
+    emit(ev)
+end`)
+	defer f.vm.close()
+
+	out := f.process("x", makeOrder())
+	assert.Equal(t, 1, len(out))
+	assert.Equal(t, "abab", out[0].payload.(*model.RowsEvent).Table)
+	assert.Equal(t, int64(0), f.errors.Count())
+
+	// string.rep is bounded
+	for i, src := range []string{
+		`function process(ev) ev.tbl = string.rep('x', 1e10) end`,
+		`function process(ev) ev.tbl = ('x'):rep(1e10) end`,
+	} {
+		f := newTestFilter(t, fmt.Sprintf("TestSandboxRep%d", i), src)
+		f.process("x", makeOrder())
+		assert.Equal(t, int64(1), f.errors.Count())
+		f.vm.close()
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "test.lua")
+	write := func(src string, modTime time.Time) {
+		if err := ioutil.WriteFile(file, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now().Truncate(time.Second)
+	write(`function process(ev) emit(ev) end`, now)
+	f := newTestFilter(t, "TestReload", `function process(ev) emit(ev) end`)
+	defer func() {
+		f.vm.close()
+	}()
+	f.file, f.modTime = file, now
+
+	// not changed
+	f.reload("x")
+	assert.Equal(t, 1, len(f.process("x", makeOrder())))
+
+	write(`function process(ev) emit(ev) emit(ev) end`, now.Add(time.Second))
+	f.reload("x")
+	assert.Equal(t, 2, len(f.process("x", makeOrder())))
+
+	// broken script is not loaded
+	write(`function process(ev) emit(ev`, now.Add(time.Second*2))
+	f.reload("x")
+	assert.Equal(t, 2, len(f.process("x", makeOrder())))
+
+	write(`x = 1`, now.Add(time.Second*3))
+	f.reload("x")
+	assert.Equal(t, 2, len(f.process("x", makeOrder())))
+}
@@ -0,0 +1,188 @@
+package script
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/funkygao/dbus/pkg/model"
+	"github.com/yuin/gopher-lua"
+)
+
+// Lua event table of RowsEvent:
+//
+//	{db=, tbl=, dml=, ts=, log=, pos=, gtid=, cols={"id", ...}, rows={{id=1, ...}, ...}}
+//
+// For update, rows are pairs of [before update row, after update row].
+// Only db, tbl, dml, cols and rows are written back to the emitted event.
+
+// toLua converts a column value into lua value.
+// Lua numbers are float64: integers beyond 2^53 lose precision if they are modified.
+func toLua(v interface{}) lua.LValue {
+	switch x := v.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(x)
+	case string:
+		return lua.LString(x)
+	case []byte:
+		return lua.LString(x)
+	case int:
+		return lua.LNumber(x)
+	case int8:
+		return lua.LNumber(x)
+	case int16:
+		return lua.LNumber(x)
+	case int32:
+		return lua.LNumber(x)
+	case int64:
+		return lua.LNumber(x)
+	case uint:
+		return lua.LNumber(x)
+	case uint8:
+		return lua.LNumber(x)
+	case uint16:
+		return lua.LNumber(x)
+	case uint32:
+		return lua.LNumber(x)
+	case uint64:
+		return lua.LNumber(x)
+	case float32:
+		return lua.LNumber(x)
+	case float64:
+		return lua.LNumber(x)
+	default:
+		return lua.LString(fmt.Sprint(x))
+	}
+}
+
+// fromLua converts lua value back into column value.
+// The original value is kept if it is not modified so that its Go type and precision survive.
+func fromLua(lv lua.LValue, orig interface{}, hasOrig bool) interface{} {
+	if hasOrig && toLua(orig) == lv {
+		return orig
+	}
+
+	switch x := lv.(type) {
+	case lua.LBool:
+		return bool(x)
+	case lua.LString:
+		return string(x)
+	case lua.LNumber:
+		f := float64(x)
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return int64(f)
+		}
+		return f
+	}
+	return nil
+}
+
+// eventTable converts the rows event into lua table, the original row of each row table
+// is recorded in origins.
+func eventTable(L *lua.LState, ev *model.RowsEvent, origins map[*lua.LTable][]interface{}) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("db", lua.LString(ev.Schema))
+	t.RawSetString("tbl", lua.LString(ev.Table))
+	t.RawSetString("dml", lua.LString(ev.Action))
+	t.RawSetString("ts", lua.LNumber(ev.Timestamp))
+	t.RawSetString("log", lua.LString(ev.Log))
+	t.RawSetString("pos", lua.LNumber(ev.Position))
+	t.RawSetString("gtid", lua.LString(ev.GTID))
+
+	cols := L.NewTable()
+	for _, col := range ev.Columns {
+		cols.Append(lua.LString(col))
+	}
+	t.RawSetString("cols", cols)
+
+	rows := L.NewTable()
+	for _, row := range ev.Rows {
+		r := L.NewTable()
+		for i, col := range ev.Columns {
+			if i < len(row) {
+				r.RawSetString(col, toLua(row[i]))
+			}
+		}
+		origins[r] = row
+		rows.Append(r)
+	}
+	t.RawSetString("rows", rows)
+
+	return t
+}
+
+// eventFromTable converts the lua event table back into a new rows event based on the original.
+func eventFromTable(t *lua.LTable, orig *model.RowsEvent, origins map[*lua.LTable][]interface{}) (*model.RowsEvent, error) {
+	cols, ok := t.RawGetString("cols").(*lua.LTable)
+	if !ok {
+		return nil, ErrInvalidCols
+	}
+	rows, ok := t.RawGetString("rows").(*lua.LTable)
+	if !ok {
+		return nil, ErrInvalidRows
+	}
+
+	e := orig.CloneWithRows(nil)
+	e.Schema = lua.LVAsString(t.RawGetString("db"))
+	e.Table = lua.LVAsString(t.RawGetString("tbl"))
+	e.Action = lua.LVAsString(t.RawGetString("dml"))
+
+	origIndex := make(map[string]int, len(orig.Columns))
+	for i, col := range orig.Columns {
+		origIndex[col] = i
+	}
+
+	e.Columns = make([]string, 0, cols.Len())
+	for i := 1; i <= cols.Len(); i++ {
+		col, ok := cols.RawGetInt(i).(lua.LString)
+		if !ok {
+			return nil, ErrInvalidCols
+		}
+		e.Columns = append(e.Columns, string(col))
+	}
+
+	if len(orig.ColumnTypes) == len(orig.Columns) {
+		e.ColumnTypes = make([]model.Column, len(e.Columns))
+		for i, col := range e.Columns {
+			if j, present := origIndex[col]; present {
+				e.ColumnTypes[i] = orig.ColumnTypes[j]
+			} else {
+				e.ColumnTypes[i] = model.Column{Name: col}
+			}
+		}
+	}
+
+	e.PKs = nil
+	for _, pk := range orig.PKs {
+		for i, col := range e.Columns {
+			if pk < len(orig.Columns) && orig.Columns[pk] == col {
+				e.PKs = append(e.PKs, i)
+			}
+		}
+	}
+
+	e.Rows = make([][]interface{}, 0, rows.Len())
+	for i := 1; i <= rows.Len(); i++ {
+		r, ok := rows.RawGetInt(i).(*lua.LTable)
+		if !ok {
+			return nil, ErrInvalidRows
+		}
+
+		origRow, hasOrigRow := origins[r]
+		row := make([]interface{}, len(e.Columns))
+		for j, col := range e.Columns {
+			var (
+				v    interface{}
+				hasV bool
+			)
+			if k, present := origIndex[col]; present && hasOrigRow && k < len(origRow) {
+				v, hasV = origRow[k], true
+			}
+			row[j] = fromLua(r.RawGetString(col), v, hasV)
+		}
+		e.Rows = append(e.Rows, row)
+	}
+
+	return e, nil
+}
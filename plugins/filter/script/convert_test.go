@@ -0,0 +1,73 @@
+package script
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/pkg/model"
+	"github.com/yuin/gopher-lua"
+)
+
+func TestFromLua(t *testing.T) {
+	// unmodified values keep Go type and precision
+	for _, v := range []interface{}{int64(1<<60 + 1), uint64(1<<64 - 1), int32(2), []byte("a"), 2.5, "s", true, nil} {
+		assert.Equal(t, v, fromLua(toLua(v), v, true))
+	}
+
+	assert.Equal(t, int64(3), fromLua(lua.LNumber(3), int32(2), true))
+	assert.Equal(t, 2.5, fromLua(lua.LNumber(2.5), nil, false))
+	assert.Equal(t, float64(1<<60), fromLua(lua.LNumber(1<<60), nil, false))
+	assert.Equal(t, "b", fromLua(lua.LString("b"), []byte("a"), true))
+	assert.Equal(t, false, fromLua(lua.LFalse, nil, false))
+	assert.Equal(t, nil, fromLua(lua.LNil, 1, true))
+}
+
+func TestEventTableRoundTrip(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	ev := makeOrder()
+	ev.Action = "U"
+	ev.GTID = "uuid:1"
+	origins := make(map[*lua.LTable][]interface{})
+	tbl := eventTable(L, ev, origins)
+	assert.Equal(t, "U", lua.LVAsString(tbl.RawGetString("dml")))
+	assert.Equal(t, "uuid:1", lua.LVAsString(tbl.RawGetString("gtid")))
+	assert.Equal(t, 2, len(origins))
+
+	e, err := eventFromTable(tbl, ev, origins)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, ev.Columns, e.Columns)
+	assert.Equal(t, ev.ColumnTypes, e.ColumnTypes)
+	assert.Equal(t, ev.PKs, e.PKs)
+	assert.Equal(t, ev.Rows, e.Rows)
+
+	// drop column id and add column memo
+	cols := tbl.RawGetString("cols").(*lua.LTable)
+	cols.RawSetInt(1, lua.LString("memo"))
+	row := tbl.RawGetString("rows").(*lua.LTable).RawGetInt(1).(*lua.LTable)
+	row.RawSetString("memo", lua.LString("hi"))
+	e, err = eventFromTable(tbl, ev, origins)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"memo", "price", "qty"}, e.Columns)
+	assert.Equal(t, model.Column{Name: "memo"}, e.ColumnTypes[0])
+	assert.Equal(t, 0, len(e.PKs))
+	assert.Equal(t, []interface{}{"hi", 2.5, int32(2)}, e.Rows[0])
+	assert.Equal(t, []interface{}{nil, 1.5, int32(4)}, e.Rows[1])
+
+	// rows created by script have no origins
+	rows := tbl.RawGetString("rows").(*lua.LTable)
+	r := L.NewTable()
+	r.RawSetString("qty", lua.LNumber(1))
+	rows.Append(r)
+	e, _ = eventFromTable(tbl, ev, origins)
+	assert.Equal(t, []interface{}{nil, nil, int64(1)}, e.Rows[2])
+
+	tbl.RawSetString("cols", lua.LNumber(1))
+	_, err = eventFromTable(tbl, ev, origins)
+	assert.Equal(t, ErrInvalidCols, err)
+	tbl.RawSetString("cols", cols)
+	rows.Append(lua.LNumber(1))
+	_, err = eventFromTable(tbl, ev, origins)
+	assert.Equal(t, ErrInvalidRows, err)
+}
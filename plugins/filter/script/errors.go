@@ -0,0 +1,12 @@
+package script
+
+import (
+	"errors"
+)
+
+var (
+	ErrTimeout     = errors.New("script execution timeout")
+	ErrNoProcess   = errors.New("script has no process function")
+	ErrInvalidCols = errors.New("event cols is not a table of strings")
+	ErrInvalidRows = errors.New("event rows is not a table of tables")
+)
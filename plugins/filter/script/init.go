@@ -0,0 +1,15 @@
+package script
+
+import (
+	"github.com/funkygao/dbus/engine"
+)
+
+var (
+	_ engine.Filter = &ScriptFilter{}
+)
+
+func init() {
+	engine.RegisterPlugin("ScriptFilter", func() engine.Plugin {
+		return new(ScriptFilter)
+	})
+}
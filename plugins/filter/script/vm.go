@@ -0,0 +1,129 @@
+package script
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+const (
+	processFunc = "process"
+
+	vmCallStackSize = 64
+	vmRegistrySize  = 1 << 14
+
+	// lua state has no memory limit, string.rep is bounded to avoid exhausting memory in a single call.
+	vmMaxRepLen = 1 << 20
+)
+
+// functions of base lib that reach outside of the sandbox
+var unsafeBuiltins = []string{"dofile", "loadfile", "load", "loadstring", "require", "module", "collectgarbage", "print"}
+
+// vm is a sandboxed lua state with the script loaded.
+// Only base, table, string and math libs are available: no io, os, package and debug.
+// string.rep is replaced with bounded repLimited.
+type vm struct {
+	L       *lua.LState
+	process *lua.LFunction
+}
+
+// compile parses the script into a function proto that can be shared by lua states.
+func compile(name, src string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(src), name)
+	if err != nil {
+		return nil, err
+	}
+
+	return lua.Compile(chunk, name)
+}
+
+// newVM creates a sandbox, runs the script and binds the builtin functions.
+func newVM(proto *lua.FunctionProto, builtins map[string]lua.LGFunction, timeout time.Duration) (*vm, error) {
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:  true,
+		CallStackSize: vmCallStackSize,
+		RegistrySize:  vmRegistrySize,
+	})
+
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range unsafeBuiltins {
+		L.SetGlobal(name, lua.LNil)
+	}
+	// string methods share the string lib table
+	L.SetField(L.GetGlobal(lua.StringLibName), "rep", L.NewFunction(repLimited))
+	for name, fn := range builtins {
+		L.SetGlobal(name, L.NewFunction(fn))
+	}
+
+	// the top level statements are under the time budget too
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	L.SetContext(ctx)
+	L.Push(L.NewFunctionFromProto(proto))
+	err := L.PCall(0, lua.MultRet, nil)
+	L.RemoveContext()
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = ErrTimeout
+	}
+	if err != nil {
+		L.Close()
+		return nil, err
+	}
+
+	process, ok := L.GetGlobal(processFunc).(*lua.LFunction)
+	if !ok {
+		L.Close()
+		return nil, ErrNoProcess
+	}
+
+	return &vm{L: L, process: process}, nil
+}
+
+// call invokes the process function with the time budget.
+func (v *vm) call(arg lua.LValue, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	v.L.SetContext(ctx)
+	err := v.L.CallByParam(lua.P{Fn: v.process, NRet: 0, Protect: true}, arg)
+	v.L.RemoveContext()
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return ErrTimeout
+	}
+	return err
+}
+
+func (v *vm) close() {
+	v.L.Close()
+}
+
+// repLimited is string.rep(s, n) that raises error if the result exceeds vmMaxRepLen.
+func repLimited(L *lua.LState) int {
+	s, n := L.CheckString(1), L.CheckInt(2)
+	if n <= 0 {
+		L.Push(lua.LString(""))
+		return 1
+	}
+	if len(s) > 0 && n > vmMaxRepLen/len(s) {
+		L.RaiseError("string.rep: result exceeds %d bytes", vmMaxRepLen)
+		return 0
+	}
+
+	L.Push(lua.LString(strings.Repeat(s, n)))
+	return 1
+}
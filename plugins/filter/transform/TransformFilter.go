@@ -0,0 +1,129 @@
+package transform
+
+import (
+	"fmt"
+
+	"github.com/funkygao/dbus/engine"
+	conf "github.com/funkygao/jsconf"
+)
+
+// TransformFilter is a filter plugin that applies a chain of operators on the packets,
+// and emits the transformed payloads as cloned packets.
+//
+// Operators:
+//
+//	drop    drop rows(or KeyValuer payload) whose field is in the values or matches the regex
+//	keep    keep only rows(or KeyValuer payload) that match the condition
+//	rename  rename columns(or KeyValuer keys)
+//	project keep only the columns in the given order
+//	split   split multi-row event into single-row events
+//	add     add columns(or KeyValuer keys) with static values
+//	count   count the payloads in meter plugin.<name>.<metric> exported by /metrics
+//
+// Condition field is a column name, or $db, $table, $action of the rows event.
+type TransformFilter struct {
+	name      string
+	ident     string
+	operators []operator
+	meters    []string // meters of count operators
+}
+
+func (this *TransformFilter) Init(config *conf.Conf) {
+	this.ident = config.String("ident", "")
+	if this.ident == "" {
+		// emitted packets with the received Ident would be routed back to itself
+		panic("empty ident")
+	}
+	this.name = config.String("name", "")
+	for i := 0; i < len(config.List("operators", nil)); i++ {
+		section, err := config.Section(fmt.Sprintf("operators[%d]", i))
+		if err != nil {
+			panic(err)
+		}
+
+		this.operators = append(this.operators, newOperator(this.name, section))
+		if section.String("op", "") == "count" {
+			this.meters = append(this.meters, section.String("metric", ""))
+		}
+	}
+	if len(this.operators) == 0 {
+		panic("empty operators")
+	}
+}
+
+func (*TransformFilter) SampleConfig() string {
+	return `
+	ident: "transformed" // Ident of emitted packets
+	operators: [
+	    {
+	        op: "drop"
+	        field: "$action"
+	        in: ["D"]
+	    }
+	    {
+	        op: "keep"
+	        field: "status"
+	        regex: "^(paid|shipped)$"
+	    }
+	    {
+	        op: "rename"
+	        from: ["uid"]
+	        to: ["user_id"]
+	    }
+	    {
+	        op: "project"
+	        columns: ["id", "user_id", "status"]
+	    }
+	    {
+	        op: "add"
+	        columns: ["source"]
+	        values: ["mysql"]
+	    }
+	    {
+	        op: "split"
+	    }
+	    {
+	        op: "count"
+	        metric: "orders"
+	    }
+	]
+	`
+}
+
+func (this *TransformFilter) Run(r engine.FilterRunner, h engine.PluginHelper) error {
+	defer func() {
+		for _, metric := range this.meters {
+			engine.UnregisterPluginMeter(this.name, metric)
+		}
+	}()
+
+	for pack := range r.Exchange().InChan() {
+		for _, payload := range this.transform(pack.Payload) {
+			p := h.ShallowClonePacket(pack)
+			p.Ident = this.ident
+			p.Payload = payload
+			r.Exchange().Emit(p)
+		}
+
+		pack.Recycle()
+	}
+
+	return nil
+}
+
+func (this *TransformFilter) transform(payload engine.Payloader) []engine.Payloader {
+	payloads := []engine.Payloader{payload}
+	for _, op := range this.operators {
+		var next []engine.Payloader
+		for _, p := range payloads {
+			next = append(next, op(p)...)
+		}
+		if len(next) == 0 {
+			return nil
+		}
+
+		payloads = next
+	}
+
+	return payloads
+}
@@ -0,0 +1,15 @@
+package transform
+
+import (
+	"github.com/funkygao/dbus/engine"
+)
+
+var (
+	_ engine.Filter = &TransformFilter{}
+)
+
+func init() {
+	engine.RegisterPlugin("TransformFilter", func() engine.Plugin {
+		return new(TransformFilter)
+	})
+}
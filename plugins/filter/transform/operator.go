@@ -0,0 +1,346 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/funkygao/dbus/engine"
+	"github.com/funkygao/dbus/pkg/model"
+	"github.com/funkygao/go-metrics"
+	conf "github.com/funkygao/jsconf"
+)
+
+// operator transforms a payload into zero or more payloads.
+// Payload is never modified in place because it might be shared with other plugins,
+// unless it is a KeyValuer that is not engine.Cloner.
+type operator func(payload engine.Payloader) []engine.Payloader
+
+// Event fields of RowsEvent in condition, other fields are column names.
+const (
+	fieldDB     = "$db"
+	fieldTable  = "$table"
+	fieldAction = "$action"
+)
+
+func newOperator(name string, section *conf.Conf) operator {
+	switch op := section.String("op", ""); op {
+	case "drop":
+		return dropOperator(newCondition(section), false)
+
+	case "keep":
+		return dropOperator(newCondition(section), true)
+
+	case "rename":
+		from, to := section.StringList("from", nil), section.StringList("to", nil)
+		if len(from) == 0 || len(from) != len(to) {
+			panic("rename: from and to mismatch")
+		}
+		return renameOperator(from, to)
+
+	case "project":
+		columns := section.StringList("columns", nil)
+		if len(columns) == 0 {
+			panic("project: empty columns")
+		}
+		return projectOperator(columns)
+
+	case "split":
+		return splitOperator
+
+	case "add":
+		columns, values := section.StringList("columns", nil), section.StringList("values", nil)
+		if len(columns) == 0 || len(columns) != len(values) {
+			panic("add: columns and values mismatch")
+		}
+		return addOperator(columns, values)
+
+	case "count":
+		metric := section.String("metric", "")
+		if metric == "" {
+			panic("count: empty metric")
+		}
+		return countOperator(engine.NewPluginMeter(name, metric))
+
+	default:
+		panic("invalid op: " + op)
+	}
+}
+
+// condition matches a field value against a list of values or a regexp.
+type condition struct {
+	field  string
+	values map[string]struct{}
+	re     *regexp.Regexp
+}
+
+func newCondition(section *conf.Conf) *condition {
+	c := &condition{field: section.String("field", "")}
+	if c.field == "" {
+		panic("empty condition field")
+	}
+
+	if values := section.StringList("in", nil); len(values) > 0 {
+		c.values = make(map[string]struct{}, len(values))
+		for _, v := range values {
+			c.values[v] = struct{}{}
+		}
+	}
+	if re := section.String("regex", ""); re != "" {
+		c.re = regexp.MustCompile(re)
+	}
+	if c.values == nil && c.re == nil {
+		panic(c.field + ": condition requires in or regex")
+	}
+
+	return c
+}
+
+func (c *condition) matchValue(v interface{}, present bool) bool {
+	if !present {
+		return false
+	}
+
+	var s string
+	switch x := v.(type) {
+	case string:
+		s = x
+	case []byte:
+		s = string(x)
+	default:
+		s = fmt.Sprint(x)
+	}
+
+	if c.values != nil {
+		if _, present := c.values[s]; present {
+			return true
+		}
+	}
+	return c.re != nil && c.re.MatchString(s)
+}
+
+// matchRow checks the condition on a row of the rows event.
+func (c *condition) matchRow(r *model.RowsEvent, row []interface{}) bool {
+	switch c.field {
+	case fieldDB:
+		return c.matchValue(r.Schema, true)
+	case fieldTable:
+		return c.matchValue(r.Table, true)
+	case fieldAction:
+		return c.matchValue(r.Action, true)
+	}
+
+	for i, col := range r.Columns {
+		if col == c.field && i < len(row) {
+			return c.matchValue(row[i], true)
+		}
+	}
+	return false
+}
+
+func (c *condition) matchKeyValuer(kv engine.KeyValuer) bool {
+	return c.matchValue(kv.Get(c.field))
+}
+
+// invalidator is a payload that caches its encoding, e,g. model.RowsEvent.
+type invalidator interface {
+	Invalidate()
+}
+
+// invalidate discards the cached encoding of a modified payload.
+func invalidate(payload engine.Payloader) engine.Payloader {
+	if i, ok := payload.(invalidator); ok {
+		i.Invalidate()
+	}
+	return payload
+}
+
+// writable returns a copy of the KeyValuer payload to modify if it is engine.Cloner.
+func writable(payload engine.Payloader) engine.Payloader {
+	if c, ok := payload.(engine.Cloner); ok {
+		p := c.ClonePayload()
+		if _, ok := p.(engine.KeyValuer); ok {
+			return p
+		}
+	}
+	return payload
+}
+
+// rowStep returns number of rows of a single row change.
+func rowStep(r *model.RowsEvent) int {
+	if r.Action == "U" {
+		// [before update row, after update row]
+		return 2
+	}
+	return 1
+}
+
+// dropOperator drops the rows that match the condition, or keeps only them if keep.
+// For update, the after image is evaluated. Events without rows left are dropped.
+func dropOperator(c *condition, keep bool) operator {
+	return func(payload engine.Payloader) []engine.Payloader {
+		switch ev := payload.(type) {
+		case *model.RowsEvent:
+			step := rowStep(ev)
+			var rows [][]interface{}
+			for i := 0; i+step <= len(ev.Rows); i += step {
+				if c.matchRow(ev, ev.Rows[i+step-1]) == keep {
+					rows = append(rows, ev.Rows[i:i+step]...)
+				}
+			}
+			if len(rows) == 0 {
+				return nil
+			}
+			if len(rows) == len(ev.Rows) {
+				return []engine.Payloader{ev}
+			}
+
+			return []engine.Payloader{ev.CloneWithRows(rows)}
+
+		case engine.KeyValuer:
+			if c.matchKeyValuer(ev) == keep {
+				return []engine.Payloader{payload}
+			}
+			return nil
+		}
+
+		return []engine.Payloader{payload}
+	}
+}
+
+func renameOperator(from, to []string) operator {
+	return func(payload engine.Payloader) []engine.Payloader {
+		switch ev := payload.(type) {
+		case *model.RowsEvent:
+			e := ev.Clone()
+			for i, col := range e.Columns {
+				for j, name := range from {
+					if col == name {
+						e.Columns[i] = to[j]
+						if i < len(e.ColumnTypes) {
+							e.ColumnTypes[i].Name = to[j]
+						}
+						break
+					}
+				}
+			}
+			return []engine.Payloader{invalidate(e)}
+
+		case engine.KeyValuer:
+			payload = writable(payload)
+			kv := payload.(engine.KeyValuer)
+			for i, name := range from {
+				if v, present := kv.Get(name); present {
+					kv.Del(name)
+					kv.Set(to[i], v)
+				}
+			}
+			invalidate(payload)
+		}
+
+		return []engine.Payloader{payload}
+	}
+}
+
+// projectOperator keeps only the columns in the given order, primary keys are remapped.
+func projectOperator(columns []string) operator {
+	return func(payload engine.Payloader) []engine.Payloader {
+		ev, ok := payload.(*model.RowsEvent)
+		if !ok {
+			return []engine.Payloader{payload}
+		}
+
+		idx := make([]int, 0, len(columns)) // old index of projected columns
+		for _, name := range columns {
+			for i, col := range ev.Columns {
+				if col == name {
+					idx = append(idx, i)
+					break
+				}
+			}
+		}
+
+		e := ev.Clone()
+		e.Columns = make([]string, len(idx))
+		for j, i := range idx {
+			e.Columns[j] = ev.Columns[i]
+		}
+		if len(ev.ColumnTypes) == len(ev.Columns) {
+			e.ColumnTypes = make([]model.Column, len(idx))
+			for j, i := range idx {
+				e.ColumnTypes[j] = ev.ColumnTypes[i]
+			}
+		}
+		e.PKs = nil
+		for _, pk := range ev.PKs {
+			for j, i := range idx {
+				if i == pk {
+					e.PKs = append(e.PKs, j)
+				}
+			}
+		}
+		for r, row := range ev.Rows {
+			e.Rows[r] = make([]interface{}, len(idx))
+			for j, i := range idx {
+				if i < len(row) {
+					e.Rows[r][j] = row[i]
+				}
+			}
+		}
+
+		return []engine.Payloader{invalidate(e)}
+	}
+}
+
+// splitOperator splits a multi-row event into single-row events.
+func splitOperator(payload engine.Payloader) []engine.Payloader {
+	ev, ok := payload.(*model.RowsEvent)
+	if !ok {
+		return []engine.Payloader{payload}
+	}
+
+	events := ev.SplitRows()
+	r := make([]engine.Payloader, len(events))
+	for i, e := range events {
+		r[i] = e
+	}
+	return r
+}
+
+// addOperator adds static fields.
+func addOperator(columns, values []string) operator {
+	return func(payload engine.Payloader) []engine.Payloader {
+		switch ev := payload.(type) {
+		case *model.RowsEvent:
+			e := ev.Clone()
+			typed := len(e.ColumnTypes) == len(e.Columns)
+			for i, col := range columns {
+				e.Columns = append(e.Columns, col)
+				if typed {
+					e.ColumnTypes = append(e.ColumnTypes, model.Column{Name: col, Type: "varchar(255)"})
+				}
+				for r := range e.Rows {
+					e.Rows[r] = append(e.Rows[r], values[i])
+				}
+			}
+			return []engine.Payloader{invalidate(e)}
+
+		case engine.KeyValuer:
+			payload = writable(payload)
+			kv := payload.(engine.KeyValuer)
+			for i, col := range columns {
+				kv.Set(col, values[i])
+			}
+			invalidate(payload)
+		}
+
+		return []engine.Payloader{payload}
+	}
+}
+
+// countOperator counts the payloads passing through it.
+func countOperator(meter metrics.Meter) operator {
+	return func(payload engine.Payloader) []engine.Payloader {
+		meter.Mark(1)
+		return []engine.Payloader{payload}
+	}
+}
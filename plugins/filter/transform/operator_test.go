@@ -0,0 +1,162 @@
+package transform
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/engine"
+	"github.com/funkygao/dbus/pkg/model"
+)
+
+// kv is a KeyValuer payload that is not engine.Cloner.
+type kv map[string]interface{}
+
+func (m kv) Length() int {
+	return len(m)
+}
+
+func (m kv) Encode() ([]byte, error) {
+	return nil, nil
+}
+
+func (m kv) Get(k string) (interface{}, bool) {
+	v, ok := m[k]
+	return v, ok
+}
+
+func (m kv) Set(k string, v interface{}) {
+	m[k] = v
+}
+
+func (m kv) Del(k string) {
+	delete(m, k)
+}
+
+func makeOrders() *model.RowsEvent {
+	return &model.RowsEvent{
+		Schema:      "db",
+		Table:       "orders",
+		Action:      "I",
+		Columns:     []string{"id", "uid", "status"},
+		ColumnTypes: []model.Column{{Name: "id", Type: "int(11)"}, {Name: "uid", Type: "int(11)"}, {Name: "status", Type: "varchar(10)"}},
+		PKs:         []int{0},
+		Rows:        [][]interface{}{{1, 10, "paid"}, {2, 20, "new"}, {3, 30, "shipped"}},
+	}
+}
+
+func TestDropOperator(t *testing.T) {
+	ev := makeOrders()
+	c := &condition{field: "status", values: map[string]struct{}{"new": {}}}
+
+	r := dropOperator(c, false)(ev)
+	assert.Equal(t, 1, len(r))
+	e := r[0].(*model.RowsEvent)
+	assert.Equal(t, [][]interface{}{{1, 10, "paid"}, {3, 30, "shipped"}}, e.Rows)
+	assert.Equal(t, 3, len(ev.Rows))
+
+	r = dropOperator(c, true)(ev)
+	assert.Equal(t, [][]interface{}{{2, 20, "new"}}, r[0].(*model.RowsEvent).Rows)
+
+	// all rows kept: the event is passed through
+	c = &condition{field: "$table", re: regexp.MustCompile("^ord")}
+	r = dropOperator(c, true)(ev)
+	assert.Equal(t, true, r[0].(*model.RowsEvent) == ev)
+	assert.Equal(t, 0, len(dropOperator(c, false)(ev)))
+
+	// update is evaluated on the after image
+	ev.Action = "U"
+	ev.Rows = [][]interface{}{{1, 10, "new"}, {1, 10, "paid"}, {2, 20, "paid"}, {2, 20, "new"}}
+	c = &condition{field: "status", values: map[string]struct{}{"new": {}}}
+	r = dropOperator(c, false)(ev)
+	assert.Equal(t, [][]interface{}{{1, 10, "new"}, {1, 10, "paid"}}, r[0].(*model.RowsEvent).Rows)
+
+	// KeyValuer
+	assert.Equal(t, 0, len(dropOperator(c, false)(kv{"status": "new"})))
+	assert.Equal(t, 1, len(dropOperator(c, false)(kv{"status": "paid"})))
+	assert.Equal(t, 0, len(dropOperator(c, true)(kv{})))
+}
+
+func TestRenameOperator(t *testing.T) {
+	ev := makeOrders()
+	op := renameOperator([]string{"uid", "none"}, []string{"user_id", "nil"})
+
+	e := op(ev)[0].(*model.RowsEvent)
+	assert.Equal(t, []string{"id", "user_id", "status"}, e.Columns)
+	assert.Equal(t, "user_id", e.ColumnTypes[1].Name)
+	assert.Equal(t, []string{"id", "uid", "status"}, ev.Columns)
+	assert.Equal(t, "uid", ev.ColumnTypes[1].Name)
+
+	m := kv{"id": 1, "uid": 10}
+	op(m)
+	assert.Equal(t, kv{"id": 1, "user_id": 10}, m)
+}
+
+func TestProjectOperator(t *testing.T) {
+	ev := makeOrders()
+
+	e := projectOperator([]string{"status", "id", "none"})(ev)[0].(*model.RowsEvent)
+	assert.Equal(t, []string{"status", "id"}, e.Columns)
+	assert.Equal(t, []model.Column{{Name: "status", Type: "varchar(10)"}, {Name: "id", Type: "int(11)"}}, e.ColumnTypes)
+	assert.Equal(t, []int{1}, e.PKs)
+	assert.Equal(t, [][]interface{}{{"paid", 1}, {"new", 2}, {"shipped", 3}}, e.Rows)
+	assert.Equal(t, []interface{}{1, 10, "paid"}, ev.Rows[0])
+	assert.Equal(t, []int{0}, ev.PKs)
+
+	// pk projected out
+	e = projectOperator([]string{"status"})(ev)[0].(*model.RowsEvent)
+	assert.Equal(t, 0, len(e.PKs))
+
+	// other payloads pass through
+	m := kv{"id": 1}
+	assert.Equal(t, kv{"id": 1}, projectOperator([]string{"status"})(m)[0])
+}
+
+func TestSplitOperator(t *testing.T) {
+	ev := makeOrders()
+	r := splitOperator(ev)
+	assert.Equal(t, 3, len(r))
+	for i, p := range r {
+		assert.Equal(t, [][]interface{}{ev.Rows[i]}, p.(*model.RowsEvent).Rows)
+	}
+
+	ev.Action = "U"
+	ev.Rows = ev.Rows[:2]
+	r = splitOperator(ev)
+	assert.Equal(t, 1, len(r))
+	assert.Equal(t, true, r[0].(*model.RowsEvent) == ev)
+
+	assert.Equal(t, 1, len(splitOperator(kv{})))
+}
+
+func TestAddOperator(t *testing.T) {
+	ev := makeOrders()
+	op := addOperator([]string{"source"}, []string{"mysql"})
+
+	e := op(ev)[0].(*model.RowsEvent)
+	assert.Equal(t, []string{"id", "uid", "status", "source"}, e.Columns)
+	assert.Equal(t, model.Column{Name: "source", Type: "varchar(255)"}, e.ColumnTypes[3])
+	for _, row := range e.Rows {
+		assert.Equal(t, "mysql", row[3])
+	}
+	assert.Equal(t, 3, len(ev.Columns))
+	assert.Equal(t, 3, len(ev.Rows[0]))
+
+	m := kv{"id": 1}
+	op(m)
+	assert.Equal(t, kv{"id": 1, "source": "mysql"}, m)
+}
+
+func TestTransformChain(t *testing.T) {
+	f := &TransformFilter{operators: []operator{
+		dropOperator(&condition{field: "status", values: map[string]struct{}{"new": {}}}, false),
+		splitOperator,
+	}}
+
+	r := f.transform(makeOrders())
+	assert.Equal(t, 2, len(r))
+	assert.Equal(t, []interface{}{3, 30, "shipped"}, r[1].(*model.RowsEvent).Rows[0])
+
+	var p engine.Payloader = kv{"status": "new"}
+	assert.Equal(t, 0, len(f.transform(p)))
+}
@@ -17,41 +17,67 @@ import (
 // For cluster, there should be a load balancer sitting in front of dbusd.
 type HTTPInput struct {
 	ex engine.Exchange
+
+	maxBody     int64
+	poolTimeout time.Duration
+	syncAck     bool
+	ackTimeout  time.Duration
+
+	// acquiring serializes packets acquisition from the recycle pool, so that concurrent
+	// requests never hold part of the pool each and starve one another.
+	acquiring chan struct{}
 }
 
 func (this *HTTPInput) Init(config *conf.Conf) {
+	this.maxBody = int64(config.Int("max_body", 1<<20))
+	this.poolTimeout = config.Duration("pool_timeout", time.Millisecond*100)
+	this.syncAck = config.Bool("sync_ack", false)
+	this.ackTimeout = config.Duration("ack_timeout", time.Second*5)
+	this.acquiring = make(chan struct{}, 1)
 }
 
 func (*HTTPInput) SampleConfig() string {
 	return `
 	listen: "localhost:8899"
+	max_body: 1048576
+	pool_timeout: "100ms"
+	sync_ack: false
+	ack_timeout: "5s"
 	`
 }
 
 func (this *HTTPInput) Ack(pack *engine.Packet) error {
+	if w, ok := pack.Metadata.(*ackWaiter); ok {
+		w.ack()
+	}
+
 	return nil
 }
 
 func (this *HTTPInput) End(r engine.InputRunner) {}
 
+func (this *HTTPInput) router() http.Handler {
+	router := mux.NewRouter()
+	handler := middleware.WrapAccesslog(
+		middleware.WrapWithRecover(
+			http.HandlerFunc(this.payloadHandler)))
+	router.Handle("/v1/payload", handler).Methods("POST")
+	router.Handle("/v1/payload/{ident}", handler).Methods("POST")
+	return router
+}
+
 func (this *HTTPInput) Run(r engine.InputRunner, h engine.PluginHelper) error {
 	addr := r.Conf().String("listen", "")
 	if len(addr) == 0 {
 		return errors.New("empty listen")
 	}
 
-	router := mux.NewRouter()
 	server := &http.Server{
 		Addr:         addr,
-		Handler:      router,
+		Handler:      this.router(),
 		ReadTimeout:  time.Second * 10,
-		WriteTimeout: time.Second * 10,
+		WriteTimeout: time.Second*10 + this.ackTimeout,
 	}
-	router.Handle("/v1/payload",
-		middleware.WrapAccesslog(
-			middleware.WrapWithRecover(
-				http.HandlerFunc(this.payloadHandler)))).
-		Methods("POST")
 
 	l, err := net.Listen("tcp", addr)
 	if err != nil {
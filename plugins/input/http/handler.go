@@ -1,8 +1,204 @@
 package http
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/funkygao/dbus/engine"
+	"github.com/funkygao/dbus/pkg/model"
+	"github.com/gorilla/mux"
 )
 
+// HeaderIdent is the HTTP header to specify the packet Ident for routing.
+// Ident in the URL path /v1/payload/{ident} takes precedence.
+const HeaderIdent = "X-Dbus-Ident"
+
+var errEmptyPayload = errors.New("empty payload")
+
+// payloadHandler accepts a single JSON document, a JSON array of documents or
+// NDJSON(Content-Type: application/x-ndjson), each document becomes a packet.
+//
+// If there are more documents than the recycle pool holds, responds 413.
+// If the recycle pool is saturated, responds 503 and nothing is emitted.
+// In sync ack mode, the response is held until all the packets are acked by Output,
+// responds 504 on ack timeout and the caller should retry: at-least-once delivery.
+// Otherwise responds 202 once the packets are emitted.
 func (this *HTTPInput) payloadHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, this.maxBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var payloads []model.Bytes
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-ndjson") {
+		payloads, err = parseNDJSON(body)
+	} else {
+		payloads, err = parseJSON(body)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ident := mux.Vars(r)["ident"]
+	if len(ident) == 0 {
+		ident = r.Header.Get(HeaderIdent)
+	}
+
+	if len(payloads) > cap(this.ex.InChan()) {
+		http.Error(w, fmt.Sprintf("too many documents: %d > %d", len(payloads), cap(this.ex.InChan())),
+			http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	packs, ok := this.acquirePackets(len(payloads))
+	if !ok {
+		http.Error(w, "too busy", http.StatusServiceUnavailable)
+		return
+	}
+
+	var waiter *ackWaiter
+	if this.syncAck {
+		waiter = newAckWaiter(len(packs))
+	}
+	for i, pack := range packs {
+		pack.Ident = ident // empty Ident will be the Input name
+		pack.Payload = payloads[i]
+		pack.Metadata = nil
+		if waiter != nil {
+			pack.Metadata = waiter
+		}
+		this.ex.Emit(pack)
+	}
+
+	if waiter == nil {
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, `{"accepted":%d}`, len(packs))
+		return
+	}
+
+	select {
+	case <-waiter.done:
+		fmt.Fprintf(w, `{"acked":%d}`, len(packs))
+	case <-time.After(this.ackTimeout):
+		http.Error(w, "ack timeout", http.StatusGatewayTimeout)
+	}
+}
+
+// acquirePackets gets n packets from the recycle pool, giving up if the pool
+// stays saturated longer than the pool timeout.
+// One request acquires at a time, so that the partial packets held while waiting
+// never make concurrent requests fail one another.
+func (this *HTTPInput) acquirePackets(n int) ([]*engine.Packet, bool) {
+	timeout := time.After(this.poolTimeout)
+	select {
+	case this.acquiring <- struct{}{}:
+		defer func() { <-this.acquiring }()
+	case <-timeout:
+		return nil, false
+	}
+
+	packs := make([]*engine.Packet, 0, n)
+	for len(packs) < n {
+		select {
+		case pack, ok := <-this.ex.InChan():
+			if !ok {
+				// engine stops
+				releasePackets(packs)
+				return nil, false
+			}
+			packs = append(packs, pack)
+
+		case <-timeout:
+			releasePackets(packs)
+			return nil, false
+		}
+	}
+
+	return packs, true
+}
+
+func releasePackets(packs []*engine.Packet) {
+	for _, pack := range packs {
+		pack.Recycle()
+	}
+}
+
+func parseJSON(body []byte) ([]model.Bytes, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, errEmptyPayload
+	}
+
+	if body[0] != '[' {
+		if !validJSON(body) {
+			return nil, errors.New("invalid json")
+		}
+
+		return []model.Bytes{model.Bytes(body)}, nil
+	}
+
+	var docs []json.RawMessage
+	if err := json.Unmarshal(body, &docs); err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, errEmptyPayload
+	}
+
+	payloads := make([]model.Bytes, len(docs))
+	for i, doc := range docs {
+		payloads[i] = model.Bytes(doc)
+	}
+	return payloads, nil
+}
+
+func parseNDJSON(body []byte) ([]model.Bytes, error) {
+	var payloads []model.Bytes
+	for i, doc := range bytes.Split(body, []byte{'\n'}) {
+		doc = bytes.TrimSpace(doc)
+		if len(doc) == 0 {
+			continue
+		}
+
+		if !validJSON(doc) {
+			return nil, fmt.Errorf("line %d: invalid json", i+1)
+		}
+
+		payloads = append(payloads, model.Bytes(doc))
+	}
+
+	if len(payloads) == 0 {
+		return nil, errEmptyPayload
+	}
+	return payloads, nil
+}
+
+func validJSON(b []byte) bool {
+	var v json.RawMessage
+	return json.Unmarshal(b, &v) == nil
+}
+
+// ackWaiter waits for all the packets of a request to be acked by Output.
+type ackWaiter struct {
+	pending int32
+	done    chan struct{}
+}
+
+func newAckWaiter(n int) *ackWaiter {
+	return &ackWaiter{pending: int32(n), done: make(chan struct{})}
+}
+
+func (w *ackWaiter) ack() {
+	if atomic.AddInt32(&w.pending, -1) == 0 {
+		close(w.done)
+	}
 }
@@ -0,0 +1,131 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/dbus/engine"
+	"github.com/funkygao/dbus/pkg/model"
+)
+
+// exchange is an engine.Exchange with a recycle pool of the given size.
+type exchange struct {
+	pool    chan *engine.Packet
+	input   *HTTPInput
+	ack     bool // ack each emitted packet
+	emitted []*engine.Packet
+}
+
+func (e *exchange) InChan() <-chan *engine.Packet {
+	return e.pool
+}
+
+func (e *exchange) Emit(pack *engine.Packet) {
+	e.emitted = append(e.emitted, pack)
+	if e.ack {
+		e.input.Ack(pack)
+	}
+}
+
+func newTestInput(capacity, free int, syncAck bool) (*HTTPInput, *exchange) {
+	input := &HTTPInput{
+		maxBody:     1 << 20,
+		poolTimeout: time.Millisecond * 20,
+		syncAck:     syncAck,
+		ackTimeout:  time.Millisecond * 20,
+		acquiring:   make(chan struct{}, 1),
+	}
+	ex := &exchange{pool: make(chan *engine.Packet, capacity), input: input}
+	for i := 0; i < free; i++ {
+		ex.pool <- &engine.Packet{}
+	}
+	input.ex = ex
+	return input, ex
+}
+
+func post(input *HTTPInput, path string, header map[string]string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	input.router().ServeHTTP(w, req)
+	return w
+}
+
+func TestPayloadHandlerJSON(t *testing.T) {
+	input, ex := newTestInput(10, 10, false)
+	w := post(input, "/v1/payload/foo", nil, ` {"a":1} `)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, `{"accepted":1}`, w.Body.String())
+	assert.Equal(t, 1, len(ex.emitted))
+	assert.Equal(t, "foo", ex.emitted[0].Ident)
+	assert.Equal(t, model.Bytes(`{"a":1}`), ex.emitted[0].Payload)
+
+	// array
+	ex.emitted = nil
+	w = post(input, "/v1/payload", map[string]string{HeaderIdent: "bar"}, `[{"a":1}, {"b":2}]`)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, 2, len(ex.emitted))
+	assert.Equal(t, "bar", ex.emitted[1].Ident)
+	assert.Equal(t, model.Bytes(`{"b":2}`), ex.emitted[1].Payload)
+
+	for _, body := range []string{``, `[]`, `{"a":`, `[{"a":1},]`} {
+		assert.Equal(t, http.StatusBadRequest, post(input, "/v1/payload", nil, body).Code)
+	}
+}
+
+func TestPayloadHandlerNDJSON(t *testing.T) {
+	input, ex := newTestInput(10, 10, false)
+	ndjson := map[string]string{"Content-Type": "application/x-ndjson", HeaderIdent: "bar"}
+	w := post(input, "/v1/payload/foo", ndjson, "{\"a\":1}\n\n{\"b\":2}\n")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, 2, len(ex.emitted))
+	assert.Equal(t, "foo", ex.emitted[0].Ident) // path takes precedence over header
+	assert.Equal(t, model.Bytes(`{"b":2}`), ex.emitted[1].Payload)
+
+	w = post(input, "/v1/payload", ndjson, "{\"a\":1}\n{\"b\":\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, true, strings.Contains(w.Body.String(), "line 2"))
+	assert.Equal(t, http.StatusBadRequest, post(input, "/v1/payload", ndjson, "\n\n").Code)
+}
+
+func TestPayloadHandlerPool(t *testing.T) {
+	// more documents than the pool holds
+	input, ex := newTestInput(2, 2, false)
+	w := post(input, "/v1/payload", nil, `[1, 2, 3]`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, 0, len(ex.emitted))
+	assert.Equal(t, 2, len(ex.pool))
+
+	// saturated pool
+	input, ex = newTestInput(2, 1, false)
+	w = post(input, "/v1/payload", nil, `[1, 2]`)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, 0, len(ex.emitted))
+
+	// another request is acquiring
+	input, ex = newTestInput(2, 2, false)
+	input.acquiring <- struct{}{}
+	assert.Equal(t, http.StatusServiceUnavailable, post(input, "/v1/payload", nil, `1`).Code)
+	<-input.acquiring
+	assert.Equal(t, http.StatusAccepted, post(input, "/v1/payload", nil, `1`).Code)
+}
+
+func TestPayloadHandlerSyncAck(t *testing.T) {
+	input, ex := newTestInput(10, 10, true)
+	ex.ack = true
+	w := post(input, "/v1/payload", nil, `[1, 2]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"acked":2}`, w.Body.String())
+
+	// not acked by Output in time
+	ex.ack = false
+	w = post(input, "/v1/payload", nil, `[1, 2]`)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, 4, len(ex.emitted))
+}
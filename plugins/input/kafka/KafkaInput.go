@@ -1,6 +1,7 @@
 package kafka
 
 import (
+	"sync"
 	"time"
 
 	"github.com/funkygao/dbus/engine"
@@ -12,23 +13,50 @@ import (
 )
 
 // KafkaInput is an input plugin that consumes data stream from a single specified kafka topic.
+// Offset of each partition is checkpointed on ack, and consuming resumes from it after
+// restart or cluster rebalance.
 type KafkaInput struct {
 	c *kafka.Consumer
+
+	commitInterval time.Duration
+
+	mu          sync.RWMutex
+	checkpoints map[string]*partitionCheckpoint // key is partition DSN
 }
 
 func (this *KafkaInput) Init(config *conf.Conf) {
+	this.commitInterval = config.Duration("offset_commit_interval", time.Second)
+	this.checkpoints = make(map[string]*partitionCheckpoint)
 }
 
 func (*KafkaInput) SampleConfig() string {
-	return ``
+	return `
+	offset_commit_interval: "1s"
+	`
 }
 
 func (this *KafkaInput) Ack(pack *engine.Packet) error {
-	// TODO checkpoint
-	return nil
+	msg, ok := pack.Payload.(model.ConsumerMessage)
+	if !ok {
+		return nil
+	}
+
+	dsn, _ := pack.Metadata.(string)
+	this.mu.RLock()
+	pc := this.checkpoints[dsn]
+	this.mu.RUnlock()
+
+	if pc == nil {
+		// the partition has been rebalanced away, it will be replayed
+		return nil
+	}
+
+	return pc.ack(msg.Offset)
 }
 
-func (this *KafkaInput) End(r engine.InputRunner) {}
+func (this *KafkaInput) End(r engine.InputRunner) {
+	this.closeCheckpoints()
+}
 
 func (this *KafkaInput) Run(r engine.InputRunner, h engine.PluginHelper) error {
 	name := r.Name()
@@ -74,6 +102,7 @@ func (this *KafkaInput) Run(r engine.InputRunner, h engine.PluginHelper) error {
 		log.Trace("[%s] starting consumer from %+v...", name, dsns)
 
 		this.c = kafka.NewConsumer(dsns, cf)
+		this.openCheckpoints(name, dsns)
 		if err := this.c.Start(); err != nil {
 			panic(err)
 		}
@@ -119,7 +148,18 @@ func (this *KafkaInput) Run(r engine.InputRunner, h engine.PluginHelper) error {
 						return nil
 					}
 
-					pack.Payload = model.ConsumerMessage{ConsumerMessage: msg}
+					this.mu.RLock()
+					pc, present := this.checkpoints[msg.DSN]
+					this.mu.RUnlock()
+					if present {
+						pc.tracker.Deliver(msg.Offset)
+					} else {
+						// checkpoint not opened, e,g. invalid DSN, its ack is ignored
+						log.Warn("[%s] %s#%d without checkpoint", name, msg.DSN, msg.Offset)
+					}
+
+					pack.Payload = model.ConsumerMessage{ConsumerMessage: msg.ConsumerMessage}
+					pack.Metadata = msg.DSN
 					ex.Emit(pack)
 				}
 			}
@@ -0,0 +1,103 @@
+package kafka
+
+import (
+	"sync"
+
+	"github.com/funkygao/dbus/engine"
+	"github.com/funkygao/dbus/pkg/checkpoint"
+	kstate "github.com/funkygao/dbus/pkg/checkpoint/state/kafka"
+	"github.com/funkygao/dbus/pkg/checkpoint/store/discard"
+	czk "github.com/funkygao/dbus/pkg/checkpoint/store/zk"
+	"github.com/funkygao/dbus/pkg/kafka"
+	log "github.com/funkygao/log4go"
+)
+
+// partitionCheckpoint commits the offset of a partition up to which all the
+// delivered messages are acked.
+type partitionCheckpoint struct {
+	mu      sync.Mutex
+	state   *kstate.KafkaState
+	cp      checkpoint.Checkpoint
+	tracker *kafka.OffsetTracker
+}
+
+func (pc *partitionCheckpoint) ack(offset int64) error {
+	next, advanced := pc.tracker.Ack(offset)
+	if !advanced {
+		return nil
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if next <= pc.state.Offset {
+		// committed by a concurrent ack
+		return nil
+	}
+
+	pc.state.Offset = next
+	return pc.cp.Commit(pc.state)
+}
+
+// openCheckpoints replaces the partition checkpoints with that of the newly assigned
+// partitions, and tells the consumer to resume from their persisted offsets.
+func (this *KafkaInput) openCheckpoints(name string, dsns []string) {
+	this.closeCheckpoints()
+
+	globals := engine.Globals()
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for _, dsn := range dsns {
+		zone, _, _, partitionID, err := kafka.ParseDSN(dsn)
+		if err != nil {
+			log.Error("[%s] %s: %v", name, dsn, err)
+			continue
+		}
+
+		state := kstate.New(dsn, name)
+		state.PartitionID = partitionID
+
+		var cp checkpoint.Checkpoint
+		if len(globals.Cluster) == 0 {
+			cp = discard.New()
+		} else {
+			cp = czk.New(globals.GetOrRegisterZkzone(zone), state, globals.Cluster, dsn, this.commitInterval)
+		}
+
+		switch err = cp.LastPersistedState(state); err {
+		case nil:
+			log.Trace("[%s] %s resume from offset %d", name, dsn, state.Offset)
+			this.c.ResumeFrom(dsn, state.Offset)
+
+		case checkpoint.ErrStateNotFound:
+			log.Trace("[%s] %s no checkpoint found", name, dsn)
+
+		default:
+			log.Error("[%s] %s: %v", name, dsn, err)
+		}
+
+		this.checkpoints[dsn] = &partitionCheckpoint{
+			state:   state,
+			cp:      cp,
+			tracker: kafka.NewOffsetTracker(state.Offset),
+		}
+	}
+}
+
+// closeCheckpoints persists all the inflight offsets.
+func (this *KafkaInput) closeCheckpoints() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for dsn, pc := range this.checkpoints {
+		pc.mu.Lock()
+		if err := pc.cp.Shutdown(); err != nil {
+			log.Error("%s: %v", dsn, err)
+		}
+		pc.mu.Unlock()
+	}
+
+	this.checkpoints = make(map[string]*partitionCheckpoint)
+}
@@ -13,9 +13,10 @@ import (
 // MysqlbinlogInput is an input plugin that pretends to be a mysql instance's
 // slave and consumes mysql binlog events.
 type MysqlbinlogInput struct {
-	maxEventLength int
-	cf             *conf.Conf
-	clusterMode    bool
+	maxEventLength    int
+	cf                *conf.Conf
+	clusterMode       bool
+	hierarchicalIdent bool
 
 	mu     sync.RWMutex
 	slaves map[string]*myslave.MySlave // cluster mode, key is DSN
@@ -25,6 +26,7 @@ type MysqlbinlogInput struct {
 func (this *MysqlbinlogInput) Init(config *conf.Conf) {
 	this.maxEventLength = config.Int("max_event_length", (1<<20)-100)
 	this.cf = config
+	this.hierarchicalIdent = config.Bool("hierarchical_ident", false)
 	if dsn := this.cf.String("dsn", ""); len(dsn) == 0 {
 		this.clusterMode = true
 		this.slaves = make(map[string]*myslave.MySlave)
@@ -34,15 +36,33 @@ func (this *MysqlbinlogInput) Init(config *conf.Conf) {
 func (*MysqlbinlogInput) SampleConfig() string {
 	return `
 	max_event_length: 1048476
+	hierarchical_ident: false // Ident is name.db.table for pattern match, e,g. "mybinlog.db1.*"
 	recv_buffer: 524288
 	server_id: 137
 	semi_sync: false
+	GTID: false
+	txn_boundary: false
+	ddl_event: false
+	snapshot: false
+	snapshot_chunk: 1000
+	table_allowed: ["db1.user*", "re:^db1\\.log_\\d+$"]
+	table_excluded: []
+	column_hash_key: "secret" // HMAC key of hash columns
+	column_rules: [
+	    {
+	        table: "db1.user*"
+	        include: []
+	        exclude: ["password"]
+	        hash: ["mobile"]
+	        null: ["email"]
+	    }
+	]
 	`
 }
 
 func (this *MysqlbinlogInput) Ack(pack *engine.Packet) error {
 	if !this.clusterMode {
-		return this.slave.MarkAsProcessed(pack.Payload.(*model.RowsEvent))
+		return markAsProcessed(this.slave, pack)
 	}
 
 	dsn := pack.Metadata.(string)
@@ -58,7 +78,21 @@ func (this *MysqlbinlogInput) Ack(pack *engine.Packet) error {
 	// cluster mode
 	// FIXME
 	// race condition: in cluster mode, when ACK, the slave might have been gone
-	return slave.MarkAsProcessed(pack.Payload.(*model.RowsEvent))
+	return markAsProcessed(slave, pack)
+}
+
+func markAsProcessed(slave *myslave.MySlave, pack *engine.Packet) error {
+	switch ev := pack.Payload.(type) {
+	case *model.RowsEvent:
+		return slave.MarkAsProcessed(ev)
+
+	case *model.DDLEvent:
+		return slave.MarkDDLAsProcessed(ev)
+
+	default:
+		log.Warn("unrecognized payload: %+v", pack.Payload)
+		return nil
+	}
 }
 
 func (this *MysqlbinlogInput) End(r engine.InputRunner) {}
@@ -70,3 +104,24 @@ func (this *MysqlbinlogInput) Run(r engine.InputRunner, h engine.PluginHelper) e
 
 	return this.runStandalone(this.cf.String("dsn", ""), r, h)
 }
+
+// packetIdent returns the Ident of the packet: empty for the Input name, or
+// name.db.table if hierarchical ident is enabled.
+func (this *MysqlbinlogInput) packetIdent(name string, ev model.BinlogEvent) string {
+	if !this.hierarchicalIdent {
+		return ""
+	}
+
+	switch e := ev.(type) {
+	case *model.RowsEvent:
+		return name + "." + e.Schema + "." + e.Table
+
+	case *model.DDLEvent:
+		if len(e.Tables) > 0 {
+			return name + "." + e.Tables[0]
+		}
+		return name + "." + e.Schema
+	}
+
+	return ""
+}
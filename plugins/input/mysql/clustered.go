@@ -99,6 +99,24 @@ func (this *MysqlbinlogInput) runClustered(r engine.InputRunner, h engine.Plugin
 	return nil
 }
 
+// ResourceLoads reports the replication load of each DSN in cluster mode.
+func (this *MysqlbinlogInput) ResourceLoads() cluster.ResourceLoads {
+	loads := make(cluster.ResourceLoads)
+	if !this.clusterMode {
+		return loads
+	}
+
+	this.mu.RLock()
+	for dsn, slave := range this.slaves {
+		// slaves of revoked resources are also reported, leader ignores them
+		eps, bps, lag := slave.Load()
+		loads[dsn] = cluster.ResourceLoad{EventsPerSecond: eps, BytesPerSecond: bps, Lag: lag}
+	}
+	this.mu.RUnlock()
+
+	return loads
+}
+
 func (this *MysqlbinlogInput) runSlaveReplication(slave *myslave.MySlave, name string, ex engine.Exchange,
 	wg *sync.WaitGroup, slavesStopper <-chan struct{}, replicationErrs chan<- error) {
 	defer func() {
@@ -167,6 +185,7 @@ func (this *MysqlbinlogInput) runSlaveReplication(slave *myslave.MySlave, name s
 				}
 
 				if row.Length() < this.maxEventLength {
+					pack.Ident = this.packetIdent(name, row)
 					pack.Payload = row
 					pack.Metadata = dsn
 					ex.Emit(pack)
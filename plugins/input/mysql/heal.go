@@ -10,6 +10,19 @@ import (
 func (this *MysqlbinlogInput) tryAutoHeal(name string, err error, slave *myslave.MySlave) {
 	if strings.Contains(err.Error(), "ERROR 1236 (HY000)") {
 		log.Trace("[%s] auto healing ERROR 1236", name)
+		if slave.GTID {
+			// the executed GTID set has been purged from master binlog
+			if gset, _err := slave.MasterGTIDSet(); _err == nil {
+				log.Warn("[%s] reset %s GTID to %s", name, slave.DSN(), gset)
+				if er := slave.CommitGTIDSet("", 0, gset.String()); er != nil {
+					log.Error("[%s] %s: %v", name, slave.DSN(), er)
+				}
+			} else {
+				log.Error("[%s] %s", name, _err)
+			}
+			return
+		}
+
 		if pos, _err := slave.MasterPosition(); _err == nil {
 			// FIXME the pos might miss 'table id' info.
 			log.Warn("[%s] reset %s pos to %s", name, slave.DSN(), pos.Name)
@@ -5,7 +5,8 @@ import (
 )
 
 var (
-	_ engine.Input = &MysqlbinlogInput{}
+	_ engine.Input        = &MysqlbinlogInput{}
+	_ engine.LoadReporter = &MysqlbinlogInput{}
 )
 
 func init() {
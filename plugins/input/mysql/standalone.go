@@ -91,6 +91,7 @@ func (this *MysqlbinlogInput) runStandalone(dsn string, r engine.InputRunner, h
 					}
 
 					if row.Length() < this.maxEventLength {
+						pack.Ident = this.packetIdent(name, row)
 						pack.Payload = row
 						ex.Emit(pack)
 					} else {
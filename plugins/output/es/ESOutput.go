@@ -1,23 +1,131 @@
 package es
 
 import (
+	"time"
+
 	"github.com/funkygao/dbus/engine"
+	"github.com/funkygao/dbus/pkg/es"
+	"github.com/funkygao/dbus/pkg/model"
 	conf "github.com/funkygao/jsconf"
+	log "github.com/funkygao/log4go"
 )
 
+// ESOutput is an output plugin that indexes mysql binlog rows events into ElasticSearch
+// with bulk requests. Packets are acked only after the bulk request succeeds.
 type ESOutput struct {
+	addrs         []string
+	index, typ    string
+	timeout       time.Duration
+	batchSize     int
+	batchBytes    int
+	flushInterval time.Duration
+	maxBackoff    time.Duration
 }
 
 func (this *ESOutput) Init(config *conf.Conf) {
+	this.addrs = config.StringList("addrs", nil)
+	if len(this.addrs) == 0 {
+		panic("empty addrs")
+	}
+	this.index = config.String("index", "{db}_{table}")
+	this.typ = config.String("type", "doc")
+	this.timeout = config.Duration("timeout", time.Second*30)
+	this.batchSize = config.Int("batch_size", 1000)
+	this.batchBytes = config.Int("batch_bytes", 5<<20)
+	this.flushInterval = config.Duration("flush_interval", time.Second)
+	this.maxBackoff = config.Duration("max_backoff", time.Second*30)
 }
 
 func (*ESOutput) SampleConfig() string {
-	return ``
+	return `
+	addrs: ["http://localhost:9200"]
+	index: "{db}_{table}"
+	type: "doc"
+	timeout: "30s"
+	batch_size: 1000
+	batch_bytes: 5242880
+	flush_interval: "1s"
+	max_backoff: "30s"
+	`
 }
 
 func (this *ESOutput) Run(r engine.OutputRunner, h engine.PluginHelper) error {
-	for pack := range r.Exchange().InChan() {
-		pack.Recycle()
+	indexer := es.NewIndexer(this.addrs, this.timeout)
+
+	tick := time.NewTicker(this.flushInterval)
+	defer tick.Stop()
+
+	// FIXME delayed recycle will block input channel, so currently let input chan bigger than batch size
+	var pending []*engine.Packet
+	flush := func() {
+		backoff := time.Millisecond * 100
+		for {
+			rejected, err := indexer.Flush()
+			for _, e := range rejected {
+				// will never succeed, e,g. mapping conflict
+				log.Error("[%s] rejected: %s", r.Name(), e)
+			}
+			if err == nil {
+				break
+			}
+
+			log.Error("[%s] backoff %s: %v", r.Name(), backoff, err)
+			select {
+			case <-time.After(backoff):
+			case <-r.Stopper():
+				// nacked to stall the checkpoint, they will be replayed after restart
+				log.Warn("[%s] stopped with %d packets not indexed", r.Name(), len(pending))
+				for _, pack := range pending {
+					r.Nack(pack)
+					pack.Recycle()
+				}
+				pending = pending[:0]
+				return
+			}
+			if backoff *= 2; backoff > this.maxBackoff {
+				backoff = this.maxBackoff
+			}
+		}
+
+		// ack in order so that checkpoint never skips unindexed events
+		for _, pack := range pending {
+			if err := r.Ack(pack); err != nil {
+				log.Error("[%s] ack: %v", r.Name(), err)
+			}
+
+			pack.Recycle()
+		}
+		pending = pending[:0]
+	}
+
+	for {
+		select {
+		case <-tick.C:
+			if len(pending) > 0 {
+				flush()
+			}
+
+		case pack, ok := <-r.Exchange().InChan():
+			if !ok {
+				// engine stops
+				if len(pending) > 0 {
+					flush()
+				}
+				return nil
+			}
+
+			if row, ok := pack.Payload.(*model.RowsEvent); ok {
+				if err := indexer.AddRowsEvent(row, es.IndexName(this.index, row.Schema, row.Table), this.typ); err != nil {
+					log.Warn("[%s] %s skipped: %v", r.Name(), row.MetaInfo(), err)
+				}
+			}
+
+			// packets without bulk action are acked along with the batch to keep checkpoint order
+			pending = append(pending, pack)
+			if indexer.Actions() >= this.batchSize || indexer.Size() >= this.batchBytes {
+				flush()
+			}
+		}
 	}
 
 	return nil
@@ -6,27 +6,57 @@ import (
 
 	"github.com/Shopify/sarama"
 	"github.com/funkygao/dbus/engine"
+	"github.com/funkygao/dbus/pkg/idempotent"
 	"github.com/funkygao/dbus/pkg/kafka"
+	"github.com/funkygao/dbus/pkg/schemaregistry"
+	"github.com/funkygao/go-metrics"
 	"github.com/funkygao/golib/gofmt"
 	conf "github.com/funkygao/jsconf"
 	log "github.com/funkygao/log4go"
 )
 
-// KafkaOutput is an Output plugin that send pack to a single specified kafka topic.
+// KafkaOutput is an Output plugin that send pack to the kafka topic of DSN, or to the topic
+// rendered from the payload if topic template is configured.
 type KafkaOutput struct {
 	zone, cluster, topic string
 	reporter             bool
+	partitionID          int32
+	encode               encoder
+	partitioner          *partitioner
+	router               *topicRouter
+
+	exactlyOnce    bool
+	idempotentFile string
+	idempotentSize int
+	eo             *exactlyOnce
+
+	encodeErrors metrics.Meter
+	rejected     metrics.Meter // packets dropped for unknown topic
 }
 
 // Init setup KafkaOutput state according to config section.
 // Default kafka delivery: async WaitForAll.
 func (this *KafkaOutput) Init(config *conf.Conf) {
 	var err error
-	this.zone, this.cluster, this.topic, _, err = kafka.ParseDSN(config.String("dsn", ""))
+	this.zone, this.cluster, this.topic, this.partitionID, err = kafka.ParseDSN(config.String("dsn", ""))
 	if err != nil || this.cluster == "" || this.zone == "" || this.topic == "" {
 		panic("invalid configuration: " + fmt.Sprintf("%s.%s.%s", this.zone, this.cluster, this.topic))
 	}
 	this.reporter = config.Bool("reporter", false)
+	this.encode = newEncoder(config.String("encoder", "json"), config.String("schema_registry", ""),
+		config.String("schema_subject", schemaregistry.StrategyTopicRecord))
+	this.partitioner = newPartitioner(config.String("partition_by", partitionByNone),
+		config.StringList("partition_column", nil), this.partitionID)
+	this.router = newTopicRouter(config.String("topic_template", ""), this.topic,
+		config.StringList("topic_allowed", nil), config.String("unknown_topic", unknownTopicReject))
+	this.exactlyOnce = config.Bool("exactly_once", false)
+	if this.exactlyOnce {
+		this.idempotentFile = config.String("idempotent_file", "")
+		if this.idempotentFile == "" {
+			panic("exactly_once requires idempotent_file")
+		}
+		this.idempotentSize = config.Int("idempotent_size", 1<<20)
+	}
 }
 
 func (*KafkaOutput) SampleConfig() string {
@@ -37,6 +67,17 @@ func (*KafkaOutput) SampleConfig() string {
 	qos: "LossTolerant" // LossTolerant|ThroughputFirst
 	dsn: "kafka:local://me/foobar"
 	reporter: true
+	encoder: "json" // json|ffjson|avro
+	schema_registry: "http://localhost:8081" // avro only, optional
+	schema_subject: "topic_record" // topic|record|topic_record, subject name strategy of schema registry
+	partition_by: "pk" // none|table|pk|column|fixed
+	partition_column: ["uid"] // column only
+	topic_template: "{db}.{tbl}" // optional, fallback to DSN topic
+	topic_allowed: ["mydb.*"] // glob patterns of routed topics, optional
+	unknown_topic: "reject" // reject(drop the packet)|create
+	exactly_once: false // async LossTolerant only
+	idempotent_file: "var/kafka_out.ids" // exactly_once only
+	idempotent_size: 1048576 // ids kept for replay dedup
 	`
 }
 
@@ -45,6 +86,24 @@ func (this *KafkaOutput) CleanupForRestart() bool {
 }
 
 func (this *KafkaOutput) Run(r engine.OutputRunner, h engine.PluginHelper) error {
+	this.encodeErrors = engine.NewPluginMeter(r.Name(), "encode_error")
+	this.rejected = engine.NewPluginMeter(r.Name(), "topic_rejected")
+	this.eo = nil
+	if this.exactlyOnce {
+		repo, err := idempotent.NewDisk(this.idempotentFile, this.idempotentSize)
+		if err != nil {
+			return err
+		}
+
+		this.eo = newExactlyOnce(repo)
+		defer func() {
+			// after producer drained
+			if err := this.eo.close(); err != nil {
+				log.Error("[%s] %v", r.Name(), err)
+			}
+		}()
+	}
+
 	producer := this.setupProducer(r)
 	if err := producer.Start(); err != nil {
 		return err
@@ -84,22 +143,86 @@ func (this *KafkaOutput) Run(r engine.OutputRunner, h engine.PluginHelper) error
 
 			n++
 
-			// loop is for sync mode only: async send will never return error
-			for {
-				if err := producer.Send(&sarama.ProducerMessage{
-					Topic:    this.topic,
-					Value:    pack.Payload,
-					Metadata: pack,
-				}); err == nil {
-					break
-				} else {
-					log.Error("[%s] %v", r.Name(), err)
-
-					time.Sleep(time.Millisecond * 500)
+			topic := this.router.topic(pack.Payload)
+			if !this.router.accept(topic, producer) {
+				// drop the packet so that it will not block the pipeline
+				this.rejected.Mark(1)
+				log.Warn("[%s] topic[%s] rejected, dropped: %s", r.Name(), topic, metaInfo(pack.Payload))
+				this.delivered(r, topic, pack)
+				continue
+			}
+
+			if this.eo != nil {
+				this.sendExactlyOnce(r, producer, topic, pack)
+				continue
+			}
+
+			if events := this.partitioner.split(pack.Payload); len(events) > 0 {
+				sp := &splitPacket{Packet: pack, pending: int32(len(events))}
+				for _, ev := range events {
+					this.send(r, producer, topic, ev, sp)
 				}
+			} else {
+				this.send(r, producer, topic, pack.Payload, pack)
 			}
 		}
 	}
 
 	return nil
 }
+
+func (this *KafkaOutput) sendExactlyOnce(r engine.OutputRunner, producer *kafka.Producer, topic string, pack *engine.Packet) {
+	payloads := []engine.Payloader{pack.Payload}
+	if events := this.partitioner.split(pack.Payload); len(events) > 0 {
+		payloads = payloads[:0]
+		for _, ev := range events {
+			payloads = append(payloads, ev)
+		}
+	}
+
+	sp := &splitPacket{Packet: pack, pending: int32(len(payloads))}
+	for _, payload := range payloads {
+		id := messageID(payload)
+		if this.eo.duplicated(id) {
+			// replayed after restart
+			log.Debug("[%s] duplicated %s", r.Name(), id)
+			this.delivered(r, topic, sp)
+			continue
+		}
+
+		this.send(r, producer, topic, payload, &identifiedMessage{splitPacket: sp, id: id})
+	}
+}
+
+func (this *KafkaOutput) send(r engine.OutputRunner, producer *kafka.Producer, topic string, payload engine.Payloader, metadata interface{}) {
+	value, err := this.encode(topic, payload)
+	if err != nil {
+		// encode failure is deterministic and replay never helps, it is dropped and acked
+		// so that the checkpoint goes on
+		this.encodeErrors.Mark(1)
+		log.Error("[%s] topic[%s] encode failed, dropped: %s %v", r.Name(), topic, metaInfo(payload), err)
+		this.delivered(r, topic, metadata)
+		return
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic:    topic,
+		Key:      this.partitioner.key(payload),
+		Value:    value,
+		Metadata: metadata,
+	}
+	if this.partitioner.fixed() {
+		msg.Partition = this.partitionID
+	}
+
+	// loop is for sync mode only: async send will never return error
+	for {
+		if err := producer.Send(msg); err == nil {
+			break
+		} else {
+			log.Error("[%s] %v", r.Name(), err)
+
+			time.Sleep(time.Millisecond * 500)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package kafka
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/dbus/engine"
+	"github.com/funkygao/dbus/pkg/model"
+	"github.com/funkygao/dbus/pkg/schemaregistry"
+	"github.com/pquerna/ffjson/ffjson"
+)
+
+// encoder encodes packet payload to kafka message value.
+type encoder func(topic string, payload engine.Payloader) (sarama.Encoder, error)
+
+func newEncoder(name string, registryURL string, subjectStrategy string) encoder {
+	switch name {
+	case "json":
+		return encodeAsIs
+
+	case "ffjson":
+		return encodeFFJSON
+
+	case "avro":
+		var registry *schemaregistry.Client
+		if len(registryURL) > 0 {
+			registry = schemaregistry.New(registryURL)
+		}
+		if !schemaregistry.ValidStrategy(subjectStrategy) {
+			panic("invalid schema_subject: " + subjectStrategy)
+		}
+		return func(topic string, payload engine.Payloader) (sarama.Encoder, error) {
+			return encodeAvro(registry, subjectStrategy, topic, payload)
+		}
+
+	default:
+		panic("invalid encoder: " + name)
+	}
+}
+
+// encodeAsIs uses the payload default encoding, which is json for RowsEvent.
+func encodeAsIs(topic string, payload engine.Payloader) (sarama.Encoder, error) {
+	return payload, nil
+}
+
+func encodeFFJSON(topic string, payload engine.Payloader) (sarama.Encoder, error) {
+	switch payload.(type) {
+	case *model.RowsEvent, *model.DDLEvent:
+		b, err := ffjson.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		return sarama.ByteEncoder(b), nil
+
+	default:
+		return payload, nil
+	}
+}
+
+// encodeAvro encodes RowsEvent with per-table avro schema, other payloads are sent as is.
+// If registry is provided, the schema is registered under the subject of the strategy and
+// the payload is prepended with the Confluent wire format header.
+// Tables of the same topic have different schemas, so topic name strategy works only if
+// each topic has a single table.
+func encodeAvro(registry *schemaregistry.Client, subjectStrategy, topic string, payload engine.Payloader) (sarama.Encoder, error) {
+	r, ok := payload.(*model.RowsEvent)
+	if !ok {
+		return payload, nil
+	}
+
+	b, schema, name, err := r.EncodeAvro()
+	if err != nil {
+		return nil, err
+	}
+
+	if registry == nil {
+		return sarama.ByteEncoder(b), nil
+	}
+
+	id, err := registry.Register(schemaregistry.SubjectOf(subjectStrategy, topic, name), schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return sarama.ByteEncoder(schemaregistry.Frame(id, b)), nil
+}
@@ -0,0 +1,104 @@
+package kafka
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/funkygao/dbus/engine"
+	"github.com/funkygao/dbus/pkg/idempotent"
+	"github.com/funkygao/dbus/pkg/model"
+)
+
+// exactlyOnce delivers binlog events to kafka exactly once end to end:
+//
+//   - each message has a deterministic id derived from its binlog event, and the ids
+//     of produced messages are recorded in an idempotent.Repository, so that messages
+//     replayed after restart or batch retry are dropped instead of produced again
+//   - a packet is acked only after all of its messages are produced, and the engine
+//     acks Input in emitted order and replays the nacked packets, so that input
+//     checkpoint never skips a failed message
+type exactlyOnce struct {
+	repo idempotent.Repository
+}
+
+// identifiedMessage is the metadata of kafka message in exactly once mode.
+type identifiedMessage struct {
+	*splitPacket
+	id string
+}
+
+// MessageID implements kafka.Identifier.
+func (m *identifiedMessage) MessageID() string {
+	return m.id
+}
+
+func newExactlyOnce(repo idempotent.Repository) *exactlyOnce {
+	return &exactlyOnce{repo: repo}
+}
+
+// duplicated checks whether the message is already produced.
+func (eo *exactlyOnce) duplicated(id string) bool {
+	return id != "" && eo.repo.Contains(id)
+}
+
+func (eo *exactlyOnce) close() error {
+	return eo.repo.Close()
+}
+
+// messageID returns the deterministic id of a payload derived from its binlog
+// event, empty if the payload has none.
+func messageID(payload engine.Payloader) string {
+	switch ev := payload.(type) {
+	case *model.RowsEvent:
+		if ev.IsSnapshot() {
+			// all chunks of a snapshot share the same binlog position, and the same chunk
+			// dumped again might hold different rows: identified by its own rows
+			if id := snapshotRowsID(ev); id != "" {
+				return fmt.Sprintf("S:%s.%s:%s", ev.Schema, ev.Table, id)
+			}
+			return ""
+		}
+		if ev.GTID != "" {
+			// binlog position of the same event differs after master failover
+			return fmt.Sprintf("%s:%d:%d", ev.GTID, ev.TxnSeq, ev.RowIndex())
+		}
+		return fmt.Sprintf("%s:%d:%d", ev.Log, ev.Position, ev.RowIndex())
+
+	case *model.DDLEvent:
+		if ev.GTID != "" {
+			// DDL is a transaction by itself
+			return ev.GTID
+		}
+		return fmt.Sprintf("%s:%d", ev.Log, ev.Position)
+	}
+
+	return ""
+}
+
+// snapshotRowsID returns the primary key values of the rows, hashed if there are
+// multiple rows. Empty if the table has no primary key, which is never deduplicated.
+func snapshotRowsID(ev *model.RowsEvent) string {
+	if len(ev.PKs) == 0 || len(ev.Rows) == 0 {
+		return ""
+	}
+
+	if len(ev.Rows) == 1 {
+		return pkValues(ev.Rows[0], ev.PKs)
+	}
+
+	h := fnv.New64a()
+	for _, row := range ev.Rows {
+		h.Write([]byte(pkValues(row, ev.PKs)))
+		h.Write([]byte{';'})
+	}
+	return fmt.Sprintf("%d#%x", len(ev.Rows), h.Sum64())
+}
+
+func pkValues(row []interface{}, pks []int) string {
+	vals := make([]string, len(pks))
+	for i, idx := range pks {
+		vals[i] = fmt.Sprint(row[idx])
+	}
+	return strings.Join(vals, ",")
+}
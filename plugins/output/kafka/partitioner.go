@@ -0,0 +1,205 @@
+package kafka
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/dbus/engine"
+	"github.com/funkygao/dbus/pkg/model"
+)
+
+const (
+	partitionByNone   = "none"   // sarama default partitioner: random without key
+	partitionByTable  = "table"  // key is db.table
+	partitionByPK     = "pk"     // key is db.table:pk values
+	partitionByColumn = "column" // key is db.table:values of the configured columns
+	partitionByFixed  = "fixed"  // all messages go to the partition of DSN fragment
+)
+
+// partitioner decides the message key of a payload, so that updates of the same row
+// are always sent to the same partition and consumed in order.
+type partitioner struct {
+	strategy  string
+	columns   []string
+	partition int32 // fixed partition id
+}
+
+func newPartitioner(strategy string, columns []string, partition int32) *partitioner {
+	p := &partitioner{strategy: strategy, columns: columns, partition: partition}
+	switch strategy {
+	case "", partitionByNone:
+		p.strategy = partitionByNone
+
+	case partitionByTable, partitionByPK:
+
+	case partitionByColumn:
+		if len(columns) == 0 {
+			panic("empty partition_column")
+		}
+
+	case partitionByFixed:
+		if partition < 0 {
+			panic("fixed partition requires DSN #partition")
+		}
+
+	default:
+		panic("invalid partition_by: " + strategy)
+	}
+
+	return p
+}
+
+// fixed returns whether all messages go to the fixed partition.
+func (p *partitioner) fixed() bool {
+	return p.strategy == partitionByFixed
+}
+
+// split splits a multi-row rows event into per-row payloads when key is row based,
+// because rows of a single event might belong to different partitions.
+func (p *partitioner) split(payload engine.Payloader) []*model.RowsEvent {
+	r, ok := payload.(*model.RowsEvent)
+	if !ok {
+		return nil
+	}
+
+	switch p.strategy {
+	case partitionByPK, partitionByColumn:
+		if events := r.SplitRows(); len(events) > 1 {
+			return events
+		}
+	}
+
+	return nil
+}
+
+// key returns the message key of the payload, nil if message is not keyed.
+func (p *partitioner) key(payload engine.Payloader) sarama.Encoder {
+	if p.strategy == partitionByNone {
+		return nil
+	}
+
+	switch ev := payload.(type) {
+	case *model.RowsEvent:
+		table := ev.Schema + "." + ev.Table
+		switch p.strategy {
+		case partitionByTable:
+			return sarama.StringEncoder(table)
+
+		case partitionByColumn:
+			if vals := rowValues(ev, columnIndexes(ev.Columns, p.columns)); vals != "" {
+				return sarama.StringEncoder(table + ":" + vals)
+			}
+
+		default:
+			// pk is also the key of fixed partition for consumers to dedup rows
+			if vals := rowValues(ev, ev.PKs); vals != "" {
+				return sarama.StringEncoder(table + ":" + vals)
+			}
+		}
+
+		// row of table without pk falls back to table key
+		return sarama.StringEncoder(table)
+
+	case *model.DDLEvent:
+		// DDL goes to the same partition as the rows of its table
+		if len(ev.Tables) > 0 {
+			return sarama.StringEncoder(ev.Tables[0])
+		}
+		return sarama.StringEncoder(ev.Schema)
+	}
+
+	return nil
+}
+
+func columnIndexes(columns, names []string) []int {
+	idx := make([]int, 0, len(names))
+	for _, name := range names {
+		for i, col := range columns {
+			if col == name {
+				idx = append(idx, i)
+				break
+			}
+		}
+	}
+
+	if len(idx) != len(names) {
+		// partial key would break the ordering guarantee
+		return nil
+	}
+	return idx
+}
+
+// rowValues returns the joined values of the columns of the row event.
+// For update, the after image is used.
+func rowValues(ev *model.RowsEvent, idx []int) string {
+	if len(idx) == 0 || len(ev.Rows) == 0 {
+		return ""
+	}
+
+	row := ev.Rows[len(ev.Rows)-1]
+	vals := make([]string, len(idx))
+	for i, j := range idx {
+		if j >= len(row) {
+			return ""
+		}
+		vals[i] = fmt.Sprint(row[j])
+	}
+	return strings.Join(vals, ",")
+}
+
+// splitPacket is the metadata of messages split from a single packet: the packet is
+// acked and recycled after all of its messages are delivered.
+type splitPacket struct {
+	*engine.Packet
+	pending int32
+	failed  int32
+}
+
+func (p *splitPacket) done() bool {
+	return atomic.AddInt32(&p.pending, -1) == 0
+}
+
+// fail marks that a message of the packet is undeliverable: the packet will be nacked
+// after all of its messages are done, so that the engine replays it.
+func (p *splitPacket) fail() {
+	atomic.StoreInt32(&p.failed, 1)
+}
+
+// Recycle overrides the Packet recycle so that it is recycled only once.
+func (p *splitPacket) Recycle() {
+	if p.done() {
+		p.Packet.Recycle()
+	}
+}
+
+// splitOf returns the split packet of a message, nil if the packet is not split.
+func splitOf(metadata interface{}) *splitPacket {
+	switch m := metadata.(type) {
+	case *splitPacket:
+		return m
+	case *identifiedMessage:
+		return m.splitPacket
+	}
+
+	return nil
+}
+
+// deliveredPacket returns the packet of a delivered message, whether all messages
+// of the packet are done and whether any of them failed.
+func deliveredPacket(metadata interface{}) (pack *engine.Packet, done bool, failed bool) {
+	if sp := splitOf(metadata); sp != nil {
+		return sp.Packet, sp.done(), atomic.LoadInt32(&sp.failed) == 1
+	}
+
+	return metadata.(*engine.Packet), true, false
+}
+
+func messagePacket(msg *sarama.ProducerMessage) *engine.Packet {
+	if sp := splitOf(msg.Metadata); sp != nil {
+		return sp.Packet
+	}
+
+	return msg.Metadata.(*engine.Packet)
+}
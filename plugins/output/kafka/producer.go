@@ -1,6 +1,8 @@
 package kafka
 
 import (
+	"fmt"
+
 	"github.com/Shopify/sarama"
 	"github.com/funkygao/dbus/engine"
 	"github.com/funkygao/dbus/pkg/kafka"
@@ -26,6 +28,9 @@ func (this *KafkaOutput) setupProducer(r engine.OutputRunner) *kafka.Producer {
 	// get the bootstrap broker list
 	zkzone := engine.Globals().GetOrRegisterZkzone(this.zone)
 	zkcluster := zkzone.NewCluster(this.cluster)
+	if this.partitioner.fixed() {
+		cf.Sarama.Producer.Partitioner = sarama.NewManualPartitioner
+	}
 	producer := kafka.NewProducer(r.Conf().String("name", "undefined"), zkcluster.BrokerList(), cf)
 
 	switch r.Conf().String("qos", "LossTolerant") {
@@ -37,27 +42,26 @@ func (this *KafkaOutput) setupProducer(r engine.OutputRunner) *kafka.Producer {
 			// kafka: Failed to produce message to topic dbustest: kafka server: Message was too large, server rejected it to avoid allocation error.
 			// kafka server: Unexpected (unknown?) server error.
 			// java.lang.OutOfMemoryError: Direct buffer memory
-			row := err.Msg.Value.(*model.RowsEvent)
-			log.Error("[%s.%s.%s] %s %s", this.zone, this.cluster, this.topic, err, row.MetaInfo())
+			pack := messagePacket(err.Msg)
+			log.Error("[%s.%s.%s] %s %s", this.zone, this.cluster, err.Msg.Topic, err, metaInfo(pack.Payload))
 		})
 
 		producer.SetSuccessHandler(func(msg *sarama.ProducerMessage) {
-			// FIXME what if:
-			// [1, 2, 3, 4, 5] sent
-			// [1, 2, 4, 5] ok, [3] fails
-			// then shutdown dbusd? 3 might be lost
-			pack := msg.Metadata.(*engine.Packet)
-			if err := r.Ack(pack); err != nil {
-				row := msg.Value.(*model.RowsEvent)
-				log.Error("[%s.%s.%s] {%s} %v", this.zone, this.cluster, this.topic, row, err)
-			}
-
-			// safe to recycle
-			// FIXME delayed recycle will block input channel, so currently let input chan bigger than batch size
-			pack.Recycle()
+			// [1, 2, 3, 4, 5] sent, [1, 2, 4, 5] ok while [3] in retry:
+			// the engine acks Input in emitted order, so checkpoint never skips 3.
+			this.delivered(r, msg.Topic, msg.Metadata)
 		})
 
+		if this.eo != nil {
+			if err := producer.SetRepository(this.eo.repo); err != nil {
+				panic("exactly_once requires async mode")
+			}
+		}
+
 	case "ThroughputFirst":
+		if this.eo != nil {
+			panic("exactly_once requires LossTolerant qos")
+		}
 		cf.ThroughputFirst()
 
 	default:
@@ -66,3 +70,50 @@ func (this *KafkaOutput) setupProducer(r engine.OutputRunner) *kafka.Producer {
 
 	return producer
 }
+
+// delivered acks and recycles the packet of a delivered message once all messages of
+// the packet are delivered.
+func (this *KafkaOutput) delivered(r engine.OutputRunner, topic string, metadata interface{}) {
+	pack, done, failed := deliveredPacket(metadata)
+	if !done {
+		// other messages split from the packet still in flight
+		return
+	}
+
+	if failed {
+		// replayed by the engine
+		r.Nack(pack)
+		pack.Recycle()
+		return
+	}
+
+	if err := r.Ack(pack); err != nil {
+		log.Error("[%s.%s.%s] {%s} %v", this.zone, this.cluster, topic, metaInfo(pack.Payload), err)
+	}
+
+	// safe to recycle
+	// FIXME delayed recycle will block input channel, so currently let input chan bigger than batch size
+	pack.Recycle()
+}
+
+// failed nacks and recycles the packet of an undeliverable message, so that the engine
+// replays it.
+func (this *KafkaOutput) failed(r engine.OutputRunner, topic string, metadata interface{}) {
+	if sp := splitOf(metadata); sp != nil {
+		sp.fail()
+		this.delivered(r, topic, metadata)
+		return
+	}
+
+	pack := metadata.(*engine.Packet)
+	r.Nack(pack)
+	pack.Recycle()
+}
+
+func metaInfo(payload engine.Payloader) string {
+	if ev, ok := payload.(model.BinlogEvent); ok {
+		return ev.MetaInfo()
+	}
+
+	return fmt.Sprintf("len=%d", payload.Length())
+}
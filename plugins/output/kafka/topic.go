@@ -0,0 +1,157 @@
+package kafka
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/funkygao/dbus/engine"
+	"github.com/funkygao/dbus/pkg/kafka"
+	"github.com/funkygao/dbus/pkg/model"
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	unknownTopicCreate = "create" // rely on broker auto.create.topics.enable
+	unknownTopicReject = "reject"
+
+	// rejected topic is checked again after this interval in case it is created by ops
+	topicRecheckInterval = time.Minute
+)
+
+// topicRouter renders the topic of each payload from a template, e,g.
+// "{db}.{tbl}" or "binlog_{db}".
+// Payloads that cannot be rendered go to the default topic of DSN.
+//
+// topicRouter is not goroutine safe: it is used only in the Run loop.
+type topicRouter struct {
+	template     string
+	defaultTopic string
+	allowed      []string // topic glob patterns, empty means all
+	autoCreate   bool
+
+	accepted map[string]struct{}
+	rejected map[string]time.Time // topic -> when to check again
+}
+
+func newTopicRouter(template, defaultTopic string, allowed []string, policy string) *topicRouter {
+	for _, pattern := range allowed {
+		if _, err := path.Match(pattern, ""); err != nil {
+			panic("invalid topic_allowed: " + pattern)
+		}
+	}
+
+	t := &topicRouter{
+		template:     template,
+		defaultTopic: defaultTopic,
+		allowed:      allowed,
+		accepted:     map[string]struct{}{defaultTopic: {}},
+		rejected:     make(map[string]time.Time),
+	}
+	switch policy {
+	case unknownTopicCreate:
+		t.autoCreate = true
+	case unknownTopicReject:
+	default:
+		panic("invalid unknown_topic: " + policy)
+	}
+
+	return t
+}
+
+// topic returns the rendered topic of the payload.
+func (t *topicRouter) topic(payload engine.Payloader) string {
+	if t.template == "" {
+		return t.defaultTopic
+	}
+
+	var db, table string
+	switch ev := payload.(type) {
+	case *model.RowsEvent:
+		db, table = ev.Schema, ev.Table
+
+	case *model.DDLEvent:
+		db = ev.Schema
+		if len(ev.Tables) > 0 {
+			if dot := strings.IndexByte(ev.Tables[0], '.'); dot > 0 {
+				db, table = ev.Tables[0][:dot], ev.Tables[0][dot+1:]
+			}
+		}
+
+	default:
+		return t.defaultTopic
+	}
+
+	if (db == "" && strings.Contains(t.template, "{db}")) ||
+		(table == "" && strings.Contains(t.template, "{tbl}")) {
+		// e,g. CREATE DATABASE for "{db}.{tbl}"
+		return t.defaultTopic
+	}
+
+	return topicName(strings.NewReplacer("{db}", db, "{tbl}", table).Replace(t.template))
+}
+
+// accept checks whether messages can be sent to the topic.
+func (t *topicRouter) accept(topic string, producer *kafka.Producer) bool {
+	if _, present := t.accepted[topic]; present {
+		return true
+	}
+	if recheck, present := t.rejected[topic]; present && time.Now().Before(recheck) {
+		return false
+	}
+
+	ok, reason := t.check(topic, producer)
+	if !ok {
+		log.Warn("topic[%s] rejected: %s", topic, reason)
+		t.rejected[topic] = time.Now().Add(topicRecheckInterval)
+		return false
+	}
+
+	delete(t.rejected, topic)
+	t.accepted[topic] = struct{}{}
+	return true
+}
+
+func (t *topicRouter) check(topic string, producer *kafka.Producer) (bool, string) {
+	if !t.allowedTopic(topic) {
+		return false, "not allowed"
+	}
+
+	if t.autoCreate {
+		return true, ""
+	}
+
+	exists, err := producer.TopicExists(topic)
+	if err != nil {
+		return false, err.Error()
+	}
+	if !exists {
+		return false, "not found"
+	}
+	return true, ""
+}
+
+func (t *topicRouter) allowedTopic(topic string) bool {
+	if len(t.allowed) == 0 {
+		return true
+	}
+
+	for _, pattern := range t.allowed {
+		if matched, _ := path.Match(pattern, topic); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// topicName replaces the chars that are illegal in kafka topic name with '_'.
+func topicName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}